@@ -0,0 +1,35 @@
+//go:build linux
+
+package audit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	bootOffsetOnce sync.Once
+	bootOffset     time.Duration
+)
+
+// bootTimeToWall converts a CLOCK_BOOTTIME reading from the kernel into wall
+// clock time. The offset is sampled once; it only drifts when the wall clock
+// is stepped.
+func bootTimeToWall(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	bootOffsetOnce.Do(func() {
+		var ts unix.Timespec
+		if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &ts); err != nil {
+			return
+		}
+		bootOffset = time.Duration(time.Now().UnixNano() - ts.Nano())
+	})
+	if bootOffset == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns)+int64(bootOffset))
+}
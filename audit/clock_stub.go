@@ -0,0 +1,10 @@
+//go:build !linux
+
+package audit
+
+import "time"
+
+func bootTimeToWall(ns uint64) time.Time {
+	_ = ns
+	return time.Time{}
+}
@@ -1,9 +1,47 @@
 package audit
 
-import "context"
+import (
+	"context"
+	"os"
+)
+
+const defaultObjDir = "ebpf/objects"
+
+// DefaultPinPath is where long-running collectors pin their eBPF state.
+const DefaultPinPath = "/sys/fs/bpf/glasshouse"
 
 type Config struct {
 	BPFObjectDir string
+	// Filter restricts which processes the kernel programs emit events for.
+	// The zero value traces the whole host.
+	Filter Filter
+	// PinPath pins programs, maps and links on a bpf filesystem so a later
+	// collector with the same PinPath resumes them instead of starting
+	// over. Empty disables pinning.
+	PinPath string
+}
+
+// ObjectDir returns the directory the collector loads eBPF objects from.
+func (c Config) ObjectDir() string {
+	if c.BPFObjectDir != "" {
+		return c.BPFObjectDir
+	}
+	if env := os.Getenv("GLASSHOUSE_BPF_DIR"); env != "" {
+		return env
+	}
+	return defaultObjDir
+}
+
+// Filter lists the processes and cgroups traced in the kernel. Tracked PIDs
+// are followed across forks.
+type Filter struct {
+	PIDs      []uint32
+	CgroupIDs []uint64
+}
+
+// Enabled reports whether the filter restricts tracing.
+func (f Filter) Enabled() bool {
+	return len(f.PIDs) > 0 || len(f.CgroupIDs) > 0
 }
 
 type Collector interface {
@@ -12,3 +50,16 @@ type Collector interface {
 	Errors() <-chan error
 	Close() error
 }
+
+// Tracker is implemented by collectors that filter events in the kernel.
+// TrackPID also tracks the current descendants of pid.
+type Tracker interface {
+	TrackPID(pid uint32) error
+	TrackCgroup(id uint64) error
+}
+
+// DropCounter is implemented by collectors that count events the kernel
+// failed to submit. Counts remain available after Close.
+type DropCounter interface {
+	Drops() (map[EventType]uint64, error)
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,10 +20,9 @@ import (
 	"github.com/cilium/ebpf/ringbuf"
 )
 
-const (
-	defaultObjDir = "ebpf/objects"
-	eventSize     = 320
-)
+// sharedMaps are created by the first object that defines them and reused by
+// the rest, so every program consults the same target filter.
+var sharedMaps = []string{"filter_config", "tracked_pids", "tracked_cgroups", "drops"}
 
 type ebpfCollector struct {
 	mu      sync.Mutex
@@ -35,17 +35,17 @@ type ebpfCollector struct {
 	wg      sync.WaitGroup
 	closed  chan struct{}
 	debug   int32
+	shared  map[string]*ebpf.Map
+	// finalDrops is the drop count snapshot taken when the collector closes.
+	finalDrops map[EventType]uint64
 }
 
+// collectorObjects are the objects NewCollector loads. exec-argv.o is tried
+// before exec.o when argv capture is on, so it is not required.
+var collectorObjects = []string{"exec.o", "fs.o", "net.o", "proc.o", "sec.o"}
+
 func NewCollector(cfg Config) (Collector, error) {
-	dir := cfg.BPFObjectDir
-	if dir == "" {
-		if env := os.Getenv("GLASSHOUSE_BPF_DIR"); env != "" {
-			dir = env
-		} else {
-			dir = defaultObjDir
-		}
-	}
+	dir := cfg.ObjectDir()
 
 	execPaths := []string{filepath.Join(dir, "exec.o")}
 	if captureArgvEnabled() {
@@ -59,10 +59,17 @@ func NewCollector(cfg Config) (Collector, error) {
 		filepath.Join(dir, "net.o"),
 	}
 
+	if cfg.PinPath != "" {
+		if err := checkPinRoot(cfg.PinPath); err != nil {
+			return nil, err
+		}
+	}
+
 	collector := &ebpfCollector{
 		events: make(chan Event, 1024),
 		errs:   make(chan error, 16),
 		closed: make(chan struct{}),
+		shared: make(map[string]*ebpf.Map),
 	}
 	if isTruthy(os.Getenv("GLASSHOUSE_DEBUG_EVENTS")) {
 		collector.debug = 20
@@ -70,26 +77,36 @@ func NewCollector(cfg Config) (Collector, error) {
 
 	loaded := 0
 	var loadErrors []error
-	cwd, _ := os.Getwd()
-	fmt.Fprintf(os.Stderr, "glasshouse: loading eBPF objects from dir=%s (cwd=%s)\n", dir, cwd)
+	// Load progress is only printed with GLASSHOUSE_DEBUG_EVENTS; Probe
+	// reports why objects cannot load.
+	verbose := collector.debug > 0
+	if verbose {
+		cwd, _ := os.Getwd()
+		fmt.Fprintf(os.Stderr, "glasshouse: loading eBPF objects from dir=%s (cwd=%s)\n", dir, cwd)
+	}
 	loadPath := func(path string) bool {
-		// Debug: check if file exists
-		absPath, _ := filepath.Abs(path)
 		if _, err := os.Stat(path); err != nil {
-			fmt.Fprintf(os.Stderr, "glasshouse: file not found: %s (abs: %s) - %v\n", path, absPath, err)
+			if verbose {
+				absPath, _ := filepath.Abs(path)
+				fmt.Fprintf(os.Stderr, "glasshouse: file not found: %s (abs: %s) - %v\n", path, absPath, err)
+			}
 			loadErrors = append(loadErrors, fmt.Errorf("file not found: %s (%w)", path, err))
 			collector.errs <- fmt.Errorf("eBPF object missing: %s", path)
 			return false
 		}
-		fmt.Fprintf(os.Stderr, "glasshouse: attempting to load: %s\n", path)
-		coll, readers, links, err := loadObject(path)
+		if verbose {
+			fmt.Fprintf(os.Stderr, "glasshouse: attempting to load: %s\n", path)
+		}
+		coll, readers, links, err := loadObject(path, collector.shared, newObjectPins(cfg.PinPath, path))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "glasshouse: load failed for %s: %v\n", path, err)
 			loadErrors = append(loadErrors, err)
 			collector.errs <- err
 			return false
 		}
-		fmt.Fprintf(os.Stderr, "glasshouse: successfully loaded: %s\n", path)
+		if verbose {
+			fmt.Fprintf(os.Stderr, "glasshouse: successfully loaded: %s\n", path)
+		}
 		collector.objs = append(collector.objs, coll)
 		collector.readers = append(collector.readers, readers...)
 		collector.links = append(collector.links, links...)
@@ -110,14 +127,11 @@ func NewCollector(cfg Config) (Collector, error) {
 	for _, path := range otherPaths {
 		_ = loadPath(path)
 	}
+	procLoaded := loadPath(filepath.Join(dir, "proc.o"))
+	_ = loadPath(filepath.Join(dir, "sec.o"))
 
 	if loaded == 0 {
 		if len(loadErrors) > 0 {
-			// Print detailed errors to stderr for debugging
-			fmt.Fprintf(os.Stderr, "glasshouse: eBPF load errors:\n")
-			for _, err := range loadErrors {
-				fmt.Fprintf(os.Stderr, "  - %s\n", err.Error())
-			}
 			errMsg := fmt.Sprintf("no eBPF objects found in %s", dir)
 			for _, err := range loadErrors {
 				errMsg += "; " + err.Error()
@@ -127,9 +141,112 @@ func NewCollector(cfg Config) (Collector, error) {
 		return nil, fmt.Errorf("no eBPF objects found in %s (run scripts/build-ebpf.sh)", dir)
 	}
 
+	if cfg.Filter.Enabled() {
+		if err := collector.applyFilter(cfg.Filter, procLoaded); err != nil {
+			fmt.Fprintf(os.Stderr, "glasshouse: kernel-side filtering disabled: %v\n", err)
+			collector.errs <- fmt.Errorf("kernel-side filtering disabled: %w", err)
+		}
+	}
+
 	return collector, nil
 }
 
+// applyFilter populates the tracking maps and then enables filtering. PID
+// tracking depends on proc.o to follow forks, so it stays host-wide without it.
+func (c *ebpfCollector) applyFilter(filter Filter, procLoaded bool) error {
+	config := c.shared["filter_config"]
+	if config == nil || c.shared["tracked_pids"] == nil || c.shared["tracked_cgroups"] == nil {
+		return errors.New("eBPF objects predate target filtering (rebuild with scripts/build-ebpf.sh)")
+	}
+	if len(filter.PIDs) > 0 && !procLoaded {
+		return errors.New("proc.o not loaded; descendants cannot be followed")
+	}
+	for _, pid := range filter.PIDs {
+		if err := c.TrackPID(pid); err != nil {
+			return err
+		}
+	}
+	for _, id := range filter.CgroupIDs {
+		if err := c.TrackCgroup(id); err != nil {
+			return err
+		}
+	}
+	// struct filter_config { __u32 enabled; __u32 pad; }
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint32(value[0:4], 1)
+	if err := config.Put(uint32(0), value); err != nil {
+		return fmt.Errorf("enable filter: %w", err)
+	}
+	return nil
+}
+
+// TrackPID adds pid and its current descendants to the traced set. Later
+// forks are followed in the kernel.
+func (c *ebpfCollector) TrackPID(pid uint32) error {
+	pids := c.shared["tracked_pids"]
+	if pids == nil {
+		return errors.New("tracked_pids map not loaded")
+	}
+	for _, p := range append([]uint32{pid}, descendants(pid)...) {
+		if err := pids.Put(p, uint8(1)); err != nil {
+			return fmt.Errorf("track pid %d: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// TrackCgroup adds a cgroup v2 ID to the traced set.
+func (c *ebpfCollector) TrackCgroup(id uint64) error {
+	cgroups := c.shared["tracked_cgroups"]
+	if cgroups == nil {
+		return errors.New("tracked_cgroups map not loaded")
+	}
+	if err := cgroups.Put(id, uint8(1)); err != nil {
+		return fmt.Errorf("track cgroup %d: %w", id, err)
+	}
+	return nil
+}
+
+// descendants walks /proc for processes forked before tracking began.
+func descendants(root uint32) []uint32 {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	children := make(map[uint32][]uint32)
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The comm field may contain spaces; fields after ')' are fixed.
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		children[uint32(ppid)] = append(children[uint32(ppid)], uint32(pid))
+	}
+	out := []uint32{}
+	queue := []uint32{root}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, child := range children[pid] {
+			out = append(out, child)
+			queue = append(queue, child)
+		}
+	}
+	return out
+}
+
 func (c *ebpfCollector) Start(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -169,6 +286,14 @@ func (c *ebpfCollector) Close() error {
 	}
 	c.wg.Wait()
 
+	drops, err := c.readDrops()
+	c.mu.Lock()
+	c.finalDrops = drops
+	c.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: read drop counters: %v\n", err)
+	}
+
 	for _, l := range c.links {
 		_ = l.Close()
 	}
@@ -181,6 +306,39 @@ func (c *ebpfCollector) Close() error {
 	return nil
 }
 
+// Drops returns how many events of each type the kernel failed to submit.
+func (c *ebpfCollector) Drops() (map[EventType]uint64, error) {
+	c.mu.Lock()
+	final := c.finalDrops
+	c.mu.Unlock()
+	if final != nil {
+		return final, nil
+	}
+	return c.readDrops()
+}
+
+func (c *ebpfCollector) readDrops() (map[EventType]uint64, error) {
+	dropsMap := c.shared["drops"]
+	if dropsMap == nil {
+		return map[EventType]uint64{}, errors.New("eBPF objects predate drop accounting (rebuild with scripts/build-ebpf.sh)")
+	}
+	out := map[EventType]uint64{}
+	var perCPU []uint64
+	for key := uint32(0); key < dropsMap.MaxEntries(); key++ {
+		if err := dropsMap.Lookup(key, &perCPU); err != nil {
+			return out, fmt.Errorf("lookup drops[%d]: %w", key, err)
+		}
+		var total uint64
+		for _, v := range perCPU {
+			total += v
+		}
+		if total > 0 {
+			out[EventType(key)] = total
+		}
+	}
+	return out, nil
+}
+
 func (c *ebpfCollector) readLoop(ctx context.Context, reader *ringbuf.Reader) {
 	defer c.wg.Done()
 	for {
@@ -203,6 +361,7 @@ func (c *ebpfCollector) readLoop(ctx context.Context, reader *ringbuf.Reader) {
 			}
 			continue
 		}
+		resolveEventPaths(&ev)
 		if atomic.LoadInt32(&c.debug) > 0 {
 			if atomic.AddInt32(&c.debug, -1) >= 0 {
 				fmt.Fprintf(os.Stderr, "glasshouse: event type=%d pid=%d ppid=%d path=%q\n", ev.Type, ev.PID, ev.PPID, ev.Path)
@@ -218,36 +377,7 @@ func (c *ebpfCollector) readLoop(ctx context.Context, reader *ringbuf.Reader) {
 	}
 }
 
-func parseEvent(data []byte) (Event, error) {
-	if len(data) < eventSize {
-		return Event{}, fmt.Errorf("short event: %d", len(data))
-	}
-
-	ev := Event{}
-	ev.Type = EventType(binary.LittleEndian.Uint32(data[0:4]))
-	ev.PID = binary.LittleEndian.Uint32(data[4:8])
-	ev.PPID = binary.LittleEndian.Uint32(data[8:12])
-	ev.CgroupID = binary.LittleEndian.Uint64(data[16:24])
-	ev.Flags = binary.LittleEndian.Uint32(data[24:28])
-	ev.Port = binary.LittleEndian.Uint16(data[28:30])
-	ev.AddrFamily = data[30]
-	ev.Proto = data[31]
-	copy(ev.Addr[:], data[32:48])
-	ev.Comm = trimNull(data[48:64])
-	ev.Path = trimNull(data[64:320])
-
-	return ev, nil
-}
-
-func trimNull(b []byte) string {
-	idx := bytes.IndexByte(b, 0)
-	if idx == -1 {
-		idx = len(b)
-	}
-	return string(b[:idx])
-}
-
-func loadObject(path string) (*ebpf.Collection, []*ringbuf.Reader, []link.Link, error) {
+func loadObject(path string, shared map[string]*ebpf.Map, pins *objectPins) (*ebpf.Collection, []*ringbuf.Reader, []link.Link, error) {
 	if _, err := os.Stat(path); err != nil {
 		return nil, nil, nil, fmt.Errorf("eBPF object missing: %s", path)
 	}
@@ -257,9 +387,18 @@ func loadObject(path string) (*ebpf.Collection, []*ringbuf.Reader, []link.Link,
 		return nil, nil, nil, fmt.Errorf("load eBPF spec %s: %w", path, err)
 	}
 
-	coll, err := ebpf.NewCollection(spec)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("load eBPF collection %s: %w", path, err)
+	coll, resumed := pins.resume(spec, shared)
+	if !resumed {
+		pins.discard()
+		var err error
+		coll, err = newCollection(spec, shared, pins)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("load eBPF collection %s: %w", path, err)
+		}
+		if err := pins.pin(coll); err != nil {
+			coll.Close()
+			return nil, nil, nil, err
+		}
 	}
 
 	readers := []*ringbuf.Reader{}
@@ -275,73 +414,241 @@ func loadObject(path string) (*ebpf.Collection, []*ringbuf.Reader, []link.Link,
 	links := []link.Link{}
 	switch filepath.Base(path) {
 	case "exec.o":
-		link1, err := attachTracepoint(coll, "trace_execve", "syscalls", "sys_enter_execve")
+		link1, err := attachTracepoint(coll, pins, "trace_execve", "syscalls", "sys_enter_execve")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link1)
 
-		link2, err := attachTracepoint(coll, "trace_execveat", "syscalls", "sys_enter_execveat")
+		link2, err := attachTracepoint(coll, pins, "trace_execveat", "syscalls", "sys_enter_execveat")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link2)
 	case "exec-argv.o":
-		link1, err := attachTracepoint(coll, "trace_execve", "syscalls", "sys_enter_execve")
+		link1, err := attachTracepoint(coll, pins, "trace_execve", "syscalls", "sys_enter_execve")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link1)
 
-		link2, err := attachTracepoint(coll, "trace_execveat", "syscalls", "sys_enter_execveat")
+		link2, err := attachTracepoint(coll, pins, "trace_execveat", "syscalls", "sys_enter_execveat")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link2)
 	case "fs.o":
-		link1, err := attachTracepoint(coll, "trace_openat", "syscalls", "sys_enter_openat")
+		link1, err := attachTracepoint(coll, pins, "trace_openat", "syscalls", "sys_enter_openat")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link1)
 
-		link2, err := attachTracepoint(coll, "trace_open", "syscalls", "sys_enter_open")
+		link2, err := attachTracepoint(coll, pins, "trace_open", "syscalls", "sys_enter_open")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link2)
+
+		mutationLinks, err := attachPrograms(coll, pins, fsMutationPrograms)
+		if err != nil {
+			coll.Close()
+			return nil, nil, nil, err
+		}
+		links = append(links, mutationLinks...)
+	case "proc.o":
+		for _, progName := range []string{"trace_fork", "trace_exit"} {
+			prog := coll.Programs[progName]
+			if prog == nil {
+				coll.Close()
+				return nil, nil, nil, fmt.Errorf("program %s not found", progName)
+			}
+			l, err := pins.attach(progName, func() (link.Link, error) {
+				return link.AttachTracing(link.TracingOptions{Program: prog, AttachType: ebpf.AttachTraceRawTp})
+			})
+			if err != nil {
+				coll.Close()
+				return nil, nil, nil, fmt.Errorf("attach %s: %w", progName, err)
+			}
+			links = append(links, l)
+		}
 	case "net.o":
-		link1, err := attachTracepoint(coll, "trace_connect", "syscalls", "sys_enter_connect")
+		link1, err := attachTracepoint(coll, pins, "trace_connect", "syscalls", "sys_enter_connect")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link1)
 
-		link2, err := attachTracepoint(coll, "trace_socket_enter", "syscalls", "sys_enter_socket")
+		link2, err := attachTracepoint(coll, pins, "trace_socket_enter", "syscalls", "sys_enter_socket")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link2)
 
-		link3, err := attachTracepoint(coll, "trace_socket_exit", "syscalls", "sys_exit_socket")
+		link3, err := attachTracepoint(coll, pins, "trace_socket_exit", "syscalls", "sys_exit_socket")
 		if err != nil {
 			coll.Close()
 			return nil, nil, nil, err
 		}
 		links = append(links, link3)
+
+		extraLinks, err := attachPrograms(coll, pins, netPrograms)
+		if err != nil {
+			coll.Close()
+			return nil, nil, nil, err
+		}
+		links = append(links, extraLinks...)
+	case "sec.o":
+		secLinks, err := attachPrograms(coll, pins, secPrograms)
+		if err != nil {
+			coll.Close()
+			return nil, nil, nil, err
+		}
+		links = append(links, secLinks...)
 	}
 
 	return coll, readers, links, nil
 }
 
+// newCollection loads spec, reusing maps already in shared or pinned by an
+// earlier run, and records the shared maps it creates.
+func newCollection(spec *ebpf.CollectionSpec, shared map[string]*ebpf.Map, pins *objectPins) (*ebpf.Collection, error) {
+	opened := pins.loadShared(spec, shared)
+	opts := ebpf.CollectionOptions{MapReplacements: map[string]*ebpf.Map{}}
+	for name, m := range shared {
+		if _, ok := spec.Maps[name]; ok {
+			opts.MapReplacements[name] = m
+		}
+	}
+	coll, err := ebpf.NewCollectionWithOptions(spec, opts)
+	// Pinned shared maps are replaced by the collection's clones so the
+	// collection owns them like maps it created.
+	for _, name := range opened {
+		m := shared[name]
+		delete(shared, name)
+		m.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sharedMaps {
+		if _, ok := shared[name]; !ok && coll.Maps[name] != nil {
+			shared[name] = coll.Maps[name]
+		}
+	}
+	return coll, nil
+}
+
+// programAttachment describes where an optional program attaches. Kind is
+// "tracepoint" (a syscalls tracepoint), "kprobe" or "kretprobe".
+type programAttachment struct {
+	prog     string
+	kind     string
+	target   string
+	optional bool
+}
+
+// fsMutationPrograms attach fs.o mutation programs. Legacy syscalls are
+// optional because some architectures only provide the *at forms.
+var fsMutationPrograms = []programAttachment{
+	{"trace_unlinkat", "tracepoint", "sys_enter_unlinkat", false},
+	{"trace_unlink", "tracepoint", "sys_enter_unlink", true},
+	{"trace_rmdir", "tracepoint", "sys_enter_rmdir", true},
+	{"trace_renameat2", "tracepoint", "sys_enter_renameat2", false},
+	{"trace_renameat", "tracepoint", "sys_enter_renameat", true},
+	{"trace_rename", "tracepoint", "sys_enter_rename", true},
+	{"trace_mkdirat", "tracepoint", "sys_enter_mkdirat", false},
+	{"trace_mkdir", "tracepoint", "sys_enter_mkdir", true},
+	{"trace_fchmodat", "tracepoint", "sys_enter_fchmodat", false},
+	{"trace_chmod", "tracepoint", "sys_enter_chmod", true},
+	{"trace_fchownat", "tracepoint", "sys_enter_fchownat", false},
+	{"trace_chown", "tracepoint", "sys_enter_chown", true},
+	{"trace_lchown", "tracepoint", "sys_enter_lchown", true},
+	{"trace_truncate", "tracepoint", "sys_enter_truncate", false},
+}
+
+// netPrograms attach net.o programs beyond connect/socket. TCP byte
+// accounting uses kprobes, which may be unavailable on some kernels.
+var netPrograms = []programAttachment{
+	{"trace_bind", "tracepoint", "sys_enter_bind", false},
+	{"trace_listen", "tracepoint", "sys_enter_listen", false},
+	{"trace_sendto", "tracepoint", "sys_enter_sendto", false},
+	{"trace_sendmsg", "tracepoint", "sys_enter_sendmsg", false},
+	{"trace_sendmmsg", "tracepoint", "sys_enter_sendmmsg", false},
+	{"trace_recvfrom_enter", "tracepoint", "sys_enter_recvfrom", false},
+	{"trace_recvfrom_exit", "tracepoint", "sys_exit_recvfrom", false},
+	{"trace_accept", "kretprobe", "inet_csk_accept", true},
+	{"trace_tcp_sendmsg", "kprobe", "tcp_sendmsg", true},
+	{"trace_tcp_cleanup_rbuf", "kprobe", "tcp_cleanup_rbuf", true},
+	{"trace_tcp_close", "kprobe", "tcp_close", true},
+}
+
+// secPrograms attach sec.o. The 16-bit ID and module syscalls are missing on
+// some kernels and architectures.
+var secPrograms = []programAttachment{
+	{"trace_setuid", "tracepoint", "sys_enter_setuid", false},
+	{"trace_setreuid", "tracepoint", "sys_enter_setreuid", false},
+	{"trace_setresuid", "tracepoint", "sys_enter_setresuid", false},
+	{"trace_setfsuid", "tracepoint", "sys_enter_setfsuid", true},
+	{"trace_setgid", "tracepoint", "sys_enter_setgid", false},
+	{"trace_setregid", "tracepoint", "sys_enter_setregid", false},
+	{"trace_setresgid", "tracepoint", "sys_enter_setresgid", false},
+	{"trace_setfsgid", "tracepoint", "sys_enter_setfsgid", true},
+	{"trace_capset", "tracepoint", "sys_enter_capset", false},
+	{"trace_ptrace", "tracepoint", "sys_enter_ptrace", false},
+	{"trace_mount", "tracepoint", "sys_enter_mount", false},
+	{"trace_umount", "tracepoint", "sys_enter_umount", true},
+	{"trace_bpf", "tracepoint", "sys_enter_bpf", false},
+	{"trace_init_module", "tracepoint", "sys_enter_init_module", true},
+	{"trace_finit_module", "tracepoint", "sys_enter_finit_module", true},
+	{"trace_memfd_create", "tracepoint", "sys_enter_memfd_create", false},
+	{"trace_fileless_exec", "tracepoint", "sys_enter_execveat", false},
+	{"trace_mprotect", "tracepoint", "sys_enter_mprotect", false},
+}
+
+// attachPrograms attaches each listed program present in coll. Objects built
+// before a program existed are accepted without it.
+func attachPrograms(coll *ebpf.Collection, pins *objectPins, attachments []programAttachment) ([]link.Link, error) {
+	links := []link.Link{}
+	for _, a := range attachments {
+		prog := coll.Programs[a.prog]
+		if prog == nil {
+			continue
+		}
+		var (
+			l   link.Link
+			err error
+		)
+		switch a.kind {
+		case "kprobe":
+			l, err = pins.attach(a.prog, func() (link.Link, error) { return link.Kprobe(a.target, prog, nil) })
+		case "kretprobe":
+			l, err = pins.attach(a.prog, func() (link.Link, error) { return link.Kretprobe(a.target, prog, nil) })
+		default:
+			l, err = attachTracepoint(coll, pins, a.prog, "syscalls", a.target)
+		}
+		if err != nil {
+			if a.optional {
+				continue
+			}
+			for _, existing := range links {
+				_ = existing.Close()
+			}
+			return nil, fmt.Errorf("attach %s: %w", a.prog, err)
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
 func captureArgvEnabled() bool {
 	value := strings.ToLower(strings.TrimSpace(os.Getenv("GLASSHOUSE_CAPTURE_ARGV")))
 	if value == "" || value == "0" || value == "false" || value == "no" {
@@ -380,12 +687,12 @@ func isWSL() bool {
 	return false
 }
 
-func attachTracepoint(coll *ebpf.Collection, progName, category, name string) (link.Link, error) {
+func attachTracepoint(coll *ebpf.Collection, pins *objectPins, progName, category, name string) (link.Link, error) {
 	prog := coll.Programs[progName]
 	if prog == nil {
 		return nil, fmt.Errorf("program %s not found", progName)
 	}
-	l, err := link.Tracepoint(category, name, prog, nil)
+	l, err := pins.attach(progName, func() (link.Link, error) { return link.Tracepoint(category, name, prog, nil) })
 	if err != nil {
 		return nil, fmt.Errorf("attach %s/%s: %w", category, name, err)
 	}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package audit
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDescendantsFindsExistingChildren(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 5 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("start sh: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	child := uint32(cmd.Process.Pid)
+	found := false
+	for _, pid := range descendants(uint32(os.Getpid())) {
+		if pid == child {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("child %d not found among descendants", child)
+	}
+}
+
+func TestParseVariableLengthOpenResolvesCwd(t *testing.T) {
+	path := strings.Repeat("d/", 300) + "data.csv"
+	data := newRecord(EventOpen, headerSize+len(path)+1)
+	binary.LittleEndian.PutUint32(data[offPID:], uint32(os.Getpid()))
+	dirfd := int32(atFDCWD)
+	binary.LittleEndian.PutUint32(data[offDirFD:], uint32(dirfd))
+	copy(data[offFilename:], path)
+
+	ev, err := parseEvent(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if ev.Path != path || ev.PathTruncated {
+		t.Fatalf("unexpected path %q truncated=%v", ev.Path, ev.PathTruncated)
+	}
+	resolveEventPaths(&ev)
+	cwd, _ := os.Getwd()
+	if want := filepath.Join(cwd, path); ev.Path != want {
+		t.Fatalf("resolved %q, want %q", ev.Path, want)
+	}
+}
+
+func TestParseRenameMarksTruncatedTarget(t *testing.T) {
+	data := newRecord(EventRename, fsEventSize)
+	copy(data[offFilename:], "/tmp/a")
+	copy(data[offFSTarget:], strings.Repeat("x", 255))
+
+	// A target that fits exactly is complete; only the BPF flag marks it cut.
+	ev, err := parseEvent(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if ev.Path != "/tmp/a" || len(ev.Target) != 255 || ev.PathTruncated {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	binary.LittleEndian.PutUint32(data[offWireFlags:], wireTargetTruncated)
+	if ev, err = parseEvent(data); err != nil || !ev.PathTruncated {
+		t.Fatalf("flagged target not truncated: %+v, %v", ev, err)
+	}
+}
+
+func TestParseOpenTruncationComesFromWireFlags(t *testing.T) {
+	path := "/" + strings.Repeat("p", fullPathMax-2)
+	data := newRecord(EventOpen, headerSize+fullPathMax)
+	copy(data[offFilename:], path)
+
+	ev, err := parseEvent(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if ev.Path != path || ev.PathTruncated {
+		t.Fatalf("complete %d-byte path marked truncated", len(path))
+	}
+	binary.LittleEndian.PutUint32(data[offWireFlags:], wirePathTruncated)
+	if ev, err = parseEvent(data); err != nil || !ev.PathTruncated {
+		t.Fatalf("flagged path not truncated: %v", err)
+	}
+}
+
+func TestParseSecurityEventResolvesFd(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data := newRecord(EventModuleLoad, secEventSize)
+	binary.LittleEndian.PutUint32(data[offPID:], uint32(os.Getpid()))
+	binary.LittleEndian.PutUint32(data[offDirFD:], uint32(f.Fd()))
+	binary.LittleEndian.PutUint32(data[offSecOp:], moduleOpFinit)
+	binary.LittleEndian.PutUint64(data[offSecArgs:], 7)
+	copy(data[offSecTarget:], "debug=1")
+
+	ev, err := parseEvent(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if ev.Op != moduleOpFinit || ev.Args[0] != 7 || ev.Target != "debug=1" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	resolveEventPaths(&ev)
+	if ev.Path != f.Name() {
+		t.Fatalf("resolved %q, want %q", ev.Path, f.Name())
+	}
+	binary.LittleEndian.PutUint32(data[offLength:], eventSize)
+	if _, err := parseEvent(data[:eventSize]); err == nil {
+		t.Fatal("expected short security event error")
+	}
+}
+
+func TestParseConvertsBootTimestamp(t *testing.T) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &ts); err != nil {
+		t.Skipf("CLOCK_BOOTTIME: %v", err)
+	}
+	data := newRecord(EventExec, eventSize)
+	binary.LittleEndian.PutUint64(data[offTimestamp:], uint64(ts.Nano()))
+
+	ev, err := parseEvent(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if skew := time.Since(ev.Timestamp); skew < 0 || skew > time.Second {
+		t.Fatalf("timestamp %v is %v away from now", ev.Timestamp, skew)
+	}
+}
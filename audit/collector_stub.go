@@ -17,3 +17,7 @@ func (s *stubCollector) Start(ctx context.Context) error { return nil }
 func (s *stubCollector) Events() <-chan Event            { return nil }
 func (s *stubCollector) Errors() <-chan error            { return nil }
 func (s *stubCollector) Close() error                    { return nil }
+
+func Unpin(root string) error {
+	return fmt.Errorf("eBPF pinning is only supported on Linux")
+}
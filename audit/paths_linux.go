@@ -0,0 +1,73 @@
+//go:build linux
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// atFDCWD is the dirfd value meaning "relative to the working directory".
+const atFDCWD = -100
+
+// resolveEventPaths makes relative paths absolute using the process's cwd or
+// the directory fd it passed. Resolution happens when the event is read, so a
+// process that has already exited keeps its raw path.
+func resolveEventPaths(ev *Event) {
+	switch ev.Type {
+	case EventOpen, EventUnlink, EventMkdir, EventChmod, EventChown, EventTruncate:
+		ev.Path = resolvePath(ev.PID, ev.DirFD, ev.Path)
+	case EventRename:
+		ev.Path = resolvePath(ev.PID, ev.DirFD, ev.Path)
+		ev.Target = resolvePath(ev.PID, ev.TargetDirFD, ev.Target)
+	case EventMount, EventUmount:
+		ev.Path = resolvePath(ev.PID, atFDCWD, ev.Path)
+	case EventFilelessExec:
+		ev.Path = fdPath(ev.PID, ev.DirFD)
+	case EventModuleLoad:
+		if ev.Op == moduleOpFinit {
+			ev.Path = fdPath(ev.PID, ev.DirFD)
+		}
+	}
+}
+
+// moduleOpFinit is the sec_event op for finit_module.
+const moduleOpFinit = 1
+
+// fdPath names the file behind an fd, e.g. "/memfd:payload (deleted)".
+func fdPath(pid uint32, fd int32) string {
+	if pid == 0 || fd < 0 {
+		return ""
+	}
+	target, err := os.Readlink(filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10), "fd", strconv.Itoa(int(fd))))
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func resolvePath(pid uint32, dirfd int32, path string) string {
+	if path == "" || filepath.IsAbs(path) || pid == 0 {
+		return path
+	}
+	proc := filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10))
+	var link string
+	switch {
+	case dirfd == atFDCWD:
+		link = filepath.Join(proc, "cwd")
+	case dirfd >= 0:
+		link = filepath.Join(proc, "fd", strconv.Itoa(int(dirfd)))
+		// Objects without dirfd report 0; only trust fds that are directories.
+		if info, err := os.Stat(link); err != nil || !info.IsDir() {
+			return path
+		}
+	default:
+		return path
+	}
+	dir, err := os.Readlink(link)
+	if err != nil || !filepath.IsAbs(dir) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
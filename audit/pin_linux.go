@@ -0,0 +1,285 @@
+//go:build linux
+
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// objectPins pins one object's programs, maps and links below
+// <root>/<object>. Shared maps live in <root>/maps so every object reopens
+// the same instance. A nil *objectPins disables pinning.
+//
+// Tracepoint and kprobe attachments are perf events, which cannot be
+// pinned; they are detached on Close and re-attached from the pinned
+// programs on restart. Raw tracepoint links (fork and exit) stay attached,
+// so those events keep filling the pinned ring buffer while no collector runs.
+//
+// A marker map records the SHA-256 of the object file the pins came from.
+// After an upgrade the old programs, which would emit an older wire version,
+// are discarded rather than resumed.
+type objectPins struct {
+	root   string
+	dir    string
+	digest [sha256.Size]byte
+}
+
+func newObjectPins(root, objectPath string) *objectPins {
+	if root == "" {
+		return nil
+	}
+	name := strings.TrimSuffix(filepath.Base(objectPath), filepath.Ext(objectPath))
+	p := &objectPins{root: root, dir: filepath.Join(root, name)}
+	if data, err := os.ReadFile(objectPath); err == nil {
+		p.digest = sha256.Sum256(data)
+	}
+	return p
+}
+
+// checkPinRoot creates root and verifies that it is on a bpf filesystem.
+func checkPinRoot(root string) error {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return fmt.Errorf("create pin dir: %w", err)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", root, err)
+	}
+	if uint32(st.Type) != unix.BPF_FS_MAGIC {
+		return fmt.Errorf("pin dir %s is not on a bpf filesystem (mount -t bpf bpf /sys/fs/bpf)", root)
+	}
+	return nil
+}
+
+// Unpin removes everything pinned below root, detaching pinned links.
+func Unpin(root string) error {
+	if err := os.RemoveAll(root); err != nil {
+		return fmt.Errorf("unpin %s: %w", root, err)
+	}
+	return nil
+}
+
+func (p *objectPins) sharedMapPath(name string) string {
+	return filepath.Join(p.root, "maps", name)
+}
+
+func (p *objectPins) mapPath(name string) string {
+	return filepath.Join(p.dir, "maps", name)
+}
+
+func (p *objectPins) progPath(name string) string {
+	return filepath.Join(p.dir, "progs", name)
+}
+
+func (p *objectPins) linkPath(name string) string {
+	return filepath.Join(p.dir, "links", name)
+}
+
+func (p *objectPins) markerPath() string {
+	return filepath.Join(p.dir, "object")
+}
+
+// pinnedDigest reads the object digest recorded by pin.
+func (p *objectPins) pinnedDigest() ([]byte, error) {
+	m, err := ebpf.LoadPinnedMap(p.markerPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	digest := make([]byte, sha256.Size)
+	if err := m.Lookup(uint32(0), digest); err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
+func (p *objectPins) pinMarker() error {
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Name: "object", Type: ebpf.Array, KeySize: 4, ValueSize: sha256.Size, MaxEntries: 1})
+	if err != nil {
+		return fmt.Errorf("create object marker: %w", err)
+	}
+	defer m.Close()
+	if err := m.Put(uint32(0), p.digest[:]); err != nil {
+		return fmt.Errorf("write object marker: %w", err)
+	}
+	if err := m.Pin(p.markerPath()); err != nil {
+		return fmt.Errorf("pin object marker: %w", err)
+	}
+	return nil
+}
+
+func isSharedMap(name string) bool {
+	for _, shared := range sharedMaps {
+		if shared == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadShared opens pinned shared maps that are not yet in shared and
+// returns their names so the caller can close them once the collection
+// holds clones.
+func (p *objectPins) loadShared(spec *ebpf.CollectionSpec, shared map[string]*ebpf.Map) []string {
+	if p == nil {
+		return nil
+	}
+	var opened []string
+	for _, name := range sharedMaps {
+		if _, ok := spec.Maps[name]; !ok || shared[name] != nil {
+			continue
+		}
+		m, err := ebpf.LoadPinnedMap(p.sharedMapPath(name), nil)
+		if err != nil {
+			continue
+		}
+		shared[name] = m
+		opened = append(opened, name)
+	}
+	return opened
+}
+
+// resume reopens a previously pinned object. It reports false when the
+// object was never pinned, was pinned from a different object file or its
+// pins do not match spec.
+func (p *objectPins) resume(spec *ebpf.CollectionSpec, shared map[string]*ebpf.Map) (*ebpf.Collection, bool) {
+	if p == nil {
+		return nil, false
+	}
+	if digest, err := p.pinnedDigest(); err != nil || !bytes.Equal(digest, p.digest[:]) {
+		return nil, false
+	}
+	coll := &ebpf.Collection{Programs: map[string]*ebpf.Program{}, Maps: map[string]*ebpf.Map{}}
+	fail := func() (*ebpf.Collection, bool) {
+		coll.Close()
+		return nil, false
+	}
+	for name, ms := range spec.Maps {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := p.mapPath(name)
+		if isSharedMap(name) {
+			path = p.sharedMapPath(name)
+		}
+		m, err := ebpf.LoadPinnedMap(path, nil)
+		if err != nil {
+			return fail()
+		}
+		coll.Maps[name] = m
+		if ms.Type != m.Type() || ms.KeySize != m.KeySize() || ms.ValueSize != m.ValueSize() {
+			return fail()
+		}
+		if !isSharedMap(name) {
+			continue
+		}
+		// The pinned programs reference the pinned shared map, so an earlier
+		// object that created a new one this run makes the pins stale.
+		if existing := shared[name]; existing != nil {
+			if !sameMap(existing, m) {
+				return fail()
+			}
+			continue
+		}
+		shared[name] = m
+	}
+	for name, ps := range spec.Programs {
+		prog, err := ebpf.LoadPinnedProgram(p.progPath(name), nil)
+		if err != nil {
+			return fail()
+		}
+		coll.Programs[name] = prog
+		if prog.Type() != ps.Type {
+			return fail()
+		}
+	}
+	return coll, true
+}
+
+func sameMap(a, b *ebpf.Map) bool {
+	ai, err := a.Info()
+	if err != nil {
+		return false
+	}
+	bi, err := b.Info()
+	if err != nil {
+		return false
+	}
+	aid, aok := ai.ID()
+	bid, bok := bi.ID()
+	return aok && bok && aid == bid
+}
+
+// pin pins the maps and programs of a freshly loaded object and records its
+// digest. Shared maps
+// are only pinned by the first object that creates them.
+func (p *objectPins) pin(coll *ebpf.Collection) error {
+	if p == nil {
+		return nil
+	}
+	for _, dir := range []string{filepath.Join(p.root, "maps"), filepath.Join(p.dir, "maps"), filepath.Join(p.dir, "progs"), filepath.Join(p.dir, "links")} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("create pin dir: %w", err)
+		}
+	}
+	for name, m := range coll.Maps {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := p.mapPath(name)
+		if isSharedMap(name) {
+			path = p.sharedMapPath(name)
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+		if err := m.Pin(path); err != nil {
+			return fmt.Errorf("pin map %s: %w", name, err)
+		}
+	}
+	for name, prog := range coll.Programs {
+		if err := prog.Pin(p.progPath(name)); err != nil {
+			return fmt.Errorf("pin program %s: %w", name, err)
+		}
+	}
+	// Written last, so a partly pinned object is never resumed.
+	return p.pinMarker()
+}
+
+// discard removes the object's pins so it can be loaded from scratch.
+func (p *objectPins) discard() {
+	if p != nil {
+		_ = os.RemoveAll(p.dir)
+	}
+}
+
+// attach reuses a pinned link for prog when one exists and otherwise calls
+// fn and pins the result if the link type supports it.
+func (p *objectPins) attach(prog string, fn func() (link.Link, error)) (link.Link, error) {
+	if p == nil {
+		return fn()
+	}
+	path := p.linkPath(prog)
+	if l, err := link.LoadPinnedLink(path, nil); err == nil {
+		return l, nil
+	}
+	l, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.Pin(path); err != nil && !errors.Is(err, link.ErrNotSupported) {
+		_ = l.Close()
+		return nil, fmt.Errorf("pin link %s: %w", prog, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"golang.org/x/sys/unix"
+)
+
+func TestPinnedObjectResumesState(t *testing.T) {
+	root := t.TempDir()
+	if err := unix.Mount("bpf", root, "bpf", 0, ""); err != nil {
+		t.Skipf("mount bpffs: %v", err)
+	}
+	defer unix.Unmount(root, 0)
+	if err := checkPinRoot(root); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &ebpf.CollectionSpec{
+		Maps: map[string]*ebpf.MapSpec{
+			"events":       {Name: "events", Type: ebpf.RingBuf, MaxEntries: 4096},
+			"tracked_pids": {Name: "tracked_pids", Type: ebpf.Hash, KeySize: 4, ValueSize: 1, MaxEntries: 16},
+		},
+		Programs: map[string]*ebpf.ProgramSpec{
+			"trace_noop": {
+				Name:         "trace_noop",
+				Type:         ebpf.SocketFilter,
+				License:      "GPL",
+				Instructions: asm.Instructions{asm.Mov.Imm(asm.R0, 0), asm.Return()},
+			},
+		},
+	}
+	pins := newObjectPins(root, "/objects/proc.o")
+	shared := map[string]*ebpf.Map{}
+	coll, err := newCollection(spec, shared, pins)
+	if err != nil {
+		t.Skipf("load collection: %v", err)
+	}
+	if err := pins.pin(coll); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared["tracked_pids"].Put(uint32(42), uint8(1)); err != nil {
+		t.Fatal(err)
+	}
+	coll.Close()
+
+	shared = map[string]*ebpf.Map{}
+	resumed, ok := pins.resume(spec, shared)
+	if !ok {
+		t.Fatal("pinned object was not resumed")
+	}
+	defer resumed.Close()
+	var value uint8
+	if err := shared["tracked_pids"].Lookup(uint32(42), &value); err != nil || value != 1 {
+		t.Fatalf("tracked pid lost across resume: %v", err)
+	}
+
+	upgraded := *pins
+	upgraded.digest[0] ^= 0xff
+	if again, ok := upgraded.resume(spec, map[string]*ebpf.Map{}); ok {
+		again.Close()
+		t.Fatal("resumed pins from a different object file")
+	}
+
+	spec.Maps["tracked_pids"].ValueSize = 8
+	if again, ok := pins.resume(spec, map[string]*ebpf.Map{}); ok {
+		again.Close()
+		t.Fatal("resumed pins that do not match the object")
+	}
+}
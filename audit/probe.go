@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Features checked by Probe.
+const (
+	FeaturePlatform     = "platform"
+	FeatureBTF          = "btf"
+	FeatureTracepoints  = "tracepoints"
+	FeatureMemlock      = "memlock"
+	FeatureCapabilities = "capabilities"
+	FeatureObjects      = "objects"
+	FeatureArgvCapture  = "argv_capture"
+)
+
+// Feature is the outcome of one probe check. Reason explains why the
+// feature is unavailable, or qualifies an available one.
+type Feature struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	// Optional features only degrade receipts when unavailable.
+	Optional bool   `json:"optional,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ProbeResult reports which parts of the eBPF collector can work on this
+// host.
+type ProbeResult struct {
+	Features []Feature `json:"features"`
+}
+
+// Feature returns the named check.
+func (r ProbeResult) Feature(name string) (Feature, bool) {
+	for _, f := range r.Features {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Feature{}, false
+}
+
+// Err describes the required features that are unavailable, or returns nil
+// when the collector is expected to load.
+func (r ProbeResult) Err() error {
+	var missing []string
+	for _, f := range r.Features {
+		if f.Available || f.Optional {
+			continue
+		}
+		if f.Reason != "" {
+			missing = append(missing, f.Name+": "+f.Reason)
+		} else {
+			missing = append(missing, f.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("eBPF unavailable: %s", strings.Join(missing, "; "))
+}
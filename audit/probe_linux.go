@@ -0,0 +1,160 @@
+//go:build linux
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+const (
+	vmlinuxBTF = "/sys/kernel/btf/vmlinux"
+
+	capSysAdmin    = 21
+	capSysResource = 24
+	capPerfmon     = 38
+	capBPF         = 39
+
+	// minMemlock is enough for the ring buffers and maps of every object on
+	// kernels that still charge BPF memory to RLIMIT_MEMLOCK.
+	minMemlock = 64 << 20
+)
+
+// tracefsRoots are where the tracepoint event directories can be mounted.
+var tracefsRoots = []string{"/sys/kernel/tracing", "/sys/kernel/debug/tracing"}
+
+// Probe checks what the collector needs without loading any programs, so
+// it is cheap enough to run before every execution.
+func Probe(cfg Config) ProbeResult {
+	caps, capsErr := effectiveCaps()
+	return ProbeResult{Features: []Feature{
+		probeBTF(),
+		probeTracepoints(),
+		probeMemlock(caps),
+		probeCapabilities(caps, capsErr),
+		probeObjects(cfg.ObjectDir()),
+		probeArgvCapture(),
+	}}
+}
+
+func probeBTF() Feature {
+	f := Feature{Name: FeatureBTF}
+	if _, err := os.Stat(vmlinuxBTF); err != nil {
+		f.Reason = fmt.Sprintf("%s missing; kernel built without CONFIG_DEBUG_INFO_BTF", vmlinuxBTF)
+		return f
+	}
+	f.Available = true
+	return f
+}
+
+func probeTracepoints() Feature {
+	f := Feature{Name: FeatureTracepoints}
+	for _, root := range tracefsRoots {
+		if _, err := os.Stat(filepath.Join(root, "events", "syscalls", "sys_enter_execve")); err == nil {
+			f.Available = true
+			f.Reason = root
+			return f
+		}
+	}
+	f.Reason = "syscall tracepoints not found; mount tracefs at /sys/kernel/tracing"
+	return f
+}
+
+// probeMemlock only matters before Linux 5.11, which moved BPF memory to
+// cgroup accounting.
+func probeMemlock(caps uint64) Feature {
+	f := Feature{Name: FeatureMemlock, Available: true}
+	if kernelAtLeast(5, 11) {
+		return f
+	}
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &limit); err != nil {
+		f.Available = false
+		f.Reason = fmt.Sprintf("getrlimit: %v", err)
+		return f
+	}
+	if limit.Cur == unix.RLIM_INFINITY || limit.Cur >= minMemlock || caps&(1<<capSysResource) != 0 {
+		return f
+	}
+	f.Available = false
+	f.Reason = fmt.Sprintf("RLIMIT_MEMLOCK is %d KiB; raise it (ulimit -l unlimited) or grant CAP_SYS_RESOURCE", limit.Cur>>10)
+	return f
+}
+
+func probeCapabilities(caps uint64, err error) Feature {
+	f := Feature{Name: FeatureCapabilities}
+	switch {
+	case err != nil:
+		f.Reason = err.Error()
+	case caps&(1<<capSysAdmin) != 0:
+		f.Available = true
+	case caps&(1<<capBPF) == 0 || caps&(1<<capPerfmon) == 0:
+		// Loading needs CAP_BPF; attaching tracepoints and kprobes also
+		// needs CAP_PERFMON.
+		f.Reason = "needs CAP_BPF and CAP_PERFMON, or CAP_SYS_ADMIN"
+	default:
+		f.Available = true
+	}
+	return f
+}
+
+// probeObjects requires every object the collector loads; a missing one
+// would silently drop its event classes.
+func probeObjects(dir string) Feature {
+	f := Feature{Name: FeatureObjects}
+	var missing []string
+	for _, name := range collectorObjects {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		f.Reason = fmt.Sprintf("%s not found in %s (run scripts/build-ebpf.sh or set GLASSHOUSE_BPF_DIR)", strings.Join(missing, ", "), dir)
+		return f
+	}
+	f.Available = true
+	f.Reason = dir
+	return f
+}
+
+func probeArgvCapture() Feature {
+	f := Feature{Name: FeatureArgvCapture, Optional: true, Available: true}
+	if isWSL() {
+		f.Available = false
+		f.Reason = "disabled on WSL; set GLASSHOUSE_CAPTURE_ARGV=force to override"
+	}
+	return f
+}
+
+func effectiveCaps() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, fmt.Errorf("read capabilities: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "CapEff:"); ok {
+			caps, err := strconv.ParseUint(strings.TrimSpace(rest), 16, 64)
+			if err != nil {
+				return 0, fmt.Errorf("parse capabilities: %w", err)
+			}
+			return caps, nil
+		}
+	}
+	return 0, fmt.Errorf("CapEff not found in /proc/self/status")
+}
+
+// kernelAtLeast checks the running kernel's release.
+func kernelAtLeast(major, minor int) bool {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return false
+	}
+	return profiling.KernelAtLeast(unix.ByteSliceToString(uts.Release[:]), major, minor)
+}
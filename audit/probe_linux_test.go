@@ -0,0 +1,49 @@
+//go:build linux
+
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProbeCapabilitiesNeedsPerfmonWithBPF(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		caps uint64
+		want bool
+	}{
+		{name: "none"},
+		{name: "bpf only", caps: 1 << capBPF},
+		{name: "perfmon only", caps: 1 << capPerfmon},
+		{name: "bpf and perfmon", caps: 1<<capBPF | 1<<capPerfmon, want: true},
+		{name: "sys_admin", caps: 1 << capSysAdmin, want: true},
+	} {
+		if f := probeCapabilities(tc.caps, nil); f.Available != tc.want {
+			t.Errorf("%s: available = %v (%s), want %v", tc.name, f.Available, f.Reason, tc.want)
+		}
+	}
+}
+
+func TestProbeObjectsNamesMissingObjects(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"exec.o", "net.o", "proc.o"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := probeObjects(dir)
+	if f.Available || !strings.Contains(f.Reason, "fs.o, sec.o not found") {
+		t.Fatalf("partial objects: %+v", f)
+	}
+	for _, name := range []string{"fs.o", "sec.o"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f := probeObjects(dir); !f.Available {
+		t.Fatalf("all objects: %+v", f)
+	}
+}
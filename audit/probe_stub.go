@@ -0,0 +1,12 @@
+//go:build !linux
+
+package audit
+
+// Probe reports the collector as unavailable on non-Linux platforms.
+func Probe(cfg Config) ProbeResult {
+	_ = cfg
+	return ProbeResult{Features: []Feature{{
+		Name:   FeaturePlatform,
+		Reason: "eBPF collector is only supported on Linux",
+	}}}
+}
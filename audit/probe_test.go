@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProbeResultErrIgnoresOptionalFeatures(t *testing.T) {
+	result := ProbeResult{Features: []Feature{
+		{Name: FeatureBTF, Available: true},
+		{Name: FeatureArgvCapture, Optional: true, Reason: "disabled on WSL"},
+	}}
+	if err := result.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result.Features = append(result.Features, Feature{Name: FeatureObjects, Reason: "exec.o not found"})
+	err := result.Err()
+	if err == nil || !strings.Contains(err.Error(), "objects: exec.o not found") || strings.Contains(err.Error(), "WSL") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f, ok := result.Feature(FeatureObjects); !ok || f.Available {
+		t.Fatalf("objects feature %+v %v", f, ok)
+	}
+}
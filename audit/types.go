@@ -1,25 +1,47 @@
 package audit
 
-type EventType uint32
+import "glasshouse/core/profiling"
+
+// Event and EventType are the profiling types; the collector decodes kernel
+// records straight into them (see wire.go).
+type (
+	EventType = profiling.EventType
+	Event     = profiling.Event
+)
 
 const (
-	EventExec    EventType = 1
-	EventOpen    EventType = 2
-	EventConnect EventType = 3
+	EventExec         = profiling.EventExec
+	EventOpen         = profiling.EventOpen
+	EventConnect      = profiling.EventConnect
+	EventFork         = profiling.EventFork
+	EventExit         = profiling.EventExit
+	EventUnlink       = profiling.EventUnlink
+	EventRename       = profiling.EventRename
+	EventMkdir        = profiling.EventMkdir
+	EventChmod        = profiling.EventChmod
+	EventChown        = profiling.EventChown
+	EventTruncate     = profiling.EventTruncate
+	EventBind         = profiling.EventBind
+	EventListen       = profiling.EventListen
+	EventAccept       = profiling.EventAccept
+	EventSend         = profiling.EventSend
+	EventRecv         = profiling.EventRecv
+	EventSocketStats  = profiling.EventSocketStats
+	EventSetUID       = profiling.EventSetUID
+	EventSetGID       = profiling.EventSetGID
+	EventCapset       = profiling.EventCapset
+	EventPtrace       = profiling.EventPtrace
+	EventMount        = profiling.EventMount
+	EventUmount       = profiling.EventUmount
+	EventBPF          = profiling.EventBPF
+	EventModuleLoad   = profiling.EventModuleLoad
+	EventMemfdCreate  = profiling.EventMemfdCreate
+	EventFilelessExec = profiling.EventFilelessExec
+	EventMprotectExec = profiling.EventMprotectExec
 )
 
-type Event struct {
-	Type       EventType
-	PID        uint32
-	PPID       uint32
-	CgroupID   uint64
-	Flags      uint32
-	Comm       string
-	Path       string
-	AddrFamily uint8
-	Proto      uint8
-	Addr       [16]byte
-	Port       uint16
+func isFSMutation(t EventType) bool {
+	return t >= EventUnlink && t <= EventTruncate
 }
 
 type Receipt struct {
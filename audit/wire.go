@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Offsets and sizes of the ring buffer records declared in
+// ebpf/common/events.h. wire_test.go parses that header and fails when these
+// drift from the C layout.
+const (
+	wireVersion = 2
+
+	// struct wire_header
+	offType        = 0
+	offVersion     = 2
+	offLength      = 4
+	wireHeaderSize = 8
+
+	// struct event
+	offPID        = 8
+	offPPID       = 12
+	offDirFD      = 16
+	offFlags      = 20
+	offCgroupID   = 24
+	offTimestamp  = 32
+	offPort       = 40
+	offAddrFamily = 42
+	offProto      = 43
+	offWireFlags  = 44
+	offAddr       = 48
+	offComm       = 64
+	offFilename   = 80
+	commMax       = 16
+	pathMax       = 256
+	eventSize     = offFilename + pathMax
+
+	// headerSize is the part of struct event shared by variable-length
+	// open events (EVENT_HEADER_SIZE).
+	headerSize  = offFilename
+	fullPathMax = 4096
+
+	// struct fs_event
+	offFSUID         = eventSize
+	offFSGID         = eventSize + 4
+	offFSTargetDirFD = eventSize + 8
+	offFSTarget      = eventSize + 16
+	fsEventSize      = offFSTarget + pathMax
+
+	// struct net_event
+	offNetBytesSent     = eventSize
+	offNetBytesReceived = eventSize + 8
+	netEventSize        = eventSize + 16
+
+	// struct sec_event
+	offSecOp     = eventSize
+	offSecArgs   = eventSize + 8
+	offSecTarget = eventSize + 32
+	secEventSize = offSecTarget + pathMax
+
+	// event.wire_flags bits, set by the BPF side when a string read filled
+	// its buffer before the terminator.
+	wirePathTruncated   = 1
+	wireTargetTruncated = 2
+
+	dnsPort = 53
+)
+
+// minRecordSize is the smallest valid length for each event type. Types
+// missing from the table are rejected.
+func minRecordSize(t EventType) int {
+	switch {
+	case t == EventOpen:
+		return headerSize
+	case t == EventSocketStats:
+		return netEventSize
+	case isFSMutation(t):
+		return fsEventSize
+	case t.IsSecurity():
+		return secEventSize
+	case t >= EventExec && t <= EventRecv:
+		return eventSize
+	default:
+		return 0
+	}
+}
+
+// parseEvent decodes one ring buffer record. The header's version must match
+// wireVersion; objects built from an older events.h are rejected rather than
+// misread.
+func parseEvent(data []byte) (Event, error) {
+	if len(data) < wireHeaderSize {
+		return Event{}, fmt.Errorf("short event: %d", len(data))
+	}
+	typ := EventType(binary.LittleEndian.Uint16(data[offType:]))
+	version := binary.LittleEndian.Uint16(data[offVersion:])
+	length := int(binary.LittleEndian.Uint32(data[offLength:]))
+	if version != wireVersion {
+		return Event{}, fmt.Errorf("unsupported event wire version %d (want %d); rebuild the eBPF objects", version, wireVersion)
+	}
+	min := minRecordSize(typ)
+	if min == 0 {
+		return Event{}, fmt.Errorf("unknown event type %d", typ)
+	}
+	if length > len(data) {
+		return Event{}, fmt.Errorf("event length %d exceeds record size %d", length, len(data))
+	}
+	if length < min {
+		return Event{}, fmt.Errorf("short %s event: %d", typ, length)
+	}
+	data = data[:length]
+
+	ev := Event{Type: typ}
+	decodeCommon(&ev, data)
+	wireFlags := binary.LittleEndian.Uint32(data[offWireFlags:])
+	ev.PathTruncated = wireFlags&wirePathTruncated != 0
+	switch {
+	case typ == EventOpen:
+		ev.Path = trimNull(data[offFilename:])
+	case typ == EventSend || typ == EventRecv:
+		if ev.Port == dnsPort {
+			n := int(ev.Flags)
+			if n > pathMax {
+				n = pathMax
+			}
+			ev.Payload = append([]byte(nil), data[offFilename:offFilename+n]...)
+		}
+	case typ == EventSocketStats:
+		ev.BytesSent = binary.LittleEndian.Uint64(data[offNetBytesSent:])
+		ev.BytesReceived = binary.LittleEndian.Uint64(data[offNetBytesReceived:])
+	default:
+		decodeFilename(&ev, data)
+	}
+	switch {
+	case isFSMutation(typ):
+		decodeFS(&ev, data)
+		ev.PathTruncated = ev.PathTruncated || wireFlags&wireTargetTruncated != 0
+	case typ.IsSecurity():
+		decodeSec(&ev, data)
+	}
+	return ev, nil
+}
+
+func decodeCommon(ev *Event, data []byte) {
+	ev.PID = binary.LittleEndian.Uint32(data[offPID:])
+	ev.PPID = binary.LittleEndian.Uint32(data[offPPID:])
+	ev.DirFD = int32(binary.LittleEndian.Uint32(data[offDirFD:]))
+	ev.Flags = binary.LittleEndian.Uint32(data[offFlags:])
+	ev.CgroupID = binary.LittleEndian.Uint64(data[offCgroupID:])
+	ev.Timestamp = bootTimeToWall(binary.LittleEndian.Uint64(data[offTimestamp:]))
+	ev.Port = binary.LittleEndian.Uint16(data[offPort:])
+	ev.AddrFamily = data[offAddrFamily]
+	ev.Proto = data[offProto]
+	copy(ev.Addr[:], data[offAddr:offAddr+len(ev.Addr)])
+	ev.Comm = trimNull(data[offComm : offComm+commMax])
+}
+
+func decodeFilename(ev *Event, data []byte) {
+	ev.Path = trimNull(data[offFilename:eventSize])
+}
+
+func decodeFS(ev *Event, data []byte) {
+	ev.UID = binary.LittleEndian.Uint32(data[offFSUID:])
+	ev.GID = binary.LittleEndian.Uint32(data[offFSGID:])
+	ev.TargetDirFD = int32(binary.LittleEndian.Uint32(data[offFSTargetDirFD:]))
+	ev.Target = trimNull(data[offFSTarget:fsEventSize])
+}
+
+func decodeSec(ev *Event, data []byte) {
+	ev.Op = binary.LittleEndian.Uint32(data[offSecOp:])
+	for i := range ev.Args {
+		ev.Args[i] = binary.LittleEndian.Uint64(data[offSecArgs+8*i:])
+	}
+	ev.Target = trimNull(data[offSecTarget:secEventSize])
+}
+
+func trimNull(b []byte) string {
+	idx := bytes.IndexByte(b, 0)
+	if idx == -1 {
+		idx = len(b)
+	}
+	return string(b[:idx])
+}
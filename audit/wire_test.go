@@ -0,0 +1,256 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newRecord returns a zeroed record of the given size with a current header.
+func newRecord(t EventType, size int) []byte {
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint16(data[offType:], uint16(t))
+	binary.LittleEndian.PutUint16(data[offVersion:], wireVersion)
+	binary.LittleEndian.PutUint32(data[offLength:], uint32(size))
+	return data
+}
+
+type cField struct {
+	offset int
+	size   int
+}
+
+type cStruct struct {
+	fields map[string]cField
+	size   int
+	align  int
+}
+
+type cHeader struct {
+	defines map[string]int
+	enum    map[string]int
+	structs map[string]cStruct
+}
+
+var (
+	defineRe = regexp.MustCompile(`^#define\s+(\w+)\s+(\d+)\s*$`)
+	enumRe   = regexp.MustCompile(`^(\w+)\s*=\s*(\d+),?$`)
+	fieldRe  = regexp.MustCompile(`^(struct\s+\w+|\w+)\s+(\w+)(?:\[(\w+)\])?;$`)
+)
+
+var cScalars = map[string]int{"__u8": 1, "char": 1, "__u16": 2, "__u32": 4, "__s32": 4, "__u64": 8}
+
+// parseCHeader understands the subset of C used by events.h: integer
+// #defines, one enum and structs of fixed-width scalars, arrays and nested
+// structs laid out with natural alignment.
+func parseCHeader(t *testing.T, path string) cHeader {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	h := cHeader{defines: map[string]int{}, enum: map[string]int{}, structs: map[string]cStruct{}}
+	var (
+		inEnum    bool
+		inComment bool
+		current   string
+		cur       cStruct
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inComment {
+			if strings.Contains(line, "*/") {
+				inComment = false
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "/*") {
+			inComment = !strings.Contains(line, "*/")
+			continue
+		}
+		switch {
+		case line == "":
+		case defineRe.MatchString(line):
+			m := defineRe.FindStringSubmatch(line)
+			h.defines[m[1]], _ = strconv.Atoi(m[2])
+		case strings.HasPrefix(line, "enum "):
+			inEnum = true
+		case inEnum && line == "};":
+			inEnum = false
+		case inEnum:
+			m := enumRe.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("unparsed enum line %q", line)
+			}
+			h.enum[m[1]], _ = strconv.Atoi(m[2])
+		case strings.HasPrefix(line, "struct ") && strings.HasSuffix(line, "{"):
+			current = strings.TrimSuffix(strings.TrimPrefix(line, "struct "), " {")
+			cur = cStruct{fields: map[string]cField{}, align: 1}
+		case current != "" && line == "};":
+			cur.size = alignUp(cur.size, cur.align)
+			h.structs[current] = cur
+			current = ""
+		case current != "":
+			m := fieldRe.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("unparsed field in struct %s: %q", current, line)
+			}
+			size, align := 0, 0
+			if elem, ok := cScalars[m[1]]; ok {
+				size, align = elem, elem
+			} else if nested, ok := h.structs[strings.TrimPrefix(m[1], "struct ")]; ok {
+				size, align = nested.size, nested.align
+			} else {
+				t.Fatalf("unknown type %q in struct %s", m[1], current)
+			}
+			if m[3] != "" {
+				n, err := strconv.Atoi(m[3])
+				if err != nil {
+					var ok bool
+					if n, ok = h.defines[m[3]]; !ok {
+						t.Fatalf("unknown array length %q", m[3])
+					}
+				}
+				size *= n
+			}
+			off := alignUp(cur.size, align)
+			cur.fields[m[2]] = cField{offset: off, size: size}
+			cur.size = off + size
+			if align > cur.align {
+				cur.align = align
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+func TestWireLayoutMatchesEventsHeader(t *testing.T) {
+	h := parseCHeader(t, "../ebpf/common/events.h")
+
+	if h.defines["WIRE_VERSION"] != wireVersion {
+		t.Errorf("WIRE_VERSION = %d, wireVersion = %d", h.defines["WIRE_VERSION"], wireVersion)
+	}
+	for name, want := range map[string]int{
+		"PATH_MAX":              pathMax,
+		"COMM_MAX":              commMax,
+		"EVENT_HEADER_SIZE":     headerSize,
+		"PATH_MAX_FULL":         fullPathMax,
+		"WIRE_PATH_TRUNCATED":   wirePathTruncated,
+		"WIRE_TARGET_TRUNCATED": wireTargetTruncated,
+	} {
+		if h.defines[name] != want {
+			t.Errorf("%s = %d, Go uses %d", name, h.defines[name], want)
+		}
+	}
+
+	offsets := map[string]int{
+		"wire_header.type":         offType,
+		"wire_header.version":      offVersion,
+		"wire_header.length":       offLength,
+		"event.pid":                offPID,
+		"event.ppid":               offPPID,
+		"event.dirfd":              offDirFD,
+		"event.flags":              offFlags,
+		"event.cgroup_id":          offCgroupID,
+		"event.ts_ns":              offTimestamp,
+		"event.port":               offPort,
+		"event.addr_family":        offAddrFamily,
+		"event.proto":              offProto,
+		"event.wire_flags":         offWireFlags,
+		"event.addr":               offAddr,
+		"event.comm":               offComm,
+		"event.filename":           offFilename,
+		"fs_event.uid":             offFSUID,
+		"fs_event.gid":             offFSGID,
+		"fs_event.target_dirfd":    offFSTargetDirFD,
+		"fs_event.target":          offFSTarget,
+		"net_event.bytes_sent":     offNetBytesSent,
+		"net_event.bytes_received": offNetBytesReceived,
+		"sec_event.op":             offSecOp,
+		"sec_event.args":           offSecArgs,
+		"sec_event.target":         offSecTarget,
+		"open_event.filename":      headerSize,
+	}
+	for name, want := range offsets {
+		parts := strings.SplitN(name, ".", 2)
+		field, ok := h.structs[parts[0]].fields[parts[1]]
+		if !ok {
+			t.Errorf("%s not declared in events.h", name)
+			continue
+		}
+		if field.offset != want {
+			t.Errorf("offsetof(%s) = %d, Go uses %d", name, field.offset, want)
+		}
+	}
+	sizes := map[string]int{
+		"wire_header": wireHeaderSize,
+		"event":       eventSize,
+		"fs_event":    fsEventSize,
+		"net_event":   netEventSize,
+		"sec_event":   secEventSize,
+	}
+	for name, want := range sizes {
+		if got := h.structs[name].size; got != want {
+			t.Errorf("sizeof(struct %s) = %d, Go uses %d", name, got, want)
+		}
+	}
+	if got := h.structs["event"].fields["addr"].size; got != len(Event{}.Addr) {
+		t.Errorf("event.addr is %d bytes, Event.Addr holds %d", got, len(Event{}.Addr))
+	}
+
+	if len(h.enum) == 0 {
+		t.Fatal("enum event_type not found")
+	}
+	for name, value := range h.enum {
+		typ := EventType(value)
+		if minRecordSize(typ) == 0 {
+			t.Errorf("%s = %d is not decoded", name, value)
+		}
+		if want := "EVENT_" + strings.ToUpper(typ.String()); want != name {
+			t.Errorf("%s = %d, Go names it %s", name, value, want)
+		}
+	}
+	for typ := EventType(1); minRecordSize(typ) != 0; typ++ {
+		if _, ok := h.enum["EVENT_"+strings.ToUpper(typ.String())]; !ok {
+			t.Errorf("Go event type %d (%s) missing from events.h", typ, typ)
+		}
+	}
+}
+
+func TestParseRejectsBadHeaders(t *testing.T) {
+	data := newRecord(EventExec, eventSize)
+	binary.LittleEndian.PutUint16(data[offVersion:], wireVersion+1)
+	if _, err := parseEvent(data); err == nil || !strings.Contains(err.Error(), "wire version") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+
+	data = newRecord(EventExec, eventSize)
+	binary.LittleEndian.PutUint32(data[offLength:], eventSize+8)
+	if _, err := parseEvent(data); err == nil {
+		t.Fatal("expected length error")
+	}
+
+	if _, err := parseEvent(newRecord(EventType(99), eventSize)); err == nil {
+		t.Fatal("expected unknown type error")
+	}
+
+	// Trailing ring buffer padding beyond length is ignored.
+	data = append(newRecord(EventExec, eventSize), make([]byte, 8)...)
+	if _, err := parseEvent(data); err != nil {
+		t.Fatalf("parse padded record: %v", err)
+	}
+}
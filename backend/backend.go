@@ -9,8 +9,13 @@ type (
 	ExecutionHandle      = execution.ExecutionHandle
 	ExecutionResult      = execution.ExecutionResult
 	BackendProfilingInfo = execution.BackendProfilingInfo
+	ContextBackend       = execution.ContextBackend
 	ExtraErrorProvider   = execution.ExtraErrorProvider
 	OutputProvider       = execution.OutputProvider
+	InputProvider        = execution.InputProvider
+	TerminalResizer      = execution.TerminalResizer
+	ProcessKiller        = execution.ProcessKiller
+	PTYConfig            = execution.PTYConfig
 	ProcessStateProvider = execution.ProcessStateProvider
 	MetadataProvider     = execution.MetadataProvider
 )
@@ -3,6 +3,8 @@ package firecracker
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -44,9 +46,19 @@ type vmHandle struct {
 	workspacePath string
 	fcProcess     *exec.Cmd
 	startTime     time.Time
+	stdinHash     string
 }
 
 func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle, error) {
+	return b.StartContext(context.Background(), spec)
+}
+
+// StartContext bounds VM boot and API configuration by ctx.
+func (b *Backend) StartContext(ctx context.Context, spec execution.ExecutionSpec) (execution.ExecutionHandle, error) {
+	if spec.PTY != nil {
+		return execution.ExecutionHandle{}, fmt.Errorf("pty unsupported by firecracker backend")
+	}
+
 	// Create unique workspace for this execution
 	workDir, err := os.MkdirTemp("", "glasshouse-workspace-")
 	if err != nil {
@@ -65,6 +77,20 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 		return execution.ExecutionHandle{}, fmt.Errorf("write code: %w", err)
 	}
 
+	// Stdin is staged as a file; guest init feeds it to the workload.
+	stdin, err := readStdin(spec)
+	if err != nil {
+		return execution.ExecutionHandle{}, fmt.Errorf("read stdin: %w", err)
+	}
+	var stdinHash string
+	if stdin != nil {
+		if err := os.WriteFile(filepath.Join(pendingDir, "stdin"), stdin, 0644); err != nil {
+			return execution.ExecutionHandle{}, fmt.Errorf("write stdin: %w", err)
+		}
+		sum := sha256.Sum256(stdin)
+		stdinHash = hex.EncodeToString(sum[:])
+	}
+
 	// Create workspace ext4 image
 	workspaceImg := filepath.Join(workDir, "workspace.ext4")
 	if err := createWorkspaceImage(workspaceImg, workDir); err != nil {
@@ -89,7 +115,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	}
 
 	// Wait for socket to be ready
-	if err := waitForSocket(socketPath, 5*time.Second); err != nil {
+	if err := waitForSocket(ctx, socketPath, 5*time.Second); err != nil {
 		fcCmd.Process.Kill()
 		return execution.ExecutionHandle{}, fmt.Errorf("wait for socket: %w", err)
 	}
@@ -98,7 +124,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	client := newUnixClient(socketPath)
 
 	// Machine config
-	if err := apiPut(client, socketPath, "/machine-config", map[string]interface{}{
+	if err := apiPut(ctx, client, socketPath, "/machine-config", map[string]interface{}{
 		"vcpu_count":   1,
 		"mem_size_mib": 256,
 		"smt":          false,
@@ -108,7 +134,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	}
 
 	// Boot source
-	if err := apiPut(client, socketPath, "/boot-source", map[string]interface{}{
+	if err := apiPut(ctx, client, socketPath, "/boot-source", map[string]interface{}{
 		"kernel_image_path": b.cfg.KernelImagePath,
 		"boot_args":         "console=ttyS0 reboot=k panic=1 pci=off root=/dev/vda rw init=/sbin/init",
 	}); err != nil {
@@ -117,7 +143,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	}
 
 	// Root drive (rootfs)
-	if err := apiPut(client, socketPath, "/drives/rootfs", map[string]interface{}{
+	if err := apiPut(ctx, client, socketPath, "/drives/rootfs", map[string]interface{}{
 		"drive_id":       "rootfs",
 		"path_on_host":   b.cfg.RootFSPath,
 		"is_root_device": true,
@@ -128,7 +154,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	}
 
 	// Workspace drive
-	if err := apiPut(client, socketPath, "/drives/workspace", map[string]interface{}{
+	if err := apiPut(ctx, client, socketPath, "/drives/workspace", map[string]interface{}{
 		"drive_id":       "workspace",
 		"path_on_host":   workspaceImg,
 		"is_root_device": false,
@@ -139,7 +165,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	}
 
 	// Start VM
-	if err := apiPut(client, socketPath, "/actions", map[string]interface{}{
+	if err := apiPut(ctx, client, socketPath, "/actions", map[string]interface{}{
 		"action_type": "InstanceStart",
 	}); err != nil {
 		fcCmd.Process.Kill()
@@ -151,6 +177,7 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 		workspacePath: workDir,
 		fcProcess:     fcCmd,
 		startTime:     time.Now(),
+		stdinHash:     stdinHash,
 	}
 
 	return execution.ExecutionHandle{
@@ -173,6 +200,7 @@ func (b *Backend) Wait(h execution.ExecutionHandle) (execution.ExecutionResult,
 		Handle:      h,
 		StartedAt:   vm.startTime,
 		CompletedAt: completedAt,
+		StdinHash:   vm.stdinHash,
 	}
 
 	// Read result from workspace
@@ -192,6 +220,14 @@ func (b *Backend) Wait(h execution.ExecutionHandle) (execution.ExecutionResult,
 	return result, nil
 }
 
+// Signal always fails: a signal to the firecracker process would stop the
+// VMM, not the guest workload, and there is no channel to forward it into
+// the guest. The engine then kills the VM and records a forced stop.
+func (b *Backend) Signal(h execution.ExecutionHandle, sig os.Signal) error {
+	_ = h
+	return fmt.Errorf("firecracker cannot deliver %v to the guest workload", sig)
+}
+
 func (b *Backend) Kill(h execution.ExecutionHandle) error {
 	vm, ok := h.BackendHandle.(*vmHandle)
 	if !ok {
@@ -258,6 +294,16 @@ func extractCode(args []string) string {
 	return ""
 }
 
+func readStdin(spec execution.ExecutionSpec) ([]byte, error) {
+	if spec.Stdin != nil {
+		return spec.Stdin, nil
+	}
+	if spec.StdinReader == nil {
+		return nil, nil
+	}
+	return io.ReadAll(spec.StdinReader)
+}
+
 func createWorkspaceImage(path string, sourceDir string) error {
 	// Create 64MB ext4 image
 	f, err := os.Create(path)
@@ -323,9 +369,12 @@ func readResultFromImage(imagePath string) (*GuestResult, error) {
 	return &result, nil
 }
 
-func waitForSocket(path string, timeout time.Duration) error {
+func waitForSocket(ctx context.Context, path string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if _, err := os.Stat(path); err == nil {
 			// Try to connect
 			conn, err := net.Dial("unix", path)
@@ -349,13 +398,13 @@ func newUnixClient(socketPath string) *http.Client {
 	}
 }
 
-func apiPut(client *http.Client, socketPath, path string, body interface{}) error {
+func apiPut(ctx context.Context, client *http.Client, socketPath, path string, body interface{}) error {
 	data, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("PUT", "http://localhost"+path, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "PUT", "http://localhost"+path, bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
@@ -376,6 +425,7 @@ func apiPut(client *http.Client, socketPath, path string, body interface{}) erro
 }
 
 var _ execution.ExecutionBackend = (*Backend)(nil)
+var _ execution.ContextBackend = (*Backend)(nil)
 var _ execution.MetadataProvider = (*Backend)(nil)
 
 // Ensure syscall is used (for shutdown detection)
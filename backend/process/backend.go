@@ -3,8 +3,11 @@ package process
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"os/exec"
@@ -18,6 +21,14 @@ import (
 	"glasshouse/core/receipt"
 )
 
+// stdinWaitDelay bounds how long Wait waits for the stdin copy to stop after
+// the process exits, when its source never reaches EOF (for example an
+// interactive terminal).
+const stdinWaitDelay = 250 * time.Millisecond
+
+// ptyDrainTimeout bounds how long Wait drains PTY output after the process exits.
+const ptyDrainTimeout = 2 * time.Second
+
 type Options struct {
 	Guest  bool
 	Stdout io.Writer
@@ -31,6 +42,9 @@ type Backend struct {
 	handleSignals bool
 	stdoutBuf     bytes.Buffer
 	stderrBuf     bytes.Buffer
+	stdin         *stdinCopy
+	ptyMaster     *os.File
+	ptyDone       chan struct{}
 
 	reapMu       sync.Mutex
 	mainReaped   bool
@@ -58,6 +72,15 @@ func (b *Backend) Prepare(ctx context.Context) error {
 	return fmt.Errorf(strings.Join(errs, "; "))
 }
 
+// StartContext refuses to start once ctx is done; deadlines while running are
+// enforced by the engine through Signal and Kill.
+func (b *Backend) StartContext(ctx context.Context, spec execution.ExecutionSpec) (execution.ExecutionHandle, error) {
+	if err := ctx.Err(); err != nil {
+		return execution.ExecutionHandle{}, err
+	}
+	return b.Start(spec)
+}
+
 func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle, error) {
 	if len(spec.Args) == 0 {
 		return execution.ExecutionHandle{}, fmt.Errorf("no command provided")
@@ -86,15 +109,66 @@ func (b *Backend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle
 	if stderr == nil {
 		stderr = os.Stderr
 	}
-	cmd.Stdout = io.MultiWriter(stdout, &b.stdoutBuf)
-	cmd.Stderr = io.MultiWriter(stderr, &b.stderrBuf)
+	stdin := stdinReader(spec)
+	var tty *os.File
+	if spec.PTY != nil {
+		master, slave, err := openPTY()
+		if err != nil {
+			b.signalCancel()
+			return execution.ExecutionHandle{}, fmt.Errorf("open pty: %w", err)
+		}
+		rows, cols := spec.PTY.Rows, spec.PTY.Cols
+		if rows == 0 || cols == 0 {
+			rows, cols = 24, 80
+		}
+		if err := setWinsize(master, rows, cols); err != nil {
+			master.Close()
+			slave.Close()
+			b.signalCancel()
+			return execution.ExecutionHandle{}, fmt.Errorf("set pty size: %w", err)
+		}
+		cmd.Stdin = slave
+		cmd.Stdout = slave
+		cmd.Stderr = slave
+		cmd.SysProcAttr = ptySysProcAttr()
+		b.ptyMaster = master
+		tty = slave
+	} else {
+		cmd.Stdout = io.MultiWriter(stdout, &b.stdoutBuf)
+		cmd.Stderr = io.MultiWriter(stderr, &b.stderrBuf)
+		cmd.SysProcAttr = groupSysProcAttr()
+	}
+	var stdinPipe io.WriteCloser
+	if stdin != nil && tty == nil {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			b.signalCancel()
+			return execution.ExecutionHandle{}, fmt.Errorf("stdin pipe: %w", err)
+		}
+		stdinPipe = pipe
+	}
 
 	if err := cmd.Start(); err != nil {
+		if tty != nil {
+			tty.Close()
+			b.ptyMaster.Close()
+			b.ptyMaster = nil
+		}
 		b.signalCancel()
 		return execution.ExecutionHandle{}, err
 	}
 	b.cmd = cmd
 
+	if tty != nil {
+		// The child holds its own copy of the terminal; keeping ours open would
+		// prevent the master from reporting EOF once the child exits.
+		tty.Close()
+		b.startPTYCopy(stdout, stdin)
+	} else if stdinPipe != nil {
+		// Wait closes the pipe once the process exits, which ends the copy.
+		b.stdin = startStdinCopy(stdinPipe, stdin, func() { stdinPipe.Close() })
+	}
+
 	if b.handleSignals {
 		startGuestSignalHandler(signalCtx, cmd.Process, &b.reapMu, &b.mainReaped, &b.mainStatus, &b.shutdownSign)
 	}
@@ -113,6 +187,13 @@ func (b *Backend) Wait(h execution.ExecutionHandle) (execution.ExecutionResult,
 	}
 
 	waitErr := b.cmd.Wait()
+	if b.ptyDone != nil {
+		select {
+		case <-b.ptyDone:
+		case <-time.After(ptyDrainTimeout):
+		}
+	}
+	stdinHash := b.StdinHash()
 	exitCode := 0
 	if waitErr != nil {
 		exitCode = exitCodeForError(waitErr)
@@ -131,27 +212,65 @@ func (b *Backend) Wait(h execution.ExecutionHandle) (execution.ExecutionResult,
 		Handle:      h,
 		ExitCode:    exitCode,
 		Err:         waitErr,
+		StdinHash:   stdinHash,
 		StartedAt:   time.Now(), // placeholder; engine stamps authoritative time
 		CompletedAt: time.Now(),
 	}, waitErr
 }
 
+// Signal delivers sig to the execution's process group, which the PTY
+// session or Setpgid made the root process lead, so background children
+// are signalled too.
+func (b *Backend) Signal(h execution.ExecutionHandle, sig os.Signal) error {
+	_ = h
+	if b.cmd == nil || b.cmd.Process == nil {
+		return fmt.Errorf("backend not started")
+	}
+	return signalGroup(b.cmd.Process.Pid, sig)
+}
+
+// Kill sends SIGKILL to the execution's process group.
 func (b *Backend) Kill(h execution.ExecutionHandle) error {
 	_ = h
 	if b.cmd != nil && b.cmd.Process != nil {
-		return b.cmd.Process.Kill()
+		return signalGroup(b.cmd.Process.Pid, syscall.SIGKILL)
 	}
 	return nil
 }
 
+// KillProcess kills a single process of the execution. PIDs outside the
+// execution's process tree, such as a reused PID, are refused.
+func (b *Backend) KillProcess(h execution.ExecutionHandle, pid uint32) error {
+	_ = h
+	if b.cmd == nil || b.cmd.Process == nil {
+		return fmt.Errorf("backend not started")
+	}
+	if int(pid) == b.cmd.Process.Pid {
+		return b.cmd.Process.Kill()
+	}
+	return killDescendant(b.cmd.Process.Pid, int(pid))
+}
+
 func (b *Backend) Cleanup(h execution.ExecutionHandle) error {
 	_ = h
 	if b.signalCancel != nil {
 		b.signalCancel()
 	}
+	if b.ptyMaster != nil {
+		b.ptyMaster.Close()
+	}
 	return nil
 }
 
+// Resize updates the window size of the execution's PTY.
+func (b *Backend) Resize(h execution.ExecutionHandle, rows, cols uint16) error {
+	_ = h
+	if b.ptyMaster == nil {
+		return fmt.Errorf("execution has no pty")
+	}
+	return setWinsize(b.ptyMaster, rows, cols)
+}
+
 func (b *Backend) ProfilingInfo(h execution.ExecutionHandle) execution.BackendProfilingInfo {
 	rootPID := 0
 	if b.cmd != nil && b.cmd.Process != nil {
@@ -188,6 +307,93 @@ func (b *Backend) ProcessState() *os.ProcessState {
 func (b *Backend) Stdout() []byte { return b.stdoutBuf.Bytes() }
 func (b *Backend) Stderr() []byte { return b.stderrBuf.Bytes() }
 
+// StdinHash returns the SHA-256 of the stdin bytes delivered to the execution.
+// It is fixed once the process has exited and the stdin copy has stopped.
+func (b *Backend) StdinHash() string {
+	if b.stdin == nil {
+		return ""
+	}
+	return b.stdin.seal()
+}
+
+// stdinCopy feeds stdin to the execution and hashes the bytes it accepted.
+type stdinCopy struct {
+	done chan struct{}
+
+	mu     sync.Mutex
+	hash   hash.Hash
+	sum    string
+	sealed bool
+}
+
+// startStdinCopy copies src to dst and calls eof once src is exhausted.
+func startStdinCopy(dst io.Writer, src io.Reader, eof func()) *stdinCopy {
+	c := &stdinCopy{done: make(chan struct{}), hash: sha256.New()}
+	go func() {
+		defer close(c.done)
+		if _, err := io.Copy(io.MultiWriter(dst, c), src); err != nil {
+			return
+		}
+		eof()
+	}()
+	return c
+}
+
+func (c *stdinCopy) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.sealed {
+		c.hash.Write(p)
+	}
+	return len(p), nil
+}
+
+// seal waits up to stdinWaitDelay for the copy to stop and fixes the hash.
+// A copy still blocked on its source keeps running but no longer counts.
+func (c *stdinCopy) seal() string {
+	c.mu.Lock()
+	sealed := c.sealed
+	c.mu.Unlock()
+	if sealed {
+		return c.sum
+	}
+	select {
+	case <-c.done:
+	case <-time.After(stdinWaitDelay):
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.sealed {
+		c.sealed = true
+		c.sum = hex.EncodeToString(c.hash.Sum(nil))
+	}
+	return c.sum
+}
+
+func (b *Backend) startPTYCopy(stdout io.Writer, stdin io.Reader) {
+	master := b.ptyMaster
+	b.ptyDone = make(chan struct{})
+	go func() {
+		defer close(b.ptyDone)
+		// Reads fail with EIO once the last terminal descriptor is closed.
+		_, _ = io.Copy(io.MultiWriter(stdout, &b.stdoutBuf), master)
+	}()
+	if stdin == nil {
+		return
+	}
+	b.stdin = startStdinCopy(master, stdin, func() {
+		// Signal end of input to the line discipline.
+		_, _ = master.Write([]byte{4})
+	})
+}
+
+func stdinReader(spec execution.ExecutionSpec) io.Reader {
+	if spec.Stdin != nil {
+		return bytes.NewReader(spec.Stdin)
+	}
+	return spec.StdinReader
+}
+
 func (b *Backend) Metadata() receipt.ExecutionInfo {
 	isolation := "none"
 	if b.opts.Guest {
@@ -231,7 +437,10 @@ func isNoChildErr(err error) bool {
 }
 
 var _ execution.ExecutionBackend = (*Backend)(nil)
+var _ execution.ContextBackend = (*Backend)(nil)
 var _ execution.OutputProvider = (*Backend)(nil)
+var _ execution.InputProvider = (*Backend)(nil)
+var _ execution.TerminalResizer = (*Backend)(nil)
 var _ execution.ExtraErrorProvider = (*Backend)(nil)
 var _ execution.ProcessStateProvider = (*Backend)(nil)
 var _ execution.MetadataProvider = (*Backend)(nil)
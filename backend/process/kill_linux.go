@@ -0,0 +1,71 @@
+//go:build linux
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// groupSysProcAttr starts the execution in its own process group, so
+// signalGroup also reaches the processes it starts.
+func groupSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup signals the process group led by pid.
+func signalGroup(pid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %v", sig)
+	}
+	return unix.Kill(-pid, s)
+}
+
+// killDescendant kills pid if it descends from root. The process is pinned
+// with a pidfd before its ancestry is checked, so a PID reused after the
+// check cannot be signalled.
+func killDescendant(root, pid int) error {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return fmt.Errorf("open pid %d: %w", pid, err)
+	}
+	defer unix.Close(fd)
+	if !descendsFrom(root, pid) {
+		return fmt.Errorf("pid %d is not part of the execution", pid)
+	}
+	return unix.PidfdSendSignal(fd, unix.SIGKILL, nil, 0)
+}
+
+func descendsFrom(root, pid int) bool {
+	for pid > 1 {
+		ppid, err := parentPID(pid)
+		if err != nil {
+			return false
+		}
+		if ppid == root {
+			return true
+		}
+		pid = ppid
+	}
+	return false
+}
+
+func parentPID(pid int) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The comm field may contain spaces; fields after ')' are fixed.
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("short stat for pid %d", pid)
+	}
+	return strconv.Atoi(fields[1])
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func killDescendant(root, pid int) error {
+	_ = root
+	return fmt.Errorf("cannot verify pid %d belongs to the execution on this platform", pid)
+}
+
+func groupSysProcAttr() *syscall.SysProcAttr { return nil }
+
+// signalGroup only reaches pid itself on this platform.
+func signalGroup(pid int, sig os.Signal) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Signal(sig)
+}
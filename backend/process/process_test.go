@@ -1,13 +1,20 @@
 package process_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"glasshouse/backend/process"
 	"glasshouse/core/execution"
@@ -132,3 +139,191 @@ func TestProcessBackendCapturesStderr(t *testing.T) {
 		t.Fatal("expected stderr output")
 	}
 }
+
+func TestProcessBackendFeedsStdin(t *testing.T) {
+	requireCommand(t, "/bin/cat")
+
+	ctx := context.Background()
+	b := process.New(process.Options{Stdout: io.Discard, Stderr: io.Discard})
+	if err := b.Prepare(ctx); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	input := []byte("from stdin\n")
+	handle, err := b.Start(execution.ExecutionSpec{Args: []string{"/bin/cat"}, Stdin: input})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := b.Wait(handle); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := b.Cleanup(handle); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+
+	if got := string(b.Stdout()); got != string(input) {
+		t.Fatalf("stdout %q, want %q", got, input)
+	}
+	sum := sha256.Sum256(input)
+	if got := b.StdinHash(); got != hex.EncodeToString(sum[:]) {
+		t.Fatalf("stdin hash %q", got)
+	}
+}
+
+func TestProcessBackendStdinHashFixedAtExit(t *testing.T) {
+	requireCommand(t, "/usr/bin/head")
+
+	// A source that never reaches EOF leaves the copy blocked after exit.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := w.WriteString("abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := process.New(process.Options{Stdout: io.Discard, Stderr: io.Discard})
+	handle, err := b.Start(execution.ExecutionSpec{Args: []string{"/usr/bin/head", "-c", "3"}, StdinReader: r})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitRes, err := b.Wait(handle)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	defer b.Cleanup(handle)
+
+	sum := sha256.Sum256([]byte("abc"))
+	want := hex.EncodeToString(sum[:])
+	if waitRes.StdinHash != want {
+		t.Fatalf("wait stdin hash %q, want %q", waitRes.StdinHash, want)
+	}
+	if _, err := w.WriteString("late"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := b.StdinHash(); got != want {
+		t.Fatalf("stdin hash changed after exit: %q", got)
+	}
+}
+
+func TestProcessBackendPTY(t *testing.T) {
+	requireCommand(t, "/bin/sh")
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("missing /dev/ptmx")
+	}
+
+	ctx := context.Background()
+	b := process.New(process.Options{Stdout: io.Discard, Stderr: io.Discard})
+	if err := b.Prepare(ctx); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	handle, err := b.Start(execution.ExecutionSpec{
+		Args: []string{"/bin/sh", "-c", "test -t 0 && stty size"},
+		PTY:  &execution.PTYConfig{Rows: 30, Cols: 100},
+	})
+	if err != nil {
+		t.Skipf("pty unavailable: %v", err)
+	}
+	waitRes, err := b.Wait(handle)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := b.Cleanup(handle); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if waitRes.ExitCode != 0 {
+		t.Fatalf("exit code %d, stdout %q", waitRes.ExitCode, b.Stdout())
+	}
+	if !strings.Contains(string(b.Stdout()), "30 100") {
+		t.Fatalf("unexpected pty size output %q", b.Stdout())
+	}
+}
+
+func TestProcessBackendKillProcessStaysInTree(t *testing.T) {
+	requireCommand(t, "/bin/sh")
+	requireCommand(t, "/bin/sleep")
+
+	outsider := exec.Command("/bin/sleep", "30")
+	if err := outsider.Start(); err != nil {
+		t.Fatalf("start outsider: %v", err)
+	}
+	defer outsider.Process.Kill()
+
+	b := process.New(process.Options{Stdout: io.Discard, Stderr: io.Discard})
+	if err := b.Prepare(context.Background()); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	handle, err := b.Start(execution.ExecutionSpec{Args: []string{"/bin/sh", "-c", "/bin/sleep 30 & echo $! > " + pidFile + "; wait"}})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer b.Cleanup(handle)
+	defer b.Kill(handle)
+
+	if err := b.KillProcess(handle, uint32(outsider.Process.Pid)); err == nil {
+		t.Fatal("killed a process outside the execution")
+	}
+	if err := outsider.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("outsider was signalled: %v", err)
+	}
+
+	var child int
+	for deadline := time.Now().Add(5 * time.Second); child == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("child pid not written")
+		}
+		data, _ := os.ReadFile(pidFile)
+		child, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if err := b.KillProcess(handle, uint32(child)); err != nil {
+		t.Fatalf("KillProcess(child): %v", err)
+	}
+	if _, err := b.Wait(handle); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestProcessBackendDeadlineKillsBackgroundChildren(t *testing.T) {
+	requireCommand(t, "/bin/sh")
+	requireCommand(t, "/bin/sleep")
+
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	engine := execution.Engine{
+		Backend:   process.New(process.Options{Stdout: io.Discard, Stderr: io.Discard}),
+		TermGrace: 100 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	result, _ := engine.Run(ctx, execution.ExecutionSpec{
+		Args: []string{"/bin/sh", "-c", "/bin/sleep 100 & echo $! > " + pidFile + "; wait"},
+	})
+	if result.Termination == nil {
+		t.Fatal("execution was not terminated")
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("child pid not written: %v", err)
+	}
+	child, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	for deadline := time.Now().Add(5 * time.Second); running(child); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			syscall.Kill(child, syscall.SIGKILL)
+			t.Fatalf("background sleep %d survived the deadline", child)
+		}
+	}
+}
+
+// running reports whether pid exists and is not a zombie waiting for a
+// reaper.
+func running(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("pty unsupported on this platform")
+}
+
+func setWinsize(f *os.File, rows, cols uint16) error {
+	return fmt.Errorf("pty unsupported on this platform")
+}
+
+func ptySysProcAttr() *syscall.SysProcAttr { return nil }
@@ -11,9 +11,14 @@ import (
 	"glasshouse/audit"
 	"glasshouse/core/agent"
 	"glasshouse/core/profiling/ebpf"
+	"glasshouse/core/signing"
+	"glasshouse/core/translog"
 )
 
 func main() {
+	if len(os.Args) >= 2 && os.Args[1] == "unpin" {
+		os.Exit(unpin(os.Args[2:]))
+	}
 	if len(os.Args) < 2 || os.Args[1] != "start" {
 		usage()
 		os.Exit(2)
@@ -23,18 +28,50 @@ func main() {
 	controlSocket := flags.String("control-socket", "/tmp/glasshouse-agent.sock", "Unix socket path for control commands")
 	receiptDir := flags.String("receipt-dir", "", "Directory for emitted receipts (default stdout)")
 	bpfDir := flags.String("bpf-dir", "", "Directory containing eBPF objects")
+	pin := flags.Bool("pin", false, "Pin eBPF programs and maps so a restarted agent resumes them")
+	pinDir := flags.String("pin-dir", audit.DefaultPinPath, "bpffs directory for pinned eBPF objects")
+	stateFile := flags.String("state-file", "", "Checkpoint open executions to this file and restore them on start")
+	signKey := flags.String("sign-key", "", "Ed25519 private key (PKCS#8 PEM) used to sign receipts")
+	logDir := flags.String("log-dir", "", "Append emitted receipts to the transparency log in this directory")
+	headInterval := flags.Duration("head-interval", translog.DefaultHeadInterval, "How often to sign a log tree head (requires --sign-key)")
+	checkpointInterval := flags.Duration("checkpoint-interval", agent.DefaultCheckpointInterval, "How often to write --state-file")
 	if err := flags.Parse(os.Args[2:]); err != nil {
 		fmt.Fprintln(os.Stderr, "glasshouse-agent:", err)
 		os.Exit(2)
 	}
 
 	cfg := agent.Config{
-		ReceiptDir:    *receiptDir,
-		Observation:   "host",
-		ControlSocket: *controlSocket,
+		ReceiptDir:         *receiptDir,
+		Observation:        "host",
+		ControlSocket:      *controlSocket,
+		StateFile:          *stateFile,
+		CheckpointInterval: *checkpointInterval,
+	}
+
+	if *signKey != "" {
+		signer, err := signing.LoadSigner(*signKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse-agent:", err)
+			os.Exit(2)
+		}
+		cfg.Signer = signer
+	}
+	if *logDir != "" {
+		log, err := translog.Open(*logDir, cfg.Signer)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse-agent:", err)
+			os.Exit(2)
+		}
+		defer log.Close()
+		cfg.Log = log
+		cfg.HeadInterval = *headInterval
 	}
 
-	profiler := ebpf.NewController(ebpfConfigFromEnv(*bpfDir))
+	ebpfCfg := ebpfConfigFromEnv(*bpfDir)
+	if *pin {
+		ebpfCfg.PinPath = *pinDir
+	}
+	profiler := ebpf.NewController(ebpfCfg)
 	agent := agent.New(cfg, profiler)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -58,6 +95,23 @@ func ebpfConfigFromEnv(dir string) audit.Config {
 	return cfg
 }
 
+// unpin detaches and removes pinned eBPF objects, e.g. before upgrading
+// them or to stop tracing after the agent has exited.
+func unpin(args []string) int {
+	flags := flag.NewFlagSet("unpin", flag.ExitOnError)
+	pinDir := flags.String("pin-dir", audit.DefaultPinPath, "bpffs directory for pinned eBPF objects")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse-agent:", err)
+		return 2
+	}
+	if err := audit.Unpin(*pinDir); err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse-agent:", err)
+		return 1
+	}
+	return 0
+}
+
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: glasshouse-agent start [--control-socket path] [--receipt-dir dir] [--bpf-dir dir]")
+	fmt.Fprintln(os.Stderr, "usage: glasshouse-agent start [--control-socket path] [--receipt-dir dir] [--bpf-dir dir] [--pin] [--pin-dir dir] [--state-file path] [--checkpoint-interval d] [--sign-key file] [--log-dir dir] [--head-interval d]")
+	fmt.Fprintln(os.Stderr, "       glasshouse-agent unpin [--pin-dir dir]")
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+
+	"glasshouse/core/translog"
+)
+
+// logHeadHandler serves the latest signed tree head.
+func (s *Server) logHeadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.logEnabled(w) {
+		return
+	}
+	head, ok, err := s.log.LatestHead()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeError(w, "no signed tree head yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, head)
+}
+
+func (s *Server) logEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.logEnabled(w) {
+		return
+	}
+	index, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		writeError(w, "entry index required", http.StatusBadRequest)
+		return
+	}
+	entry, err := s.log.Entry(index)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, entry)
+}
+
+// inclusionHandler serves /log/proof/inclusion?index=N[&size=M]. The tree
+// size defaults to the latest signed head.
+func (s *Server) inclusionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.logEnabled(w) {
+		return
+	}
+	index, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if err != nil {
+		writeError(w, "index required", http.StatusBadRequest)
+		return
+	}
+	size, ok := s.treeSize(w, r.URL.Query().Get("size"))
+	if !ok {
+		return
+	}
+	proof, err := s.log.InclusionProof(index, size)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+// consistencyHandler serves /log/proof/consistency?first=N[&second=M]. The
+// second size defaults to the latest signed head.
+func (s *Server) consistencyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.logEnabled(w) {
+		return
+	}
+	first, err := strconv.ParseUint(r.URL.Query().Get("first"), 10, 64)
+	if err != nil {
+		writeError(w, "first required", http.StatusBadRequest)
+		return
+	}
+	second, ok := s.treeSize(w, r.URL.Query().Get("second"))
+	if !ok {
+		return
+	}
+	proof, err := s.log.ConsistencyProof(first, second)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, proof)
+}
+
+func (s *Server) logEnabled(w http.ResponseWriter) bool {
+	if s.log == nil {
+		writeError(w, "transparency log disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// treeSize parses a size parameter, defaulting to the latest signed head
+// or, without one, the current log size.
+func (s *Server) treeSize(w http.ResponseWriter, param string) (uint64, bool) {
+	if param != "" {
+		size, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			writeError(w, "invalid tree size", http.StatusBadRequest)
+			return 0, false
+		}
+		return size, true
+	}
+	size, err := latestSize(s.log)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	return size, true
+}
+
+func latestSize(l *translog.Log) (uint64, error) {
+	head, ok, err := l.LatestHead()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return l.Size(), nil
+	}
+	return head.Size, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -16,6 +16,8 @@ import (
 
 	"glasshouse/backend/firecracker"
 	"glasshouse/core/execution"
+	"glasshouse/core/signing"
+	"glasshouse/core/translog"
 )
 
 var (
@@ -23,11 +25,16 @@ var (
 	kernelPath = flag.String("kernel", "", "Path to vmlinux.bin")
 	rootfsPath = flag.String("rootfs", "", "Path to rootfs.ext4")
 	receiptDir = flag.String("receipts", "/var/lib/glasshouse/receipts", "Receipt storage directory")
+	signKey    = flag.String("sign-key", "", "Ed25519 private key (PKCS#8 PEM) used to sign receipts")
+	logDir     = flag.String("log", "", "Append receipts to the transparency log in this directory")
+	headEvery  = flag.Duration("head-interval", translog.DefaultHeadInterval, "How often to sign a log tree head (requires -sign-key)")
 )
 
 type Server struct {
 	backend    *firecracker.Backend
 	receiptDir string
+	signer     *signing.Signer
+	log        *translog.Log
 	mu         sync.Mutex
 	execCount  int
 }
@@ -64,10 +71,32 @@ func main() {
 		backend:    firecracker.New(cfg),
 		receiptDir: *receiptDir,
 	}
+	if *signKey != "" {
+		signer, err := signing.LoadSigner(*signKey)
+		if err != nil {
+			log.Fatalf("Load signing key: %v", err)
+		}
+		srv.signer = signer
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *logDir != "" {
+		l, err := translog.Open(*logDir, srv.signer)
+		if err != nil {
+			log.Fatalf("Open log: %v", err)
+		}
+		defer l.Close()
+		srv.log = l
+		go l.Run(ctx, *headEvery, func(err error) { log.Printf("Sign tree head: %v", err) })
+	}
 
 	http.HandleFunc("/health", srv.healthHandler)
 	http.HandleFunc("/run", srv.runHandler)
 	http.HandleFunc("/receipts/", srv.receiptHandler)
+	http.HandleFunc("/log/head", srv.logHeadHandler)
+	http.HandleFunc("/log/entries/", srv.logEntryHandler)
+	http.HandleFunc("/log/proof/inclusion", srv.inclusionHandler)
+	http.HandleFunc("/log/proof/consistency", srv.consistencyHandler)
 
 	httpSrv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", *port),
@@ -81,6 +110,7 @@ func main() {
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
 		log.Println("Shutting down...")
+		cancel()
 		httpSrv.Shutdown(context.Background())
 	}()
 
@@ -88,6 +118,9 @@ func main() {
 	log.Printf("  Kernel: %s", *kernelPath)
 	log.Printf("  Rootfs: %s", *rootfsPath)
 	log.Printf("  Receipts: %s", *receiptDir)
+	if *logDir != "" {
+		log.Printf("  Log: %s", *logDir)
+	}
 	log.Println()
 	log.Println("Test: curl -X POST localhost:8080/run -d '{\"code\": \"print(2+2)\"}'")
 
@@ -103,6 +136,7 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 
 type RunRequest struct {
 	Code    string `json:"code"`
+	Stdin   string `json:"stdin,omitempty"`
 	Timeout int    `json:"timeout,omitempty"` // seconds, default 60
 }
 
@@ -112,7 +146,9 @@ type RunResponse struct {
 	ExitCode   int    `json:"exit_code"`
 	DurationMs int64  `json:"duration_ms"`
 	ReceiptID  string `json:"receipt_id"`
-	Error      string `json:"error,omitempty"`
+	// LogIndex is the receipt's transparency log entry, when logging is on.
+	LogIndex *uint64 `json:"log_index,omitempty"`
+	Error    string  `json:"error,omitempty"`
 }
 
 func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
@@ -147,27 +183,21 @@ func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
 	spec := execution.ExecutionSpec{
 		Args: []string{"python3", "-c", req.Code},
 	}
+	if req.Stdin != "" {
+		spec.Stdin = []byte(req.Stdin)
+	}
 
-	// Prepare backend
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	// Run with the request deadline; the engine escalates SIGTERM to kill on timeout.
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	if err := s.backend.Prepare(ctx); err != nil {
-		writeError(w, "prepare failed: "+err.Error(), http.StatusInternalServerError)
+	engine := execution.Engine{Backend: s.backend}
+	result, err := engine.Run(ctx, spec)
+	if err != nil && result.Handle.ID == "" {
+		writeError(w, "run failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Start execution
-	handle, err := s.backend.Start(spec)
-	if err != nil {
-		writeError(w, "start failed: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer s.backend.Cleanup(handle)
-
-	// Wait for completion
-	result, err := s.backend.Wait(handle)
-
 	// Build response
 	resp := RunResponse{
 		ExitCode:   result.ExitCode,
@@ -176,7 +206,10 @@ func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Read stdout/stderr from guest result
-	if result.Err != nil {
+	switch {
+	case result.Termination != nil:
+		resp.Error = result.Termination.Reason
+	case result.Err != nil:
 		resp.Error = result.Err.Error()
 	}
 
@@ -191,7 +224,13 @@ func (s *Server) runHandler(w http.ResponseWriter, r *http.Request) {
 		"stderr":      resp.Stderr,
 		"error":       resp.Error,
 	}
-	s.saveReceipt(receiptID, receipt)
+	if result.Termination != nil {
+		receipt["termination"] = result.Termination
+	}
+	if result.StdinHash != "" {
+		receipt["stdin_hash"] = result.StdinHash
+	}
+	resp.LogIndex = s.saveReceipt(receiptID, receipt)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -219,16 +258,35 @@ func (s *Server) receiptHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func (s *Server) saveReceipt(id string, receipt map[string]interface{}) {
+// saveReceipt signs, logs and stores a receipt and returns its log index.
+func (s *Server) saveReceipt(id string, receipt map[string]interface{}) *uint64 {
 	path := filepath.Join(s.receiptDir, id+".json")
+	if s.signer != nil {
+		env, err := s.signer.Sign(receipt)
+		if err != nil {
+			log.Printf("Sign receipt: %v", err)
+			return nil
+		}
+		receipt[signing.Field] = env
+	}
+	var index *uint64
+	if s.log != nil {
+		entry, err := s.log.Append(receipt)
+		if err != nil {
+			log.Printf("Log receipt: %v", err)
+		} else {
+			index = &entry.Index
+		}
+	}
 	data, err := json.MarshalIndent(receipt, "", "  ")
 	if err != nil {
 		log.Printf("Marshal receipt: %v", err)
-		return
+		return index
 	}
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		log.Printf("Write receipt: %v", err)
 	}
+	return index
 }
 
 func writeError(w http.ResponseWriter, msg string, code int) {
@@ -140,3 +140,25 @@ func TestCLIRunDoesNotExist(t *testing.T) {
 		t.Fatalf("missing execution metadata")
 	}
 }
+
+func TestCLIDoctorJSON(t *testing.T) {
+	bin := buildCLI(t)
+	out, err := exec.Command(bin, "doctor", "--json").Output()
+	if exitErr, ok := err.(*exec.ExitError); err != nil && (!ok || exitErr.ExitCode() != 1) {
+		t.Fatalf("doctor: %v", err)
+	}
+	var report doctorReport
+	if err := json.Unmarshal(out, &report); err != nil {
+		t.Fatalf("unmarshal report: %v: %s", err, out)
+	}
+	if (err == nil) != (report.Profiler != "") {
+		t.Fatalf("exit status %v disagrees with profiler %q", err, report.Profiler)
+	}
+	var names []string
+	for _, section := range report.Sections {
+		names = append(names, section.Name)
+	}
+	if got := strings.Join(names, ","); got != "ebpf,ptrace,cgroup,namespaces,firecracker" {
+		t.Fatalf("unexpected sections %s", got)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"glasshouse/core/receipt"
+)
+
+// diff compares two receipts and exits 1 when their behavior differs, so it
+// can gate CI on behavioral regressions.
+func diff(args []string) int {
+	var paths []string
+	asJSON := false
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case len(arg) > 1 && arg[0] == '-':
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown diff flag %s\n", arg)
+			usage()
+			return 2
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 2 {
+		usage()
+		return 2
+	}
+	var recs [2]receipt.Receipt
+	for i, path := range paths {
+		rec, err := readReceipt(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 2
+		}
+		recs[i] = rec
+	}
+
+	d := receipt.Diff(recs[0], recs[1])
+	if asJSON {
+		data, err := json.MarshalIndent(struct {
+			Changed bool `json:"changed"`
+			receipt.Difference
+		}{d.Changed(), d}, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 2
+		}
+		fmt.Println(string(data))
+	} else {
+		writeDiff(os.Stdout, d)
+	}
+	if d.Changed() {
+		return 1
+	}
+	return 0
+}
+
+// readReceipt loads a receipt, migrating older versions first.
+func readReceipt(path string) (receipt.Receipt, error) {
+	var rec receipt.Receipt
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rec, err
+	}
+	migrated, err := receipt.Migrate(data)
+	if err != nil {
+		return rec, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := json.Unmarshal(migrated.Data, &rec); err != nil {
+		return rec, fmt.Errorf("%s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func writeDiff(w io.Writer, d receipt.Difference) {
+	sets := []struct {
+		name string
+		set  receipt.SetDiff
+	}{
+		{"processes", d.Processes},
+		{"reads", d.Reads},
+		{"writes", d.Writes},
+		{"deletes", d.Deletes},
+		{"network", d.Network},
+	}
+	for _, s := range sets {
+		if s.set.Empty() {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", s.name)
+		for _, entry := range s.set.Added {
+			fmt.Fprintf(w, "  + %s\n", entry)
+		}
+		for _, entry := range s.set.Removed {
+			fmt.Fprintf(w, "  - %s\n", entry)
+		}
+	}
+	writeDeltas(w, "syscalls", d.Syscalls)
+	if d.ExitCode != nil {
+		fmt.Fprintf(w, "exit_code: %d -> %d\n", d.ExitCode.Before, d.ExitCode.After)
+	}
+	if len(d.Outputs) > 0 {
+		fmt.Fprintln(w, "outputs:")
+		for _, name := range sortedNames(d.Outputs) {
+			change := d.Outputs[name]
+			fmt.Fprintf(w, "  %s: %s -> %s\n", name, orNone(change.Before), orNone(change.After))
+		}
+	}
+	writeDeltas(w, "resources", d.Resources)
+	if !d.Changed() {
+		fmt.Fprintln(w, "no behavioral changes")
+	}
+}
+
+func writeDeltas(w io.Writer, title string, deltas map[string]receipt.Delta) {
+	if len(deltas) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, name := range sortedNames(deltas) {
+		delta := deltas[name]
+		fmt.Fprintf(w, "  %s: %d -> %d (%+d)\n", name, delta.Before, delta.After, delta.Delta)
+	}
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"glasshouse/audit"
+	"glasshouse/core/profiling"
+	"glasshouse/core/profiling/ptrace"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// doctorReport describes what this host supports. Profiler is the mechanism
+// `run --profile host` would pick, or empty when neither works.
+type doctorReport struct {
+	Profiler string          `json:"profiler"`
+	Sections []doctorSection `json:"sections"`
+}
+
+type doctorSection struct {
+	Name   string        `json:"name"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+type doctorCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Optional bool   `json:"optional,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// doctor prints the host report and exits non-zero when no profiler works.
+func doctor(args []string) int {
+	asJSON := false
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown doctor flag %s\n", arg)
+			usage()
+			return 2
+		}
+	}
+
+	probe := audit.Probe(ebpfConfigFromEnv())
+	ptraceErr := ptrace.Available()
+	report := doctorReport{Sections: []doctorSection{
+		{Name: "ebpf", Checks: ebpfChecks(probe)},
+		{Name: "ptrace", Checks: []doctorCheck{errCheck("ptrace", ptraceErr, "")}},
+		{Name: "cgroup", Checks: cgroupChecks()},
+		{Name: "namespaces", Checks: namespaceChecks()},
+		{Name: "firecracker", Checks: firecrackerChecks()},
+	}}
+	switch {
+	case probe.Err() == nil:
+		report.Profiler = profiling.MechanismEBPF
+	case ptraceErr == nil:
+		report.Profiler = profiling.MechanismPtrace
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 1
+		}
+		fmt.Println(string(data))
+	} else {
+		printReport(report)
+	}
+	if report.Profiler == "" {
+		return 1
+	}
+	return 0
+}
+
+func printReport(report doctorReport) {
+	for _, section := range report.Sections {
+		fmt.Println(section.Name)
+		for _, check := range section.Checks {
+			status := "ok"
+			switch {
+			case !check.OK && check.Optional:
+				status = "warn"
+			case !check.OK:
+				status = "FAIL"
+			}
+			line := fmt.Sprintf("  %-5s %s", status, check.Name)
+			if check.Detail != "" {
+				line += ": " + check.Detail
+			}
+			fmt.Println(line)
+		}
+	}
+	profiler := report.Profiler
+	if profiler == "" {
+		profiler = "none (host profiling unavailable)"
+	}
+	fmt.Println("profiler:", profiler)
+}
+
+func ebpfChecks(probe audit.ProbeResult) []doctorCheck {
+	checks := make([]doctorCheck, 0, len(probe.Features))
+	for _, f := range probe.Features {
+		checks = append(checks, doctorCheck{Name: f.Name, OK: f.Available, Optional: f.Optional, Detail: f.Reason})
+	}
+	return checks
+}
+
+func errCheck(name string, err error, detail string) doctorCheck {
+	if err != nil {
+		return doctorCheck{Name: name, Detail: err.Error()}
+	}
+	return doctorCheck{Name: name, OK: true, Detail: detail}
+}
+
+func cgroupChecks() []doctorCheck {
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return []doctorCheck{{Name: "v2", Detail: "unified hierarchy not mounted at " + cgroupRoot}}
+	}
+	controllers := strings.Fields(string(data))
+	return []doctorCheck{{Name: "v2", OK: true, Detail: "controllers: " + strings.Join(controllers, " ")}}
+}
+
+func namespaceChecks() []doctorCheck {
+	var checks []doctorCheck
+	for _, ns := range []string{"user", "pid", "mnt", "net", "uts", "ipc", "cgroup"} {
+		_, err := os.Stat(filepath.Join("/proc/self/ns", ns))
+		checks = append(checks, errCheck(ns, err, ""))
+	}
+	data, err := os.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err != nil {
+		return append(checks, errCheck("max_user_namespaces", err, ""))
+	}
+	limit, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	check := doctorCheck{Name: "max_user_namespaces", OK: limit > 0, Detail: strconv.Itoa(limit)}
+	return append(checks, check)
+}
+
+func firecrackerChecks() []doctorCheck {
+	kvm, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err == nil {
+		kvm.Close()
+	}
+	checks := []doctorCheck{errCheck("kvm", err, "/dev/kvm")}
+	for _, bin := range []string{"firecracker", "mkfs.ext4"} {
+		path, err := exec.LookPath(bin)
+		checks = append(checks, errCheck(bin, err, path))
+	}
+	return checks
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"glasshouse/core/intoto"
+	"glasshouse/core/receipt"
+)
+
+// export converts a receipt to another format. Written files use the hashes
+// recorded by run --hash-files. With --hash-files-now, files without one are
+// digested as they are on disk now; otherwise they are only byproducts.
+func export(args []string) int {
+	var path, format, out string
+	var hashFiles bool
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--format" || arg == "-o":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "glasshouse: missing value for %s\n", arg)
+				return 2
+			}
+			i++
+			if arg == "-o" {
+				out = args[i]
+			} else {
+				format = args[i]
+			}
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--hash-files-now":
+			hashFiles = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown export flag %s\n", arg)
+			usage()
+			return 2
+		case path == "":
+			path = arg
+		default:
+			usage()
+			return 2
+		}
+	}
+	if path == "" {
+		path = "receipt.json"
+	}
+	if format != "intoto" {
+		fmt.Fprintf(os.Stderr, "glasshouse: unsupported export format %q (want intoto)\n", format)
+		return 2
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	var rec receipt.Receipt
+	if err := json.Unmarshal(data, &rec); err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: %v\n", path, err)
+		return 1
+	}
+	var opts intoto.Options
+	if hashFiles {
+		opts.Digest = digestFile
+	}
+	statement, err := intoto.FromReceipt(&rec, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: %v\n", path, err)
+		return 1
+	}
+	encoded, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	encoded = append(encoded, '\n')
+	if out == "" {
+		_, err = os.Stdout.Write(encoded)
+	} else {
+		err = os.WriteFile(out, encoded, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	return 0
+}
+
+// digestFile hashes a regular file. Relative paths are skipped: they were
+// relative to the execution's cwd, not ours.
+func digestFile(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		return "", false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", false
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
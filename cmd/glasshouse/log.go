@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"glasshouse/core/receipt"
+	"glasshouse/core/signing"
+	"glasshouse/core/translog"
+)
+
+// appendToLog adds rec to the transparency log in dir and, when a signer is
+// set, signs a tree head covering it.
+func appendToLog(dir string, rec *receipt.Receipt, signer *signing.Signer) error {
+	l, err := translog.Open(dir, signer)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if _, err := l.Append(rec); err != nil {
+		return fmt.Errorf("log receipt: %w", err)
+	}
+	if signer != nil {
+		if _, err := l.SignHead(); err != nil {
+			return fmt.Errorf("sign tree head: %w", err)
+		}
+	}
+	return nil
+}
+
+// logCommand inspects a transparency log and proves or checks that
+// receipts are in it. Commands that verify exit 1 on failure.
+func logCommand(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	flags := flag.NewFlagSet("log "+args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	pubPath := flags.String("pubkey", "", "")
+	receiptPath := flags.String("receipt", "", "")
+	size := flags.Int64("size", -1, "")
+	if err := flags.Parse(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		usage()
+		return 2
+	}
+	rest := flags.Args()
+	var pub ed25519.PublicKey
+	if *pubPath != "" {
+		var err error
+		if pub, err = signing.LoadPublicKey(*pubPath); err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 2
+		}
+	}
+
+	var code int
+	var err error
+	switch {
+	case args[0] == "head" && len(rest) == 1:
+		code, err = logHead(rest[0])
+	case args[0] == "prove" && len(rest) == 2:
+		code, err = logProve(rest[0], rest[1], *size)
+	case args[0] == "check" && len(rest) == 1 && pub != nil:
+		code, err = logCheck(rest[0], *receiptPath, pub)
+	case args[0] == "consistency" && len(rest) == 2 && pub != nil:
+		code, err = logConsistency(rest[0], rest[1], pub)
+	case args[0] == "verify" && len(rest) == 1 && pub != nil:
+		code, err = logVerify(rest[0], pub)
+	default:
+		usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+	}
+	return code
+}
+
+func logHead(dir string) (int, error) {
+	l, err := openLog(dir)
+	if err != nil {
+		return 1, err
+	}
+	defer l.Close()
+	head, ok, err := l.LatestHead()
+	if err != nil {
+		return 1, err
+	}
+	if !ok {
+		return 1, fmt.Errorf("%s: no signed tree head", dir)
+	}
+	return 0, printJSON(head)
+}
+
+// logProve prints an inclusion proof for a receipt, against the latest
+// signed head unless size is set. A receipt missing from the log exits 1.
+func logProve(dir, receiptPath string, size int64) (int, error) {
+	data, err := os.ReadFile(receiptPath)
+	if err != nil {
+		return 1, err
+	}
+	l, err := openLog(dir)
+	if err != nil {
+		return 1, err
+	}
+	defer l.Close()
+	index, ok, err := l.Find(json.RawMessage(data))
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", receiptPath, err)
+	}
+	if !ok {
+		return 1, fmt.Errorf("%s is not in the log", receiptPath)
+	}
+	treeSize := uint64(size)
+	if size < 0 {
+		head, signed, err := l.LatestHead()
+		if err != nil {
+			return 1, err
+		}
+		treeSize = l.Size()
+		if signed && head.Size > index {
+			treeSize = head.Size
+		}
+	}
+	proof, err := l.InclusionProof(index, treeSize)
+	if err != nil {
+		return 1, err
+	}
+	return 0, printJSON(proof)
+}
+
+// logCheck verifies an inclusion proof, as printed by `log prove` or served
+// by glasshouse-server, against the signed head it carries.
+func logCheck(proofPath, receiptPath string, pub ed25519.PublicKey) (int, error) {
+	var proof translog.InclusionProof
+	if err := readJSON(proofPath, &proof); err != nil {
+		return 1, err
+	}
+	if proof.Head == nil {
+		return 1, fmt.Errorf("%s: proof has no signed tree head", proofPath)
+	}
+	if err := proof.Head.Verify(pub); err != nil {
+		return 1, fmt.Errorf("%s: %w", proofPath, err)
+	}
+	if proof.Head.Size != proof.TreeSize {
+		return 1, fmt.Errorf("%s: proof is for size %d but the head is for size %d", proofPath, proof.TreeSize, proof.Head.Size)
+	}
+	if receiptPath != "" {
+		data, err := os.ReadFile(receiptPath)
+		if err != nil {
+			return 1, err
+		}
+		leaf, err := translog.ReceiptHash(json.RawMessage(data))
+		if err != nil {
+			return 1, fmt.Errorf("%s: %w", receiptPath, err)
+		}
+		if leaf != proof.LeafHash {
+			return 1, fmt.Errorf("%s is not the receipt the proof is for", receiptPath)
+		}
+	}
+	if err := proof.Verify(proof.Head.Root); err != nil {
+		return 1, fmt.Errorf("%s: %w", proofPath, err)
+	}
+	fmt.Printf("%s: entry %d is in the log of size %d (head signed %s)\n", proofPath, proof.LeafIndex, proof.TreeSize, proof.Head.Timestamp.Format(time.RFC3339))
+	return 0, nil
+}
+
+// logConsistency checks that the log's latest signed head extends a head
+// saved earlier, so no entry covered by it was dropped or rewritten.
+func logConsistency(dir, headPath string, pub ed25519.PublicKey) (int, error) {
+	var old translog.TreeHead
+	if err := readJSON(headPath, &old); err != nil {
+		return 1, err
+	}
+	if err := old.Verify(pub); err != nil {
+		return 1, fmt.Errorf("%s: %w", headPath, err)
+	}
+	l, err := openLog(dir)
+	if err != nil {
+		return 1, err
+	}
+	defer l.Close()
+	latest, ok, err := l.LatestHead()
+	if err != nil {
+		return 1, err
+	}
+	if !ok {
+		return 1, fmt.Errorf("%s: no signed tree head", dir)
+	}
+	if err := latest.Verify(pub); err != nil {
+		return 1, fmt.Errorf("latest tree head: %w", err)
+	}
+	if old.Size > latest.Size {
+		return 1, fmt.Errorf("log shrank from %d to %d entries", old.Size, latest.Size)
+	}
+	proof, err := l.ConsistencyProof(old.Size, latest.Size)
+	if err != nil {
+		return 1, err
+	}
+	if err := proof.Verify(old.Root, latest.Root); err != nil {
+		return 1, fmt.Errorf("log of size %d does not extend %s: %w", latest.Size, headPath, err)
+	}
+	fmt.Printf("%s: log grew from %d to %d entries consistently\n", dir, old.Size, latest.Size)
+	return 0, nil
+}
+
+// logVerify re-checks the whole hash chain and every signed tree head.
+func logVerify(dir string, pub ed25519.PublicKey) (int, error) {
+	l, err := openLog(dir)
+	if err != nil {
+		return 1, err
+	}
+	defer l.Close()
+	heads, err := l.Audit(pub)
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", dir, err)
+	}
+	fmt.Printf("%s: %d entries, %d signed tree heads OK\n", dir, l.Size(), len(heads))
+	return 0, nil
+}
+
+// openLog opens an existing log without creating it.
+func openLog(dir string) (*translog.Log, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return translog.Open(dir, nil)
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -5,23 +5,57 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"glasshouse/audit"
 	"glasshouse/backend/process"
+	"glasshouse/core/agent"
 	"glasshouse/core/execution"
+	"glasshouse/core/policy"
 	"glasshouse/core/profiling"
 	"glasshouse/core/profiling/ebpf"
 	"glasshouse/core/profiling/noop"
+	"glasshouse/core/profiling/ptrace"
+	"glasshouse/core/receipt"
+	"glasshouse/core/record"
+	"glasshouse/core/signing"
 )
 
 func main() {
-	if len(os.Args) < 2 || os.Args[1] != "run" {
+	ptrace.Init()
+	if len(os.Args) < 2 {
 		usage()
 		os.Exit(2)
 	}
+	switch os.Args[1] {
+	case "run":
+		run(os.Args[2:])
+	case "doctor":
+		os.Exit(doctor(os.Args[2:]))
+	case "replay":
+		os.Exit(replay(os.Args[2:]))
+	case "verify":
+		os.Exit(verify(os.Args[2:]))
+	case "log":
+		os.Exit(logCommand(os.Args[2:]))
+	case "export":
+		os.Exit(export(os.Args[2:]))
+	case "receipt":
+		os.Exit(receiptCommand(os.Args[2:]))
+	case "diff":
+		os.Exit(diff(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
 
-	opts, cmdArgs, parseErr := parseRunArgs(os.Args[2:])
+func run(args []string) {
+	opts, cmdArgs, parseErr := parseRunArgs(args)
 	if parseErr != nil {
 		fmt.Fprintln(os.Stderr, "glasshouse:", parseErr)
 		usage()
@@ -34,25 +68,102 @@ func main() {
 	}
 
 	spec := execution.ExecutionSpec{
-		Args:      cmdArgs,
-		Workdir:   mustGetwd(),
-		Env:       os.Environ(),
-		Guest:     opts.Guest,
-		Profiling: opts.Profiling,
+		Args:        cmdArgs,
+		Workdir:     mustGetwd(),
+		Env:         os.Environ(),
+		Guest:       opts.Guest,
+		Profiling:   opts.Profiling,
+		Timeline:    opts.Timeline,
+		HashFiles:   opts.HashFiles,
+		HashMaxSize: opts.HashMaxSize,
+	}
+	if err := applyStdin(&spec, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		os.Exit(2)
 	}
 
 	engine := execution.Engine{
 		Backend:  process.New(process.Options{Guest: opts.Guest}),
 		Profiler: selectProfiler(opts.Profiling),
 	}
+	if opts.AgentSocket != "" {
+		engine.Observers = append(engine.Observers, agent.NewExecutionObserver(opts.AgentSocket))
+	}
+	if opts.Policy != "" {
+		p, err := policy.LoadFile(opts.Policy)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			os.Exit(2)
+		}
+		engine.Policy = &p
+	}
+	var signer *signing.Signer
+	if opts.SignKey != "" {
+		var err error
+		if signer, err = signing.LoadSigner(opts.SignKey); err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			os.Exit(2)
+		}
+	}
+	var recordFile *os.File
+	var recorder *record.Recorder
+	if opts.Record != "" {
+		if opts.Profiling == profiling.ProfilingDisabled {
+			fmt.Fprintln(os.Stderr, "glasshouse: --record requires --profile")
+			os.Exit(2)
+		}
+		var err error
+		if recordFile, err = os.Create(opts.Record); err == nil {
+			recorder, err = record.NewRecorder(recordFile)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			os.Exit(2)
+		}
+		engine.Observers = append(engine.Observers, recorder)
+	}
+
+	// The command runs in its own process group, out of reach of the
+	// terminal's ^C; cancel the run instead so the engine stops it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	restoreTerminal := func() {}
+	if spec.PTY != nil {
+		if resizer, ok := engine.Backend.(execution.TerminalResizer); ok {
+			engine.Observers = append(engine.Observers, &resizeObserver{resizer: resizer, term: os.Stdin})
+		}
+		if restore, err := makeRaw(os.Stdin); err == nil {
+			restoreTerminal = restore
+		}
+	}
 
-	result, err := engine.Run(context.Background(), spec)
+	result, err := engine.Run(ctx, spec)
+	restoreTerminal()
 	if result.Receipt != nil {
-		writeErr := writeReceipt(result.Receipt)
+		writeErr := writeReceipt(result.Receipt, signer)
+		if writeErr == nil && opts.Log != "" {
+			writeErr = appendToLog(opts.Log, result.Receipt, signer)
+		}
 		if writeErr != nil {
 			fmt.Fprintln(os.Stderr, "glasshouse:", writeErr)
 		}
 	}
+	if recorder != nil {
+		recordErr := recorder.Err()
+		if closeErr := recordFile.Close(); recordErr == nil {
+			recordErr = closeErr
+		}
+		if recordErr != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse: record:", recordErr)
+		}
+	}
+	reportVerdict(result.Verdict)
 
 	if err != nil {
 		exitCode := result.ExitCode
@@ -66,6 +177,23 @@ func main() {
 type runOptions struct {
 	Guest     bool
 	Profiling profiling.Mode
+	Stdin     string
+	PTY       bool
+	Timeout   time.Duration
+	// AgentSocket registers the run with a glasshouse-agent control socket.
+	AgentSocket string
+	Timeline    int
+	// HashFiles records content hashes of files read and written, skipping
+	// files over HashMaxSize bytes (zero uses the default).
+	HashFiles   bool
+	HashMaxSize int64
+	// Record tees profiling events and metadata to a replayable file.
+	Record string
+	Policy string
+	// SignKey is an Ed25519 private key used to sign receipt.json.
+	SignKey string
+	// Log is a transparency log directory that receipt.json is appended to.
+	Log string
 }
 
 func parseRunArgs(args []string) (runOptions, []string, error) {
@@ -80,6 +208,56 @@ func parseRunArgs(args []string) (runOptions, []string, error) {
 			return opts, args[i+1:], nil
 		case "--guest":
 			opts.Guest = true
+		case "--pty":
+			opts.PTY = true
+		case "--timeline":
+			opts.Timeline = receipt.DefaultTimelineLimit
+		case "--hash-files":
+			opts.HashFiles = true
+		case "--agent-socket":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing agent socket path")
+			}
+			i++
+			opts.AgentSocket = args[i]
+		case "--timeout":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing timeout")
+			}
+			i++
+			if err := setTimeout(&opts, args[i]); err != nil {
+				return opts, nil, err
+			}
+		case "--record":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing recording path")
+			}
+			i++
+			opts.Record = args[i]
+		case "--policy":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing policy path")
+			}
+			i++
+			opts.Policy = args[i]
+		case "--sign-key":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing signing key path")
+			}
+			i++
+			opts.SignKey = args[i]
+		case "--log":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing log directory")
+			}
+			i++
+			opts.Log = args[i]
+		case "--stdin":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("missing stdin path")
+			}
+			i++
+			opts.Stdin = args[i]
 		case "--profile":
 			if i+1 >= len(args) {
 				return opts, nil, fmt.Errorf("missing profile mode")
@@ -89,6 +267,33 @@ func parseRunArgs(args []string) (runOptions, []string, error) {
 				return opts, nil, err
 			}
 		default:
+			if strings.HasPrefix(arg, "--timeout=") {
+				if err := setTimeout(&opts, strings.TrimPrefix(arg, "--timeout=")); err != nil {
+					return opts, nil, err
+				}
+				continue
+			}
+			if strings.HasPrefix(arg, "--timeline=") {
+				limit, err := strconv.Atoi(strings.TrimPrefix(arg, "--timeline="))
+				if err != nil || limit < 0 {
+					return opts, nil, fmt.Errorf("invalid timeline limit: %s", arg)
+				}
+				opts.Timeline = limit
+				continue
+			}
+			if strings.HasPrefix(arg, "--hash-files=") {
+				limit, err := strconv.ParseInt(strings.TrimPrefix(arg, "--hash-files="), 10, 64)
+				if err != nil || limit <= 0 {
+					return opts, nil, fmt.Errorf("invalid hash size limit: %s", arg)
+				}
+				opts.HashFiles = true
+				opts.HashMaxSize = limit
+				continue
+			}
+			if strings.HasPrefix(arg, "--stdin=") {
+				opts.Stdin = strings.TrimPrefix(arg, "--stdin=")
+				continue
+			}
 			if strings.HasPrefix(arg, "--profile=") {
 				if err := setProfilingMode(&opts, strings.TrimPrefix(arg, "--profile=")); err != nil {
 					return opts, nil, err
@@ -120,11 +325,85 @@ func setProfilingMode(opts *runOptions, mode string) error {
 	return nil
 }
 
+func setTimeout(opts *runOptions, value string) error {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid timeout: %s", value)
+	}
+	opts.Timeout = timeout
+	return nil
+}
+
+// applyStdin wires --stdin and --pty into the spec. A PTY session forwards
+// the terminal's stdin unless an explicit source is given.
+func applyStdin(spec *execution.ExecutionSpec, opts runOptions) error {
+	switch opts.Stdin {
+	case "":
+		if opts.PTY {
+			spec.StdinReader = os.Stdin
+		}
+	case "-":
+		spec.StdinReader = os.Stdin
+	default:
+		data, err := os.ReadFile(opts.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin file: %w", err)
+		}
+		spec.Stdin = data
+	}
+	if opts.PTY {
+		rows, cols := terminalSize(os.Stdin)
+		spec.PTY = &execution.PTYConfig{Rows: rows, Cols: cols}
+	}
+	return nil
+}
+
+// resizeObserver forwards the local terminal's window size to the
+// execution's PTY while it runs.
+type resizeObserver struct {
+	execution.NopObserver
+	resizer execution.TerminalResizer
+	term    *os.File
+	stop    func()
+}
+
+func (o *resizeObserver) OnStarted(ctx context.Context, h execution.ExecutionHandle, id execution.ExecutionIdentity) {
+	_, _ = ctx, id
+	resize := func(rows, cols uint16) { _ = o.resizer.Resize(h, rows, cols) }
+	o.stop = watchResize(o.term, resize)
+	// Catch up with a resize that happened before the watcher started.
+	if rows, cols := terminalSize(o.term); rows > 0 && cols > 0 {
+		resize(rows, cols)
+	}
+}
+
+func (o *resizeObserver) OnExit(ctx context.Context, result execution.ExecutionResult) {
+	_, _ = ctx, result
+	if o.stop != nil {
+		o.stop()
+	}
+}
+
 func selectProfiler(mode profiling.Mode) profiling.Controller {
 	if mode == profiling.ProfilingDisabled {
 		return noop.NewController()
 	}
-	return ebpf.NewController(ebpfConfigFromEnv())
+	cfg := ebpfConfigFromEnv()
+	switch os.Getenv("GLASSHOUSE_PROFILER") {
+	case profiling.MechanismEBPF:
+		return ebpf.NewController(cfg)
+	case profiling.MechanismPtrace:
+		return ptrace.NewController()
+	}
+	if mode != profiling.ProfilingHost {
+		return ebpf.NewController(cfg)
+	}
+	ebpfErr := ebpf.Available(cfg)
+	if ebpfErr == nil || ptrace.Available() != nil {
+		return ebpf.NewController(cfg)
+	}
+	fmt.Fprintf(os.Stderr, "glasshouse: %v; using ptrace\n", ebpfErr)
+	return ptrace.NewController()
 }
 
 func ebpfConfigFromEnv() audit.Config {
@@ -143,8 +422,16 @@ func mustGetwd() string {
 	return wd
 }
 
-func writeReceipt(receipt interface{}) error {
-	data, err := json.MarshalIndent(receipt, "", "  ")
+// writeReceipt writes receipt.json, signing it first when signer is set.
+func writeReceipt(rec *receipt.Receipt, signer *signing.Signer) error {
+	if signer != nil {
+		env, err := signer.Sign(rec)
+		if err != nil {
+			return fmt.Errorf("sign receipt: %w", err)
+		}
+		rec.Signature = env
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal receipt: %w", err)
 	}
@@ -155,5 +442,18 @@ func writeReceipt(receipt interface{}) error {
 }
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: glasshouse run [--guest] [--profile disabled|host|guest|combined] -- <command> [args...]")
+	fmt.Fprintln(os.Stderr, "usage: glasshouse run [--guest] [--profile disabled|host|guest|combined] [--timeout duration] [--agent-socket path] [--stdin file|-] [--pty] [--timeline[=N]] [--hash-files[=maxbytes]] [--policy file] [--record file] [--sign-key file] [--log dir] -- <command> [args...]")
+	fmt.Fprintln(os.Stderr, "       glasshouse replay [--policy file] [--sign-key file] <recording>")
+	fmt.Fprintln(os.Stderr, "       glasshouse verify --pubkey file <receipt.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse export --format intoto [--hash-files-now] [-o file] [receipt.json]")
+	fmt.Fprintln(os.Stderr, "       glasshouse diff [--json] <before.json> <after.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse receipt schema [--version v] [--write dir]")
+	fmt.Fprintln(os.Stderr, "       glasshouse receipt validate <receipt.json>...")
+	fmt.Fprintln(os.Stderr, "       glasshouse receipt migrate [-o file] <receipt.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse log head <dir>")
+	fmt.Fprintln(os.Stderr, "       glasshouse log prove [--size n] <dir> <receipt.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse log check --pubkey file [--receipt file] <proof.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse log consistency --pubkey file <dir> <head.json>")
+	fmt.Fprintln(os.Stderr, "       glasshouse log verify --pubkey file <dir>")
+	fmt.Fprintln(os.Stderr, "       glasshouse doctor [--json]")
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"glasshouse/core/receipt"
+	"glasshouse/core/version"
+)
+
+// receiptCommand prints receipt schemas and validates or migrates receipt
+// documents. validate exits 1 when any file is invalid.
+func receiptCommand(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	var files []string
+	var writeDir, out string
+	schemaVersion := version.ReceiptVersion
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--write" || arg == "--version" || arg == "-o":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "glasshouse: missing value for %s\n", arg)
+				return 2
+			}
+			i++
+			switch arg {
+			case "--write":
+				writeDir = args[i]
+			case "--version":
+				schemaVersion = args[i]
+			default:
+				out = args[i]
+			}
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown receipt flag %s\n", arg)
+			usage()
+			return 2
+		default:
+			files = append(files, arg)
+		}
+	}
+
+	switch {
+	case args[0] == "schema" && len(files) == 0:
+		return receiptSchema(schemaVersion, writeDir)
+	case args[0] == "validate" && len(files) > 0:
+		return receiptValidate(files)
+	case args[0] == "migrate" && len(files) == 1:
+		return receiptMigrate(files[0], out)
+	}
+	usage()
+	return 2
+}
+
+// receiptSchema prints a published schema, or with --write regenerates the
+// current version's schema into a directory.
+func receiptSchema(v, writeDir string) int {
+	if writeDir != "" {
+		path, err := receipt.WriteSchema(writeDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 1
+		}
+		fmt.Println(path)
+		return 0
+	}
+	data, err := receipt.Schema(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %v (have %s)\n", err, strings.Join(receipt.SchemaVersions(), ", "))
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+func receiptValidate(files []string) int {
+	code := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = receipt.Validate(data)
+		}
+		var invalid *receipt.ValidationError
+		switch {
+		case err == nil:
+			fmt.Printf("%s: valid\n", path)
+		case errors.As(err, &invalid):
+			fmt.Fprintf(os.Stderr, "%s: invalid %s receipt\n", path, invalid.Version)
+			for _, problem := range invalid.Problems {
+				fmt.Fprintf(os.Stderr, "  %s\n", problem)
+			}
+			code = 1
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// receiptMigrate upgrades a receipt to the current version, writing it to
+// out or stdout, and validates the result.
+func receiptMigrate(path, out string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	result, err := receipt.Migrate(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: %v\n", path, err)
+		return 1
+	}
+	if err := receipt.Validate(result.Data); err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: migrated receipt does not validate: %v\n", path, err)
+		return 1
+	}
+	if result.DroppedSignature {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: signature dropped; re-sign the migrated receipt\n", path)
+	}
+	if out == "" {
+		fmt.Println(strings.TrimSuffix(string(result.Data), "\n"))
+	} else if err := os.WriteFile(out, append(result.Data, '\n'), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	if result.From != result.To {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: migrated %s -> %s\n", path, result.From, result.To)
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"glasshouse/core/execution"
+	"glasshouse/core/policy"
+	"glasshouse/core/record"
+	"glasshouse/core/signing"
+)
+
+// replay rebuilds receipt.json from a recording, optionally under a
+// different policy, and exits 1 when the policy denies the execution.
+func replay(args []string) int {
+	var path, policyPath, signKey string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--policy":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "glasshouse: missing policy path")
+				return 2
+			}
+			i++
+			policyPath = args[i]
+		case strings.HasPrefix(arg, "--policy="):
+			policyPath = strings.TrimPrefix(arg, "--policy=")
+		case arg == "--sign-key":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "glasshouse: missing signing key path")
+				return 2
+			}
+			i++
+			signKey = args[i]
+		case strings.HasPrefix(arg, "--sign-key="):
+			signKey = strings.TrimPrefix(arg, "--sign-key=")
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown replay flag %s\n", arg)
+			usage()
+			return 2
+		case path == "":
+			path = arg
+		default:
+			usage()
+			return 2
+		}
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "glasshouse: no recording provided")
+		usage()
+		return 2
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	rec, err := record.Read(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: %v\n", path, err)
+		return 1
+	}
+
+	engine := execution.Engine{Profiler: record.NewController(rec)}
+	if policyPath != "" {
+		p, err := policy.LoadFile(policyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 2
+		}
+		engine.Policy = &p
+	}
+	var signer *signing.Signer
+	if signKey != "" {
+		if signer, err = signing.LoadSigner(signKey); err != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", err)
+			return 2
+		}
+	}
+	result, err := engine.Replay(context.Background(), rec.Replay())
+	if result.Receipt != nil {
+		if writeErr := writeReceipt(result.Receipt, signer); writeErr != nil {
+			fmt.Fprintln(os.Stderr, "glasshouse:", writeErr)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	if !reportVerdict(result.Verdict) {
+		return 1
+	}
+	return 0
+}
+
+// reportVerdict prints policy violations and reports whether the execution
+// was allowed.
+func reportVerdict(verdict *policy.Verdict) bool {
+	if verdict == nil || verdict.Allowed {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "glasshouse: policy violations: %s\n", strings.Join(verdict.Reasons, ", "))
+	return false
+}
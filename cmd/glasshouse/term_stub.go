@@ -0,0 +1,23 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func terminalSize(f *os.File) (uint16, uint16) {
+	_ = f
+	return 0, 0
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	_ = f
+	return nil, errors.New("raw terminal mode unsupported on this platform")
+}
+
+func watchResize(f *os.File, resize func(rows, cols uint16)) func() {
+	_, _ = f, resize
+	return func() {}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"glasshouse/core/signing"
+)
+
+// verify checks a receipt's signature against a public key and exits 1
+// when it is missing or does not match.
+func verify(args []string) int {
+	var path, pubPath string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--pubkey":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "glasshouse: missing public key path")
+				return 2
+			}
+			i++
+			pubPath = args[i]
+		case strings.HasPrefix(arg, "--pubkey="):
+			pubPath = strings.TrimPrefix(arg, "--pubkey=")
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintf(os.Stderr, "glasshouse: unknown verify flag %s\n", arg)
+			usage()
+			return 2
+		case path == "":
+			path = arg
+		default:
+			usage()
+			return 2
+		}
+	}
+	if path == "" || pubPath == "" {
+		usage()
+		return 2
+	}
+
+	pub, err := signing.LoadPublicKey(pubPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 2
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 1
+	}
+	sig, err := signing.Verify(data, pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("%s: signature OK (key %s, signed %s)\n", path, sig.KeyID, sig.SignedAt.Format(time.RFC3339))
+	return 0
+}
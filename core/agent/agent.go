@@ -14,6 +14,8 @@ import (
 	"glasshouse/core/policy"
 	"glasshouse/core/profiling"
 	"glasshouse/core/receipt"
+	"glasshouse/core/signing"
+	"glasshouse/core/translog"
 )
 
 // Config configures the glasshouse agent daemon.
@@ -22,6 +24,17 @@ type Config struct {
 	Observation   string
 	Policy        policy.Policy
 	ControlSocket string
+	// StateFile, when set, is where the agent checkpoints open executions
+	// and restores them from on start.
+	StateFile string
+	// CheckpointInterval defaults to DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+	// Signer, when set, signs every emitted receipt.
+	Signer *signing.Signer
+	// Log, when set, receives every emitted receipt. The agent signs a tree
+	// head every HeadInterval (default translog.DefaultHeadInterval).
+	Log          *translog.Log
+	HeadInterval time.Duration
 }
 
 // Agent runs in daemon mode: it only observes kernel events and never launches workloads.
@@ -37,11 +50,21 @@ type Agent struct {
 
 	mu      sync.Mutex
 	runtime map[string]*runtimeState
+	stats   profiling.StatsReporter
+
+	// checkpointMu orders state file writes so an older snapshot never
+	// replaces a newer one.
+	checkpointMu sync.Mutex
+	// checkpointReq wakes the state writer; it holds at most one pending
+	// request, so bursts coalesce into one write.
+	checkpointReq chan struct{}
 }
 
 type runtimeState struct {
 	startedAt time.Time
 	pids      map[uint32]struct{}
+	// drops is the session's drop count when the execution was first seen.
+	drops map[profiling.EventType]uint64
 }
 
 func New(cfg Config, profiler profiling.Controller) *Agent {
@@ -55,24 +78,33 @@ func New(cfg Config, profiler profiling.Controller) *Agent {
 		AutoCreate: true,
 	})
 	return &Agent{
-		cfg:         cfg,
-		profiler:    profiler,
-		aggregator:  agg,
-		preEval:     policy.PreEvaluator{Policy: cfg.Policy},
-		runtimeEval: policy.RuntimeEvaluator{Policy: cfg.Policy},
-		postEval:    policy.Evaluator{Policy: cfg.Policy},
-		enforcer:    Enforcer{},
-		runtime:     make(map[string]*runtimeState),
+		cfg:           cfg,
+		profiler:      profiler,
+		aggregator:    agg,
+		preEval:       policy.PreEvaluator{Policy: cfg.Policy},
+		runtimeEval:   policy.RuntimeEvaluator{Policy: cfg.Policy},
+		postEval:      policy.Evaluator{Policy: cfg.Policy},
+		enforcer:      Enforcer{},
+		runtime:       make(map[string]*runtimeState),
+		checkpointReq: make(chan struct{}, 1),
 	}
 }
 
 // Run starts the profiler, control plane, and event loop.
 func (a *Agent) Run(ctx context.Context) error {
+	if err := a.restore(); err != nil {
+		return err
+	}
 	session, err := a.profiler.Start(ctx, profiling.Target{Mode: profiling.ProfilingHost})
 	if err != nil {
 		return err
 	}
 	defer session.Close()
+	if reporter, ok := session.(profiling.StatsReporter); ok {
+		a.mu.Lock()
+		a.stats = reporter
+		a.mu.Unlock()
+	}
 
 	if a.cfg.ControlSocket != "" {
 		srv := NewControlServer(a.cfg.ControlSocket, a.handleControl)
@@ -83,6 +115,46 @@ func (a *Agent) Run(ctx context.Context) error {
 		}()
 	}
 
+	if a.cfg.Log != nil {
+		headCtx, cancel := context.WithCancel(ctx)
+		heads := make(chan struct{})
+		go func() {
+			defer close(heads)
+			a.cfg.Log.Run(headCtx, a.cfg.HeadInterval, func(err error) {
+				fmt.Fprintf(os.Stderr, "glasshouse-agent: tree head: %v\n", err)
+			})
+		}()
+		// Wait for the final head so it covers receipts flushed on exit.
+		defer func() {
+			cancel()
+			<-heads
+		}()
+	}
+
+	var checkpoints <-chan time.Time
+	if a.cfg.StateFile != "" {
+		interval := a.cfg.CheckpointInterval
+		if interval <= 0 {
+			interval = DefaultCheckpointInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		checkpoints = ticker.C
+		// State is written off the event loop; the last write on exit is
+		// synchronous so it covers everything handled.
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			a.writeCheckpoints(stop)
+		}()
+		defer func() {
+			close(stop)
+			<-stopped
+			a.saveState()
+		}()
+	}
+
 	for {
 		select {
 		case ev, ok := <-session.Events():
@@ -90,6 +162,8 @@ func (a *Agent) Run(ctx context.Context) error {
 				return nil
 			}
 			a.handleEvent(ctx, ev)
+		case <-checkpoints:
+			a.requestCheckpoint()
 		case err, ok := <-session.Errors():
 			if ok && err != nil {
 				fmt.Fprintf(os.Stderr, "glasshouse-agent: event error: %v\n", err)
@@ -184,6 +258,7 @@ func (a *Agent) handleStart(ctx context.Context, cmd ControlCommand) ControlResp
 		Command:         cmd.Command,
 		StartedAt:       startTime,
 		ObservationMode: a.cfg.Observation,
+		TimelineLimit:   cmd.Timeline,
 	})
 
 	if id.IsZero() {
@@ -251,6 +326,7 @@ func (a *Agent) handleEnd(ctx context.Context, cmd ControlCommand, closed bool)
 	if !closed {
 		rec.Completeness = "partial"
 	}
+	rec.ApplyDrops(a.dropsSince(execID.String()))
 
 	verdict := a.postEval.Evaluate(ctx, rec)
 	if rec.Policy == nil {
@@ -272,6 +348,7 @@ func (a *Agent) handleEnd(ctx context.Context, cmd ControlCommand, closed bool)
 
 	a.aggregator.ForgetExecution(execID)
 	a.clearRuntimeState(execID.String())
+	a.requestCheckpoint()
 	return ControlResponse{OK: true, ExecutionID: rec.ExecutionID}
 }
 
@@ -280,7 +357,7 @@ func (a *Agent) ensureRuntimeState(id string, startedAt time.Time) *runtimeState
 	defer a.mu.Unlock()
 	state, ok := a.runtime[id]
 	if !ok {
-		state = &runtimeState{startedAt: startedAt, pids: make(map[uint32]struct{})}
+		state = &runtimeState{startedAt: startedAt, pids: make(map[uint32]struct{}), drops: a.dropsLocked()}
 		a.runtime[id] = state
 	}
 	if state.startedAt.IsZero() {
@@ -289,6 +366,34 @@ func (a *Agent) ensureRuntimeState(id string, startedAt time.Time) *runtimeState
 	return state
 }
 
+// dropsLocked returns the session's current drop counts. The ring buffer is
+// shared by all executions, so drops are attributed to every execution that
+// was running when they happened.
+func (a *Agent) dropsLocked() map[profiling.EventType]uint64 {
+	if a.stats == nil {
+		return nil
+	}
+	stats, _ := a.stats.Stats()
+	return stats.Drops
+}
+
+func (a *Agent) dropsSince(id string) map[profiling.EventType]uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	current := a.dropsLocked()
+	state, ok := a.runtime[id]
+	if !ok {
+		return nil
+	}
+	out := map[profiling.EventType]uint64{}
+	for t, n := range current {
+		if n > state.drops[t] {
+			out[t] = n - state.drops[t]
+		}
+	}
+	return out
+}
+
 func (a *Agent) lookupStartTime(id string) time.Time {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -305,6 +410,18 @@ func (a *Agent) clearRuntimeState(id string) {
 }
 
 func (a *Agent) emitReceipt(rec receipt.Receipt) error {
+	if a.cfg.Signer != nil {
+		env, err := a.cfg.Signer.Sign(rec)
+		if err != nil {
+			return fmt.Errorf("sign receipt: %w", err)
+		}
+		rec.Signature = env
+	}
+	if a.cfg.Log != nil {
+		if _, err := a.cfg.Log.Append(rec); err != nil {
+			return fmt.Errorf("log receipt: %w", err)
+		}
+	}
 	data, err := json.MarshalIndent(rec, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal receipt: %w", err)
@@ -1,7 +1,9 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -20,6 +22,8 @@ type ControlCommand struct {
 	EndedAt       string            `json:"ended_at,omitempty"`
 	ExitCode      int               `json:"exit_code,omitempty"`
 	Labels        map[string]string `json:"labels,omitempty"`
+	// Timeline enables the receipt timeline with this many entries.
+	Timeline int `json:"timeline,omitempty"`
 }
 
 // ControlResponse reports the result of a control command.
@@ -55,3 +59,34 @@ func resolveExecutionID(cmd ControlCommand) (identity.ExecutionID, error) {
 	}
 	return identity.ExecutionID{}, fmt.Errorf("missing execution identifier")
 }
+
+// ControlClient sends control commands to a running agent over its unix socket.
+type ControlClient struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// Send delivers one command and waits for the agent's response.
+func (c ControlClient) Send(cmd ControlCommand) (ControlResponse, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	conn, err := net.DialTimeout("unix", c.Path, timeout)
+	if err != nil {
+		return ControlResponse{}, fmt.Errorf("dial agent: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if err := json.NewEncoder(conn).Encode(cmd); err != nil {
+		return ControlResponse{}, fmt.Errorf("send command: %w", err)
+	}
+	var resp ControlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return ControlResponse{}, fmt.Errorf("read response: %w", err)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"glasshouse/core/execution"
+)
+
+// ExecutionObserver registers engine runs with a running agent so the daemon
+// attributes their events and emits their receipts. Registration is
+// best-effort: failures are reported on stderr and never veto a start.
+type ExecutionObserver struct {
+	execution.NopObserver
+	Client ControlClient
+
+	mu       sync.Mutex
+	command  string
+	labels   map[string]string
+	timeline int
+	execID   string
+}
+
+// NewExecutionObserver returns an observer that talks to the agent at socketPath.
+func NewExecutionObserver(socketPath string) *ExecutionObserver {
+	return &ExecutionObserver{Client: ControlClient{Path: socketPath}}
+}
+
+func (o *ExecutionObserver) OnPrepared(ctx context.Context, spec execution.ExecutionSpec) error {
+	_ = ctx
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.command = strings.Join(spec.Args, " ")
+	o.labels = spec.Labels
+	o.timeline = spec.Timeline
+	return nil
+}
+
+func (o *ExecutionObserver) OnStarted(ctx context.Context, h execution.ExecutionHandle, id execution.ExecutionIdentity) {
+	_ = ctx
+	_ = h
+	if id.RootPID == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	resp, err := o.Client.Send(ControlCommand{
+		Action:    "start",
+		RootPID:   uint32(id.RootPID),
+		Command:   o.command,
+		StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Labels:    o.labels,
+		Timeline:  o.timeline,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: agent registration: %v\n", err)
+		return
+	}
+	o.execID = resp.ExecutionID
+}
+
+func (o *ExecutionObserver) OnExit(ctx context.Context, result execution.ExecutionResult) {
+	_ = ctx
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.execID == "" {
+		return
+	}
+	_, err := o.Client.Send(ControlCommand{
+		Action:      "end",
+		ExecutionID: o.execID,
+		EndedAt:     result.CompletedAt.UTC().Format(time.RFC3339Nano),
+		ExitCode:    result.ExitCode,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse: agent registration: %v\n", err)
+	}
+}
+
+var _ execution.Observer = (*ExecutionObserver)(nil)
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// DefaultCheckpointInterval is how often the agent saves its state when
+// Config.StateFile is set and no interval is configured.
+const DefaultCheckpointInterval = 10 * time.Second
+
+// agentState is what the agent saves to Config.StateFile: the aggregator
+// checkpoint plus the per-execution runtime policy state.
+type agentState struct {
+	Aggregator receipt.Checkpoint           `json:"aggregator"`
+	Runtime    map[string]runtimeCheckpoint `json:"runtime,omitempty"`
+}
+
+type runtimeCheckpoint struct {
+	StartedAt time.Time                      `json:"started_at"`
+	PIDs      []uint32                       `json:"pids,omitempty"`
+	Drops     map[profiling.EventType]uint64 `json:"drops,omitempty"`
+}
+
+// Checkpoint saves the agent's open executions to Config.StateFile.
+func (a *Agent) Checkpoint() error {
+	if a.cfg.StateFile == "" {
+		return nil
+	}
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+	state := agentState{
+		Aggregator: a.aggregator.Checkpoint(),
+		Runtime:    make(map[string]runtimeCheckpoint),
+	}
+	a.mu.Lock()
+	for id, rt := range a.runtime {
+		cp := runtimeCheckpoint{StartedAt: rt.startedAt, Drops: rt.drops}
+		for pid := range rt.pids {
+			cp.PIDs = append(cp.PIDs, pid)
+		}
+		state.Runtime[id] = cp
+	}
+	a.mu.Unlock()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal agent state: %w", err)
+	}
+	return writeFileAtomic(a.cfg.StateFile, data)
+}
+
+// requestCheckpoint asks the writer started by Run to save the state soon.
+// It never blocks.
+func (a *Agent) requestCheckpoint() {
+	if a.cfg.StateFile == "" {
+		return
+	}
+	select {
+	case a.checkpointReq <- struct{}{}:
+	default:
+	}
+}
+
+// writeCheckpoints saves the state for each request until stop is closed.
+func (a *Agent) writeCheckpoints(stop <-chan struct{}) {
+	for {
+		select {
+		case <-a.checkpointReq:
+			a.saveState()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (a *Agent) saveState() {
+	if err := a.Checkpoint(); err != nil {
+		fmt.Fprintf(os.Stderr, "glasshouse-agent: checkpoint: %v\n", err)
+	}
+}
+
+// restore loads Config.StateFile if it exists, so executions that were
+// open when a previous agent stopped can still be flushed.
+func (a *Agent) restore() error {
+	if a.cfg.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read agent state: %w", err)
+	}
+	var state agentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decode agent state: %w", err)
+	}
+	if err := a.aggregator.Restore(state.Aggregator); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, cp := range state.Runtime {
+		rt := &runtimeState{startedAt: cp.StartedAt, pids: make(map[uint32]struct{}), drops: cp.Drops}
+		for _, pid := range cp.PIDs {
+			rt.pids[pid] = struct{}{}
+		}
+		a.runtime[id] = rt
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path so a crash never leaves a partial state file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".agent-state-*")
+	if err != nil {
+		return fmt.Errorf("create agent state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write agent state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync agent state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close agent state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace agent state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"glasshouse/core/profiling/synthetic"
+	"glasshouse/core/receipt"
+)
+
+func TestAgentFlushesExecutionAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{ReceiptDir: dir, StateFile: filepath.Join(dir, "state.json")}
+	w := synthetic.Workload{Seed: 1, Forks: 2, Opens: 3, Connects: 1, Cgroups: true}
+	if err := New(cfg, synthetic.NewController(w)).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := New(cfg, synthetic.NewController(w))
+	if err := restarted.restore(); err != nil {
+		t.Fatal(err)
+	}
+	resp := restarted.handleControl(context.Background(), ControlCommand{Action: "end", CgroupID: 1})
+	if !resp.OK {
+		t.Fatalf("end after restart: %s", resp.Error)
+	}
+	// Without Run the end only requests a write; save as Run does on exit.
+	if err := restarted.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "receipt-cgroup_1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec receipt.Receipt
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Processes) != 3 || rec.Network == nil || len(rec.Network.Connections) == 0 {
+		t.Fatalf("restored receipt lost activity: %s", data)
+	}
+
+	again := New(cfg, nil)
+	if err := again.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if resp := again.handleControl(context.Background(), ControlCommand{Action: "end", CgroupID: 1}); resp.OK {
+		t.Fatal("flushed execution was still in the saved state")
+	}
+}
@@ -10,14 +10,30 @@ import (
 	"time"
 
 	"glasshouse/core/identity"
+	"glasshouse/core/policy"
 	"glasshouse/core/profiling"
 	"glasshouse/core/receipt"
 )
 
+const (
+	defaultTermGrace = 5 * time.Second
+	defaultKillGrace = 5 * time.Second
+)
+
 // Engine orchestrates execution, optional profiling, and receipt building.
 type Engine struct {
 	Backend  ExecutionBackend
 	Profiler profiling.Controller
+	// TermGrace is how long the engine waits after SIGTERM before killing an
+	// execution whose context is done. It only applies to ContextBackends.
+	TermGrace time.Duration
+	// KillGrace is how long the engine waits for Wait to return after Kill.
+	KillGrace time.Duration
+	// Observers receive lifecycle callbacks and may veto a start.
+	Observers []Observer
+	// Policy is evaluated before start, on each profiling event and against
+	// the final receipt. Post-execution rules require profiling.
+	Policy *policy.Policy
 }
 
 func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, error) {
@@ -38,17 +54,35 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 		result.Err = err
 		return result, err
 	}
+	if err := e.notifyPrepared(ctx, spec); err != nil {
+		result.Err = err
+		return result, err
+	}
 
 	result.StartedAt = time.Now()
-	handle, err := e.Backend.Start(spec)
+	var policyState *policyRun
+	if e.Policy != nil {
+		policyState = newPolicyRun(*e.Policy, e.Backend)
+		if err := policyState.evaluatePre(ctx, spec, result.StartedAt); err != nil {
+			verdict := policyState.finish(ctx, nil)
+			result.Verdict = &verdict
+			result.Err = err
+			return result, err
+		}
+	}
+	handle, err := e.start(ctx, e.launchSpec(spec))
 	result.Handle = handle
 	if err != nil {
 		result.Err = err
 		_ = e.Backend.Cleanup(handle)
 		return result, err
 	}
+	if policyState != nil {
+		policyState.started(handle, result.StartedAt)
+	}
 	profileInfo := e.Backend.ProfilingInfo(handle)
 	rootPID := profileInfo.Identity.RootPID
+	e.notifyStarted(ctx, handle, profileInfo.Identity)
 
 	var (
 		session        profiling.Session
@@ -59,6 +93,7 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 		aggErrors      []string
 		profilingErr   error
 		profilingReady bool
+		hasher         *receipt.FileHasher
 	)
 
 	if spec.Profiling != profiling.ProfilingDisabled {
@@ -71,7 +106,8 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 				Namespaces: profileInfo.Identity.Namespaces,
 				Mode:       spec.Profiling,
 			}
-			session, profilingErr = e.Profiler.Start(ctx, target)
+			// Observation must outlive a cancelled ctx so the receipt covers termination.
+			session, profilingErr = e.Profiler.Start(context.WithoutCancel(ctx), target)
 			if profilingErr == nil {
 				provenance := e.provenanceFor(spec)
 				agg = receipt.NewAggregator(provenance)
@@ -87,14 +123,18 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 					Command:         strings.Join(spec.Args, " "),
 					StartedAt:       result.StartedAt,
 					ObservationMode: observationModeForProfiling(spec.Profiling),
+					TimelineLimit:   spec.Timeline,
 				})
 				profilingReady = true
+				if spec.HashFiles && !spec.Guest {
+					hasher = receipt.NewFileHasher(spec.HashMaxSize)
+				}
 
 				aggWG.Add(1)
 				go func() {
 					defer aggWG.Done()
 					for ev := range session.Events() {
-						_ = agg.HandleEvent(ev)
+						e.handleEvent(ctx, agg, execID, policyState, hasher, ev)
 					}
 				}()
 
@@ -111,20 +151,35 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 		}
 	}
 
-	waitRes, waitErr := e.Backend.Wait(handle)
+	waitRes, waitErr, termination := e.wait(ctx, handle)
 	result.ExitCode = waitRes.ExitCode
-	result.Err = waitRes.Err
-	if result.Err == nil {
-		result.Err = waitErr
+	result.StdinHash = waitRes.StdinHash
+	if result.StdinHash == "" {
+		result.StdinHash = backendStdinHash(e.Backend)
+	}
+	runErr := waitRes.Err
+	if runErr == nil {
+		runErr = waitErr
+	}
+	result.Err = runErr
+	if termination != nil {
+		result.Termination = termination
+		result.Err = ctx.Err()
 	}
 	result.CompletedAt = time.Now()
 	result.ProfilingAttached = profilingReady
 	result.ProfilingError = profilingErr
 
+	var sessionStats profiling.Stats
 	if session != nil {
 		_ = session.Close()
+		if reporter, ok := session.(profiling.StatsReporter); ok {
+			// Counts are best effort: objects without drop accounting report none.
+			sessionStats, _ = reporter.Stats()
+		}
 	}
 	aggWG.Wait()
+	e.notifyExit(ctx, result)
 
 	extraErrors := aggErrors
 	if profErr := result.ProfilingError; profErr != nil {
@@ -138,35 +193,35 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 	resources := ResourcesFromBackend(e.Backend)
 
 	if agg != nil && profilingReady {
-		agg.EndExecution(execID, result.CompletedAt)
-		rec, ok := agg.FlushExecution(execID, result.ExitCode, result.CompletedAt.Sub(result.StartedAt))
-		if !ok {
-			rec = agg.Receipt(result.ExitCode, result.CompletedAt.Sub(result.StartedAt))
-		}
 		stdoutBytes, stderrBytes := backendOutput(e.Backend)
 		backendInfo := e.metadataForBackend()
 		provenance := e.provenanceFor(spec)
 		meta := receipt.Meta{
-			Start:           result.StartedAt,
-			End:             result.CompletedAt,
-			RootPID:         uint32(rootPID),
-			RootStartTime:   rootStartTime,
-			ExecutionID:     execID.String(),
-			Args:            spec.Args,
-			Workdir:         spec.Workdir,
-			Stdout:          stdoutBytes,
-			Stderr:          stderrBytes,
-			RunErr:          result.Err,
-			ExtraErrors:     extraErrors,
-			Resources:       resources,
-			Backend:         backendInfo,
-			Provenance:      provenance,
-			ObservationMode: observationModeForProfiling(spec.Profiling),
-			Completeness:    "closed",
-			RedactPaths:     spec.ReceiptMask,
+			Start:                result.StartedAt,
+			End:                  result.CompletedAt,
+			RootPID:              uint32(rootPID),
+			RootStartTime:        rootStartTime,
+			ExecutionID:          execID.String(),
+			Args:                 spec.Args,
+			Workdir:              spec.Workdir,
+			Stdout:               stdoutBytes,
+			Stderr:               stderrBytes,
+			StdinHash:            result.StdinHash,
+			RunErr:               runErr,
+			Termination:          termination,
+			ExtraErrors:          extraErrors,
+			Resources:            resources,
+			Backend:              backendInfo,
+			Provenance:           provenance,
+			ObservationMode:      observationModeForProfiling(spec.Profiling),
+			ObservationMechanism: e.Profiler.Capabilities().Mechanism,
+			Completeness:         "closed",
+			RedactPaths:          spec.ReceiptMask,
 		}
-		receipt.PopulateMetadata(&rec, meta)
-		result.Receipt = &rec
+		e.finishReceipt(ctx, agg, execID, meta, sessionStats.Drops, policyState, hasher, &result)
+	} else if policyState != nil {
+		verdict := policyState.finish(ctx, nil)
+		result.Verdict = &verdict
 	}
 
 	if cleanupErr := e.Backend.Cleanup(handle); cleanupErr != nil && result.Err == nil {
@@ -176,6 +231,127 @@ func (e Engine) Run(ctx context.Context, spec ExecutionSpec) (ExecutionResult, e
 	return result, result.Err
 }
 
+// handleEvent feeds one profiling event to the aggregator, the runtime
+// policy, the file hasher and observers.
+func (e Engine) handleEvent(ctx context.Context, agg *receipt.Aggregator, execID identity.ExecutionID, policyState *policyRun, hasher *receipt.FileHasher, ev profiling.Event) {
+	id := agg.HandleEvent(ev)
+	if policyState != nil && id == execID {
+		policyState.handleEvent(ctx, agg, execID, ev)
+	}
+	if hasher != nil && id == execID {
+		hasher.Observe(ev)
+	}
+	e.notifyEvent(ctx, ev)
+}
+
+// finishReceipt flushes the execution from the aggregator, adds metadata,
+// drop counts and file hashes, and applies post-execution policy.
+func (e Engine) finishReceipt(ctx context.Context, agg *receipt.Aggregator, execID identity.ExecutionID, meta receipt.Meta, drops map[profiling.EventType]uint64, policyState *policyRun, hasher *receipt.FileHasher, result *ExecutionResult) {
+	duration := meta.End.Sub(meta.Start)
+	agg.EndExecution(execID, meta.End)
+	rec, ok := agg.FlushExecution(execID, result.ExitCode, duration)
+	if !ok {
+		rec = agg.Receipt(result.ExitCode, duration)
+	}
+	receipt.PopulateMetadata(&rec, meta)
+	rec.ApplyDrops(drops)
+	if hasher != nil {
+		hasher.Apply(&rec)
+	}
+	if policyState != nil {
+		verdict := policyState.finish(ctx, &rec)
+		result.Verdict = &verdict
+	}
+	e.notifyReceipt(ctx, &rec)
+	result.Receipt = &rec
+}
+
+// launchSpec returns the spec handed to the backend. Profilers that observe
+// through a shim wrap the command; everything else sees the original spec.
+func (e Engine) launchSpec(spec ExecutionSpec) ExecutionSpec {
+	if spec.Profiling == profiling.ProfilingDisabled {
+		return spec
+	}
+	if wrapper, ok := e.Profiler.(profiling.CommandWrapper); ok {
+		spec.Args = wrapper.WrapCommand(spec.Args)
+	}
+	return spec
+}
+
+func (e Engine) start(ctx context.Context, spec ExecutionSpec) (ExecutionHandle, error) {
+	if err := ctx.Err(); err != nil {
+		return ExecutionHandle{}, err
+	}
+	if cb, ok := e.Backend.(ContextBackend); ok {
+		return cb.StartContext(ctx, spec)
+	}
+	return e.Backend.Start(spec)
+}
+
+type waitOutcome struct {
+	res ExecutionResult
+	err error
+}
+
+// wait blocks until the execution exits. When ctx is done first, the execution
+// is terminated with SIGTERM (ContextBackends only) and then Kill, each bounded
+// by a grace period.
+func (e Engine) wait(ctx context.Context, h ExecutionHandle) (ExecutionResult, error, *receipt.Termination) {
+	done := make(chan waitOutcome, 1)
+	go func() {
+		res, err := e.Backend.Wait(h)
+		done <- waitOutcome{res: res, err: err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.res, out.err, nil
+	case <-ctx.Done():
+	}
+
+	term := &receipt.Termination{Reason: terminationReason(ctx.Err()), Signals: []string{}}
+	if cb, ok := e.Backend.(ContextBackend); ok {
+		if err := cb.Signal(h, syscall.SIGTERM); err == nil {
+			term.Signals = append(term.Signals, "SIGTERM")
+			select {
+			case out := <-done:
+				term.Method = "graceful"
+				return out.res, out.err, term
+			case <-time.After(durationOr(e.TermGrace, defaultTermGrace)):
+			}
+		}
+	}
+
+	term.Signals = append(term.Signals, "SIGKILL")
+	killErr := e.Backend.Kill(h)
+	select {
+	case out := <-done:
+		term.Method = "forced"
+		return out.res, out.err, term
+	case <-time.After(durationOr(e.KillGrace, defaultKillGrace)):
+	}
+	term.Method = "abandoned"
+	err := errors.New("execution did not exit after kill")
+	if killErr != nil {
+		err = fmt.Errorf("kill: %w", killErr)
+	}
+	return ExecutionResult{Handle: h, ExitCode: -1, Err: err}, err, term
+}
+
+func terminationReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "deadline exceeded"
+	}
+	return "canceled"
+}
+
+func durationOr(value, fallback time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
 func (e Engine) validateSpec(spec ExecutionSpec) error {
 	if len(spec.Args) == 0 {
 		return errors.New("no command provided")
@@ -225,6 +401,13 @@ func backendOutput(b ExecutionBackend) ([]byte, []byte) {
 	return nil, nil
 }
 
+func backendStdinHash(b ExecutionBackend) string {
+	if inputProvider, ok := b.(InputProvider); ok {
+		return inputProvider.StdinHash()
+	}
+	return ""
+}
+
 func ResourcesFromBackend(b ExecutionBackend) receipt.Resources {
 	if psProvider, ok := b.(ProcessStateProvider); ok {
 		if ps := psProvider.ProcessState(); ps != nil {
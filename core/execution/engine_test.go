@@ -2,7 +2,14 @@ package execution
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"glasshouse/core/profiling"
 	"glasshouse/core/receipt"
@@ -58,6 +65,65 @@ func TestEngineBuildsReceiptWhenProfilingEnabled(t *testing.T) {
 	}
 }
 
+type lossyProfiler struct{ stubProfiler }
+
+type lossySession struct{ stubSession }
+
+func (p lossyProfiler) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	session, err := p.stubProfiler.Start(ctx, target)
+	return lossySession{session.(stubSession)}, err
+}
+
+func (s lossySession) Stats() (profiling.Stats, error) {
+	return profiling.Stats{Drops: map[profiling.EventType]uint64{profiling.EventOpen: 3}}, nil
+}
+
+func TestEngineMarksReceiptLossyOnDrops(t *testing.T) {
+	engine := Engine{
+		Backend:  &testBackend{exitCode: 0},
+		Profiler: lossyProfiler{},
+	}
+	result, err := engine.Run(context.Background(), ExecutionSpec{
+		Args:      []string{"/bin/true"},
+		Profiling: profiling.ProfilingHost,
+	})
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	rec := result.Receipt
+	if rec == nil || rec.Completeness != "lossy" || rec.Drops["open"] != 3 {
+		t.Fatalf("expected lossy receipt, got %+v", rec)
+	}
+}
+
+type wrappingProfiler struct{ stubProfiler }
+
+func (p wrappingProfiler) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: true, Mechanism: profiling.MechanismPtrace}
+}
+
+func (p wrappingProfiler) WrapCommand(args []string) []string {
+	return append([]string{"shim", "--"}, args...)
+}
+
+func TestEngineLaunchesThroughCommandWrapper(t *testing.T) {
+	b := &testBackend{exitCode: 0}
+	engine := Engine{Backend: b, Profiler: wrappingProfiler{}}
+	result, err := engine.Run(context.Background(), ExecutionSpec{
+		Args:      []string{"/bin/true"},
+		Profiling: profiling.ProfilingHost,
+	})
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if strings.Join(b.args, " ") != "shim -- /bin/true" {
+		t.Fatalf("backend started %v", b.args)
+	}
+	if result.Receipt == nil || result.Receipt.ObservationMechanism != profiling.MechanismPtrace {
+		t.Fatalf("expected ptrace mechanism in receipt, got %+v", result.Receipt)
+	}
+}
+
 func TestEngineSkipsReceiptWhenProfilingDisabled(t *testing.T) {
 	engine := Engine{
 		Backend:  &testBackend{exitCode: 0},
@@ -100,6 +166,7 @@ type testBackend struct {
 	exitCode int
 	startErr error
 	waitErr  error
+	args     []string
 }
 
 func (t *testBackend) Name() string { return "test" }
@@ -107,7 +174,7 @@ func (t *testBackend) Prepare(ctx context.Context) error {
 	return ctx.Err()
 }
 func (t *testBackend) Start(spec ExecutionSpec) (ExecutionHandle, error) {
-	_ = spec
+	t.args = spec.Args
 	return ExecutionHandle{ID: "test"}, t.startErr
 }
 func (t *testBackend) Wait(h ExecutionHandle) (ExecutionResult, error) {
@@ -139,3 +206,147 @@ func (t *testBackend) Metadata() receipt.ExecutionInfo {
 }
 
 var _ ExecutionBackend = (*testBackend)(nil)
+
+func TestEngineTerminatesOnDeadline(t *testing.T) {
+	cases := []struct {
+		name        string
+		ignoreTerm  bool
+		refuseTerm  bool
+		wantMethod  string
+		wantSignals int
+	}{
+		{name: "graceful", wantMethod: "graceful", wantSignals: 1},
+		{name: "forced", ignoreTerm: true, wantMethod: "forced", wantSignals: 2},
+		{name: "unsignalled", refuseTerm: true, wantMethod: "forced", wantSignals: 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &blockingBackend{testBackend: testBackend{}, ignoreTerm: tc.ignoreTerm, refuseTerm: tc.refuseTerm, exited: make(chan struct{})}
+			engine := Engine{
+				Backend:   b,
+				Profiler:  stubProfiler{},
+				TermGrace: 20 * time.Millisecond,
+				KillGrace: time.Second,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			result, err := engine.Run(ctx, ExecutionSpec{Args: []string{"sleep"}, Profiling: profiling.ProfilingHost})
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline error, got %v", err)
+			}
+			if result.Termination == nil || result.Termination.Method != tc.wantMethod {
+				t.Fatalf("unexpected termination %+v", result.Termination)
+			}
+			if len(result.Termination.Signals) != tc.wantSignals {
+				t.Fatalf("unexpected signals %v", result.Termination.Signals)
+			}
+			if result.Receipt == nil || result.Receipt.Outcome == nil || result.Receipt.Outcome.Error == nil {
+				t.Fatal("expected receipt outcome error")
+			}
+			if got := *result.Receipt.Outcome.Error; !strings.HasPrefix(got, "deadline exceeded") {
+				t.Fatalf("outcome error %q", got)
+			}
+			if result.Receipt.Outcome.Termination == nil {
+				t.Fatal("expected termination in receipt outcome")
+			}
+		})
+	}
+}
+
+// blockingBackend runs until it is signalled or killed.
+type blockingBackend struct {
+	testBackend
+	ignoreTerm bool
+	refuseTerm bool
+	once       sync.Once
+	exited     chan struct{}
+}
+
+func (b *blockingBackend) StartContext(ctx context.Context, spec ExecutionSpec) (ExecutionHandle, error) {
+	if err := ctx.Err(); err != nil {
+		return ExecutionHandle{}, err
+	}
+	return b.Start(spec)
+}
+
+func (b *blockingBackend) Wait(h ExecutionHandle) (ExecutionResult, error) {
+	<-b.exited
+	return ExecutionResult{Handle: h, ExitCode: 137}, nil
+}
+
+func (b *blockingBackend) Signal(h ExecutionHandle, sig os.Signal) error {
+	_ = h
+	if sig == syscall.SIGTERM && b.refuseTerm {
+		return errors.New("cannot signal workload")
+	}
+	if sig == syscall.SIGTERM && b.ignoreTerm {
+		return nil
+	}
+	b.once.Do(func() { close(b.exited) })
+	return nil
+}
+
+func (b *blockingBackend) Kill(h ExecutionHandle) error {
+	_ = h
+	b.once.Do(func() { close(b.exited) })
+	return nil
+}
+
+var _ ContextBackend = (*blockingBackend)(nil)
+
+func TestEngineObserverCallbacks(t *testing.T) {
+	obs := &recordingObserver{}
+	engine := Engine{
+		Backend:   &testBackend{exitCode: 0},
+		Profiler:  stubProfiler{},
+		Observers: []Observer{obs},
+	}
+	_, err := engine.Run(context.Background(), ExecutionSpec{Args: []string{"/bin/true"}, Profiling: profiling.ProfilingHost})
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	want := []string{"prepared", "started:4242", "exit", "receipt"}
+	if strings.Join(obs.calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("callbacks %v, want %v", obs.calls, want)
+	}
+}
+
+func TestEngineObserverVetoesStart(t *testing.T) {
+	b := &testBackend{exitCode: 0}
+	obs := &recordingObserver{veto: errors.New("quota exhausted")}
+	engine := Engine{Backend: b, Observers: []Observer{obs}}
+	result, err := engine.Run(context.Background(), ExecutionSpec{Args: []string{"/bin/true"}})
+	if !errors.Is(err, ErrStartVetoed) {
+		t.Fatalf("expected veto error, got %v", err)
+	}
+	if result.Handle.ID != "" {
+		t.Fatalf("backend should not start, got handle %q", result.Handle.ID)
+	}
+	if len(obs.calls) != 1 {
+		t.Fatalf("unexpected callbacks %v", obs.calls)
+	}
+}
+
+type recordingObserver struct {
+	NopObserver
+	veto  error
+	calls []string
+}
+
+func (o *recordingObserver) OnPrepared(ctx context.Context, spec ExecutionSpec) error {
+	o.calls = append(o.calls, "prepared")
+	return o.veto
+}
+
+func (o *recordingObserver) OnStarted(ctx context.Context, h ExecutionHandle, id ExecutionIdentity) {
+	o.calls = append(o.calls, fmt.Sprintf("started:%d", id.RootPID))
+}
+
+func (o *recordingObserver) OnExit(ctx context.Context, result ExecutionResult) {
+	o.calls = append(o.calls, "exit")
+}
+
+func (o *recordingObserver) OnReceipt(ctx context.Context, rec *receipt.Receipt) {
+	o.calls = append(o.calls, "receipt")
+}
@@ -0,0 +1,70 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// ErrStartVetoed is wrapped by the error returned when an observer rejects a start.
+var ErrStartVetoed = errors.New("start vetoed by observer")
+
+// Observer receives engine lifecycle callbacks. Callbacks run synchronously on
+// engine goroutines and should return quickly; OnEvent runs on the profiling
+// event loop and is only called when profiling is attached.
+type Observer interface {
+	// OnPrepared runs after Prepare and before Start. A non-nil error vetoes the start.
+	OnPrepared(ctx context.Context, spec ExecutionSpec) error
+	OnStarted(ctx context.Context, h ExecutionHandle, id ExecutionIdentity)
+	OnEvent(ctx context.Context, ev profiling.Event)
+	OnExit(ctx context.Context, result ExecutionResult)
+	// OnReceipt may annotate the receipt before it is returned to the caller.
+	OnReceipt(ctx context.Context, rec *receipt.Receipt)
+}
+
+// NopObserver implements Observer with no-op callbacks. Embed it to override a subset.
+type NopObserver struct{}
+
+func (NopObserver) OnPrepared(ctx context.Context, spec ExecutionSpec) error               { return nil }
+func (NopObserver) OnStarted(ctx context.Context, h ExecutionHandle, id ExecutionIdentity) {}
+func (NopObserver) OnEvent(ctx context.Context, ev profiling.Event)                        {}
+func (NopObserver) OnExit(ctx context.Context, result ExecutionResult)                     {}
+func (NopObserver) OnReceipt(ctx context.Context, rec *receipt.Receipt)                    {}
+
+func (e Engine) notifyPrepared(ctx context.Context, spec ExecutionSpec) error {
+	for _, obs := range e.Observers {
+		if err := obs.OnPrepared(ctx, spec); err != nil {
+			return fmt.Errorf("%w: %v", ErrStartVetoed, err)
+		}
+	}
+	return nil
+}
+
+func (e Engine) notifyStarted(ctx context.Context, h ExecutionHandle, id ExecutionIdentity) {
+	for _, obs := range e.Observers {
+		obs.OnStarted(ctx, h, id)
+	}
+}
+
+func (e Engine) notifyEvent(ctx context.Context, ev profiling.Event) {
+	for _, obs := range e.Observers {
+		obs.OnEvent(ctx, ev)
+	}
+}
+
+func (e Engine) notifyExit(ctx context.Context, result ExecutionResult) {
+	for _, obs := range e.Observers {
+		obs.OnExit(ctx, result)
+	}
+}
+
+func (e Engine) notifyReceipt(ctx context.Context, rec *receipt.Receipt) {
+	for _, obs := range e.Observers {
+		obs.OnReceipt(ctx, rec)
+	}
+}
+
+var _ Observer = NopObserver{}
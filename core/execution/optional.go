@@ -1,11 +1,22 @@
 package execution
 
 import (
+	"context"
 	"os"
 
 	"glasshouse/core/receipt"
 )
 
+// ContextBackend is implemented by backends that honour a context while
+// starting and can deliver signals, letting the engine escalate termination
+// from SIGTERM to Kill when the caller's context is done. Signal fails when
+// the workload itself cannot be signalled; the engine then kills it and
+// records a forced termination.
+type ContextBackend interface {
+	StartContext(ctx context.Context, spec ExecutionSpec) (ExecutionHandle, error)
+	Signal(h ExecutionHandle, sig os.Signal) error
+}
+
 // ExtraErrorProvider allows backends to surface non-fatal errors collected during execution.
 type ExtraErrorProvider interface {
 	ExtraErrors() []string
@@ -17,6 +28,16 @@ type OutputProvider interface {
 	Stderr() []byte
 }
 
+// InputProvider allows backends to expose a digest of the stdin consumed by the execution.
+type InputProvider interface {
+	StdinHash() string
+}
+
+// TerminalResizer is implemented by backends that can resize an execution's PTY.
+type TerminalResizer interface {
+	Resize(h ExecutionHandle, rows, cols uint16) error
+}
+
 // ProcessStateProvider is implemented by backends that can expose process resource usage.
 type ProcessStateProvider interface {
 	ProcessState() *os.ProcessState
@@ -26,3 +47,9 @@ type ProcessStateProvider interface {
 type MetadataProvider interface {
 	Metadata() receipt.ExecutionInfo
 }
+
+// ProcessKiller is implemented by backends that can kill a single process of
+// an execution, used for kill_process policy enforcement.
+type ProcessKiller interface {
+	KillProcess(h ExecutionHandle, pid uint32) error
+}
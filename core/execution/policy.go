@@ -0,0 +1,187 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"glasshouse/core/identity"
+	"glasshouse/core/policy"
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// ErrPolicyDenied is wrapped by the error returned when a pre-execution rule blocks a start.
+var ErrPolicyDenied = fmt.Errorf("denied by policy")
+
+// policyRun evaluates the engine policy across the phases of one execution.
+type policyRun struct {
+	policy  policy.Policy
+	backend ExecutionBackend
+	// now dates runtime evaluations; replays use the event timestamps.
+	now func(ev profiling.Event) time.Time
+
+	mu         sync.Mutex
+	handle     ExecutionHandle
+	startedAt  time.Time
+	pids       map[uint32]struct{}
+	preResults []policy.Violation
+	// runtimeHit lists runtime rules in the order they first matched; each
+	// rule is recorded once however many events match it.
+	runtimeHit []string
+	hitRules   map[string]bool
+	killed     map[uint32]bool
+	killOnce   sync.Once
+}
+
+func newPolicyRun(p policy.Policy, backend ExecutionBackend) *policyRun {
+	return &policyRun{
+		policy:   p,
+		backend:  backend,
+		now:      func(profiling.Event) time.Time { return time.Now() },
+		pids:     make(map[uint32]struct{}),
+		hitRules: make(map[string]bool),
+		killed:   make(map[uint32]bool),
+	}
+}
+
+// evaluatePre applies pre-execution rules. Violations with an enforcement
+// action block the start; audit-only violations are kept for the receipt.
+func (p *policyRun) evaluatePre(ctx context.Context, spec ExecutionSpec, now time.Time) error {
+	violations := policy.PreEvaluator{Policy: p.policy}.Evaluate(ctx, policy.PreExecutionContext{
+		Labels:    spec.Labels,
+		StartedAt: now,
+	})
+	p.preResults = violations
+	blocked := []string{}
+	for _, violation := range violations {
+		if violation.Action != policy.EnforcementNone && violation.Action != "" {
+			blocked = append(blocked, violation.Rule)
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Errorf("%w: pre-execution rules %v", ErrPolicyDenied, blocked)
+	}
+	return nil
+}
+
+func (p *policyRun) started(h ExecutionHandle, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handle = h
+	p.startedAt = at
+}
+
+// handleEvent applies runtime rules to an event attributed to the execution
+// and enforces kill actions through the backend.
+func (p *policyRun) handleEvent(ctx context.Context, agg *receipt.Aggregator, execID identity.ExecutionID, ev profiling.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now(ev)
+	p.pids[ev.PID] = struct{}{}
+	violations := policy.RuntimeEvaluator{Policy: p.policy}.Evaluate(ctx, ev, policy.RuntimeContext{
+		ExecutionID:  execID.String(),
+		StartedAt:    p.startedAt,
+		Now:          now,
+		ProcessCount: len(p.pids),
+		Duration:     now.Sub(p.startedAt),
+	})
+	for _, violation := range violations {
+		if !p.hitRules[violation.Rule] {
+			p.hitRules[violation.Rule] = true
+			agg.RecordPolicyViolation(execID, receiptViolation(violation))
+			p.runtimeHit = append(p.runtimeHit, violation.Rule)
+		}
+		if violation.Action == policy.EnforcementNone || violation.Action == "" {
+			continue
+		}
+		agg.SetPolicyFailed(execID, true)
+		target, acted, err := p.enforce(violation.Action, ev.PID)
+		if !acted {
+			continue
+		}
+		agg.RecordPolicyEnforcement(execID, receipt.PolicyEnforcement{
+			Action:  string(violation.Action),
+			Target:  target,
+			Rule:    violation.Rule,
+			Message: errorMessage(err),
+		})
+	}
+}
+
+// enforce is idempotent: each process and the execution are stopped at most
+// once, and acted reports whether this call did so.
+func (p *policyRun) enforce(action policy.EnforcementAction, pid uint32) (target string, acted bool, err error) {
+	if action == policy.EnforcementKillProcess {
+		if killer, ok := p.backend.(ProcessKiller); ok {
+			target = fmt.Sprintf("pid:%d", pid)
+			if p.killed[pid] {
+				return target, false, nil
+			}
+			p.killed[pid] = true
+			return target, true, killer.KillProcess(p.handle, pid)
+		}
+	}
+	// Without per-process control the whole execution is stopped.
+	p.killOnce.Do(func() {
+		acted = true
+		err = p.backend.Kill(p.handle)
+	})
+	return "execution:" + p.handle.ID, acted, err
+}
+
+// finish applies post-execution rules to the receipt and returns the overall verdict.
+func (p *policyRun) finish(ctx context.Context, rec *receipt.Receipt) policy.Verdict {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reasons := append([]string{}, p.runtimeHit...)
+	for _, violation := range p.preResults {
+		reasons = append(reasons, violation.Rule)
+	}
+	if rec == nil {
+		return buildVerdict(reasons)
+	}
+
+	if rec.Policy == nil {
+		rec.Policy = &receipt.PolicyInfo{}
+	}
+	for _, violation := range p.preResults {
+		rec.Policy.Violations = append(rec.Policy.Violations, receiptViolation(violation))
+	}
+	post := policy.Evaluator{Policy: p.policy}.Evaluate(ctx, *rec)
+	for _, reason := range post.Reasons {
+		rec.Policy.Violations = append(rec.Policy.Violations, receipt.PolicyViolation{
+			Phase: string(policy.PhasePostExecution),
+			Rule:  reason,
+		})
+	}
+	reasons = append(reasons, post.Reasons...)
+	verdict := buildVerdict(reasons)
+	rec.Policy.Trusted = verdict.Allowed
+	return verdict
+}
+
+func buildVerdict(reasons []string) policy.Verdict {
+	sort.Strings(reasons)
+	return policy.Verdict{Allowed: len(reasons) == 0, Reasons: reasons}
+}
+
+func receiptViolation(v policy.Violation) receipt.PolicyViolation {
+	return receipt.PolicyViolation{
+		Phase:   string(v.Phase),
+		Rule:    v.Rule,
+		Action:  string(v.Action),
+		Message: v.Message,
+	}
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
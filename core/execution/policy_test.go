@@ -0,0 +1,122 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"glasshouse/core/policy"
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+type eventProfiler struct {
+	events []profiling.Event
+}
+
+func (p eventProfiler) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	_ = ctx
+	_ = target
+	ev := make(chan profiling.Event, len(p.events))
+	for _, e := range p.events {
+		ev <- e
+	}
+	close(ev)
+	errs := make(chan error)
+	close(errs)
+	return stubSession{events: ev, errs: errs}, nil
+}
+
+func (p eventProfiler) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: true}
+}
+
+type killRecordingBackend struct {
+	testBackend
+	kills    int
+	procKill []uint32
+}
+
+func (b *killRecordingBackend) Kill(h ExecutionHandle) error {
+	_ = h
+	b.kills++
+	return nil
+}
+
+func (b *killRecordingBackend) KillProcess(h ExecutionHandle, pid uint32) error {
+	_ = h
+	b.procKill = append(b.procKill, pid)
+	return nil
+}
+
+func TestEnginePolicyPreRuleBlocksStart(t *testing.T) {
+	b := &killRecordingBackend{}
+	engine := Engine{
+		Backend: b,
+		Policy: &policy.Policy{PreRules: []policy.PreRule{{
+			Name:   "no-untrusted",
+			Match:  func(ctx policy.PreExecutionContext) bool { return ctx.Labels["trust"] != "none" },
+			Action: policy.EnforcementKillExecution,
+		}}},
+	}
+	spec := ExecutionSpec{Args: []string{"/bin/true"}, Labels: map[string]string{"trust": "none"}}
+	result, err := engine.Run(context.Background(), spec)
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Fatalf("expected policy denial, got %v", err)
+	}
+	if result.Verdict == nil || result.Verdict.Allowed {
+		t.Fatalf("expected denied verdict, got %+v", result.Verdict)
+	}
+	if result.Handle.ID != "" {
+		t.Fatalf("execution should not start, got handle %q", result.Handle.ID)
+	}
+}
+
+func TestEnginePolicyRuntimeAndPostRules(t *testing.T) {
+	b := &killRecordingBackend{}
+	engine := Engine{
+		Backend: b,
+		Profiler: eventProfiler{events: []profiling.Event{
+			{Type: profiling.EventConnect, PID: 4242, Port: 443},
+			{Type: profiling.EventConnect, PID: 4242, Port: 443},
+			{Type: profiling.EventFork, PID: 4243, PPID: 4242},
+			{Type: profiling.EventConnect, PID: 4243, Port: 80},
+			{Type: profiling.EventConnect, PID: 4242, Port: 443},
+		}},
+		Policy: &policy.Policy{
+			RuntimeRules: []policy.RuntimeRule{{
+				Name:   "no-network",
+				Match:  func(ev profiling.Event, ctx policy.RuntimeContext) bool { return ev.Type != profiling.EventConnect },
+				Action: policy.EnforcementKillProcess,
+			}},
+			PostRules: []policy.Rule{{
+				Name:  "never",
+				Match: func(r receipt.Receipt) bool { return false },
+			}},
+		},
+	}
+	spec := ExecutionSpec{Args: []string{"/bin/true"}, Profiling: profiling.ProfilingHost}
+	result, err := engine.Run(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	if len(b.procKill) != 2 || b.procKill[0] != 4242 || b.procKill[1] != 4243 {
+		t.Fatalf("expected one kill_process each on 4242 and 4243, got %v", b.procKill)
+	}
+	if result.Verdict == nil || result.Verdict.Allowed || len(result.Verdict.Reasons) != 2 {
+		t.Fatalf("expected denied verdict, got %+v", result.Verdict)
+	}
+	rec := result.Receipt
+	if rec == nil || rec.Policy == nil {
+		t.Fatal("expected receipt policy info")
+	}
+	if rec.Policy.Trusted || !rec.Policy.Failed {
+		t.Fatalf("unexpected policy info: %+v", rec.Policy)
+	}
+	if len(rec.Policy.Enforcements) != 2 || rec.Policy.Enforcements[0].Target != "pid:4242" {
+		t.Fatalf("unexpected enforcements: %+v", rec.Policy.Enforcements)
+	}
+	if len(rec.Policy.Violations) != 2 {
+		t.Fatalf("expected runtime and post violations, got %+v", rec.Policy.Violations)
+	}
+}
@@ -0,0 +1,152 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"glasshouse/core/identity"
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// Replay describes a recorded execution. Engine.Replay feeds its events,
+// read back by the engine's Profiler, through the same aggregation and
+// policy steps as Run.
+type Replay struct {
+	Spec          ExecutionSpec
+	Handle        ExecutionHandle
+	Identity      ExecutionIdentity
+	RootStartTime uint64
+	StartedAt     time.Time
+	CompletedAt   time.Time
+	ExitCode      int
+	// Meta carries the recorded receipt metadata. Start, End and the fields
+	// derived from Spec are filled in by Replay.
+	Meta  receipt.Meta
+	Drops map[profiling.EventType]uint64
+}
+
+// Replay rebuilds the receipt of a recorded execution without running it.
+// Runtime policy sees event timestamps as the current time, and enforcement
+// actions are recorded but cannot change what the execution did.
+func (e Engine) Replay(ctx context.Context, r Replay) (ExecutionResult, error) {
+	spec := r.Spec
+	result := ExecutionResult{
+		Handle:           r.Handle,
+		ExitCode:         r.ExitCode,
+		StartedAt:        r.StartedAt,
+		CompletedAt:      r.CompletedAt,
+		ProfilingEnabled: spec.Profiling != profiling.ProfilingDisabled,
+	}
+	if e.Profiler == nil {
+		result.Err = errors.New("replay requires a profiler")
+		return result, result.Err
+	}
+
+	var policyState *policyRun
+	if e.Policy != nil {
+		policyState = newPolicyRun(*e.Policy, replayBackend{})
+		policyState.now = func(ev profiling.Event) time.Time {
+			if ev.Timestamp.IsZero() {
+				return r.StartedAt
+			}
+			return ev.Timestamp
+		}
+		if err := policyState.evaluatePre(ctx, spec, r.StartedAt); err != nil {
+			verdict := policyState.finish(ctx, nil)
+			result.Verdict = &verdict
+			result.Err = err
+			return result, err
+		}
+		policyState.started(r.Handle, r.StartedAt)
+	}
+
+	session, err := e.Profiler.Start(ctx, profiling.Target{
+		RootPID:    r.Identity.RootPID,
+		CgroupPath: r.Identity.CgroupPath,
+		Namespaces: r.Identity.Namespaces,
+		Mode:       spec.Profiling,
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("start replay: %w", err)
+		return result, result.Err
+	}
+	agg := receipt.NewAggregator(e.provenanceFor(spec))
+	// An explicit ID keeps the aggregator from resolving the recorded root
+	// against this host's /proc.
+	execID := agg.StartExecution(receipt.ExecutionStart{
+		ID:              identity.FromRoot(uint32(r.Identity.RootPID), r.RootStartTime),
+		RootPID:         uint32(r.Identity.RootPID),
+		RootStartTime:   r.RootStartTime,
+		Command:         strings.Join(spec.Args, " "),
+		StartedAt:       r.StartedAt,
+		ObservationMode: observationModeForProfiling(spec.Profiling),
+		TimelineLimit:   spec.Timeline,
+	})
+	result.ProfilingAttached = true
+
+	errs := make(chan []string, 1)
+	go func() {
+		var messages []string
+		for err := range session.Errors() {
+			if err != nil {
+				messages = append(messages, err.Error())
+			}
+		}
+		errs <- messages
+	}()
+	for ev := range session.Events() {
+		e.handleEvent(ctx, agg, execID, policyState, nil, ev)
+	}
+	_ = session.Close()
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result, err
+	}
+	if messages := <-errs; len(messages) > 0 {
+		result.Err = fmt.Errorf("replay: %s", strings.Join(messages, "; "))
+		return result, result.Err
+	}
+	e.notifyExit(ctx, result)
+
+	meta := r.Meta
+	meta.Start = r.StartedAt
+	meta.End = r.CompletedAt
+	meta.RootPID = uint32(r.Identity.RootPID)
+	meta.RootStartTime = r.RootStartTime
+	meta.Args = spec.Args
+	meta.Workdir = spec.Workdir
+	meta.RedactPaths = spec.ReceiptMask
+	if meta.Provenance == "" {
+		meta.Provenance = e.provenanceFor(spec)
+	}
+	if meta.ObservationMode == "" {
+		meta.ObservationMode = observationModeForProfiling(spec.Profiling)
+	}
+	// Recorded paths describe the original host, so files are not hashed.
+	e.finishReceipt(ctx, agg, execID, meta, r.Drops, policyState, nil, &result)
+	return result, nil
+}
+
+// replayBackend absorbs enforcement during a replay; there is nothing left
+// to stop.
+type replayBackend struct{}
+
+func (replayBackend) Name() string                      { return "replay" }
+func (replayBackend) Prepare(ctx context.Context) error { return nil }
+func (replayBackend) Start(spec ExecutionSpec) (ExecutionHandle, error) {
+	return ExecutionHandle{}, errors.New("replay backend cannot start executions")
+}
+func (replayBackend) Wait(h ExecutionHandle) (ExecutionResult, error) {
+	return ExecutionResult{Handle: h}, nil
+}
+func (replayBackend) Kill(h ExecutionHandle) error    { return nil }
+func (replayBackend) Cleanup(h ExecutionHandle) error { return nil }
+func (replayBackend) ProfilingInfo(h ExecutionHandle) BackendProfilingInfo {
+	return BackendProfilingInfo{}
+}
+
+var _ ExecutionBackend = replayBackend{}
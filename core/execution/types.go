@@ -1,8 +1,10 @@
 package execution
 
 import (
+	"io"
 	"time"
 
+	"glasshouse/core/policy"
 	"glasshouse/core/profiling"
 	"glasshouse/core/receipt"
 )
@@ -17,6 +19,28 @@ type ExecutionSpec struct {
 	Profiling   profiling.Mode
 	Labels      map[string]string
 	ReceiptMask []string
+	// Stdin is fed to the execution's standard input. When nil, StdinReader is
+	// used instead; when both are nil the execution reads from /dev/null.
+	Stdin       []byte
+	StdinReader io.Reader
+	// PTY attaches the execution to a pseudo-terminal instead of pipes.
+	// Stdout and stderr are merged when a PTY is used.
+	PTY *PTYConfig
+	// Timeline adds an ordered event timeline of at most this many entries
+	// to the receipt. Zero omits it.
+	Timeline int
+	// HashFiles records SHA-256, size and mtime of files the execution reads
+	// and writes in the receipt. Files larger than HashMaxSize bytes are
+	// listed without a hash; zero uses receipt.DefaultFileHashMaxSize. Guest
+	// executions are not hashed since their paths are not local.
+	HashFiles   bool
+	HashMaxSize int64
+}
+
+// PTYConfig describes the initial pseudo-terminal window size.
+type PTYConfig struct {
+	Rows uint16
+	Cols uint16
 }
 
 // ExecutionHandle identifies a running execution in a backend.
@@ -50,5 +74,14 @@ type ExecutionResult struct {
 	ProfilingEnabled  bool
 	ProfilingAttached bool
 	ProfilingError    error
-	Receipt           *receipt.Receipt
+	// Termination is set when the engine stopped the execution because the
+	// caller's context was done.
+	Termination *receipt.Termination
+	// StdinHash is the SHA-256 of the stdin a backend staged for this
+	// execution, for backends that report it per execution rather than
+	// through InputProvider.
+	StdinHash string
+	// Verdict is set when the engine has a policy configured.
+	Verdict *policy.Verdict
+	Receipt *receipt.Receipt
 }
@@ -0,0 +1,303 @@
+// Package intoto converts receipts to in-toto attestations with a
+// SLSA-provenance-style predicate.
+//
+// The subjects are what the execution produced: stdout and the files it
+// wrote. The predicate describes how: the command line, the environment
+// and backend it ran in, the files it read and executed, and byproducts
+// such as the process tree, network activity and outcome.
+package intoto
+
+import (
+	"errors"
+	"sort"
+
+	"glasshouse/core/receipt"
+	"glasshouse/core/version"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// BuildType identifies the glasshouse run semantics of the predicate.
+	BuildType = "urn:glasshouse:buildtype:run:v1"
+	// BuilderID is prefixed to the receipt provenance (host, guest, ...).
+	BuilderID = "urn:glasshouse:builder:"
+)
+
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Provenance           `json:"predicate"`
+}
+
+// ResourceDescriptor is the in-toto v1 resource descriptor.
+type ResourceDescriptor struct {
+	Name        string            `json:"name,omitempty"`
+	URI         string            `json:"uri,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	MediaType   string            `json:"mediaType,omitempty"`
+	Annotations map[string]any    `json:"annotations,omitempty"`
+}
+
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   map[string]any       `json:"externalParameters"`
+	InternalParameters   map[string]any       `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type RunDetails struct {
+	Builder    Builder              `json:"builder"`
+	Metadata   Metadata             `json:"metadata"`
+	Byproducts []ResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type Metadata struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	StartedOn    string `json:"startedOn,omitempty"`
+	FinishedOn   string `json:"finishedOn,omitempty"`
+}
+
+// Options tune the conversion.
+type Options struct {
+	// Digest returns the sha256 of a written file the receipt recorded no
+	// hash for. Such subjects carry a "digest_source" annotation of
+	// "export", since the content was not observed during the run. Written
+	// files without a digest are listed as byproducts instead of subjects.
+	Digest func(path string) (string, bool)
+}
+
+var ErrNoSubjects = errors.New("receipt has no outputs with digests to attest")
+
+// FromReceipt builds an in-toto statement for rec.
+func FromReceipt(rec *receipt.Receipt, opts Options) (Statement, error) {
+	var subjects, undigested []ResourceDescriptor
+	if rec.Artifacts != nil && rec.Artifacts.StdoutHash != "" {
+		subjects = append(subjects, ResourceDescriptor{Name: "stdout", Digest: sha256Digest(rec.Artifacts.StdoutHash)})
+	}
+	for _, path := range writtenFiles(rec) {
+		desc := ResourceDescriptor{Name: path, URI: fileURI(path)}
+		if sum := recordedDigest(rec, path, false); sum != "" {
+			desc.Digest = sha256Digest(sum)
+			subjects = append(subjects, desc)
+			continue
+		}
+		if opts.Digest != nil {
+			if sum, ok := opts.Digest(path); ok {
+				desc.Digest = sha256Digest(sum)
+				desc.Annotations = map[string]any{"digest_source": "export"}
+				subjects = append(subjects, desc)
+				continue
+			}
+		}
+		undigested = append(undigested, desc)
+	}
+	if len(subjects) == 0 {
+		return Statement{}, ErrNoSubjects
+	}
+
+	return Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{
+				BuildType:            BuildType,
+				ExternalParameters:   externalParameters(rec),
+				InternalParameters:   internalParameters(rec),
+				ResolvedDependencies: dependencies(rec),
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{
+					ID:      BuilderID + builderName(rec),
+					Version: map[string]string{"glasshouse": version.CoreVersion, "receipt": rec.Version},
+				},
+				Metadata: Metadata{
+					InvocationID: rec.ExecutionID,
+					StartedOn:    rec.StartTime,
+					FinishedOn:   rec.EndTime,
+				},
+				Byproducts: byproducts(rec, undigested),
+			},
+		},
+	}, nil
+}
+
+func externalParameters(rec *receipt.Receipt) map[string]any {
+	params := map[string]any{}
+	if len(rec.ProcessTree) > 0 {
+		root := rec.ProcessTree[0]
+		params["argv"] = root.Argv
+		params["working_dir"] = root.WorkingDir
+	} else if len(rec.Processes) > 0 {
+		params["cmd"] = rec.Processes[0].Cmd
+	}
+	return params
+}
+
+func internalParameters(rec *receipt.Receipt) map[string]any {
+	params := map[string]any{}
+	if rec.Environment != nil {
+		params["environment"] = rec.Environment
+	}
+	if rec.Execution != nil {
+		params["execution"] = rec.Execution
+	}
+	if rec.ObservationMode != "" {
+		params["observation_mode"] = rec.ObservationMode
+	}
+	if rec.ObservationMechanism != "" {
+		params["observation_mechanism"] = rec.ObservationMechanism
+	}
+	if rec.Completeness != "" {
+		params["completeness"] = rec.Completeness
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// recordedDigest returns the hash the receipt recorded for path when it was
+// read, or after the execution when written.
+func recordedDigest(rec *receipt.Receipt, path string, read bool) string {
+	hashes := rec.Files[path]
+	digest := hashes.Written
+	if read {
+		digest = hashes.Read
+	}
+	if digest == nil {
+		return ""
+	}
+	return digest.SHA256
+}
+
+// dependencies lists the executables that ran, the files that were read,
+// with their recorded digests, and stdin.
+func dependencies(rec *receipt.Receipt) []ResourceDescriptor {
+	var deps []ResourceDescriptor
+	seen := make(map[string]bool)
+	for _, proc := range rec.ProcessTree {
+		if proc.Exe == "" || seen[proc.Exe] {
+			continue
+		}
+		seen[proc.Exe] = true
+		deps = append(deps, ResourceDescriptor{Name: proc.Exe, URI: fileURI(proc.Exe), Annotations: map[string]any{"role": "executable"}})
+	}
+	if rec.Filesystem != nil {
+		for _, path := range rec.Filesystem.Reads {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			dep := ResourceDescriptor{Name: path, URI: fileURI(path)}
+			if sum := recordedDigest(rec, path, true); sum != "" {
+				dep.Digest = sha256Digest(sum)
+			}
+			deps = append(deps, dep)
+		}
+	}
+	if rec.Artifacts != nil && rec.Artifacts.StdinHash != "" {
+		deps = append(deps, ResourceDescriptor{Name: "stdin", Digest: sha256Digest(rec.Artifacts.StdinHash)})
+	}
+	return deps
+}
+
+func byproducts(rec *receipt.Receipt, undigested []ResourceDescriptor) []ResourceDescriptor {
+	var out []ResourceDescriptor
+	if rec.Artifacts != nil && rec.Artifacts.StderrHash != "" {
+		out = append(out, ResourceDescriptor{Name: "stderr", Digest: sha256Digest(rec.Artifacts.StderrHash)})
+	}
+	out = append(out, undigested...)
+	if len(rec.ProcessTree) > 0 {
+		out = append(out, ResourceDescriptor{Name: "process_tree", Annotations: map[string]any{"processes": rec.ProcessTree}})
+	}
+	if rec.Network != nil && (len(rec.Network.Attempts) > 0 || len(rec.Network.Connections) > 0 || len(rec.Network.DNS) > 0) {
+		network := map[string]any{"attempts": rec.Network.Attempts}
+		if len(rec.Network.Connections) > 0 {
+			network["connections"] = rec.Network.Connections
+		}
+		if len(rec.Network.DNS) > 0 {
+			network["dns"] = rec.Network.DNS
+		}
+		out = append(out, ResourceDescriptor{Name: "network", Annotations: network})
+	}
+	outcome := map[string]any{"exit_code": rec.ExitCode}
+	if rec.Outcome != nil {
+		outcome["exit_code"] = rec.Outcome.ExitCode
+		if rec.Outcome.Signal != nil {
+			outcome["signal"] = *rec.Outcome.Signal
+		}
+		if rec.Outcome.Termination != nil {
+			outcome["termination"] = rec.Outcome.Termination
+		}
+	}
+	if rec.Policy != nil && len(rec.Policy.Violations) > 0 {
+		outcome["policy_violations"] = rec.Policy.Violations
+	}
+	out = append(out, ResourceDescriptor{Name: "outcome", Annotations: outcome})
+	return out
+}
+
+// writtenFiles returns the files the execution left behind. The aggregator
+// works that out in event order; receipts before v0.4.0 only have unordered
+// sets, so a path deleted at any point is left out.
+func writtenFiles(rec *receipt.Receipt) []string {
+	fs := rec.Filesystem
+	if fs == nil {
+		return nil
+	}
+	if rec.Version != "" && rec.Version != "v0.3.0" {
+		paths := append([]string(nil), fs.Outputs...)
+		sort.Strings(paths)
+		return paths
+	}
+	written := make(map[string]bool)
+	for _, path := range fs.Writes {
+		written[path] = true
+	}
+	for _, r := range fs.Renames {
+		if written[r.From] {
+			delete(written, r.From)
+			written[r.To] = true
+		}
+	}
+	for _, path := range fs.Deletes {
+		delete(written, path)
+	}
+	paths := make([]string, 0, len(written))
+	for path := range written {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func builderName(rec *receipt.Receipt) string {
+	if rec.Execution != nil && rec.Execution.Backend != "" {
+		return rec.Execution.Backend
+	}
+	if rec.Provenance != "" {
+		return rec.Provenance
+	}
+	return "unknown"
+}
+
+func sha256Digest(hex string) map[string]string {
+	return map[string]string{"sha256": hex}
+}
+
+func fileURI(path string) string {
+	return "file://" + path
+}
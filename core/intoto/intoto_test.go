@@ -0,0 +1,83 @@
+package intoto
+
+import (
+	"testing"
+
+	"glasshouse/core/receipt"
+)
+
+func TestFromReceiptAttestsOutputs(t *testing.T) {
+	exit := 0
+	rec := &receipt.Receipt{
+		Version:     "v0.3.0",
+		ExecutionID: "exec-1",
+		StartTime:   "2024-01-01T00:00:00Z",
+		EndTime:     "2024-01-01T00:00:01Z",
+		ProcessTree: []receipt.ProcessV2{
+			{PID: 1, Exe: "/usr/bin/make", Argv: []string{"make", "all"}, WorkingDir: "/src", ExitCode: &exit},
+			{PID: 2, PPID: 1, Exe: "/usr/bin/cc", Argv: []string{"cc", "-c", "main.c"}},
+		},
+		Execution: &receipt.ExecutionInfo{Backend: "process", Isolation: "none"},
+		Artifacts: &receipt.Artifacts{StdoutHash: "aa", StderrHash: "bb"},
+		Filesystem: &receipt.FilesystemInfo{
+			Reads:   []string{"/src/main.c"},
+			Writes:  []string{"/src/main.o", "/src/main.tmp", "/tmp/scratch"},
+			Renames: []receipt.Rename{{From: "/src/main.tmp", To: "/src/app"}},
+			Deletes: []string{"/tmp/scratch"},
+		},
+		Network: &receipt.NetworkInfo{Attempts: []receipt.NetworkAttempt{{Dst: "10.0.0.1:443", Protocol: "tcp"}}},
+	}
+	digests := map[string]string{"/src/app": "cc"}
+	st, err := FromReceipt(rec, Options{Digest: func(path string) (string, bool) {
+		sum, ok := digests[path]
+		return sum, ok
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Type != StatementType || st.PredicateType != PredicateType {
+		t.Fatalf("types = %q, %q", st.Type, st.PredicateType)
+	}
+	if len(st.Subject) != 2 || st.Subject[0].Name != "stdout" || st.Subject[1].Name != "/src/app" || st.Subject[1].Digest["sha256"] != "cc" || st.Subject[1].Annotations["digest_source"] != "export" {
+		t.Fatalf("subjects = %+v", st.Subject)
+	}
+	names := func(descs []ResourceDescriptor) []string {
+		var out []string
+		for _, d := range descs {
+			out = append(out, d.Name)
+		}
+		return out
+	}
+	if got := names(st.Predicate.BuildDefinition.ResolvedDependencies); len(got) != 3 || got[2] != "/src/main.c" {
+		t.Fatalf("dependencies = %v", got)
+	}
+	if got := names(st.Predicate.RunDetails.Byproducts); len(got) != 5 || got[1] != "/src/main.o" || got[3] != "network" {
+		t.Fatalf("byproducts = %v", got)
+	}
+	if st.Predicate.RunDetails.Builder.ID != BuilderID+"process" || st.Predicate.RunDetails.Metadata.InvocationID != "exec-1" {
+		t.Fatalf("run details = %+v", st.Predicate.RunDetails)
+	}
+
+	if _, err := FromReceipt(&receipt.Receipt{}, Options{}); err != ErrNoSubjects {
+		t.Fatalf("empty receipt: %v", err)
+	}
+}
+
+func TestFromReceiptKeepsRewrittenOutputs(t *testing.T) {
+	rec := &receipt.Receipt{
+		Version:     "v0.4.0",
+		ExecutionID: "exec-2",
+		Filesystem: &receipt.FilesystemInfo{
+			Writes:  []string{"/src/out"},
+			Deletes: []string{"/src/out"},
+			Outputs: []string{"/src/out"},
+		},
+	}
+	st, err := FromReceipt(rec, Options{Digest: func(string) (string, bool) { return "dd", true }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Subject) != 1 || st.Subject[0].Name != "/src/out" {
+		t.Fatalf("subjects = %+v", st.Subject)
+	}
+}
@@ -0,0 +1,440 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"glasshouse/core/execution"
+	"glasshouse/core/receipt"
+	"glasshouse/core/version"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// ErrStepFailed is wrapped by the error returned when any step does not succeed.
+var ErrStepFailed = errors.New("pipeline step failed")
+
+// Pipeline is a DAG of executions. Steps run once all of their dependencies succeed.
+type Pipeline struct {
+	Name  string
+	Steps []Step
+}
+
+// Step is a single sandboxed execution within a pipeline.
+type Step struct {
+	Name      string
+	Spec      execution.ExecutionSpec
+	DependsOn []string
+	// Inputs are artifacts from dependencies copied into Spec.Workdir before start.
+	Inputs []Input
+	// Outputs are files, relative to Spec.Workdir, hashed after the step exits.
+	Outputs []string
+}
+
+// Input references an output of another step.
+type Input struct {
+	From string
+	Path string
+	// As is the destination relative to the consuming step's workdir; defaults to Path.
+	As string
+}
+
+// EngineFactory returns the engine used for a step. Backends hold per-execution
+// state, so each step normally needs a fresh backend.
+type EngineFactory func(step Step) (execution.Engine, error)
+
+// Runner executes pipelines.
+type Runner struct {
+	Engine EngineFactory
+	// MaxParallel bounds concurrently running steps; zero means unbounded.
+	MaxParallel int
+}
+
+// Result holds per-step results in declaration order and the parent receipt.
+type Result struct {
+	Steps   []StepResult
+	Receipt Receipt
+}
+
+// StepResult is the outcome of a single step.
+type StepResult struct {
+	Name    string
+	Status  string
+	Result  execution.ExecutionResult
+	Outputs []ArtifactRef
+	Err     error
+}
+
+// Receipt is the parent receipt linking step receipts and artifacts.
+type Receipt struct {
+	Version     string       `json:"version"`
+	Pipeline    string       `json:"pipeline"`
+	Status      string       `json:"status"`
+	StartedAt   time.Time    `json:"started_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+	Steps       []StepRecord `json:"steps"`
+}
+
+// StepRecord references a child execution and the artifacts it consumed and produced.
+type StepRecord struct {
+	Name          string        `json:"name"`
+	Status        string        `json:"status"`
+	ExecutionID   string        `json:"execution_id,omitempty"`
+	ReceiptSHA256 string        `json:"receipt_sha256,omitempty"`
+	ExitCode      int           `json:"exit_code"`
+	DependsOn     []string      `json:"depends_on,omitempty"`
+	Inputs        []ArtifactRef `json:"inputs,omitempty"`
+	Outputs       []ArtifactRef `json:"outputs,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// ArtifactRef identifies a file produced by a step.
+type ArtifactRef struct {
+	Step   string `json:"step"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// ReceiptDigest is the sha256 of the compact JSON encoding of a step receipt,
+// as recorded in StepRecord.ReceiptSHA256.
+func ReceiptDigest(rec receipt.Receipt) (string, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Validate checks step names, dependencies, inputs and outputs, and rejects
+// cycles. Artifact paths must stay inside the step workdirs.
+func (p Pipeline) Validate() error {
+	steps := make(map[string]Step, len(p.Steps))
+	for _, step := range p.Steps {
+		if step.Name == "" {
+			return errors.New("pipeline: step name required")
+		}
+		if _, ok := steps[step.Name]; ok {
+			return fmt.Errorf("pipeline: duplicate step %q", step.Name)
+		}
+		steps[step.Name] = step
+	}
+	for _, step := range p.Steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("pipeline: step %q depends on unknown step %q", step.Name, dep)
+			}
+		}
+		for _, out := range step.Outputs {
+			if !filepath.IsLocal(out) {
+				return fmt.Errorf("pipeline: step %q output %q is not a path inside its workdir", step.Name, out)
+			}
+		}
+		for _, in := range step.Inputs {
+			if !filepath.IsLocal(in.Path) {
+				return fmt.Errorf("pipeline: step %q input %s/%s is not a path inside its workdir", step.Name, in.From, in.Path)
+			}
+			if in.As != "" && !filepath.IsLocal(in.As) {
+				return fmt.Errorf("pipeline: step %q input destination %q is not a path inside its workdir", step.Name, in.As)
+			}
+			if !contains(step.DependsOn, in.From) {
+				return fmt.Errorf("pipeline: step %q input from %q requires a dependency", step.Name, in.From)
+			}
+			if !contains(steps[in.From].Outputs, in.Path) {
+				return fmt.Errorf("pipeline: step %q input %s/%s is not a declared output", step.Name, in.From, in.Path)
+			}
+			if step.Spec.Workdir == "" {
+				return fmt.Errorf("pipeline: step %q has inputs but no workdir", step.Name)
+			}
+		}
+		if len(step.Outputs) > 0 && step.Spec.Workdir == "" {
+			return fmt.Errorf("pipeline: step %q has outputs but no workdir", step.Name)
+		}
+	}
+
+	// Kahn's algorithm: every step must eventually have no unresolved dependencies.
+	pending := make(map[string]int, len(p.Steps))
+	dependents := make(map[string][]string)
+	for _, step := range p.Steps {
+		pending[step.Name] = len(step.DependsOn)
+		for _, dep := range step.DependsOn {
+			dependents[dep] = append(dependents[dep], step.Name)
+		}
+	}
+	ready := []string{}
+	for name, n := range pending {
+		if n == 0 {
+			ready = append(ready, name)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		visited++
+		for _, next := range dependents[name] {
+			pending[next]--
+			if pending[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	if visited != len(p.Steps) {
+		cyclic := []string{}
+		for name, n := range pending {
+			if n > 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		return fmt.Errorf("pipeline: dependency cycle among %v", cyclic)
+	}
+	return nil
+}
+
+// Run executes the pipeline. Independent steps run in parallel; a failed step
+// causes its dependents to be skipped. The returned error wraps ErrStepFailed
+// when any step did not succeed.
+func (r Runner) Run(ctx context.Context, p Pipeline) (Result, error) {
+	if err := p.Validate(); err != nil {
+		return Result{}, err
+	}
+	if r.Engine == nil {
+		return Result{}, errors.New("pipeline: engine factory required")
+	}
+
+	run := &pipelineRun{
+		runner:  r,
+		steps:   make(map[string]Step, len(p.Steps)),
+		results: make(map[string]*StepResult, len(p.Steps)),
+		done:    make(map[string]chan struct{}, len(p.Steps)),
+	}
+	if r.MaxParallel > 0 {
+		run.sem = make(chan struct{}, r.MaxParallel)
+	}
+	for _, step := range p.Steps {
+		run.steps[step.Name] = step
+		run.results[step.Name] = &StepResult{Name: step.Name}
+		run.done[step.Name] = make(chan struct{})
+	}
+
+	startedAt := time.Now()
+	var wg sync.WaitGroup
+	for _, step := range p.Steps {
+		wg.Add(1)
+		go func(step Step) {
+			defer wg.Done()
+			defer close(run.done[step.Name])
+			run.runStep(ctx, step)
+		}(step)
+	}
+	wg.Wait()
+
+	result := Result{Receipt: Receipt{
+		Version:     version.ReceiptVersion,
+		Pipeline:    p.Name,
+		Status:      StatusSucceeded,
+		StartedAt:   startedAt,
+		CompletedAt: time.Now(),
+		Steps:       []StepRecord{},
+	}}
+	failed := []string{}
+	for _, step := range p.Steps {
+		sr := run.results[step.Name]
+		result.Steps = append(result.Steps, *sr)
+		result.Receipt.Steps = append(result.Receipt.Steps, run.record(step, sr))
+		if sr.Status != StatusSucceeded {
+			result.Receipt.Status = StatusFailed
+			failed = append(failed, step.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return result, fmt.Errorf("%w: %v", ErrStepFailed, failed)
+	}
+	return result, nil
+}
+
+type pipelineRun struct {
+	runner  Runner
+	sem     chan struct{}
+	steps   map[string]Step
+	results map[string]*StepResult
+	done    map[string]chan struct{}
+}
+
+func (run *pipelineRun) runStep(ctx context.Context, step Step) {
+	sr := run.results[step.Name]
+	for _, dep := range step.DependsOn {
+		<-run.done[dep]
+		if run.results[dep].Status != StatusSucceeded {
+			sr.Status = StatusSkipped
+			sr.Err = fmt.Errorf("dependency %q did not succeed", dep)
+			return
+		}
+	}
+	if run.sem != nil {
+		select {
+		case run.sem <- struct{}{}:
+			defer func() { <-run.sem }()
+		case <-ctx.Done():
+			sr.Status = StatusSkipped
+			sr.Err = ctx.Err()
+			return
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		sr.Status = StatusSkipped
+		sr.Err = err
+		return
+	}
+
+	sr.Status = StatusFailed
+	for _, in := range step.Inputs {
+		if err := run.stageInput(step, in); err != nil {
+			sr.Err = err
+			return
+		}
+	}
+	engine, err := run.runner.Engine(step)
+	if err != nil {
+		sr.Err = err
+		return
+	}
+	res, err := engine.Run(ctx, step.Spec)
+	sr.Result = res
+	if err != nil {
+		sr.Err = err
+		return
+	}
+	if res.ExitCode != 0 {
+		sr.Err = fmt.Errorf("exit code %d", res.ExitCode)
+		return
+	}
+	for _, out := range step.Outputs {
+		ref, err := hashArtifact(step.Name, step.Spec.Workdir, out)
+		if err != nil {
+			sr.Err = err
+			return
+		}
+		sr.Outputs = append(sr.Outputs, ref)
+	}
+	sr.Status = StatusSucceeded
+}
+
+// stageInput copies a dependency output into the step workdir, verifying that
+// the content still matches the hash recorded when the producer exited.
+func (run *pipelineRun) stageInput(step Step, in Input) error {
+	producer := run.results[in.From]
+	var want ArtifactRef
+	for _, ref := range producer.Outputs {
+		if ref.Path == in.Path {
+			want = ref
+		}
+	}
+	src, err := os.Open(filepath.Join(run.steps[in.From].Spec.Workdir, in.Path))
+	if err != nil {
+		return fmt.Errorf("open input %s/%s: %w", in.From, in.Path, err)
+	}
+	defer src.Close()
+
+	dest := filepath.Join(step.Spec.Workdir, inputDest(in))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(dst, h), src)
+	closeErr := dst.Close()
+	if copyErr != nil {
+		return fmt.Errorf("copy input %s/%s: %w", in.From, in.Path, copyErr)
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want.SHA256 {
+		_ = os.Remove(dest)
+		return fmt.Errorf("input %s/%s changed after step completed: sha256 %s, want %s", in.From, in.Path, got, want.SHA256)
+	}
+	return nil
+}
+
+func (run *pipelineRun) record(step Step, sr *StepResult) StepRecord {
+	rec := StepRecord{
+		Name:      step.Name,
+		Status:    sr.Status,
+		ExitCode:  sr.Result.ExitCode,
+		DependsOn: step.DependsOn,
+		Outputs:   sr.Outputs,
+	}
+	if sr.Err != nil {
+		rec.Error = sr.Err.Error()
+	}
+	if sr.Status == StatusSkipped {
+		return rec
+	}
+	rec.ExecutionID = sr.Result.Handle.ID
+	if child := sr.Result.Receipt; child != nil {
+		if child.ExecutionID != "" {
+			rec.ExecutionID = child.ExecutionID
+		}
+		if digest, err := ReceiptDigest(*child); err == nil {
+			rec.ReceiptSHA256 = digest
+		}
+	}
+	for _, in := range step.Inputs {
+		for _, ref := range run.results[in.From].Outputs {
+			if ref.Path == in.Path {
+				rec.Inputs = append(rec.Inputs, ref)
+			}
+		}
+	}
+	return rec
+}
+
+func hashArtifact(stepName, workdir, path string) (ArtifactRef, error) {
+	f, err := os.Open(filepath.Join(workdir, path))
+	if err != nil {
+		return ArtifactRef{}, fmt.Errorf("output %s/%s: %w", stepName, path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return ArtifactRef{}, fmt.Errorf("hash output %s/%s: %w", stepName, path, err)
+	}
+	return ArtifactRef{Step: stepName, Path: path, SHA256: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+func inputDest(in Input) string {
+	if in.As != "" {
+		return in.As
+	}
+	return in.Path
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"glasshouse/backend/fake"
+	"glasshouse/core/execution"
+	"glasshouse/core/profiling"
+)
+
+type stubProfiler struct{}
+
+type stubSession struct {
+	events chan profiling.Event
+	errs   chan error
+}
+
+func (s stubProfiler) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	_ = ctx
+	_ = target
+	ev := make(chan profiling.Event)
+	errs := make(chan error)
+	close(ev)
+	close(errs)
+	return stubSession{events: ev, errs: errs}, nil
+}
+
+func (s stubProfiler) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: true}
+}
+
+func (s stubSession) Events() <-chan profiling.Event { return s.events }
+func (s stubSession) Errors() <-chan error           { return s.errs }
+func (s stubSession) Close() error                   { return nil }
+
+// scriptBackend runs an in-process function in place of the command.
+type scriptBackend struct {
+	*fake.Backend
+	run func(spec execution.ExecutionSpec) int
+}
+
+func (b *scriptBackend) Start(spec execution.ExecutionSpec) (execution.ExecutionHandle, error) {
+	b.ExitCode = b.run(spec)
+	return execution.ExecutionHandle{ID: spec.Args[0]}, nil
+}
+
+func scripted(scripts map[string]func(spec execution.ExecutionSpec) int) EngineFactory {
+	return func(step Step) (execution.Engine, error) {
+		return execution.Engine{
+			Backend:  &scriptBackend{Backend: fake.New(0), run: scripts[step.Name]},
+			Profiler: stubProfiler{},
+		}, nil
+	}
+}
+
+func TestRunnerPassesArtifactsAndLinksReceipts(t *testing.T) {
+	root := t.TempDir()
+	dir := func(name string) string {
+		d := filepath.Join(root, name)
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	p := Pipeline{
+		Name: "etl",
+		Steps: []Step{
+			{Name: "fetch", Spec: spec("fetch", dir("fetch")), Outputs: []string{"raw.txt"}},
+			{
+				Name:      "transform",
+				Spec:      spec("transform", dir("transform")),
+				DependsOn: []string{"fetch"},
+				Inputs:    []Input{{From: "fetch", Path: "raw.txt", As: "in/raw.txt"}},
+				Outputs:   []string{"clean.txt"},
+			},
+			{
+				Name:      "validate",
+				Spec:      spec("validate", dir("validate")),
+				DependsOn: []string{"transform"},
+				Inputs:    []Input{{From: "transform", Path: "clean.txt"}},
+			},
+		},
+	}
+	scripts := map[string]func(spec execution.ExecutionSpec) int{
+		"fetch": func(s execution.ExecutionSpec) int {
+			return writeFile(filepath.Join(s.Workdir, "raw.txt"), "Hello")
+		},
+		"transform": func(s execution.ExecutionSpec) int {
+			data, err := os.ReadFile(filepath.Join(s.Workdir, "in", "raw.txt"))
+			if err != nil {
+				return 1
+			}
+			return writeFile(filepath.Join(s.Workdir, "clean.txt"), strings.ToLower(string(data)))
+		},
+		"validate": func(s execution.ExecutionSpec) int {
+			data, err := os.ReadFile(filepath.Join(s.Workdir, "clean.txt"))
+			if err != nil || string(data) != "hello" {
+				return 1
+			}
+			return 0
+		},
+	}
+
+	result, err := Runner{Engine: scripted(scripts), MaxParallel: 2}.Run(context.Background(), p)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	rec := result.Receipt
+	if rec.Status != StatusSucceeded || len(rec.Steps) != 3 {
+		t.Fatalf("unexpected parent receipt: %+v", rec)
+	}
+	for i, step := range rec.Steps {
+		if step.Status != StatusSucceeded || step.ExecutionID == "" {
+			t.Fatalf("step %s: %+v", step.Name, step)
+		}
+		digest, err := ReceiptDigest(*result.Steps[i].Result.Receipt)
+		if err != nil || digest != step.ReceiptSHA256 {
+			t.Fatalf("step %s receipt digest %q, want %q", step.Name, step.ReceiptSHA256, digest)
+		}
+	}
+	if len(rec.Steps[1].Inputs) != 1 || rec.Steps[1].Inputs[0] != rec.Steps[0].Outputs[0] {
+		t.Fatalf("transform input not linked to fetch output: %+v", rec.Steps[1])
+	}
+	if rec.Steps[2].Inputs[0].SHA256 != rec.Steps[1].Outputs[0].SHA256 {
+		t.Fatalf("validate input not linked to transform output: %+v", rec.Steps[2])
+	}
+}
+
+func TestRunnerSkipsDependentsOfFailedStep(t *testing.T) {
+	p := Pipeline{Steps: []Step{
+		{Name: "a", Spec: spec("a", "")},
+		{Name: "b", Spec: spec("b", ""), DependsOn: []string{"a"}},
+		{Name: "c", Spec: spec("c", "")},
+	}}
+	scripts := map[string]func(spec execution.ExecutionSpec) int{
+		"a": func(execution.ExecutionSpec) int { return 3 },
+		"b": func(execution.ExecutionSpec) int { return 0 },
+		"c": func(execution.ExecutionSpec) int { return 0 },
+	}
+	result, err := Runner{Engine: scripted(scripts)}.Run(context.Background(), p)
+	if !errors.Is(err, ErrStepFailed) {
+		t.Fatalf("expected step failure, got %v", err)
+	}
+	got := []string{}
+	for _, step := range result.Receipt.Steps {
+		got = append(got, step.Name+"="+step.Status)
+	}
+	want := "a=failed b=skipped c=succeeded"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("statuses %v, want %s", got, want)
+	}
+}
+
+func TestValidateRejectsCycles(t *testing.T) {
+	p := Pipeline{Steps: []Step{
+		{Name: "a", Spec: spec("a", ""), DependsOn: []string{"c"}},
+		{Name: "b", Spec: spec("b", ""), DependsOn: []string{"a"}},
+		{Name: "c", Spec: spec("c", ""), DependsOn: []string{"b"}},
+	}}
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestValidateRejectsPathsOutsideWorkdir(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		outputs []string
+		input   Input
+	}{
+		{name: "dotdot output", outputs: []string{"../../etc/x"}},
+		{name: "absolute output", outputs: []string{"/etc/x"}},
+		{name: "dotdot destination", outputs: []string{"out.txt"}, input: Input{From: "a", Path: "out.txt", As: "../../etc/x"}},
+		{name: "absolute destination", outputs: []string{"out.txt"}, input: Input{From: "a", Path: "out.txt", As: "/etc/x"}},
+	} {
+		b := Step{Name: "b", Spec: spec("b", "/work/b"), DependsOn: []string{"a"}}
+		if tc.input.From != "" {
+			b.Inputs = []Input{tc.input}
+		}
+		p := Pipeline{Steps: []Step{{Name: "a", Spec: spec("a", "/work/a"), Outputs: tc.outputs}, b}}
+		if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "inside its workdir") {
+			t.Errorf("%s: expected path error, got %v", tc.name, err)
+		}
+	}
+}
+
+func spec(name, workdir string) execution.ExecutionSpec {
+	return execution.ExecutionSpec{Args: []string{name}, Workdir: workdir, Profiling: profiling.ProfilingHost}
+}
+
+func writeFile(path, content string) int {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return 1
+	}
+	return 0
+}
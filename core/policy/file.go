@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// File is the JSON form of a Policy. Each rule lists one or more conditions
+// and is violated when any of them fails:
+//
+//	{
+//	  "name": "ci",
+//	  "pre": [{"name": "labelled", "require_labels": {"team": "build"}, "action": "kill_execution"}],
+//	  "runtime": [{"name": "no-ptrace", "deny_events": ["ptrace"], "action": "kill_execution"}],
+//	  "post": [{"name": "no-network", "deny_network": true}]
+//	}
+type File struct {
+	Name    string         `json:"name"`
+	Pre     []FilePreRule  `json:"pre,omitempty"`
+	Runtime []FileRuntime  `json:"runtime,omitempty"`
+	Post    []FilePostRule `json:"post,omitempty"`
+}
+
+type FilePreRule struct {
+	Name          string            `json:"name"`
+	RequireLabels map[string]string `json:"require_labels,omitempty"`
+	Action        EnforcementAction `json:"action,omitempty"`
+}
+
+type FileRuntime struct {
+	Name string `json:"name"`
+	// DenyEvents lists event type names, e.g. "ptrace" or "mount".
+	DenyEvents         []string `json:"deny_events,omitempty"`
+	DenySecurityEvents bool     `json:"deny_security_events,omitempty"`
+	MaxProcesses       int      `json:"max_processes,omitempty"`
+	// MaxDuration is a Go duration such as "30s".
+	MaxDuration string            `json:"max_duration,omitempty"`
+	Action      EnforcementAction `json:"action,omitempty"`
+}
+
+type FilePostRule struct {
+	Name              string   `json:"name"`
+	RequireExitCode   *int     `json:"require_exit_code,omitempty"`
+	DenyNetwork       bool     `json:"deny_network,omitempty"`
+	DenyWritePrefixes []string `json:"deny_write_prefixes,omitempty"`
+}
+
+// LoadFile reads a JSON policy.
+func LoadFile(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("read policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes a JSON policy. Unknown fields are rejected so misspelled
+// conditions do not silently allow everything.
+func Parse(data []byte) (Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return Policy{}, fmt.Errorf("decode policy: %w", err)
+	}
+	return f.Compile()
+}
+
+// Compile builds the Policy the file describes.
+func (f File) Compile() (Policy, error) {
+	p := Policy{Name: f.Name}
+	for _, r := range f.Pre {
+		rule, err := r.compile()
+		if err != nil {
+			return Policy{}, fmt.Errorf("pre rule %q: %w", r.Name, err)
+		}
+		p.PreRules = append(p.PreRules, rule)
+	}
+	for _, r := range f.Runtime {
+		rule, err := r.compile()
+		if err != nil {
+			return Policy{}, fmt.Errorf("runtime rule %q: %w", r.Name, err)
+		}
+		p.RuntimeRules = append(p.RuntimeRules, rule)
+	}
+	for _, r := range f.Post {
+		rule, err := r.compile()
+		if err != nil {
+			return Policy{}, fmt.Errorf("post rule %q: %w", r.Name, err)
+		}
+		p.PostRules = append(p.PostRules, rule)
+	}
+	return p, nil
+}
+
+func (r FilePreRule) compile() (PreRule, error) {
+	if err := checkRule(r.Name, r.Action, len(r.RequireLabels) > 0); err != nil {
+		return PreRule{}, err
+	}
+	labels := r.RequireLabels
+	return PreRule{
+		Name: r.Name,
+		Match: func(ctx PreExecutionContext) bool {
+			for k, v := range labels {
+				if ctx.Labels[k] != v {
+					return false
+				}
+			}
+			return true
+		},
+		Action: r.Action,
+	}, nil
+}
+
+func (r FileRuntime) compile() (RuntimeRule, error) {
+	if err := checkRule(r.Name, r.Action, len(r.DenyEvents) > 0 || r.DenySecurityEvents || r.MaxProcesses > 0 || r.MaxDuration != ""); err != nil {
+		return RuntimeRule{}, err
+	}
+	denied := make(map[profiling.EventType]struct{}, len(r.DenyEvents))
+	for _, name := range r.DenyEvents {
+		t, ok := profiling.ParseEventType(name)
+		if !ok {
+			return RuntimeRule{}, fmt.Errorf("unknown event type %q", name)
+		}
+		denied[t] = struct{}{}
+	}
+	var maxDuration time.Duration
+	if r.MaxDuration != "" {
+		d, err := time.ParseDuration(r.MaxDuration)
+		if err != nil || d <= 0 {
+			return RuntimeRule{}, fmt.Errorf("invalid max_duration %q", r.MaxDuration)
+		}
+		maxDuration = d
+	}
+	denySecurity, maxProcesses := r.DenySecurityEvents, r.MaxProcesses
+	return RuntimeRule{
+		Name: r.Name,
+		Match: func(ev profiling.Event, ctx RuntimeContext) bool {
+			if _, ok := denied[ev.Type]; ok {
+				return false
+			}
+			if denySecurity && ev.Type.IsSecurity() {
+				return false
+			}
+			if maxProcesses > 0 && ctx.ProcessCount > maxProcesses {
+				return false
+			}
+			return maxDuration == 0 || ctx.Duration <= maxDuration
+		},
+		Action: r.Action,
+	}, nil
+}
+
+func (r FilePostRule) compile() (Rule, error) {
+	if err := checkRule(r.Name, "", r.RequireExitCode != nil || r.DenyNetwork || len(r.DenyWritePrefixes) > 0); err != nil {
+		return Rule{}, err
+	}
+	exitCode, denyNetwork, prefixes := r.RequireExitCode, r.DenyNetwork, r.DenyWritePrefixes
+	return Rule{
+		Name: r.Name,
+		Match: func(rec receipt.Receipt) bool {
+			if exitCode != nil && rec.ExitCode != *exitCode {
+				return false
+			}
+			if denyNetwork && rec.Network != nil && (len(rec.Network.Connections) > 0 || len(rec.Network.Attempts) > 0) {
+				return false
+			}
+			return len(prefixes) == 0 || !writesUnder(rec.Filesystem, prefixes)
+		},
+	}, nil
+}
+
+func checkRule(name string, action EnforcementAction, hasCondition bool) error {
+	if name == "" {
+		return fmt.Errorf("rule needs a name")
+	}
+	if !hasCondition {
+		return fmt.Errorf("rule has no conditions")
+	}
+	switch action {
+	case "", EnforcementNone, EnforcementKillProcess, EnforcementKillExecution:
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
+
+// writesUnder reports whether the execution created, modified, removed or
+// renamed anything under one of the prefixes.
+func writesUnder(fs *receipt.FilesystemInfo, prefixes []string) bool {
+	if fs == nil {
+		return false
+	}
+	paths := append(append(append([]string{}, fs.Writes...), fs.Deletes...), fs.Mkdirs...)
+	for _, rename := range fs.Renames {
+		paths = append(paths, rename.From, rename.To)
+	}
+	for _, change := range fs.PermissionChanges {
+		paths = append(paths, change.Path)
+	}
+	for _, path := range paths {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
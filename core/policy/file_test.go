@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+func TestParseCompilesRules(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"name": "ci",
+		"pre": [{"name": "labelled", "require_labels": {"team": "build"}, "action": "kill_execution"}],
+		"runtime": [{"name": "few-procs", "max_processes": 2, "action": "kill_process"}],
+		"post": [{"name": "no-etc", "deny_write_prefixes": ["/etc/"]}]
+	}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ctx := context.Background()
+	if v := (PreEvaluator{Policy: p}).Evaluate(ctx, PreExecutionContext{Labels: map[string]string{"team": "build"}}); len(v) != 0 {
+		t.Fatalf("labelled execution violated %+v", v)
+	}
+	if v := (RuntimeEvaluator{Policy: p}).Evaluate(ctx, profiling.Event{}, RuntimeContext{ProcessCount: 3}); len(v) != 1 || v[0].Action != EnforcementKillProcess {
+		t.Fatalf("expected process limit violation, got %+v", v)
+	}
+	rec := receipt.Receipt{Filesystem: &receipt.FilesystemInfo{Renames: []receipt.Rename{{From: "/tmp/a", To: "/etc/passwd"}}}}
+	if v := (Evaluator{Policy: p}).Evaluate(ctx, rec); v.Allowed {
+		t.Fatal("rename into /etc should be denied")
+	}
+
+	for _, bad := range []string{
+		`{"post": [{"name": "typo", "deny_writes": ["/etc/"]}]}`,
+		`{"runtime": [{"name": "x", "deny_events": ["teleport"]}]}`,
+		`{"runtime": [{"name": "x", "deny_events": ["open"], "action": "explode"}]}`,
+		`{"post": [{"name": "empty"}]}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Fatalf("expected %s to be rejected", bad)
+		}
+	}
+}
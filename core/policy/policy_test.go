@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"glasshouse/core/profiling"
 	"glasshouse/core/receipt"
 )
 
@@ -34,3 +35,23 @@ func TestEvaluatorDeterministic(t *testing.T) {
 		t.Fatalf("non-deterministic reasons %v", second.Reasons)
 	}
 }
+
+func TestDenyEventsMatchesSecurityEvents(t *testing.T) {
+	p := Policy{RuntimeRules: []RuntimeRule{
+		DenyEvents("no-ptrace", EnforcementKillExecution, profiling.EventPtrace),
+		DenySecurityEvents("no-privilege", EnforcementNone),
+	}}
+	ev := RuntimeEvaluator{Policy: p}
+
+	violations := ev.Evaluate(context.Background(), profiling.Event{Type: profiling.EventPtrace}, RuntimeContext{})
+	if len(violations) != 2 || violations[0].Rule != "no-privilege" || violations[1].Action != EnforcementKillExecution {
+		t.Fatalf("unexpected violations %+v", violations)
+	}
+	violations = ev.Evaluate(context.Background(), profiling.Event{Type: profiling.EventMount}, RuntimeContext{})
+	if len(violations) != 1 || violations[0].Rule != "no-privilege" {
+		t.Fatalf("unexpected violations %+v", violations)
+	}
+	if violations := ev.Evaluate(context.Background(), profiling.Event{Type: profiling.EventOpen}, RuntimeContext{}); len(violations) != 0 {
+		t.Fatalf("open should not violate: %+v", violations)
+	}
+}
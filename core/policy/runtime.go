@@ -111,3 +111,32 @@ func (e RuntimeEvaluator) Evaluate(ctx context.Context, ev profiling.Event, stat
 	sort.Slice(violations, func(i, j int) bool { return violations[i].Rule < violations[j].Rule })
 	return violations
 }
+
+// DenyEvents returns a runtime rule violated by any event of the given types,
+// e.g. DenyEvents("no-ptrace", EnforcementKillExecution, profiling.EventPtrace).
+func DenyEvents(name string, action EnforcementAction, types ...profiling.EventType) RuntimeRule {
+	denied := make(map[profiling.EventType]struct{}, len(types))
+	for _, t := range types {
+		denied[t] = struct{}{}
+	}
+	return RuntimeRule{
+		Name: name,
+		Match: func(ev profiling.Event, ctx RuntimeContext) bool {
+			_, ok := denied[ev.Type]
+			return !ok
+		},
+		Action: action,
+	}
+}
+
+// DenySecurityEvents returns a runtime rule violated by any privilege change
+// or kernel interaction event.
+func DenySecurityEvents(name string, action EnforcementAction) RuntimeRule {
+	return RuntimeRule{
+		Name: name,
+		Match: func(ev profiling.Event, ctx RuntimeContext) bool {
+			return !ev.Type.IsSecurity()
+		},
+		Action: action,
+	}
+}
@@ -5,15 +5,25 @@ package ebpf
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
 
 	"glasshouse/audit"
 	"glasshouse/core/profiling"
 )
 
+const cgroupRoot = "/sys/fs/cgroup"
+
 // Controller wraps the legacy audit collector to satisfy the profiling.Controller
 // interface using host-side eBPF CO-RE programs.
 type Controller struct {
 	cfg audit.Config
+
+	probeOnce sync.Once
+	probe     audit.ProbeResult
 }
 
 func NewController(cfg audit.Config) *Controller {
@@ -21,9 +31,9 @@ func NewController(cfg audit.Config) *Controller {
 }
 
 func (c *Controller) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
-	// Target is intentionally not used because current eBPF programs attach
-	// system-wide; future guest/combined modes can route via target identity.
-	collector, err := audit.NewCollector(c.cfg)
+	cfg := c.cfg
+	cfg.Filter = filterForTarget(target)
+	collector, err := audit.NewCollector(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -33,8 +43,43 @@ func (c *Controller) Start(ctx context.Context, target profiling.Target) (profil
 	return &session{collector: collector}, nil
 }
 
+// filterForTarget restricts host tracing to the target's process tree and
+// cgroup. Targets without either (such as the agent's) trace the whole host.
+func filterForTarget(target profiling.Target) audit.Filter {
+	filter := audit.Filter{}
+	if target.Mode == profiling.ProfilingGuest {
+		return filter
+	}
+	if target.RootPID > 0 {
+		filter.PIDs = append(filter.PIDs, uint32(target.RootPID))
+	}
+	if id, ok := cgroupID(target.CgroupPath); ok {
+		filter.CgroupIDs = append(filter.CgroupIDs, id)
+	}
+	return filter
+}
+
+// cgroupID resolves a cgroup v2 path to the ID reported by
+// bpf_get_current_cgroup_id, which is the inode of its cgroupfs directory.
+func cgroupID(path string) (uint64, bool) {
+	if path == "" {
+		return 0, false
+	}
+	if !strings.HasPrefix(path, cgroupRoot) {
+		path = filepath.Join(cgroupRoot, path)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return st.Ino, true
+}
+
+// Capabilities reports host attachment only when the probe finds everything
+// the collector needs.
 func (c *Controller) Capabilities() profiling.Capabilities {
-	return profiling.Capabilities{Host: true}
+	c.probeOnce.Do(func() { c.probe = audit.Probe(c.cfg) })
+	return profiling.Capabilities{Host: c.probe.Err() == nil, Mechanism: profiling.MechanismEBPF}
 }
 
 type session struct {
@@ -42,26 +87,7 @@ type session struct {
 }
 
 func (s *session) Events() <-chan profiling.Event {
-	out := make(chan profiling.Event)
-	go func() {
-		defer close(out)
-		for ev := range s.collector.Events() {
-			out <- profiling.Event{
-				Type:       profiling.EventType(ev.Type),
-				PID:        ev.PID,
-				PPID:       ev.PPID,
-				CgroupID:   ev.CgroupID,
-				Flags:      ev.Flags,
-				Comm:       ev.Comm,
-				Path:       ev.Path,
-				AddrFamily: ev.AddrFamily,
-				Proto:      ev.Proto,
-				Addr:       ev.Addr,
-				Port:       ev.Port,
-			}
-		}
-	}()
-	return out
+	return s.collector.Events()
 }
 
 func (s *session) Errors() <-chan error {
@@ -77,6 +103,31 @@ func (s *session) Errors() <-chan error {
 	return out
 }
 
+func (s *session) TrackPID(pid uint32) error {
+	tracker, ok := s.collector.(audit.Tracker)
+	if !ok {
+		return fmt.Errorf("collector does not support tracking")
+	}
+	return tracker.TrackPID(pid)
+}
+
+func (s *session) TrackCgroup(id uint64) error {
+	tracker, ok := s.collector.(audit.Tracker)
+	if !ok {
+		return fmt.Errorf("collector does not support tracking")
+	}
+	return tracker.TrackCgroup(id)
+}
+
+func (s *session) Stats() (profiling.Stats, error) {
+	counter, ok := s.collector.(audit.DropCounter)
+	if !ok {
+		return profiling.Stats{}, fmt.Errorf("collector does not count drops")
+	}
+	drops, err := counter.Drops()
+	return profiling.Stats{Drops: drops}, err
+}
+
 func (s *session) Close() error {
 	if s.collector == nil {
 		return nil
@@ -86,3 +137,4 @@ func (s *session) Close() error {
 
 var _ profiling.Controller = (*Controller)(nil)
 var _ profiling.Session = (*session)(nil)
+var _ profiling.Tracker = (*session)(nil)
@@ -0,0 +1,9 @@
+package ebpf
+
+import "glasshouse/audit"
+
+// Available reports why eBPF profiling cannot work on this host, or nil. It
+// does not load programs, so Start can still fail for reasons it misses.
+func Available(cfg audit.Config) error {
+	return audit.Probe(cfg).Err()
+}
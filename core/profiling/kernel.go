@@ -0,0 +1,24 @@
+package profiling
+
+import (
+	"strconv"
+	"strings"
+)
+
+// KernelAtLeast reports whether a kernel release string such as
+// "6.1.0-18-amd64" is at least major.minor. Unparseable releases are not.
+func KernelAtLeast(release string, major, minor int) bool {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	maj, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	min, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return false
+	}
+	return maj > major || (maj == major && min >= minor)
+}
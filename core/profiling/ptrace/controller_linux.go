@@ -0,0 +1,220 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"glasshouse/core/profiling"
+)
+
+const (
+	helperArg = "__glasshouse-ptrace-helper"
+	shimArg   = "__glasshouse-ptrace-shim"
+
+	// attachTimeout bounds how long Start waits for the helper to seize
+	// the target.
+	attachTimeout = 5 * time.Second
+	// closeGrace is how long Close waits for the helper to drain before
+	// detaching from it.
+	closeGrace = 500 * time.Millisecond
+)
+
+// Init runs the ptrace helper or shim and exits when the binary was
+// re-executed as one. Programs using Controller must call it first thing
+// in main.
+func Init() {
+	if len(os.Args) < 2 {
+		return
+	}
+	switch os.Args[1] {
+	case helperArg:
+		os.Exit(runHelper(os.Args[2:]))
+	case shimArg:
+		os.Exit(runShim(os.Args[2:]))
+	}
+}
+
+// message is one line of the helper's output.
+type message struct {
+	Ready bool             `json:"ready,omitempty"`
+	Error string           `json:"error,omitempty"`
+	Event *profiling.Event `json:"event,omitempty"`
+}
+
+// Controller observes a process tree with ptrace for hosts where eBPF is
+// unavailable. Tracing runs in a helper process re-executed from the
+// current binary, which therefore has to call Init.
+type Controller struct {
+	exe string
+	err error
+}
+
+func NewController() *Controller {
+	exe, err := os.Executable()
+	if err != nil {
+		err = fmt.Errorf("locate executable for ptrace helper: %w", err)
+	}
+	return &Controller{exe: exe, err: err}
+}
+
+func (c *Controller) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: c.err == nil && Available() == nil, Mechanism: profiling.MechanismPtrace}
+}
+
+// WrapCommand launches the command through the shim so the helper attaches
+// before it runs. Commands that cannot be resolved are left unwrapped so
+// the backend reports the error as it would without profiling.
+func (c *Controller) WrapCommand(args []string) []string {
+	if c.err != nil || len(args) == 0 {
+		return args
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return args
+	}
+	return append([]string{c.exe, shimArg, "--"}, args...)
+}
+
+func (c *Controller) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	_ = ctx
+	if c.err != nil {
+		return nil, c.err
+	}
+	if target.Mode == profiling.ProfilingGuest {
+		return nil, fmt.Errorf("ptrace profiling cannot observe guests")
+	}
+	if target.RootPID <= 0 {
+		return nil, fmt.Errorf("ptrace profiling needs a root pid")
+	}
+
+	cmd := exec.Command(c.exe, helperArg, fmt.Sprint(target.RootPID))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("ptrace helper: %w", err)
+	}
+	s := &session{
+		cmd:    cmd,
+		events: make(chan profiling.Event, 256),
+		errs:   make(chan error, 1),
+		done:   make(chan struct{}),
+		stdout: stdout,
+	}
+	cmd.Stderr = &s.stderr
+	// Keep terminal signals aimed at the execution away from the tracer.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start ptrace helper: %w", err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(stdout))
+	ready := make(chan error, 1)
+	go func() {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			ready <- fmt.Errorf("ptrace helper exited before attaching: %w", err)
+			return
+		}
+		if !msg.Ready {
+			ready <- fmt.Errorf("ptrace attach: %s", msg.Error)
+			return
+		}
+		ready <- nil
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(attachTimeout):
+		err = fmt.Errorf("ptrace helper did not attach within %s", attachTimeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+	go s.read(dec)
+	return s, nil
+}
+
+type session struct {
+	cmd    *exec.Cmd
+	stdout io.Closer
+	stderr bytes.Buffer
+	events chan profiling.Event
+	errs   chan error
+	done   chan struct{}
+
+	closeOnce sync.Once
+	mu        sync.Mutex
+	detached  bool
+}
+
+func (s *session) read(dec *json.Decoder) {
+	defer close(s.done)
+	defer close(s.errs)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			if !errors.Is(err, io.EOF) && !s.isDetached() {
+				s.errs <- fmt.Errorf("ptrace helper output: %w", err)
+			}
+			break
+		}
+		if msg.Event != nil {
+			s.events <- *msg.Event
+		}
+	}
+	close(s.events)
+	if s.isDetached() {
+		go func() { _ = s.cmd.Wait() }()
+		return
+	}
+	if err := s.cmd.Wait(); err != nil {
+		if detail := strings.TrimSpace(s.stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		s.errs <- fmt.Errorf("ptrace helper: %w", err)
+	}
+}
+
+func (s *session) isDetached() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.detached
+}
+
+func (s *session) Events() <-chan profiling.Event { return s.events }
+func (s *session) Errors() <-chan error           { return s.errs }
+
+// Close gives the helper a moment to finish once the traced tree has
+// exited. If processes outlive the execution, the session stops reading
+// but the helper keeps servicing them until they exit: a tracee under the
+// seccomp filter fails traced syscalls with ENOSYS once its tracer is gone.
+func (s *session) Close() error {
+	s.closeOnce.Do(func() {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(closeGrace):
+		}
+		s.mu.Lock()
+		s.detached = true
+		s.mu.Unlock()
+		_ = s.stdout.Close()
+	})
+	return nil
+}
+
+var _ profiling.Controller = (*Controller)(nil)
+var _ profiling.CommandWrapper = (*Controller)(nil)
+var _ profiling.Session = (*session)(nil)
@@ -0,0 +1,105 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"glasshouse/core/profiling"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestControllerTracesWrappedCommand(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	made := filepath.Join(dir, "made")
+	c := NewController()
+	args := c.WrapCommand([]string{"sh", "-c", "cat /etc/hostname >/dev/null; mkdir " + made + "; exit 3"})
+	if len(args) < 2 || args[1] != shimArg {
+		t.Fatalf("command not wrapped: %v", args)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	session, err := c.Start(context.Background(), profiling.Target{RootPID: cmd.Process.Pid, Mode: profiling.ProfilingHost})
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		t.Skipf("ptrace unavailable here: %v", err)
+	}
+	var events []profiling.Event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range session.Events() {
+			events = append(events, ev)
+		}
+	}()
+	go func() {
+		for err := range session.Errors() {
+			t.Errorf("session error: %v", err)
+		}
+	}()
+
+	waitErr := cmd.Wait()
+	if exitErr, ok := waitErr.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("wait: %v", waitErr)
+	}
+	_ = session.Close()
+	<-done
+
+	root := uint32(cmd.Process.Pid)
+	var sawExec, sawOpen, sawMkdir, sawExit bool
+	for _, ev := range events {
+		switch {
+		case ev.Type == profiling.EventExec && ev.PID == root:
+			sawExec = strings.HasSuffix(ev.Path, "sh")
+		case ev.Type == profiling.EventOpen && ev.Path == "/etc/hostname":
+			sawOpen = ev.PID != root && ev.PPID == root
+		case ev.Type == profiling.EventMkdir && ev.Path == made:
+			sawMkdir = true
+		case ev.Type == profiling.EventExit && ev.PID == root:
+			sawExit = ev.Flags == 3<<8
+		case ev.PID == root && strings.HasPrefix(ev.Path, "/proc/self"):
+			t.Errorf("shim activity leaked into events: %+v", ev)
+		}
+	}
+	if !sawExec || !sawOpen || !sawMkdir || !sawExit {
+		t.Fatalf("exec=%v open=%v mkdir=%v exit=%v in %d events", sawExec, sawOpen, sawMkdir, sawExit, len(events))
+	}
+}
+
+func TestBuildFilterJumpsToTrace(t *testing.T) {
+	nrs := []uint32{1, 5, 9}
+	prog := buildFilter(nrs)
+	if len(prog) != 3+len(nrs)+2 {
+		t.Fatalf("unexpected program length %d", len(prog))
+	}
+	allow, trace := len(prog)-2, len(prog)-1
+	if prog[allow].K != seccompRetAllow || prog[trace].K != seccompRetTrace {
+		t.Fatalf("unexpected return instructions %+v", prog[allow:])
+	}
+	if target := 1 + 1 + int(prog[1].Jf); target != allow {
+		t.Fatalf("arch mismatch jumps to %d, want %d", target, allow)
+	}
+	for i := range nrs {
+		pc := 3 + i
+		if target := pc + 1 + int(prog[pc].Jt); target != trace {
+			t.Fatalf("syscall %d jumps to %d, want %d", nrs[i], target, trace)
+		}
+	}
+}
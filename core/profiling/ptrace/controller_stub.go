@@ -0,0 +1,39 @@
+//go:build !linux || !(amd64 || arm64)
+
+package ptrace
+
+import (
+	"context"
+	"fmt"
+
+	"glasshouse/core/profiling"
+)
+
+var errUnsupported = fmt.Errorf("ptrace profiling is only available on Linux amd64 and arm64")
+
+// Init is a no-op where the ptrace helper is unsupported.
+func Init() {}
+
+// Available reports that ptrace profiling is unsupported on this platform.
+func Available() error {
+	return errUnsupported
+}
+
+// NewController returns a stub on unsupported platforms.
+func NewController() *Controller {
+	return &Controller{}
+}
+
+type Controller struct{}
+
+func (c *Controller) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	_ = ctx
+	_ = target
+	return nil, errUnsupported
+}
+
+func (c *Controller) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{}
+}
+
+var _ profiling.Controller = (*Controller)(nil)
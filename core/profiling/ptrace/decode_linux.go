@@ -0,0 +1,418 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+const (
+	atFDCWD     = -100
+	atEmptyPath = 0x1000
+	atRemoveDir = 0x200
+	// pathMax bounds strings read from the tracee, matching the eBPF
+	// open capture limit.
+	pathMax  = 4096
+	pageSize = 4096
+	// idUnchanged marks IDs a setre*/setres* call leaves alone.
+	idUnchanged = 0xffffffff
+)
+
+// Variants of EventSetUID/EventSetGID and EventModuleLoad, as emitted by
+// ebpf/host/sec.c.
+const (
+	idOpSet    = 0
+	idOpSetRE  = 1
+	idOpSetRES = 2
+	idOpSetFS  = 3
+
+	moduleOpInit  = 0
+	moduleOpFinit = 1
+)
+
+// decoder turns the arguments of a syscall entry into an event. It returns
+// false when the call is not reported.
+type decoder func(d *decodeCtx, args [6]uint64) (profiling.Event, bool)
+
+// decodeCtx is the tracee a syscall is decoded for. The tracee is stopped,
+// so its memory, cwd and fds can be read through /proc.
+type decodeCtx struct {
+	tid  int
+	proc *proc
+}
+
+// syscalls lists the traced syscalls by number; the seccomp filter traps
+// exactly these. Architecture files add legacy syscalls in init.
+var syscalls = map[uint64]decoder{
+	unix.SYS_OPENAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.open(int32(a[0]), a[1], uint32(a[2]))
+	},
+	unix.SYS_OPENAT2: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		// struct open_how starts with the u64 open flags.
+		var how [8]byte
+		d.read(a[2], how[:])
+		return d.open(int32(a[0]), a[1], uint32(binary.LittleEndian.Uint64(how[:])))
+	},
+	unix.SYS_EXECVE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		d.proc.execPath = d.path(atFDCWD, a[0])
+		return profiling.Event{}, false
+	},
+	unix.SYS_EXECVEAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		dirfd, flags := int32(a[0]), uint32(a[4])
+		if flags&atEmptyPath == 0 {
+			d.proc.execPath = d.path(dirfd, a[1])
+			return profiling.Event{}, false
+		}
+		ev := d.event(profiling.EventFilelessExec)
+		ev.DirFD = dirfd
+		ev.Flags = flags
+		ev.Path = fdPath(d.proc.tgid, dirfd)
+		d.proc.execPath = ev.Path
+		return ev, true
+	},
+	unix.SYS_CONNECT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.sockaddrEvent(profiling.EventConnect, int(a[0]), a[1], a[2])
+	},
+	unix.SYS_BIND: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.sockaddrEvent(profiling.EventBind, int(a[0]), a[1], a[2])
+	},
+	unix.SYS_LISTEN: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		proto, local := socketInfo(d.proc.tgid, int(a[0]))
+		ev := d.event(profiling.EventListen)
+		ev.Proto = proto
+		if !setSockaddr(&ev, local) {
+			return ev, false
+		}
+		return ev, true
+	},
+	unix.SYS_UNLINKAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.fsEvent(profiling.EventUnlink, int32(a[0]), a[1], uint32(a[2]))
+	},
+	unix.SYS_RENAMEAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.rename(int32(a[0]), a[1], int32(a[2]), a[3], 0)
+	},
+	unix.SYS_RENAMEAT2: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.rename(int32(a[0]), a[1], int32(a[2]), a[3], uint32(a[4]))
+	},
+	unix.SYS_MKDIRAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.fsEvent(profiling.EventMkdir, int32(a[0]), a[1], uint32(a[2]))
+	},
+	unix.SYS_FCHMODAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.fsEvent(profiling.EventChmod, int32(a[0]), a[1], uint32(a[2]))
+	},
+	unix.SYS_FCHOWNAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.chown(int32(a[0]), a[1], uint32(a[2]), uint32(a[3]), uint32(a[4]))
+	},
+	unix.SYS_TRUNCATE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.fsEvent(profiling.EventTruncate, atFDCWD, a[0], 0)
+	},
+	unix.SYS_SETUID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetUID, idOpSet, idUnchanged, a[0], idUnchanged)
+	},
+	unix.SYS_SETREUID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetUID, idOpSetRE, a[0], a[1], idUnchanged)
+	},
+	unix.SYS_SETRESUID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetUID, idOpSetRES, a[0], a[1], a[2])
+	},
+	unix.SYS_SETFSUID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetUID, idOpSetFS, idUnchanged, idUnchanged, a[0])
+	},
+	unix.SYS_SETGID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetGID, idOpSet, idUnchanged, a[0], idUnchanged)
+	},
+	unix.SYS_SETREGID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetGID, idOpSetRE, a[0], a[1], idUnchanged)
+	},
+	unix.SYS_SETRESGID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetGID, idOpSetRES, a[0], a[1], a[2])
+	},
+	unix.SYS_SETFSGID: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		return d.idChange(profiling.EventSetGID, idOpSetFS, idUnchanged, idUnchanged, a[0])
+	},
+	unix.SYS_CAPSET: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		// struct __user_cap_header_struct and two __user_cap_data_structs.
+		var hdr [8]byte
+		var data [24]byte
+		d.read(a[0], hdr[:])
+		d.read(a[1], data[:])
+		set := func(off int) uint64 {
+			lo := binary.LittleEndian.Uint32(data[off:])
+			hi := binary.LittleEndian.Uint32(data[12+off:])
+			return uint64(hi)<<32 | uint64(lo)
+		}
+		ev := d.event(profiling.EventCapset)
+		ev.Flags = binary.LittleEndian.Uint32(hdr[4:])
+		ev.Args = [3]uint64{set(0), set(4), set(8)}
+		return ev, true
+	},
+	unix.SYS_PTRACE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventPtrace)
+		ev.Flags = uint32(a[0])
+		ev.Args[0] = uint64(uint32(a[1]))
+		ev.Args[1] = a[2]
+		return ev, true
+	},
+	unix.SYS_MOUNT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventMount)
+		ev.Target, _ = d.str(a[0])
+		ev.Path = d.path(atFDCWD, a[1])
+		ev.Flags = uint32(a[3])
+		return ev, true
+	},
+	unix.SYS_UMOUNT2: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventUmount)
+		ev.Path = d.path(atFDCWD, a[0])
+		ev.Flags = uint32(a[1])
+		return ev, true
+	},
+	unix.SYS_BPF: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventBPF)
+		ev.Flags = uint32(a[0])
+		ev.Args[0] = uint64(uint32(a[2]))
+		return ev, true
+	},
+	unix.SYS_INIT_MODULE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventModuleLoad)
+		ev.Op = moduleOpInit
+		ev.Args[0] = a[1]
+		ev.Target, _ = d.str(a[2])
+		return ev, true
+	},
+	unix.SYS_FINIT_MODULE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventModuleLoad)
+		ev.Op = moduleOpFinit
+		ev.DirFD = int32(a[0])
+		ev.Flags = uint32(a[2])
+		ev.Path = fdPath(d.proc.tgid, ev.DirFD)
+		ev.Target, _ = d.str(a[1])
+		return ev, true
+	},
+	unix.SYS_MEMFD_CREATE: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		ev := d.event(profiling.EventMemfdCreate)
+		ev.Path, ev.PathTruncated = d.str(a[0])
+		ev.Flags = uint32(a[1])
+		return ev, true
+	},
+	unix.SYS_MPROTECT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+		prot := uint32(a[2])
+		if prot&unix.PROT_EXEC == 0 {
+			return profiling.Event{}, false
+		}
+		ev := d.event(profiling.EventMprotectExec)
+		ev.Flags = prot
+		ev.Args[0] = a[0]
+		ev.Args[1] = a[1]
+		return ev, true
+	},
+}
+
+func (d *decodeCtx) event(typ profiling.EventType) profiling.Event {
+	return profiling.Event{
+		Type:      typ,
+		PID:       uint32(d.proc.tgid),
+		PPID:      uint32(d.proc.ppid),
+		Comm:      d.proc.comm,
+		DirFD:     atFDCWD,
+		Timestamp: time.Now(),
+	}
+}
+
+func (d *decodeCtx) open(dirfd int32, pathAddr uint64, flags uint32) (profiling.Event, bool) {
+	ev := d.event(profiling.EventOpen)
+	ev.DirFD = dirfd
+	ev.Flags = flags
+	path, truncated := d.str(pathAddr)
+	ev.Path = resolvePath(d.proc.tgid, dirfd, path)
+	ev.PathTruncated = truncated
+	return ev, true
+}
+
+func (d *decodeCtx) fsEvent(typ profiling.EventType, dirfd int32, pathAddr uint64, flags uint32) (profiling.Event, bool) {
+	ev := d.event(typ)
+	ev.DirFD = dirfd
+	ev.Flags = flags
+	path, truncated := d.str(pathAddr)
+	ev.Path = resolvePath(d.proc.tgid, dirfd, path)
+	ev.PathTruncated = truncated
+	return ev, true
+}
+
+func (d *decodeCtx) rename(fromDirfd int32, from uint64, toDirfd int32, to uint64, flags uint32) (profiling.Event, bool) {
+	ev, _ := d.fsEvent(profiling.EventRename, fromDirfd, from, flags)
+	target, truncated := d.str(to)
+	ev.TargetDirFD = toDirfd
+	ev.Target = resolvePath(d.proc.tgid, toDirfd, target)
+	ev.PathTruncated = ev.PathTruncated || truncated
+	return ev, true
+}
+
+func (d *decodeCtx) chown(dirfd int32, pathAddr uint64, uid, gid, flags uint32) (profiling.Event, bool) {
+	ev, _ := d.fsEvent(profiling.EventChown, dirfd, pathAddr, flags)
+	ev.UID = uid
+	ev.GID = gid
+	return ev, true
+}
+
+func (d *decodeCtx) idChange(typ profiling.EventType, op uint32, real, effective, saved uint64) (profiling.Event, bool) {
+	ev := d.event(typ)
+	ev.Op = op
+	ev.Args = [3]uint64{uint64(uint32(real)), uint64(uint32(effective)), uint64(uint32(saved))}
+	return ev, true
+}
+
+// sockaddrEvent reports connect and bind calls on inet sockets.
+func (d *decodeCtx) sockaddrEvent(typ profiling.EventType, fd int, addr, addrLen uint64) (profiling.Event, bool) {
+	var raw [unix.SizeofSockaddrInet6]byte
+	if addrLen < 4 {
+		return profiling.Event{}, false
+	}
+	n := int(addrLen)
+	if n > len(raw) {
+		n = len(raw)
+	}
+	if d.read(addr, raw[:n]) < 4 {
+		return profiling.Event{}, false
+	}
+	ev := d.event(typ)
+	ev.AddrFamily = uint8(binary.LittleEndian.Uint16(raw[0:2]))
+	ev.Port = binary.BigEndian.Uint16(raw[2:4])
+	switch ev.AddrFamily {
+	case unix.AF_INET:
+		copy(ev.Addr[:], raw[4:8])
+	case unix.AF_INET6:
+		copy(ev.Addr[:], raw[8:24])
+	default:
+		return profiling.Event{}, false
+	}
+	ev.Proto, _ = socketInfo(d.proc.tgid, fd)
+	return ev, true
+}
+
+func (d *decodeCtx) path(dirfd int32, addr uint64) string {
+	path, _ := d.str(addr)
+	return resolvePath(d.proc.tgid, dirfd, path)
+}
+
+// str reads a NUL-terminated string of at most pathMax bytes, reporting
+// whether it was cut off.
+func (d *decodeCtx) str(addr uint64) (string, bool) {
+	if addr == 0 {
+		return "", false
+	}
+	var out []byte
+	for len(out) < pathMax {
+		// Reads stop at page boundaries so an unmapped next page does not
+		// fail the whole read.
+		n := pageSize - int(addr%pageSize)
+		if n > pathMax-len(out) {
+			n = pathMax - len(out)
+		}
+		chunk := make([]byte, n)
+		got := d.read(addr, chunk)
+		if got <= 0 {
+			break
+		}
+		if i := bytes.IndexByte(chunk[:got], 0); i >= 0 {
+			return string(append(out, chunk[:i]...)), false
+		}
+		out = append(out, chunk[:got]...)
+		addr += uint64(got)
+	}
+	return string(out), len(out) >= pathMax
+}
+
+func (d *decodeCtx) read(addr uint64, buf []byte) int {
+	if addr == 0 || len(buf) == 0 {
+		return 0
+	}
+	local := []unix.Iovec{{Base: &buf[0]}}
+	local[0].SetLen(len(buf))
+	remote := []unix.RemoteIovec{{Base: uintptr(addr), Len: len(buf)}}
+	n, err := unix.ProcessVMReadv(d.tid, local, remote, 0)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// socketInfo duplicates a tracee socket to read its protocol and local
+// address. Failures leave both unset.
+func socketInfo(pid, fd int) (uint8, unix.Sockaddr) {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return 0, nil
+	}
+	defer unix.Close(pidfd)
+	sock, err := unix.PidfdGetfd(pidfd, fd, 0)
+	if err != nil {
+		return 0, nil
+	}
+	defer unix.Close(sock)
+	proto, err := unix.GetsockoptInt(sock, unix.SOL_SOCKET, unix.SO_PROTOCOL)
+	if err != nil {
+		proto = 0
+	}
+	local, _ := unix.Getsockname(sock)
+	return uint8(proto), local
+}
+
+func setSockaddr(ev *profiling.Event, sa unix.Sockaddr) bool {
+	switch addr := sa.(type) {
+	case *unix.SockaddrInet4:
+		ev.AddrFamily = unix.AF_INET
+		ev.Port = uint16(addr.Port)
+		copy(ev.Addr[:], addr.Addr[:])
+	case *unix.SockaddrInet6:
+		ev.AddrFamily = unix.AF_INET6
+		ev.Port = uint16(addr.Port)
+		copy(ev.Addr[:], addr.Addr[:])
+	default:
+		return false
+	}
+	return true
+}
+
+// fdPath names the file behind a tracee fd, e.g. "/memfd:payload (deleted)".
+func fdPath(pid int, fd int32) string {
+	if fd < 0 {
+		return ""
+	}
+	target, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "fd", strconv.Itoa(int(fd))))
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// resolvePath makes a relative path absolute against the tracee's cwd or
+// the directory fd it passed.
+func resolvePath(pid int, dirfd int32, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	proc := filepath.Join("/proc", strconv.Itoa(pid))
+	var link string
+	switch {
+	case dirfd == atFDCWD:
+		link = filepath.Join(proc, "cwd")
+	case dirfd >= 0:
+		link = filepath.Join(proc, "fd", strconv.Itoa(int(dirfd)))
+	default:
+		return path
+	}
+	dir, err := os.Readlink(link)
+	if err != nil || !filepath.IsAbs(dir) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
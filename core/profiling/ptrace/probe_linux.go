@@ -0,0 +1,32 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+const yamaScope = "/proc/sys/kernel/yama/ptrace_scope"
+
+// Available reports why ptrace profiling cannot work on this host, or nil.
+// It needs PTRACE_GET_SYSCALL_INFO (Linux 5.3) and ptrace not disabled by
+// Yama; scopes 1 and 2 are handled by the shim and CAP_SYS_PTRACE.
+func Available() error {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return fmt.Errorf("uname: %w", err)
+	}
+	if !profiling.KernelAtLeast(unix.ByteSliceToString(uts.Release[:]), 5, 3) {
+		return fmt.Errorf("kernel %s lacks PTRACE_GET_SYSCALL_INFO (needs 5.3)", unix.ByteSliceToString(uts.Release[:]))
+	}
+	if data, err := os.ReadFile(yamaScope); err == nil && strings.TrimSpace(string(data)) == "3" {
+		return fmt.Errorf("ptrace is disabled (kernel.yama.ptrace_scope=3)")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+// tracerWait bounds how long the shim waits for the helper to attach before
+// running the command untraced.
+const tracerWait = 5 * time.Second
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTSync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetTrace        = 0x7ff00000
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// runShim is the process the engine launches in place of the command. It
+// lets the glasshouse process tree trace it under Yama, waits for the
+// helper to attach, installs a filter that stops only at traced syscalls
+// and execs the command.
+func runShim(args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "glasshouse: shim: no command")
+		return 2
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "glasshouse:", err)
+		return 127
+	}
+	// Without Yama this fails with EINVAL and is not needed.
+	_ = unix.Prctl(unix.PR_SET_PTRACER, uintptr(os.Getppid()), 0, 0, 0)
+	if waitForTracer(tracerWait) {
+		// Without CAP_SYS_ADMIN (and no no_new_privs inherited from our
+		// parent) this fails with EACCES; tracing every syscall is slower
+		// but leaves the command's privileges alone.
+		if err := installFilter(); err != nil && !errors.Is(err, unix.EACCES) {
+			fmt.Fprintln(os.Stderr, "glasshouse: seccomp filter unavailable, tracing every syscall:", err)
+		}
+	}
+	err = unix.Exec(path, args, os.Environ())
+	fmt.Fprintln(os.Stderr, "glasshouse:", err)
+	return 127
+}
+
+func waitForTracer(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if statusField(os.Getpid(), "TracerPid:", 0) != 0 {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+// installFilter returns SECCOMP_RET_TRACE for every decoded syscall so the
+// tracer is only woken for them. Loading a filter without CAP_SYS_ADMIN
+// needs no_new_privs, which would stop setuid binaries and file
+// capabilities from working in the traced command. It is never set here:
+// the load fails with EACCES instead and the tracer stops at every syscall.
+func installFilter() error {
+	prog := buildFilter(tracedSyscalls())
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTSync, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func tracedSyscalls() []uint32 {
+	nrs := make([]uint32, 0, len(syscalls))
+	for nr := range syscalls {
+		nrs = append(nrs, uint32(nr))
+	}
+	sort.Slice(nrs, func(i, j int) bool { return nrs[i] < nrs[j] })
+	return nrs
+}
+
+// buildFilter assembles:
+//
+//	ld arch; jne auditArch -> allow
+//	ld nr; jeq nrs[i] -> trace ...
+//	allow: ret ALLOW
+//	trace: ret TRACE
+func buildFilter(nrs []uint32) []unix.SockFilter {
+	n := len(nrs)
+	prog := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataArch},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: uint8(n + 1), K: auditArch},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: seccompDataNr},
+	}
+	for i, nr := range nrs {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: uint8(n - i), K: nr})
+	}
+	return append(prog,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetAllow},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: seccompRetTrace},
+	)
+}
+
+// runHelper traces pid and writes messages to stdout until no tracee is
+// left. It runs in its own process: a tracer in the glasshouse process
+// would steal the wait statuses the backend relies on.
+func runHelper(args []string) int {
+	runtime.LockOSThread()
+	// Once glasshouse stops reading, keep tracing silently rather than die
+	// on SIGPIPE and leave tracees without their tracer.
+	signal.Ignore(syscall.SIGPIPE)
+	enc := json.NewEncoder(os.Stdout)
+	if len(args) != 1 {
+		_ = enc.Encode(message{Error: "usage: helper <pid>"})
+		return 2
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil || pid <= 0 {
+		_ = enc.Encode(message{Error: "invalid pid " + strconv.Quote(args[0])})
+		return 2
+	}
+
+	writing := true
+	t := newTracer(func(ev profiling.Event) {
+		if writing && enc.Encode(message{Event: &ev}) != nil {
+			writing = false
+		}
+	})
+	if err := t.attach(pid); err != nil {
+		_ = enc.Encode(message{Error: err.Error()})
+		return 1
+	}
+	if err := enc.Encode(message{Ready: true}); err != nil {
+		return 1
+	}
+	if err := t.run(); err != nil {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(err.Error()))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package ptrace
+
+import (
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+const auditArch = unix.AUDIT_ARCH_X86_64
+
+// x86-64 keeps the pre-*at syscalls that newer architectures dropped.
+func init() {
+	legacy := map[uint64]decoder{
+		unix.SYS_OPEN: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.open(atFDCWD, a[0], uint32(a[1]))
+		},
+		unix.SYS_CREAT: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.open(atFDCWD, a[0], unix.O_CREAT|unix.O_WRONLY|unix.O_TRUNC)
+		},
+		unix.SYS_UNLINK: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.fsEvent(profiling.EventUnlink, atFDCWD, a[0], 0)
+		},
+		unix.SYS_RMDIR: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.fsEvent(profiling.EventUnlink, atFDCWD, a[0], atRemoveDir)
+		},
+		unix.SYS_RENAME: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.rename(atFDCWD, a[0], atFDCWD, a[1], 0)
+		},
+		unix.SYS_MKDIR: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.fsEvent(profiling.EventMkdir, atFDCWD, a[0], uint32(a[1]))
+		},
+		unix.SYS_CHMOD: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.fsEvent(profiling.EventChmod, atFDCWD, a[0], uint32(a[1]))
+		},
+		unix.SYS_CHOWN: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.chown(atFDCWD, a[0], uint32(a[1]), uint32(a[2]), 0)
+		},
+		unix.SYS_LCHOWN: func(d *decodeCtx, a [6]uint64) (profiling.Event, bool) {
+			return d.chown(atFDCWD, a[0], uint32(a[1]), uint32(a[2]), 0)
+		},
+	}
+	for nr, decode := range legacy {
+		syscalls[nr] = decode
+	}
+}
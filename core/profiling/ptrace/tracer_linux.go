@@ -0,0 +1,399 @@
+//go:build linux && (amd64 || arm64)
+
+package ptrace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"glasshouse/core/profiling"
+)
+
+const traceOptions = unix.PTRACE_O_TRACESYSGOOD |
+	unix.PTRACE_O_TRACEFORK |
+	unix.PTRACE_O_TRACEVFORK |
+	unix.PTRACE_O_TRACECLONE |
+	unix.PTRACE_O_TRACEEXEC |
+	unix.PTRACE_O_TRACESECCOMP
+
+// syscallInfo mirrors struct ptrace_syscall_info up to the entry arguments;
+// the seccomp variant shares the layout.
+type syscallInfo struct {
+	Op    uint8
+	_     [3]uint8
+	Arch  uint32
+	IP    uint64
+	SP    uint64
+	Nr    uint64
+	Args  [6]uint64
+	Extra uint32
+}
+
+// proc is a traced thread group.
+type proc struct {
+	tgid int
+	ppid int
+	comm string
+	// execPath is the filename of the last execve, reported once the exec
+	// succeeds.
+	execPath string
+	// quiet suppresses events from the glasshouse shim until it execs the
+	// target command.
+	quiet bool
+	// announced is set once the process's fork event was emitted.
+	announced bool
+}
+
+// task is a traced thread.
+type task struct {
+	tid  int
+	proc *proc
+	// seccomp is set once the thread runs under the shim's filter; it is
+	// then resumed with PTRACE_CONT and stops only at traced syscalls.
+	seccomp bool
+	// entered is set when the current syscall was decoded at its entry
+	// stop, so the seccomp stop that follows is not decoded again.
+	entered bool
+	started bool
+}
+
+// tracer follows a process tree with ptrace and reports its syscalls. All
+// ptrace requests must come from the thread that attached, so run holds the
+// OS thread for its whole lifetime.
+type tracer struct {
+	emit  func(profiling.Event)
+	tasks map[int]*task
+	procs map[int]*proc
+}
+
+func newTracer(emit func(profiling.Event)) *tracer {
+	return &tracer{
+		emit:  emit,
+		tasks: make(map[int]*task),
+		procs: make(map[int]*proc),
+	}
+}
+
+// attach seizes every thread of pid. A process that is still the glasshouse
+// shim stays quiet until it execs the real command.
+func (t *tracer) attach(pid int) error {
+	p := t.proc(pid)
+	p.quiet = isShim(pid)
+	p.announced = true
+	entries, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+	if err != nil {
+		return fmt.Errorf("list threads of %d: %w", pid, err)
+	}
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if err := seize(tid); err != nil {
+			if tid == pid {
+				return fmt.Errorf("seize %d: %w", tid, err)
+			}
+			continue
+		}
+		t.tasks[tid] = &task{tid: tid, proc: p}
+		_ = unix.PtraceInterrupt(tid)
+	}
+	return nil
+}
+
+func seize(tid int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_SEIZE, uintptr(tid), 0, traceOptions, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// run services ptrace stops until no tracee is left.
+func (t *tracer) run() error {
+	for {
+		var status unix.WaitStatus
+		tid, err := unix.Wait4(-1, &status, unix.WALL, nil)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			if errors.Is(err, unix.ECHILD) {
+				return nil
+			}
+			return fmt.Errorf("wait: %w", err)
+		}
+		t.handle(tid, status)
+	}
+}
+
+func (t *tracer) handle(tid int, status unix.WaitStatus) {
+	tk := t.task(tid)
+	if status.Exited() || status.Signaled() {
+		delete(t.tasks, tid)
+		p := tk.proc
+		if tid == p.tgid {
+			if !p.quiet {
+				ev := t.event(profiling.EventExit, p)
+				ev.Flags = uint32(status)
+				t.emit(ev)
+			}
+			delete(t.procs, p.tgid)
+		}
+		return
+	}
+	if !status.Stopped() {
+		return
+	}
+
+	sig := status.StopSignal()
+	event := int(status>>16) & 0xff
+	switch {
+	case sig == unix.SIGTRAP|0x80:
+		t.syscallStop(tk)
+		t.resume(tk, 0)
+	case event == unix.PTRACE_EVENT_SECCOMP:
+		if tk.entered {
+			tk.entered = false
+		} else {
+			t.decode(tk)
+		}
+		tk.seccomp = true
+		t.resume(tk, 0)
+	case event == unix.PTRACE_EVENT_FORK, event == unix.PTRACE_EVENT_VFORK, event == unix.PTRACE_EVENT_CLONE:
+		t.newChild(tk, event)
+		t.resume(tk, 0)
+	case event == unix.PTRACE_EVENT_EXEC:
+		t.exec(tk)
+		t.resume(tk, 0)
+	case event == unix.PTRACE_EVENT_STOP:
+		// The first stop of a new tracee and PTRACE_INTERRUPT stops are
+		// resumed; job control stops are kept with PTRACE_LISTEN.
+		if tk.started && isGroupStop(sig) {
+			_ = ptraceListen(tid)
+			return
+		}
+		tk.started = true
+		t.resume(tk, 0)
+	default:
+		tk.started = true
+		t.resume(tk, int(sig))
+	}
+}
+
+func isGroupStop(sig unix.Signal) bool {
+	switch sig {
+	case unix.SIGSTOP, unix.SIGTSTP, unix.SIGTTIN, unix.SIGTTOU:
+		return true
+	}
+	return false
+}
+
+func ptraceListen(tid int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_LISTEN, uintptr(tid), 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (t *tracer) resume(tk *task, sig int) {
+	if tk.seccomp {
+		_ = unix.PtraceCont(tk.tid, sig)
+		return
+	}
+	_ = unix.PtraceSyscall(tk.tid, sig)
+}
+
+// syscallStop decodes syscall-entry stops of threads that are not yet under
+// the seccomp filter.
+func (t *tracer) syscallStop(tk *task) {
+	info, ok := getSyscallInfo(tk.tid)
+	if !ok {
+		return
+	}
+	switch info.Op {
+	case unix.PTRACE_SYSCALL_INFO_ENTRY:
+		tk.entered = true
+		t.decodeInfo(tk, info)
+	case unix.PTRACE_SYSCALL_INFO_EXIT:
+		tk.entered = false
+	}
+}
+
+func (t *tracer) decode(tk *task) {
+	if info, ok := getSyscallInfo(tk.tid); ok {
+		t.decodeInfo(tk, info)
+	}
+}
+
+func (t *tracer) decodeInfo(tk *task, info syscallInfo) {
+	if info.Arch != auditArch {
+		return
+	}
+	decode, ok := syscalls[info.Nr]
+	if !ok {
+		return
+	}
+	ev, ok := decode(&decodeCtx{tid: tk.tid, proc: tk.proc}, info.Args)
+	if ok && !tk.proc.quiet {
+		t.emit(ev)
+	}
+}
+
+func getSyscallInfo(tid int) (syscallInfo, bool) {
+	var info syscallInfo
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_GET_SYSCALL_INFO, uintptr(tid),
+		unsafe.Sizeof(info), uintptr(unsafe.Pointer(&info)), 0, 0)
+	return info, errno == 0
+}
+
+// newChild registers a thread or process created by tk. Its first stop may
+// already have been seen, in which case the task exists without a parent.
+func (t *tracer) newChild(tk *task, event int) {
+	msg, err := unix.PtraceGetEventMsg(tk.tid)
+	if err != nil {
+		return
+	}
+	child := int(msg)
+	isProcess := event != unix.PTRACE_EVENT_CLONE || threadGroup(child) == child
+	ct, known := t.tasks[child]
+	if !known {
+		ct = &task{tid: child}
+		t.tasks[child] = ct
+	}
+	ct.seccomp = tk.seccomp
+	if !isProcess {
+		if ct.proc != nil && ct.proc != tk.proc && ct.proc.tgid == child {
+			delete(t.procs, child)
+		}
+		ct.proc = tk.proc
+		return
+	}
+	p := t.proc(child)
+	p.ppid = tk.proc.tgid
+	ct.proc = p
+	t.announce(p)
+}
+
+// announce emits the fork event for a new process. A child's first stop can
+// be reported before its parent's fork event, so whichever comes first
+// announces it.
+func (t *tracer) announce(p *proc) {
+	if p.announced {
+		return
+	}
+	p.announced = true
+	parent, ok := t.procs[p.ppid]
+	if !ok || parent.quiet {
+		return
+	}
+	ev := t.event(profiling.EventFork, p)
+	ev.Comm = parent.comm
+	t.emit(ev)
+}
+
+// exec reports a successful execve. The exec may have come from a
+// non-leader thread, which then takes over the thread group ID.
+func (t *tracer) exec(tk *task) {
+	if msg, err := unix.PtraceGetEventMsg(tk.tid); err == nil && int(msg) != tk.tid {
+		delete(t.tasks, int(msg))
+	}
+	p := tk.proc
+	p.comm = readComm(p.tgid)
+	path := p.execPath
+	p.execPath = ""
+	if path == "" {
+		path, _ = os.Readlink(filepath.Join("/proc", strconv.Itoa(p.tgid), "exe"))
+	}
+	p.quiet = false
+	ev := t.event(profiling.EventExec, p)
+	ev.Path = path
+	t.emit(ev)
+}
+
+func (t *tracer) event(typ profiling.EventType, p *proc) profiling.Event {
+	return profiling.Event{
+		Type:      typ,
+		PID:       uint32(p.tgid),
+		PPID:      uint32(p.ppid),
+		Comm:      p.comm,
+		DirFD:     atFDCWD,
+		Timestamp: time.Now(),
+	}
+}
+
+// task returns the task for tid, registering tracees that reported a stop
+// before their creation event.
+func (t *tracer) task(tid int) *task {
+	if tk, ok := t.tasks[tid]; ok {
+		return tk
+	}
+	tk := &task{tid: tid, proc: t.proc(threadGroup(tid))}
+	t.tasks[tid] = tk
+	if tk.proc.tgid == tid {
+		t.announce(tk.proc)
+	}
+	return tk
+}
+
+func (t *tracer) proc(tgid int) *proc {
+	if p, ok := t.procs[tgid]; ok {
+		return p
+	}
+	p := &proc{tgid: tgid, ppid: parentPID(tgid), comm: readComm(tgid)}
+	t.procs[tgid] = p
+	return p
+}
+
+func readComm(pid int) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// threadGroup returns the process a thread belongs to, or tid itself when
+// it cannot be read.
+func threadGroup(tid int) int {
+	return statusField(tid, "Tgid:", tid)
+}
+
+func parentPID(pid int) int {
+	return statusField(pid, "PPid:", 0)
+}
+
+func statusField(pid int, field string, fallback int) int {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return fallback
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, field); ok {
+			if value, err := strconv.Atoi(strings.TrimSpace(rest)); err == nil {
+				return value
+			}
+		}
+	}
+	return fallback
+}
+
+// isShim reports whether pid is still running the glasshouse shim.
+func isShim(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	args := bytes.Split(data, []byte{0})
+	return len(args) > 1 && string(args[1]) == shimArg
+}
@@ -0,0 +1,91 @@
+package synthetic_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"glasshouse/core/agent"
+	"glasshouse/core/profiling"
+	"glasshouse/core/profiling/synthetic"
+	"glasshouse/core/receipt"
+)
+
+var workloads = []struct {
+	name string
+	w    synthetic.Workload
+}{
+	{"ForkTree", synthetic.Workload{Seed: 1, Forks: 2000, Opens: 2, Connects: 1}},
+	{"OpenStorm", synthetic.Workload{Seed: 2, Forks: 8, Opens: 5000, WriteRatio: 0.1}},
+	{"ConnectBurst", synthetic.Workload{Seed: 3, Forks: 8, Connects: 5000}},
+	{"PIDReuse", synthetic.Workload{Seed: 4, Executions: 64, Parallel: 8, Forks: 50, Opens: 10, Connects: 2, PIDSpace: 256}},
+	{"Cgroups", synthetic.Workload{Seed: 5, Executions: 64, Parallel: 16, Forks: 20, Opens: 20, Connects: 5, Cgroups: true}},
+}
+
+// BenchmarkAggregator feeds each workload straight into a stream aggregator
+// and reports throughput and the heap retained per event before flushing.
+func BenchmarkAggregator(b *testing.B) {
+	for _, tc := range workloads {
+		b.Run(tc.name, func(b *testing.B) {
+			events := tc.w.Events()
+			var retained uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				before := heapInUse()
+				agg := receipt.NewStreamAggregator(receipt.AggregatorOptions{Provenance: "host", AutoCreate: true})
+				tc.w.Generate(0, func(ev profiling.Event) bool {
+					agg.HandleEvent(ev)
+					return true
+				})
+				b.StopTimer()
+				if after := heapInUse(); after > before {
+					retained += after - before
+				}
+				runtime.KeepAlive(agg)
+				b.StartTimer()
+			}
+			reportRates(b, events, retained)
+		})
+	}
+}
+
+// BenchmarkAgent runs the agent event loop over a synthetic session,
+// including runtime policy evaluation and channel delivery.
+func BenchmarkAgent(b *testing.B) {
+	for _, tc := range workloads {
+		b.Run(tc.name, func(b *testing.B) {
+			events := tc.w.Events()
+			controller := synthetic.NewController(tc.w)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				err := agent.New(agent.Config{}, controller).Run(ctx)
+				cancel()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			reportRates(b, events, 0)
+		})
+	}
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+func reportRates(b *testing.B, events int, retained uint64) {
+	total := float64(events) * float64(b.N)
+	if elapsed := b.Elapsed().Seconds(); elapsed > 0 {
+		b.ReportMetric(total/elapsed, "events/s")
+	}
+	if retained > 0 {
+		b.ReportMetric(float64(retained)/total, "retained-B/event")
+	}
+}
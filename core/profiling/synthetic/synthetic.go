@@ -0,0 +1,294 @@
+// Package synthetic generates deterministic profiling workloads so the
+// aggregator and agent can be load tested without a kernel.
+package synthetic
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"glasshouse/core/profiling"
+)
+
+// Mechanism is reported in Capabilities and receipts built from a
+// synthetic session.
+const Mechanism = "synthetic"
+
+const (
+	firstPID = 1000
+	// eventSpacing separates timestamps when no Rate is set.
+	eventSpacing = time.Microsecond
+)
+
+// Workload describes a generated event stream. Each execution is a process
+// tree: the root execs, forks Forks children, and each child execs, opens
+// Opens files, connects Connects times and exits before the root exits.
+type Workload struct {
+	// Seed makes the stream reproducible; the same workload and seed always
+	// produce the same events.
+	Seed int64
+	// Executions is the number of process trees, at least one.
+	Executions int
+	// Parallel trees are interleaved at random, at least one.
+	Parallel int
+	Forks    int
+	Opens    int
+	Connects int
+	// WriteRatio is the fraction of opens that write, between 0 and 1.
+	WriteRatio float64
+	// PIDSpace, when positive, wraps PIDs after that many so later
+	// processes reuse the PIDs of exited ones.
+	PIDSpace int
+	// Cgroups gives every execution its own cgroup ID.
+	Cgroups bool
+	// Rate paces the session in events per second. Zero delivers events as
+	// fast as they are consumed. Generate never sleeps.
+	Rate int
+	// Start is the timestamp of the first event; zero uses the Unix epoch so
+	// streams stay reproducible.
+	Start time.Time
+}
+
+// Events returns how many events the workload generates.
+func (w Workload) Events() int {
+	w = w.normalized()
+	return w.Executions * (2 + w.Forks*(3+w.Opens+w.Connects))
+}
+
+func (w Workload) normalized() Workload {
+	if w.Executions < 1 {
+		w.Executions = 1
+	}
+	if w.Parallel < 1 {
+		w.Parallel = 1
+	}
+	if w.Start.IsZero() {
+		w.Start = time.Unix(0, 0).UTC()
+	}
+	return w
+}
+
+func (w Workload) spacing() time.Duration {
+	if w.Rate > 0 {
+		return time.Second / time.Duration(w.Rate)
+	}
+	return eventSpacing
+}
+
+// Generate calls emit with every event of the workload in order and stops
+// early when emit returns false. A non-zero root is used as the root PID of
+// the first execution.
+func (w Workload) Generate(root uint32, emit func(profiling.Event) bool) {
+	w = w.normalized()
+	g := &generator{
+		w:    w,
+		rng:  rand.New(rand.NewSource(w.Seed)),
+		live: make(map[uint32]struct{}),
+		next: firstPID,
+		at:   w.Start,
+	}
+	var active []*tree
+	started := 0
+	for started < w.Executions || len(active) > 0 {
+		for len(active) < w.Parallel && started < w.Executions {
+			t := &tree{}
+			if started == 0 && root != 0 {
+				t.root = root
+				g.live[root] = struct{}{}
+			} else {
+				t.root = g.allocPID()
+			}
+			if w.Cgroups {
+				t.cgroup = uint64(started + 1)
+			}
+			active = append(active, t)
+			started++
+		}
+		// The first event is always the exec of the target root.
+		i := 0
+		if g.at != w.Start {
+			i = g.rng.Intn(len(active))
+		}
+		ev, more := g.step(active[i])
+		if !more {
+			active = append(active[:i], active[i+1:]...)
+		}
+		if !emit(ev) {
+			return
+		}
+	}
+}
+
+type tree struct {
+	root   uint32
+	cgroup uint64
+	child  uint32
+	// pos is the index of the tree's next event.
+	pos int
+}
+
+type generator struct {
+	w    Workload
+	rng  *rand.Rand
+	live map[uint32]struct{}
+	next uint32
+	at   time.Time
+}
+
+// step returns the tree's next event and whether more remain.
+func (g *generator) step(t *tree) (profiling.Event, bool) {
+	perChild := 3 + g.w.Opens + g.w.Connects
+	last := 1 + g.w.Forks*perChild
+	pos := t.pos
+	t.pos++
+	switch {
+	case pos == 0:
+		return g.event(t, profiling.EventExec, t.root, 0, "/usr/bin/synthetic-root"), true
+	case pos == last:
+		delete(g.live, t.root)
+		return g.event(t, profiling.EventExit, t.root, 0, ""), false
+	default:
+		return g.childEvent(t, (pos-1)%perChild), true
+	}
+}
+
+func (g *generator) childEvent(t *tree, i int) profiling.Event {
+	switch {
+	case i == 0:
+		t.child = g.allocPID()
+		return g.event(t, profiling.EventFork, t.child, t.root, "")
+	case i == 1:
+		return g.event(t, profiling.EventExec, t.child, t.root, "/usr/bin/synthetic-worker")
+	case i < 2+g.w.Opens:
+		path := fmt.Sprintf("/srv/synthetic/d%02d/f%04d", g.rng.Intn(64), g.rng.Intn(4096))
+		ev := g.event(t, profiling.EventOpen, t.child, t.root, path)
+		if g.rng.Float64() < g.w.WriteRatio {
+			ev.Flags = syscall.O_WRONLY | syscall.O_CREAT
+		}
+		return ev
+	case i < 2+g.w.Opens+g.w.Connects:
+		ev := g.event(t, profiling.EventConnect, t.child, t.root, "")
+		ev.AddrFamily = syscall.AF_INET
+		ev.Proto = syscall.IPPROTO_TCP
+		ev.Addr = [16]byte{10, byte(g.rng.Intn(4)), byte(g.rng.Intn(256)), byte(1 + g.rng.Intn(254))}
+		ev.Port = []uint16{53, 80, 443, 5432}[g.rng.Intn(4)]
+		return ev
+	default:
+		delete(g.live, t.child)
+		return g.event(t, profiling.EventExit, t.child, t.root, "")
+	}
+}
+
+func (g *generator) event(t *tree, typ profiling.EventType, pid, ppid uint32, path string) profiling.Event {
+	ev := profiling.Event{
+		Type:      typ,
+		PID:       pid,
+		PPID:      ppid,
+		CgroupID:  t.cgroup,
+		Comm:      "synthetic",
+		Path:      path,
+		Timestamp: g.at,
+	}
+	g.at = g.at.Add(g.w.spacing())
+	return ev
+}
+
+// allocPID returns the next PID that is not in use, wrapping within
+// PIDSpace when set.
+func (g *generator) allocPID() uint32 {
+	for tries := 0; ; tries++ {
+		pid := g.next
+		g.next++
+		if g.w.PIDSpace > 0 && g.next >= firstPID+uint32(g.w.PIDSpace) {
+			g.next = firstPID
+		}
+		if _, busy := g.live[pid]; !busy || (g.w.PIDSpace > 0 && tries > g.w.PIDSpace) {
+			g.live[pid] = struct{}{}
+			return pid
+		}
+	}
+}
+
+// Controller is a profiling.Controller that streams a Workload.
+type Controller struct {
+	w Workload
+}
+
+func NewController(w Workload) *Controller {
+	return &Controller{w: w}
+}
+
+func (c *Controller) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: true, Guest: true, Combined: true, Mechanism: Mechanism}
+}
+
+// Start streams the workload rooted at target.RootPID until it is
+// exhausted, ctx is done or the session is closed.
+func (c *Controller) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	s := &session{
+		events: make(chan profiling.Event, 1024),
+		errs:   make(chan error),
+		done:   make(chan struct{}),
+	}
+	go s.run(ctx, c.w, uint32(target.RootPID))
+	return s, nil
+}
+
+type session struct {
+	events    chan profiling.Event
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *session) run(ctx context.Context, w Workload, root uint32) {
+	defer close(s.errs)
+	defer close(s.events)
+	begin := time.Now()
+	var interval time.Duration
+	if w.Rate > 0 {
+		interval = time.Second / time.Duration(w.Rate)
+	}
+	n := 0
+	w.Generate(root, func(ev profiling.Event) bool {
+		if interval > 0 {
+			if wait := time.Until(begin.Add(time.Duration(n) * interval)); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return false
+				case <-s.done:
+					return false
+				}
+			}
+		}
+		n++
+		select {
+		case s.events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-s.done:
+			return false
+		}
+	})
+}
+
+func (s *session) Events() <-chan profiling.Event {
+	return s.events
+}
+
+func (s *session) Errors() <-chan error {
+	return s.errs
+}
+
+func (s *session) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+var _ profiling.Controller = (*Controller)(nil)
+var _ profiling.Session = (*session)(nil)
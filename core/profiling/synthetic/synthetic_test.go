@@ -0,0 +1,73 @@
+package synthetic
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"glasshouse/core/profiling"
+)
+
+func collect(w Workload, root uint32) []profiling.Event {
+	var events []profiling.Event
+	w.Generate(root, func(ev profiling.Event) bool {
+		events = append(events, ev)
+		return true
+	})
+	return events
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	w := Workload{Seed: 7, Executions: 6, Parallel: 3, Forks: 4, Opens: 5, Connects: 2, WriteRatio: 0.2, PIDSpace: 16}
+	first := collect(w, 42)
+	if len(first) != w.Events() {
+		t.Fatalf("generated %d events, want %d", len(first), w.Events())
+	}
+	if first[0].PID != 42 || first[0].Type != profiling.EventExec {
+		t.Fatalf("first event = %+v, want exec of root 42", first[0])
+	}
+	if !reflect.DeepEqual(first, collect(w, 42)) {
+		t.Fatal("same seed produced a different stream")
+	}
+	w.Seed = 8
+	if reflect.DeepEqual(first, collect(w, 42)) {
+		t.Fatal("different seeds produced the same stream")
+	}
+
+	live := make(map[uint32]bool)
+	reused := false
+	seen := make(map[uint32]bool)
+	for _, ev := range first {
+		switch ev.Type {
+		case profiling.EventFork:
+			if live[ev.PID] {
+				t.Fatalf("pid %d forked while still live", ev.PID)
+			}
+			reused = reused || seen[ev.PID]
+			live[ev.PID], seen[ev.PID] = true, true
+		case profiling.EventExit:
+			delete(live, ev.PID)
+		}
+	}
+	if !reused {
+		t.Fatal("PIDSpace did not cause pid reuse")
+	}
+}
+
+func TestControllerStreamsWorkload(t *testing.T) {
+	w := Workload{Seed: 1, Executions: 2, Forks: 3, Opens: 2, Connects: 1}
+	session, err := NewController(w).Start(context.Background(), profiling.Target{RootPID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []profiling.Event
+	for ev := range session.Events() {
+		got = append(got, ev)
+	}
+	if !reflect.DeepEqual(got, collect(w, 42)) {
+		t.Fatal("session stream differs from Generate")
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,10 @@
 package profiling
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 // Mode expresses how profiling should be attached.
 // Profiling is optional and defaults to disabled.
@@ -13,11 +17,19 @@ const (
 	ProfilingCombined Mode = "combined"
 )
 
+// Observation mechanisms reported in Capabilities.Mechanism.
+const (
+	MechanismEBPF   = "ebpf"
+	MechanismPtrace = "ptrace"
+)
+
 // Capabilities declares which profiling attachment points a provider supports.
 type Capabilities struct {
 	Host     bool
 	Guest    bool
 	Combined bool
+	// Mechanism names how events are observed, e.g. MechanismEBPF.
+	Mechanism string
 }
 
 // Target describes the process identity a profiler should attach to.
@@ -39,8 +51,126 @@ const (
 	EventExec    EventType = 1
 	EventOpen    EventType = 2
 	EventConnect EventType = 3
+	// EventFork reports a new process: PID is the child and PPID the parent.
+	EventFork EventType = 4
+	// EventExit reports a process exit; Flags carries the raw wait status.
+	EventExit EventType = 5
+	// Filesystem mutations. Path is the affected file; Flags carries the
+	// syscall flags or mode.
+	EventUnlink EventType = 6
+	// EventRename sets Target to the destination path.
+	EventRename EventType = 7
+	EventMkdir  EventType = 8
+	EventChmod  EventType = 9
+	// EventChown sets UID and GID; 0xffffffff leaves the owner unchanged.
+	EventChown    EventType = 10
+	EventTruncate EventType = 11
+	// Network events carry the address in AddrFamily/Addr/Port. EventBind and
+	// EventListen report the local address; EventAccept the remote peer with
+	// the local port in Flags.
+	EventBind   EventType = 12
+	EventListen EventType = 13
+	EventAccept EventType = 14
+	// EventSend and EventRecv report UDP datagrams, with the byte count in
+	// Flags and the start of DNS messages in Payload.
+	EventSend EventType = 15
+	EventRecv EventType = 16
+	// EventSocketStats reports TCP bytes for a socket when it closes.
+	EventSocketStats EventType = 17
+	// Security-sensitive syscalls. Op distinguishes variants sharing a type
+	// (e.g. setuid, setreuid, setresuid) and Args holds numeric arguments;
+	// see receipt.SecurityInfo for how each is interpreted.
+	EventSetUID       EventType = 18
+	EventSetGID       EventType = 19
+	EventCapset       EventType = 20
+	EventPtrace       EventType = 21
+	EventMount        EventType = 22
+	EventUmount       EventType = 23
+	EventBPF          EventType = 24
+	EventModuleLoad   EventType = 25
+	EventMemfdCreate  EventType = 26
+	EventFilelessExec EventType = 27
+	EventMprotectExec EventType = 28
 )
 
+// IsSecurity reports whether t is a privilege or kernel-interaction event.
+func (t EventType) IsSecurity() bool {
+	return t >= EventSetUID && t <= EventMprotectExec
+}
+
+// ParseEventType returns the event type whose String is name.
+func ParseEventType(name string) (EventType, bool) {
+	for t := EventExec; t <= EventMprotectExec; t++ {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func (t EventType) String() string {
+	switch t {
+	case EventExec:
+		return "exec"
+	case EventOpen:
+		return "open"
+	case EventConnect:
+		return "connect"
+	case EventFork:
+		return "fork"
+	case EventExit:
+		return "exit"
+	case EventUnlink:
+		return "unlink"
+	case EventRename:
+		return "rename"
+	case EventMkdir:
+		return "mkdir"
+	case EventChmod:
+		return "chmod"
+	case EventChown:
+		return "chown"
+	case EventTruncate:
+		return "truncate"
+	case EventBind:
+		return "bind"
+	case EventListen:
+		return "listen"
+	case EventAccept:
+		return "accept"
+	case EventSend:
+		return "send"
+	case EventRecv:
+		return "recv"
+	case EventSocketStats:
+		return "socket_stats"
+	case EventSetUID:
+		return "setuid"
+	case EventSetGID:
+		return "setgid"
+	case EventCapset:
+		return "capset"
+	case EventPtrace:
+		return "ptrace"
+	case EventMount:
+		return "mount"
+	case EventUmount:
+		return "umount"
+	case EventBPF:
+		return "bpf"
+	case EventModuleLoad:
+		return "module_load"
+	case EventMemfdCreate:
+		return "memfd_create"
+	case EventFilelessExec:
+		return "fileless_exec"
+	case EventMprotectExec:
+		return "mprotect_exec"
+	default:
+		return fmt.Sprintf("event(%d)", uint32(t))
+	}
+}
+
 // Event is a substrate-agnostic observation captured during execution.
 // The fields mirror the current eBPF emission format but do not assume eBPF.
 type Event struct {
@@ -55,6 +185,23 @@ type Event struct {
 	Proto      uint8
 	Addr       [16]byte
 	Port       uint16
+	UID        uint32
+	GID        uint32
+	Target     string
+	// DirFD and TargetDirFD are the directory fds relative paths were passed
+	// with. Sources resolve paths before emitting, so these are informational.
+	DirFD       int32
+	TargetDirFD int32
+	// PathTruncated is set when Path or Target hit the capture limit.
+	PathTruncated bool
+	BytesSent     uint64
+	BytesReceived uint64
+	Payload       []byte
+	Op            uint32
+	Args          [3]uint64
+	// Timestamp is when the event happened, or zero when the source does
+	// not record it.
+	Timestamp time.Time
 }
 
 // Session represents a running profiling attachment.
@@ -64,6 +211,41 @@ type Session interface {
 	Close() error
 }
 
+// Tracker is implemented by sessions that filter events at the source. It
+// adds a process tree or cgroup to the traced set of a running session.
+type Tracker interface {
+	TrackPID(pid uint32) error
+	TrackCgroup(id uint64) error
+}
+
+// Stats reports how complete a session's event stream was.
+type Stats struct {
+	// Drops counts events the source failed to deliver, by event type.
+	Drops map[EventType]uint64
+}
+
+// TotalDrops sums Drops across event types.
+func (s Stats) TotalDrops() uint64 {
+	var total uint64
+	for _, n := range s.Drops {
+		total += n
+	}
+	return total
+}
+
+// StatsReporter is implemented by sessions that account for lost events.
+// Stats may be called after Close and then reports the final counts.
+type StatsReporter interface {
+	Stats() (Stats, error)
+}
+
+// CommandWrapper is implemented by controllers that must launch the target
+// through a shim, e.g. to wait for a tracer before the command runs. The
+// engine starts the wrapped command in place of the original arguments.
+type CommandWrapper interface {
+	WrapCommand(args []string) []string
+}
+
 // Controller creates profiling sessions and advertises support.
 type Controller interface {
 	Start(ctx context.Context, target Target) (Session, error)
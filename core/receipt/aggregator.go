@@ -1,6 +1,7 @@
 package receipt
 
 import (
+	"fmt"
 	"net"
 	"sort"
 	"strconv"
@@ -37,8 +38,14 @@ type ExecutionStart struct {
 	Command         string
 	StartedAt       time.Time
 	ObservationMode string
+	// TimelineLimit enables the receipt timeline with at most this many
+	// events. Zero disables it.
+	TimelineLimit int
 }
 
+// DefaultTimelineLimit caps the timeline when callers enable it without a limit.
+const DefaultTimelineLimit = 1000
+
 // Aggregator consumes profiling events and builds deterministic receipts.
 type Aggregator struct {
 	mu         sync.Mutex
@@ -68,9 +75,47 @@ type executionAggregate struct {
 	processes map[uint32]ProcessEntry
 	fsRead    map[string]struct{}
 	fsWrite   map[string]struct{}
+	fsDelete  map[string]struct{}
+	// fsOutput follows writes, renames and deletes in event order and holds
+	// the files the execution left behind.
+	fsOutput  map[string]struct{}
+	fsMkdir   map[string]struct{}
+	truncated map[string]struct{}
+	renames   map[Rename]struct{}
+	perms     map[permissionKey]struct{}
 	netConns  map[string]Connection
+	listeners map[Listener]struct{}
+	inbound   map[string]Inbound
+	dns       map[dnsKey]map[string]struct{}
+	hostnames map[string]string
+	security  *securityState
 	syscalls  map[string]int
+	lifecycle map[uint32]*processLifecycle
 	policy    *PolicyInfo
+
+	timelineLimit   int
+	timeline        []timelineEntry
+	timelineDropped int
+}
+
+type timelineEntry struct {
+	at    time.Time
+	event TimelineEvent
+}
+
+type dnsKey struct {
+	name   string
+	qtype  string
+	server string
+}
+
+// processLifecycle tracks when a process was seen to start and exit.
+type processLifecycle struct {
+	comm   string
+	start  time.Time
+	end    time.Time
+	exited bool
+	status uint32
 }
 
 // NewAggregator preserves legacy single-execution behavior.
@@ -315,12 +360,26 @@ func newExecutionAggregate(provenance string, start ExecutionStart, id identity.
 		processes:       make(map[uint32]ProcessEntry),
 		fsRead:          make(map[string]struct{}),
 		fsWrite:         make(map[string]struct{}),
+		fsDelete:        make(map[string]struct{}),
+		fsOutput:        make(map[string]struct{}),
+		fsMkdir:         make(map[string]struct{}),
+		truncated:       make(map[string]struct{}),
+		renames:         make(map[Rename]struct{}),
+		perms:           make(map[permissionKey]struct{}),
 		netConns:        make(map[string]Connection),
+		listeners:       make(map[Listener]struct{}),
+		inbound:         make(map[string]Inbound),
+		dns:             make(map[dnsKey]map[string]struct{}),
+		hostnames:       make(map[string]string),
+		security:        newSecurityState(),
 		syscalls:        make(map[string]int),
+		lifecycle:       make(map[uint32]*processLifecycle),
+		timelineLimit:   start.TimelineLimit,
 	}
 	if start.RootPID != 0 {
 		exec.pids[start.RootPID] = struct{}{}
 		exec.processes[start.RootPID] = ProcessEntry{PID: start.RootPID, PPID: 0, Cmd: start.Command}
+		exec.lifecycle[start.RootPID] = &processLifecycle{start: start.StartedAt}
 	}
 	return exec
 }
@@ -390,6 +449,12 @@ func (e *executionAggregate) handleEvent(ev profiling.Event) {
 
 	e.pids[ev.PID] = struct{}{}
 
+	at := ev.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	e.recordTimeline(ev, at)
+
 	entry, ok := e.processes[ev.PID]
 	if !ok {
 		entry = ProcessEntry{PID: ev.PID, PPID: ev.PPID}
@@ -399,6 +464,20 @@ func (e *executionAggregate) handleEvent(ev profiling.Event) {
 		e.processes[ev.PID] = entry
 	}
 
+	if ev.PathTruncated && isFilesystemEvent(ev.Type) {
+		if ev.Path != "" {
+			e.truncated[ev.Path] = struct{}{}
+		}
+		if ev.Target != "" {
+			e.truncated[ev.Target] = struct{}{}
+		}
+	}
+
+	if ev.Type.IsSecurity() {
+		e.syscalls[securitySyscall(ev)]++
+	}
+	e.security.handleEvent(ev)
+
 	switch ev.Type {
 	case profiling.EventExec:
 		e.syscalls["execve"]++
@@ -425,9 +504,54 @@ func (e *executionAggregate) handleEvent(ev profiling.Event) {
 		}
 		if isWriteOpen(ev.Flags) {
 			e.fsWrite[path] = struct{}{}
+			e.fsOutput[path] = struct{}{}
 		} else {
 			e.fsRead[path] = struct{}{}
 		}
+	case profiling.EventFork:
+		e.processLifecycle(ev.PID).start = at
+		e.processLifecycle(ev.PID).comm = ev.Comm
+	case profiling.EventExit:
+		lc := e.processLifecycle(ev.PID)
+		lc.end = at
+		lc.exited = true
+		lc.status = ev.Flags
+	case profiling.EventUnlink:
+		e.syscalls["unlink"]++
+		if ev.Path != "" {
+			e.fsDelete[ev.Path] = struct{}{}
+			delete(e.fsOutput, ev.Path)
+		}
+	case profiling.EventRename:
+		e.syscalls["rename"]++
+		if ev.Path != "" {
+			e.renames[Rename{From: ev.Path, To: ev.Target}] = struct{}{}
+			if _, ok := e.fsOutput[ev.Path]; ok && ev.Target != "" {
+				delete(e.fsOutput, ev.Path)
+				e.fsOutput[ev.Target] = struct{}{}
+			}
+		}
+	case profiling.EventMkdir:
+		e.syscalls["mkdir"]++
+		if ev.Path != "" {
+			e.fsMkdir[ev.Path] = struct{}{}
+		}
+	case profiling.EventChmod:
+		e.syscalls["chmod"]++
+		if ev.Path != "" {
+			e.perms[permissionKey{path: ev.Path, op: "chmod", mode: ev.Flags & 0o7777}] = struct{}{}
+		}
+	case profiling.EventChown:
+		e.syscalls["chown"]++
+		if ev.Path != "" {
+			e.perms[permissionKey{path: ev.Path, op: "chown", uid: ev.UID, gid: ev.GID}] = struct{}{}
+		}
+	case profiling.EventTruncate:
+		e.syscalls["truncate"]++
+		if ev.Path != "" {
+			e.fsWrite[ev.Path] = struct{}{}
+			e.fsOutput[ev.Path] = struct{}{}
+		}
 	case profiling.EventConnect:
 		e.syscalls["connect"]++
 		dst := formatAddr(ev)
@@ -436,9 +560,184 @@ func (e *executionAggregate) handleEvent(ev profiling.Event) {
 			key := dst + "|" + proto
 			e.netConns[key] = Connection{Dst: dst, Protocol: proto, Attempted: true}
 		}
+	case profiling.EventBind:
+		e.syscalls["bind"]++
+		// TCP sockets only become listeners once listen is called.
+		if addr := formatAddr(ev); addr != "" && ev.Proto == syscall.IPPROTO_UDP {
+			e.listeners[Listener{Addr: addr, Protocol: "udp"}] = struct{}{}
+		}
+	case profiling.EventListen:
+		e.syscalls["listen"]++
+		if addr := formatAddr(ev); addr != "" {
+			e.listeners[Listener{Addr: addr, Protocol: "tcp"}] = struct{}{}
+		}
+	case profiling.EventAccept:
+		e.syscalls["accept"]++
+		if src := formatAddr(ev); src != "" {
+			e.inbound[src] = Inbound{Src: src, LocalPort: uint16(ev.Flags), Protocol: "tcp"}
+		}
+	case profiling.EventSend:
+		e.syscalls["sendto"]++
+		dst := formatAddr(ev)
+		if dst == "" {
+			return
+		}
+		conn := e.connection(dst, "udp")
+		conn.BytesSent += int64(ev.Flags)
+		e.netConns[dst+"|udp"] = conn
+		if ev.Port == dnsPort {
+			e.recordDNS(dst, ev.Payload)
+		}
+	case profiling.EventRecv:
+		e.syscalls["recvfrom"]++
+		src := formatAddr(ev)
+		if src == "" {
+			return
+		}
+		conn := e.connection(src, "udp")
+		conn.BytesReceived += int64(ev.Flags)
+		e.netConns[src+"|udp"] = conn
+		if ev.Port == dnsPort {
+			e.recordDNS(src, ev.Payload)
+		}
+	case profiling.EventSocketStats:
+		peer := formatAddr(ev)
+		if peer == "" {
+			return
+		}
+		if in, ok := e.inbound[peer]; ok {
+			in.BytesSent += int64(ev.BytesSent)
+			in.BytesReceived += int64(ev.BytesReceived)
+			e.inbound[peer] = in
+			return
+		}
+		conn := e.connection(peer, "tcp")
+		conn.BytesSent += int64(ev.BytesSent)
+		conn.BytesReceived += int64(ev.BytesReceived)
+		e.netConns[peer+"|tcp"] = conn
 	}
 }
 
+func (e *executionAggregate) connection(dst, proto string) Connection {
+	if conn, ok := e.netConns[dst+"|"+proto]; ok {
+		return conn
+	}
+	return Connection{Dst: dst, Protocol: proto, Attempted: true}
+}
+
+// recordDNS adds the questions of a query or response exchanged with server
+// and remembers which name each answered address was looked up as.
+func (e *executionAggregate) recordDNS(server string, payload []byte) {
+	msg, err := parseDNS(payload)
+	if err != nil {
+		return
+	}
+	for _, q := range msg.questions {
+		key := dnsKey{name: q.name, qtype: dnsTypeString(q.qtype), server: server}
+		answers, ok := e.dns[key]
+		if !ok {
+			answers = make(map[string]struct{})
+			e.dns[key] = answers
+		}
+		if !msg.response {
+			continue
+		}
+		for _, ans := range msg.answers {
+			answers[ans.value] = struct{}{}
+			if ans.rtype == dnsTypeA || ans.rtype == dnsTypeAAAA {
+				if _, seen := e.hostnames[ans.value]; !seen {
+					e.hostnames[ans.value] = q.name
+				}
+			}
+		}
+	}
+}
+
+// recordTimeline keeps the first timelineLimit events. Events from different
+// ring buffers arrive slightly out of order and are sorted when flushed.
+func (e *executionAggregate) recordTimeline(ev profiling.Event, at time.Time) {
+	if e.timelineLimit <= 0 {
+		return
+	}
+	if len(e.timeline) >= e.timelineLimit {
+		e.timelineDropped++
+		return
+	}
+	entry := TimelineEvent{Type: ev.Type.String(), PID: ev.PID}
+	switch {
+	case ev.Type == profiling.EventSocketStats || ev.Type == profiling.EventConnect ||
+		(ev.Type >= profiling.EventBind && ev.Type <= profiling.EventRecv):
+		entry.Addr = formatAddr(ev)
+	default:
+		entry.Path = ev.Path
+		entry.Target = ev.Target
+	}
+	e.timeline = append(e.timeline, timelineEntry{at: at, event: entry})
+}
+
+func (e *executionAggregate) timelineSection() *Timeline {
+	if e.timelineLimit <= 0 {
+		return nil
+	}
+	entries := make([]timelineEntry, len(e.timeline))
+	copy(entries, e.timeline)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+	events := make([]TimelineEvent, 0, len(entries))
+	for _, entry := range entries {
+		ev := entry.event
+		if !e.startTime.IsZero() {
+			ev.OffsetNs = entry.at.Sub(e.startTime).Nanoseconds()
+		}
+		events = append(events, ev)
+	}
+	return &Timeline{Events: events, Dropped: e.timelineDropped}
+}
+
+func (e *executionAggregate) processLifecycle(pid uint32) *processLifecycle {
+	lc, ok := e.lifecycle[pid]
+	if !ok {
+		lc = &processLifecycle{}
+		e.lifecycle[pid] = lc
+	}
+	return lc
+}
+
+// processTree returns lifecycle details; PopulateMetadata merges them into
+// the final process tree.
+func (e *executionAggregate) processTree(processes []ProcessEntry) []ProcessV2 {
+	tree := make([]ProcessV2, 0, len(processes))
+	for _, entry := range processes {
+		proc := ProcessV2{PID: entry.PID, PPID: entry.PPID, Argv: []string{}}
+		lc := e.lifecycle[entry.PID]
+		if lc == nil {
+			tree = append(tree, proc)
+			continue
+		}
+		if entry.Cmd == "" {
+			proc.Exe = lc.comm
+		}
+		proc.StartTime = formatTime(lc.start)
+		if lc.exited {
+			proc.EndTime = formatTime(lc.end)
+			applyWaitStatus(&proc, lc.status)
+		}
+		tree = append(tree, proc)
+	}
+	return tree
+}
+
+// applyWaitStatus decodes a raw Linux wait status into exit code or signal.
+func applyWaitStatus(proc *ProcessV2, status uint32) {
+	sig := status & 0x7f
+	if sig == 0 {
+		code := int((status >> 8) & 0xff)
+		proc.ExitCode = &code
+		return
+	}
+	proc.Signal = syscall.Signal(sig).String()
+	proc.CoreDumped = status&0x80 != 0
+}
+
 func (e *executionAggregate) receipt(exitCode int, duration time.Duration, completeness string) Receipt {
 	processes := make([]ProcessEntry, 0, len(e.processes))
 	for _, entry := range e.processes {
@@ -455,15 +754,26 @@ func (e *executionAggregate) receipt(exitCode int, duration time.Duration, compl
 		written = []string{}
 	}
 	fs := &FilesystemInfo{
-		Reads:            read,
-		Writes:           written,
-		Deletes:          []string{},
-		PolicyViolations: []string{},
+		Reads:             read,
+		Writes:            written,
+		Deletes:           setToSortedSlice(e.fsDelete),
+		Outputs:           setToSortedSlice(e.fsOutput),
+		Renames:           sortedRenames(e.renames),
+		Mkdirs:            setToSortedSlice(e.fsMkdir),
+		PermissionChanges: sortedPermissionChanges(e.perms),
+		TruncatedPaths:    setToSortedSlice(e.truncated),
+		PolicyViolations:  []string{},
 	}
 
 	connections := make([]Connection, 0, len(e.netConns))
 	attempts := make([]NetworkAttempt, 0, len(e.netConns))
+	var bytesSent, bytesReceived int64
 	for _, conn := range e.netConns {
+		if host, _, err := net.SplitHostPort(conn.Dst); err == nil {
+			conn.Hostname = e.hostnames[host]
+		}
+		bytesSent += conn.BytesSent
+		bytesReceived += conn.BytesReceived
 		connections = append(connections, conn)
 		attempts = append(attempts, NetworkAttempt{
 			Dst:      conn.Dst,
@@ -483,11 +793,21 @@ func (e *executionAggregate) receipt(exitCode int, duration time.Duration, compl
 		}
 		return attempts[i].Dst < attempts[j].Dst
 	})
+	inbound := make([]Inbound, 0, len(e.inbound))
+	for _, in := range e.inbound {
+		bytesSent += in.BytesSent
+		bytesReceived += in.BytesReceived
+		inbound = append(inbound, in)
+	}
+	sort.Slice(inbound, func(i, j int) bool { return inbound[i].Src < inbound[j].Src })
 	netInfo := &NetworkInfo{
 		Connections:   connections,
 		Attempts:      attempts,
-		BytesSent:     0,
-		BytesReceived: 0,
+		Listeners:     sortedListeners(e.listeners),
+		Inbound:       inbound,
+		DNS:           sortedDNS(e.dns),
+		BytesSent:     bytesSent,
+		BytesReceived: bytesReceived,
 	}
 
 	rec := Receipt{
@@ -501,8 +821,11 @@ func (e *executionAggregate) receipt(exitCode int, duration time.Duration, compl
 		ExitCode:        exitCode,
 		DurationMs:      duration.Milliseconds(),
 		Processes:       processes,
+		ProcessTree:     e.processTree(processes),
 		Filesystem:      fs,
 		Network:         netInfo,
+		Security:        e.security.info(),
+		Timeline:        e.timelineSection(),
 		Syscalls: &SyscallInfo{
 			Counts: copyCounts(e.syscalls),
 			Denied: []string{},
@@ -515,6 +838,83 @@ func (e *executionAggregate) receipt(exitCode int, duration time.Duration, compl
 	return rec
 }
 
+func isFilesystemEvent(t profiling.EventType) bool {
+	return t == profiling.EventOpen || (t >= profiling.EventUnlink && t <= profiling.EventTruncate)
+}
+
+// ownerUnchanged is the chown argument (-1) that leaves an ID as is.
+const ownerUnchanged = ^uint32(0)
+
+// permissionKey de-duplicates permission changes before they are rendered.
+type permissionKey struct {
+	path string
+	op   string
+	mode uint32
+	uid  uint32
+	gid  uint32
+}
+
+func sortedRenames(set map[Rename]struct{}) []Rename {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]Rename, 0, len(set))
+	for rename := range set {
+		out = append(out, rename)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].From == out[j].From {
+			return out[i].To < out[j].To
+		}
+		return out[i].From < out[j].From
+	})
+	return out
+}
+
+func sortedPermissionChanges(set map[permissionKey]struct{}) []PermissionChange {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]permissionKey, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		if a.mode != b.mode {
+			return a.mode < b.mode
+		}
+		if a.uid != b.uid {
+			return a.uid < b.uid
+		}
+		return a.gid < b.gid
+	})
+	out := make([]PermissionChange, 0, len(keys))
+	for _, key := range keys {
+		change := PermissionChange{Path: key.path, Op: key.op}
+		if key.op == "chmod" {
+			change.Mode = fmt.Sprintf("%04o", key.mode)
+		} else {
+			if key.uid != ownerUnchanged {
+				uid := key.uid
+				change.UID = &uid
+			}
+			if key.gid != ownerUnchanged {
+				gid := key.gid
+				change.GID = &gid
+			}
+		}
+		out = append(out, change)
+	}
+	return out
+}
+
 func copyCounts(counts map[string]int) map[string]int {
 	out := make(map[string]int, len(counts))
 	for key, value := range counts {
@@ -554,6 +954,41 @@ func formatAddr(ev profiling.Event) string {
 	}
 }
 
+func sortedListeners(set map[Listener]struct{}) []Listener {
+	out := make([]Listener, 0, len(set))
+	for l := range set {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Addr == out[j].Addr {
+			return out[i].Protocol < out[j].Protocol
+		}
+		return out[i].Addr < out[j].Addr
+	})
+	return out
+}
+
+func sortedDNS(queries map[dnsKey]map[string]struct{}) []DNSQuery {
+	out := make([]DNSQuery, 0, len(queries))
+	for key, answers := range queries {
+		q := DNSQuery{Name: key.name, Type: key.qtype, Server: key.server}
+		if len(answers) > 0 {
+			q.Answers = setToSortedSlice(answers)
+		}
+		out = append(out, q)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].Server < out[j].Server
+	})
+	return out
+}
+
 func protoString(proto uint8) string {
 	switch proto {
 	case syscall.IPPROTO_TCP:
@@ -565,6 +1000,8 @@ func protoString(proto uint8) string {
 	}
 }
 
+const dnsPort = 53
+
 func itoa16(v uint16) string {
 	return strconv.Itoa(int(v))
 }
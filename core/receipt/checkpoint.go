@@ -0,0 +1,386 @@
+package receipt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"glasshouse/core/identity"
+)
+
+// CheckpointVersion is bumped when the checkpoint layout changes. Restore
+// rejects other versions rather than guessing.
+const CheckpointVersion = 1
+
+// Checkpoint is a serializable snapshot of an aggregator's executions and
+// attribution indexes, so a restarted daemon can keep aggregating and still
+// flush executions that were open when it stopped.
+type Checkpoint struct {
+	Version    int                   `json:"version"`
+	Provenance string                `json:"provenance"`
+	DefaultID  string                `json:"default_id,omitempty"`
+	ByCgroup   map[uint64]string     `json:"by_cgroup,omitempty"`
+	ByPID      map[uint32]string     `json:"by_pid,omitempty"`
+	Executions []ExecutionCheckpoint `json:"executions"`
+}
+
+// ExecutionCheckpoint holds one execution's aggregate. Sets are stored as
+// sorted slices so checkpoints of equal state are byte-identical.
+type ExecutionCheckpoint struct {
+	ID              string         `json:"id"`
+	ObservationMode string         `json:"observation_mode"`
+	State           ExecutionState `json:"state"`
+	StartTime       time.Time      `json:"start_time"`
+	EndTime         time.Time      `json:"end_time,omitempty"`
+	RootPID         uint32         `json:"root_pid"`
+	RootStartTime   uint64         `json:"root_start_time"`
+	Command         string         `json:"command,omitempty"`
+
+	PIDs              []uint32               `json:"pids,omitempty"`
+	Processes         []ProcessEntry         `json:"processes,omitempty"`
+	Reads             []string               `json:"reads,omitempty"`
+	Writes            []string               `json:"writes,omitempty"`
+	Deletes           []string               `json:"deletes,omitempty"`
+	Outputs           []string               `json:"outputs,omitempty"`
+	Mkdirs            []string               `json:"mkdirs,omitempty"`
+	Truncated         []string               `json:"truncated,omitempty"`
+	Renames           []Rename               `json:"renames,omitempty"`
+	PermissionChanges []checkpointPermission `json:"permission_changes,omitempty"`
+	Connections       []Connection           `json:"connections,omitempty"`
+	Listeners         []Listener             `json:"listeners,omitempty"`
+	Inbound           []Inbound              `json:"inbound,omitempty"`
+	DNS               []checkpointDNS        `json:"dns,omitempty"`
+	Hostnames         map[string]string      `json:"hostnames,omitempty"`
+	Security          checkpointSecurity     `json:"security"`
+	Syscalls          map[string]int         `json:"syscalls,omitempty"`
+	Lifecycle         []checkpointLifecycle  `json:"lifecycle,omitempty"`
+	Policy            *PolicyInfo            `json:"policy,omitempty"`
+
+	TimelineLimit   int                  `json:"timeline_limit,omitempty"`
+	Timeline        []checkpointTimeline `json:"timeline,omitempty"`
+	TimelineDropped int                  `json:"timeline_dropped,omitempty"`
+}
+
+type checkpointPermission struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Mode uint32 `json:"mode"`
+	UID  uint32 `json:"uid"`
+	GID  uint32 `json:"gid"`
+}
+
+type checkpointDNS struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Server  string   `json:"server"`
+	Answers []string `json:"answers,omitempty"`
+}
+
+type checkpointLifecycle struct {
+	PID    uint32    `json:"pid"`
+	Comm   string    `json:"comm,omitempty"`
+	Start  time.Time `json:"start,omitempty"`
+	End    time.Time `json:"end,omitempty"`
+	Exited bool      `json:"exited,omitempty"`
+	Status uint32    `json:"status,omitempty"`
+}
+
+type checkpointTimeline struct {
+	At    time.Time     `json:"at"`
+	Event TimelineEvent `json:"event"`
+}
+
+type checkpointIDChange struct {
+	PID     uint32    `json:"pid"`
+	Syscall string    `json:"syscall"`
+	Args    [3]uint64 `json:"args"`
+}
+
+type checkpointCount struct {
+	PID   uint32 `json:"pid"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type checkpointSecurity struct {
+	IDChanges []checkpointIDChange `json:"id_changes,omitempty"`
+	Caps      []CapabilityChange   `json:"caps,omitempty"`
+	Ptrace    []PtraceCall         `json:"ptrace,omitempty"`
+	Mounts    []MountCall          `json:"mounts,omitempty"`
+	BPF       []checkpointCount    `json:"bpf,omitempty"`
+	Modules   []ModuleLoad         `json:"modules,omitempty"`
+	Memfds    []MemfdCreate        `json:"memfds,omitempty"`
+	Fileless  []FilelessExec       `json:"fileless,omitempty"`
+	Mprotects map[uint32]int       `json:"mprotects,omitempty"`
+}
+
+// Checkpoint snapshots the aggregator. It holds the aggregator lock while
+// copying, so events are not applied concurrently.
+func (a *Aggregator) Checkpoint() Checkpoint {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cp := Checkpoint{
+		Version:    CheckpointVersion,
+		Provenance: a.provenance,
+		DefaultID:  a.defaultID,
+		ByCgroup:   make(map[uint64]string, len(a.byCgroup)),
+		ByPID:      make(map[uint32]string, len(a.byPID)),
+		Executions: make([]ExecutionCheckpoint, 0, len(a.executions)),
+	}
+	for k, v := range a.byCgroup {
+		cp.ByCgroup[k] = v
+	}
+	for k, v := range a.byPID {
+		cp.ByPID[k] = v
+	}
+	keys := make([]string, 0, len(a.executions))
+	for key := range a.executions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cp.Executions = append(cp.Executions, a.executions[key].checkpoint())
+	}
+	return cp
+}
+
+// Restore replaces the aggregator's executions and indexes with those in cp.
+func (a *Aggregator) Restore(cp Checkpoint) error {
+	if cp.Version != CheckpointVersion {
+		return fmt.Errorf("checkpoint version %d is not supported (want %d)", cp.Version, CheckpointVersion)
+	}
+	executions := make(map[string]*executionAggregate, len(cp.Executions))
+	for _, ec := range cp.Executions {
+		id, err := identity.ParseExecutionID(ec.ID)
+		if err != nil {
+			return fmt.Errorf("checkpoint execution %q: %w", ec.ID, err)
+		}
+		executions[ec.ID] = restoreExecution(a.provenance, id, ec)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.executions = executions
+	a.byCgroup = make(map[uint64]string, len(cp.ByCgroup))
+	for k, v := range cp.ByCgroup {
+		a.byCgroup[k] = v
+	}
+	a.byPID = make(map[uint32]string, len(cp.ByPID))
+	for k, v := range cp.ByPID {
+		a.byPID[k] = v
+	}
+	a.defaultID = cp.DefaultID
+	return nil
+}
+
+func (e *executionAggregate) checkpoint() ExecutionCheckpoint {
+	ec := ExecutionCheckpoint{
+		ID:              e.idString,
+		ObservationMode: e.observationMode,
+		State:           e.state,
+		StartTime:       e.startTime,
+		EndTime:         e.endTime,
+		RootPID:         e.rootPID,
+		RootStartTime:   e.rootStartTime,
+		Command:         e.command,
+		Reads:           sortedStrings(e.fsRead),
+		Writes:          sortedStrings(e.fsWrite),
+		Deletes:         sortedStrings(e.fsDelete),
+		Outputs:         sortedStrings(e.fsOutput),
+		Mkdirs:          sortedStrings(e.fsMkdir),
+		Truncated:       sortedStrings(e.truncated),
+		Renames:         sortedRenames(e.renames),
+		Hostnames:       copyMap(e.hostnames),
+		Syscalls:        copyMap(e.syscalls),
+		TimelineLimit:   e.timelineLimit,
+		TimelineDropped: e.timelineDropped,
+		Security:        e.security.checkpoint(),
+	}
+	for pid := range e.pids {
+		ec.PIDs = append(ec.PIDs, pid)
+	}
+	sort.Slice(ec.PIDs, func(i, j int) bool { return ec.PIDs[i] < ec.PIDs[j] })
+	for _, entry := range e.processes {
+		ec.Processes = append(ec.Processes, entry)
+	}
+	sort.Slice(ec.Processes, func(i, j int) bool { return ec.Processes[i].PID < ec.Processes[j].PID })
+	for k := range e.perms {
+		ec.PermissionChanges = append(ec.PermissionChanges, checkpointPermission{Path: k.path, Op: k.op, Mode: k.mode, UID: k.uid, GID: k.gid})
+	}
+	sort.Slice(ec.PermissionChanges, func(i, j int) bool {
+		a, b := ec.PermissionChanges[i], ec.PermissionChanges[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+	for _, conn := range e.netConns {
+		ec.Connections = append(ec.Connections, conn)
+	}
+	sort.Slice(ec.Connections, func(i, j int) bool {
+		return connectionKey(ec.Connections[i]) < connectionKey(ec.Connections[j])
+	})
+	if len(e.listeners) > 0 {
+		ec.Listeners = sortedListeners(e.listeners)
+	}
+	for _, in := range e.inbound {
+		ec.Inbound = append(ec.Inbound, in)
+	}
+	sort.Slice(ec.Inbound, func(i, j int) bool { return ec.Inbound[i].Src < ec.Inbound[j].Src })
+	for k, answers := range e.dns {
+		ec.DNS = append(ec.DNS, checkpointDNS{Name: k.name, Type: k.qtype, Server: k.server, Answers: setToSortedSlice(answers)})
+	}
+	sort.Slice(ec.DNS, func(i, j int) bool {
+		a, b := ec.DNS[i], ec.DNS[j]
+		return a.Name+"\x00"+a.Type+"\x00"+a.Server < b.Name+"\x00"+b.Type+"\x00"+b.Server
+	})
+	for pid, lc := range e.lifecycle {
+		ec.Lifecycle = append(ec.Lifecycle, checkpointLifecycle{PID: pid, Comm: lc.comm, Start: lc.start, End: lc.end, Exited: lc.exited, Status: lc.status})
+	}
+	sort.Slice(ec.Lifecycle, func(i, j int) bool { return ec.Lifecycle[i].PID < ec.Lifecycle[j].PID })
+	for _, entry := range e.timeline {
+		ec.Timeline = append(ec.Timeline, checkpointTimeline{At: entry.at, Event: entry.event})
+	}
+	if e.policy != nil {
+		policy := *e.policy
+		ec.Policy = &policy
+	}
+	return ec
+}
+
+func restoreExecution(provenance string, id identity.ExecutionID, ec ExecutionCheckpoint) *executionAggregate {
+	e := newExecutionAggregate(provenance, ExecutionStart{
+		ID:              id,
+		Command:         ec.Command,
+		StartedAt:       ec.StartTime,
+		ObservationMode: ec.ObservationMode,
+		TimelineLimit:   ec.TimelineLimit,
+	}, id, ec.ID)
+	e.state = ec.State
+	e.endTime = ec.EndTime
+	e.rootPID = ec.RootPID
+	e.rootStartTime = ec.RootStartTime
+	for _, pid := range ec.PIDs {
+		e.pids[pid] = struct{}{}
+	}
+	for _, entry := range ec.Processes {
+		e.processes[entry.PID] = entry
+	}
+	fillSet(e.fsRead, ec.Reads)
+	fillSet(e.fsWrite, ec.Writes)
+	fillSet(e.fsDelete, ec.Deletes)
+	fillSet(e.fsOutput, ec.Outputs)
+	fillSet(e.fsMkdir, ec.Mkdirs)
+	fillSet(e.truncated, ec.Truncated)
+	for _, r := range ec.Renames {
+		e.renames[r] = struct{}{}
+	}
+	for _, p := range ec.PermissionChanges {
+		e.perms[permissionKey{path: p.Path, op: p.Op, mode: p.Mode, uid: p.UID, gid: p.GID}] = struct{}{}
+	}
+	for _, conn := range ec.Connections {
+		e.netConns[connectionKey(conn)] = conn
+	}
+	for _, l := range ec.Listeners {
+		e.listeners[l] = struct{}{}
+	}
+	for _, in := range ec.Inbound {
+		e.inbound[in.Src] = in
+	}
+	for _, q := range ec.DNS {
+		answers := make(map[string]struct{}, len(q.Answers))
+		fillSet(answers, q.Answers)
+		e.dns[dnsKey{name: q.Name, qtype: q.Type, server: q.Server}] = answers
+	}
+	for k, v := range ec.Hostnames {
+		e.hostnames[k] = v
+	}
+	e.security.restore(ec.Security)
+	for k, v := range ec.Syscalls {
+		e.syscalls[k] = v
+	}
+	e.lifecycle = make(map[uint32]*processLifecycle, len(ec.Lifecycle))
+	for _, lc := range ec.Lifecycle {
+		e.lifecycle[lc.PID] = &processLifecycle{comm: lc.Comm, start: lc.Start, end: lc.End, exited: lc.Exited, status: lc.Status}
+	}
+	if ec.Policy != nil {
+		policy := *ec.Policy
+		e.policy = &policy
+	}
+	for _, entry := range ec.Timeline {
+		e.timeline = append(e.timeline, timelineEntry{at: entry.At, event: entry.Event})
+	}
+	e.timelineDropped = ec.TimelineDropped
+	return e
+}
+
+func (s *securityState) checkpoint() checkpointSecurity {
+	cs := checkpointSecurity{Mprotects: copyMap(s.mprotects)}
+	for k := range s.ids {
+		cs.IDChanges = append(cs.IDChanges, checkpointIDChange{PID: k.pid, Syscall: k.syscall, Args: k.args})
+	}
+	sort.Slice(cs.IDChanges, func(i, j int) bool { return fmt.Sprint(cs.IDChanges[i]) < fmt.Sprint(cs.IDChanges[j]) })
+	for k, n := range s.bpf {
+		cs.BPF = append(cs.BPF, checkpointCount{PID: k.pid, Name: k.name, Count: n})
+	}
+	sort.Slice(cs.BPF, func(i, j int) bool { return fmt.Sprint(cs.BPF[i]) < fmt.Sprint(cs.BPF[j]) })
+	cs.Caps = sortedByKey(s.caps, printed[CapabilityChange])
+	cs.Ptrace = sortedByKey(s.ptrace, printed[PtraceCall])
+	cs.Mounts = sortedByKey(s.mounts, printed[MountCall])
+	cs.Modules = sortedByKey(s.modules, printed[ModuleLoad])
+	cs.Memfds = sortedByKey(s.memfds, printed[MemfdCreate])
+	cs.Fileless = sortedByKey(s.fileless, printed[FilelessExec])
+	return cs
+}
+
+func (s *securityState) restore(cs checkpointSecurity) {
+	for _, c := range cs.IDChanges {
+		s.ids[idChangeKey{pid: c.PID, syscall: c.Syscall, args: c.Args}] = struct{}{}
+	}
+	for _, c := range cs.BPF {
+		s.bpf[countKey{pid: c.PID, name: c.Name}] = c.Count
+	}
+	fillSet(s.caps, cs.Caps)
+	fillSet(s.ptrace, cs.Ptrace)
+	fillSet(s.mounts, cs.Mounts)
+	fillSet(s.modules, cs.Modules)
+	fillSet(s.memfds, cs.Memfds)
+	fillSet(s.fileless, cs.Fileless)
+	for k, v := range cs.Mprotects {
+		s.mprotects[k] = v
+	}
+}
+
+func sortedStrings(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	return setToSortedSlice(set)
+}
+
+// connectionKey matches the netConns keys built from events.
+func connectionKey(conn Connection) string {
+	return conn.Dst + "|" + conn.Protocol
+}
+
+// printed orders checkpoint sets by their printed form, which only needs to
+// be deterministic.
+func printed[T any](value T) string {
+	return fmt.Sprint(value)
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func fillSet[K comparable](m map[K]struct{}, keys []K) {
+	for _, k := range keys {
+		m[k] = struct{}{}
+	}
+}
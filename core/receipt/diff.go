@@ -0,0 +1,258 @@
+package receipt
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Difference is the behavioral difference between two receipts of the same
+// job. PIDs, timestamps and execution IDs are normalized away: processes
+// are compared by executable and argv, and /proc/<pid> paths are collapsed.
+type Difference struct {
+	Processes SetDiff           `json:"processes"`
+	Reads     SetDiff           `json:"reads"`
+	Writes    SetDiff           `json:"writes"`
+	Deletes   SetDiff           `json:"deletes"`
+	Network   SetDiff           `json:"network"`
+	Syscalls  map[string]Delta  `json:"syscalls,omitempty"`
+	ExitCode  *Delta            `json:"exit_code,omitempty"`
+	Outputs   map[string]Change `json:"outputs,omitempty"`
+	Resources map[string]Delta  `json:"resources,omitempty"`
+}
+
+// SetDiff lists entries only in the second receipt (Added) or only in the
+// first (Removed).
+type SetDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (d SetDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+type Delta struct {
+	Before int64 `json:"before"`
+	After  int64 `json:"after"`
+	Delta  int64 `json:"delta"`
+}
+
+type Change struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Changed reports whether the receipts differ in behavior. Resource deltas
+// and changed syscall counts are informational; a syscall that appears or
+// disappears counts.
+func (d Difference) Changed() bool {
+	return !d.Processes.Empty() || !d.Reads.Empty() || !d.Writes.Empty() || !d.Deletes.Empty() ||
+		!d.Network.Empty() || d.ExitCode != nil || len(d.Outputs) > 0 || d.syscallsChanged()
+}
+
+func (d Difference) syscallsChanged() bool {
+	for _, delta := range d.Syscalls {
+		if delta.Before == 0 || delta.After == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares a (before) with b (after).
+func Diff(a, b Receipt) Difference {
+	fa, fb := a.Filesystem, b.Filesystem
+	if fa == nil {
+		fa = &FilesystemInfo{}
+	}
+	if fb == nil {
+		fb = &FilesystemInfo{}
+	}
+	d := Difference{
+		Processes: diffSets(processKeys(a), processKeys(b)),
+		Reads:     diffSets(normalizePaths(fa.Reads), normalizePaths(fb.Reads)),
+		Writes:    diffSets(normalizePaths(fa.Writes), normalizePaths(fb.Writes)),
+		Deletes:   diffSets(normalizePaths(fa.Deletes), normalizePaths(fb.Deletes)),
+		Network:   diffSets(networkKeys(a), networkKeys(b)),
+		Syscalls:  diffCounts(syscallCounts(a), syscallCounts(b)),
+		Outputs:   make(map[string]Change),
+		Resources: make(map[string]Delta),
+	}
+	if a.ExitCode != b.ExitCode {
+		d.ExitCode = &Delta{Before: int64(a.ExitCode), After: int64(b.ExitCode), Delta: int64(b.ExitCode - a.ExitCode)}
+	}
+	aa, ab := a.Artifacts, b.Artifacts
+	if aa == nil {
+		aa = &Artifacts{}
+	}
+	if ab == nil {
+		ab = &Artifacts{}
+	}
+	for name, pair := range map[string][2]string{
+		"stdout_hash": {aa.StdoutHash, ab.StdoutHash},
+		"stderr_hash": {aa.StderrHash, ab.StderrHash},
+		"stdin_hash":  {aa.StdinHash, ab.StdinHash},
+	} {
+		if pair[0] != pair[1] {
+			d.Outputs[name] = Change{Before: pair[0], After: pair[1]}
+		}
+	}
+	diffFileHashes(d.Outputs, a.Files, b.Files)
+	addDelta(d.Resources, "duration_ms", a.DurationMs, b.DurationMs)
+	ra, rb := a.Resources, b.Resources
+	if ra == nil {
+		ra = &Resources{}
+	}
+	if rb == nil {
+		rb = &Resources{}
+	}
+	addDelta(d.Resources, "cpu_time_ms", ra.CPUTimeMs, rb.CPUTimeMs)
+	addDelta(d.Resources, "max_rss_kb", ra.MaxRSSKB, rb.MaxRSSKB)
+	if a.Network != nil && b.Network != nil {
+		addDelta(d.Resources, "bytes_sent", a.Network.BytesSent, b.Network.BytesSent)
+		addDelta(d.Resources, "bytes_received", a.Network.BytesReceived, b.Network.BytesReceived)
+	}
+	if len(d.Outputs) == 0 {
+		d.Outputs = nil
+	}
+	if len(d.Resources) == 0 {
+		d.Resources = nil
+	}
+	return d
+}
+
+func addDelta(deltas map[string]Delta, name string, before, after int64) {
+	if before != after {
+		deltas[name] = Delta{Before: before, After: after, Delta: after - before}
+	}
+}
+
+// diffFileHashes reports files whose content changed, as "read:<path>" or
+// "written:<path>". Files hashed in only one receipt are not compared.
+func diffFileHashes(changes map[string]Change, a, b map[string]FileHashes) {
+	for path, before := range a {
+		after, ok := b[path]
+		if !ok {
+			continue
+		}
+		if x, y := digestSum(before.Read), digestSum(after.Read); x != "" && y != "" && x != y {
+			changes["read:"+path] = Change{Before: x, After: y}
+		}
+		if x, y := digestSum(before.Written), digestSum(after.Written); x != "" && y != "" && x != y {
+			changes["written:"+path] = Change{Before: x, After: y}
+		}
+	}
+}
+
+func digestSum(d *FileDigest) string {
+	if d == nil {
+		return ""
+	}
+	return d.SHA256
+}
+
+// processKeys identifies processes by executable and arguments.
+func processKeys(r Receipt) []string {
+	var keys []string
+	for _, proc := range r.ProcessTree {
+		key := proc.Exe
+		if len(proc.Argv) > 1 {
+			key += " " + strings.Join(proc.Argv[1:], " ")
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		for _, proc := range r.Processes {
+			keys = append(keys, proc.Cmd)
+		}
+	}
+	return normalizePaths(keys)
+}
+
+func networkKeys(r Receipt) []string {
+	if r.Network == nil {
+		return nil
+	}
+	var keys []string
+	for _, conn := range r.Network.Connections {
+		keys = append(keys, endpointKey(conn.Dst, conn.Protocol))
+	}
+	for _, attempt := range r.Network.Attempts {
+		keys = append(keys, endpointKey(attempt.Dst, attempt.Protocol))
+	}
+	for _, listener := range r.Network.Listeners {
+		keys = append(keys, "listen "+endpointKey(listener.Addr, listener.Protocol))
+	}
+	for _, query := range r.Network.DNS {
+		keys = append(keys, "dns "+query.Name+" "+query.Type)
+	}
+	return keys
+}
+
+func endpointKey(addr, protocol string) string {
+	if protocol == "" {
+		return addr
+	}
+	return addr + "/" + protocol
+}
+
+func syscallCounts(r Receipt) map[string]int {
+	if r.Syscalls == nil {
+		return nil
+	}
+	return r.Syscalls.Counts
+}
+
+func diffCounts(a, b map[string]int) map[string]Delta {
+	out := make(map[string]Delta)
+	for name, before := range a {
+		if after := b[name]; after != before {
+			out[name] = Delta{Before: int64(before), After: int64(after), Delta: int64(after - before)}
+		}
+	}
+	for name, after := range b {
+		if _, ok := a[name]; !ok && after != 0 {
+			out[name] = Delta{After: int64(after), Delta: int64(after)}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func diffSets(a, b []string) SetDiff {
+	inA := make(map[string]bool, len(a))
+	for _, key := range a {
+		inA[key] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, key := range b {
+		inB[key] = true
+	}
+	var d SetDiff
+	for key := range inB {
+		if !inA[key] {
+			d.Added = append(d.Added, key)
+		}
+	}
+	for key := range inA {
+		if !inB[key] {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+var procPID = regexp.MustCompile(`/proc/\d+(/|$)`)
+
+func normalizePaths(paths []string) []string {
+	out := make([]string, len(paths))
+	for i, path := range paths {
+		out[i] = procPID.ReplaceAllString(path, "/proc/<pid>$1")
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+package receipt
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var errDNSShort = errors.New("dns message truncated")
+
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeAAAA  = 28
+)
+
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+}
+
+type dnsAnswer struct {
+	name  string
+	rtype uint16
+	value string
+}
+
+type dnsMessage struct {
+	id        uint16
+	response  bool
+	questions []dnsQuestion
+	answers   []dnsAnswer
+}
+
+// parseDNS decodes the questions and A/AAAA/CNAME answers of a DNS message.
+// Captured payloads are capped, so records cut off at the end are dropped
+// rather than treated as an error once the header and a question were read.
+func parseDNS(b []byte) (dnsMessage, error) {
+	var msg dnsMessage
+	if len(b) < 12 {
+		return msg, errDNSShort
+	}
+	msg.id = binary.BigEndian.Uint16(b[0:2])
+	msg.response = b[2]&0x80 != 0
+	qdcount := int(binary.BigEndian.Uint16(b[4:6]))
+	ancount := int(binary.BigEndian.Uint16(b[6:8]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil || next+4 > len(b) {
+			if len(msg.questions) == 0 {
+				return msg, errDNSShort
+			}
+			return msg, nil
+		}
+		msg.questions = append(msg.questions, dnsQuestion{
+			name:  name,
+			qtype: binary.BigEndian.Uint16(b[next : next+2]),
+		})
+		off = next + 4
+	}
+	for i := 0; i < ancount; i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil || next+10 > len(b) {
+			break
+		}
+		rtype := binary.BigEndian.Uint16(b[next : next+2])
+		rdlen := int(binary.BigEndian.Uint16(b[next+8 : next+10]))
+		start := next + 10
+		if start+rdlen > len(b) {
+			break
+		}
+		rdata := b[start : start+rdlen]
+		off = start + rdlen
+
+		var value string
+		switch rtype {
+		case dnsTypeA:
+			if len(rdata) == net.IPv4len {
+				value = net.IP(rdata).String()
+			}
+		case dnsTypeAAAA:
+			if len(rdata) == net.IPv6len {
+				value = net.IP(rdata).String()
+			}
+		case dnsTypeCNAME:
+			value, _, _ = readDNSName(b, start)
+		}
+		if value != "" {
+			msg.answers = append(msg.answers, dnsAnswer{name: name, rtype: rtype, value: value})
+		}
+	}
+	return msg, nil
+}
+
+// readDNSName reads a possibly compressed name at off and returns it with the
+// offset just past the name in the original position.
+func readDNSName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errDNSShort
+		}
+		length := int(b[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errDNSShort
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			jumps++
+			if jumps > 16 {
+				return "", 0, errors.New("dns name compression loop")
+			}
+			off = int(binary.BigEndian.Uint16(b[off:off+2]) & 0x3fff)
+		default:
+			if off+1+length > len(b) {
+				return "", 0, errDNSShort
+			}
+			labels = append(labels, string(b[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+func dnsTypeString(t uint16) string {
+	switch t {
+	case dnsTypeA:
+		return "A"
+	case dnsTypeAAAA:
+		return "AAAA"
+	case dnsTypeCNAME:
+		return "CNAME"
+	case 12:
+		return "PTR"
+	case 15:
+		return "MX"
+	case 16:
+		return "TXT"
+	case 33:
+		return "SRV"
+	case 65:
+		return "HTTPS"
+	default:
+		return "TYPE" + strconv.Itoa(int(t))
+	}
+}
@@ -0,0 +1,200 @@
+package receipt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"glasshouse/core/profiling"
+)
+
+// DefaultFileHashMaxSize is the largest file FileHasher reads when no limit
+// is configured.
+const DefaultFileHashMaxSize = 64 << 20
+
+// FileHashes records the content of one file at the points the execution
+// depended on it.
+type FileHashes struct {
+	// Read is taken shortly after the execution first opened the file for
+	// reading.
+	Read *FileDigest `json:"read,omitempty"`
+	// Written is taken after the execution ended.
+	Written *FileDigest `json:"written,omitempty"`
+}
+
+// FileDigest is a file's SHA-256, size and modification time. SHA256 is
+// empty when Skipped says why the content was not hashed.
+type FileDigest struct {
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mtime"`
+	Skipped string `json:"skipped,omitempty"`
+}
+
+const (
+	SkippedTooLarge   = "too_large"
+	SkippedUnreadable = "unreadable"
+)
+
+// FileHasher hashes files an execution reads, at first open, and writes,
+// once it has ended. Hashing is best effort: files that are gone, are not
+// regular files or changed identity are left out. Paths are resolved on the
+// local filesystem, so it only applies to host executions. Relative paths,
+// kept when the process exited before its cwd was resolved, are skipped
+// rather than resolved against our own working directory.
+type FileHasher struct {
+	maxSize int64
+	queue   chan string
+	done    chan struct{}
+
+	mu     sync.Mutex
+	read   map[string]*FileDigest
+	closed bool
+}
+
+// fileHashQueue bounds the paths waiting to be hashed; opens beyond it are
+// not hashed rather than stalling the event loop.
+const fileHashQueue = 1024
+
+// NewFileHasher skips files larger than maxSize bytes, or
+// DefaultFileHashMaxSize when maxSize is zero or less. It starts a worker
+// that runs until Apply.
+func NewFileHasher(maxSize int64) *FileHasher {
+	if maxSize <= 0 {
+		maxSize = DefaultFileHashMaxSize
+	}
+	h := &FileHasher{
+		maxSize: maxSize,
+		queue:   make(chan string, fileHashQueue),
+		done:    make(chan struct{}),
+		read:    make(map[string]*FileDigest),
+	}
+	go h.work()
+	return h
+}
+
+func (h *FileHasher) work() {
+	defer close(h.done)
+	for path := range h.queue {
+		digest := h.digest(path)
+		h.mu.Lock()
+		h.read[path] = digest
+		h.mu.Unlock()
+	}
+}
+
+// Observe queues the target of the first read-only open of each path for
+// hashing. It never blocks on file I/O.
+func (h *FileHasher) Observe(ev profiling.Event) {
+	if ev.Type != profiling.EventOpen || ev.Path == "" || isWriteOpen(ev.Flags) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, seen := h.read[ev.Path]; seen || h.closed {
+		return
+	}
+	select {
+	case h.queue <- ev.Path:
+		h.read[ev.Path] = nil
+	default:
+		// Full: a later open of the same path may still get queued.
+	}
+}
+
+// wait stops accepting opens and waits for queued reads to be hashed.
+func (h *FileHasher) wait() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mu.Unlock()
+	<-h.done
+}
+
+// Apply waits for queued reads and fills rec.Files for the paths the
+// receipt lists, so masked paths stay out. Written files, including rename
+// targets, are hashed now. Observe has no effect afterwards.
+func (h *FileHasher) Apply(rec *Receipt) {
+	h.wait()
+	if rec.Filesystem == nil {
+		return
+	}
+	files := make(map[string]*FileHashes)
+	entry := func(path string) *FileHashes {
+		if files[path] == nil {
+			files[path] = &FileHashes{}
+		}
+		return files[path]
+	}
+	h.mu.Lock()
+	for _, path := range rec.Filesystem.Reads {
+		if digest := h.read[path]; digest != nil {
+			entry(path).Read = digest
+		}
+	}
+	h.mu.Unlock()
+	written := append([]string(nil), rec.Filesystem.Writes...)
+	for _, rename := range rec.Filesystem.Renames {
+		written = append(written, rename.To)
+	}
+	for _, path := range written {
+		if files[path] != nil && files[path].Written != nil {
+			continue
+		}
+		if digest := h.digest(path); digest != nil {
+			entry(path).Written = digest
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+	rec.Files = make(map[string]FileHashes, len(files))
+	for path, hashes := range files {
+		rec.Files[path] = *hashes
+	}
+}
+
+func (h *FileHasher) digest(path string) *FileDigest {
+	if !filepath.IsAbs(path) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	digest := &FileDigest{Size: info.Size(), ModTime: info.ModTime().UTC().Format(time.RFC3339Nano)}
+	if info.Size() > h.maxSize {
+		digest.Skipped = SkippedTooLarge
+		return digest
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		digest.Skipped = SkippedUnreadable
+		return digest
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil || !os.SameFile(info, opened) {
+		return nil
+	}
+	sum := sha256.New()
+	n, err := io.Copy(sum, io.LimitReader(f, h.maxSize+1))
+	if err != nil {
+		digest.Skipped = SkippedUnreadable
+		return digest
+	}
+	if n > h.maxSize {
+		digest.Size = n
+		digest.Skipped = SkippedTooLarge
+		return digest
+	}
+	digest.Size = n
+	digest.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return digest
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"glasshouse/core/identity"
+	"glasshouse/core/profiling"
 )
 
 // Meta bundles execution context used to enrich receipts after aggregation.
@@ -25,14 +26,43 @@ type Meta struct {
 	Workdir         string
 	Stdout          []byte
 	Stderr          []byte
+	StdinHash       string
 	RunErr          error
+	Termination     *Termination
 	ExtraErrors     []string
 	Resources       Resources
 	Backend         ExecutionInfo
 	Provenance      string
 	ObservationMode string
-	Completeness    string
-	RedactPaths     []string
+	// ObservationMechanism is the profiler's Capabilities.Mechanism.
+	ObservationMechanism string
+	Completeness         string
+	RedactPaths          []string
+
+	// Replays have no output, error values or host of their own. When set,
+	// these recorded values are used instead of deriving them.
+	StdoutHash  string
+	StderrHash  string
+	Outcome     *Outcome
+	Environment *Environment
+	Files       map[string]FileHashes
+}
+
+// ApplyDrops records lost events and marks the receipt lossy when any were
+// dropped, since the observed activity may then be incomplete.
+func (r *Receipt) ApplyDrops(drops map[profiling.EventType]uint64) {
+	for t, n := range drops {
+		if n == 0 {
+			continue
+		}
+		if r.Drops == nil {
+			r.Drops = make(map[string]uint64)
+		}
+		r.Drops[t.String()] += n
+	}
+	if len(r.Drops) > 0 {
+		r.Completeness = "lossy"
+	}
 }
 
 func PopulateMetadata(r *Receipt, meta Meta) {
@@ -62,6 +92,9 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 		}
 		r.ObservationMode = mode
 	}
+	if r.ObservationMechanism == "" {
+		r.ObservationMechanism = meta.ObservationMechanism
+	}
 	if r.Completeness == "" {
 		if meta.Completeness != "" {
 			r.Completeness = meta.Completeness
@@ -72,6 +105,10 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 
 	exitCode := r.ExitCode
 	errStr := errorString(meta.RunErr)
+	if meta.Termination != nil {
+		reason := meta.Termination.Reason
+		errStr = &reason
+	}
 	if len(meta.ExtraErrors) > 0 {
 		extra := strings.Join(meta.ExtraErrors, "; ")
 		if errStr == nil {
@@ -86,6 +123,14 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 		Signal:   signalForError(meta.RunErr),
 		Error:    errStr,
 	}
+	if meta.Termination != nil {
+		term := *meta.Termination
+		r.Outcome.Termination = &term
+	}
+	if meta.Outcome != nil {
+		outcome := *meta.Outcome
+		r.Outcome = &outcome
+	}
 
 	r.Timing = &Timing{
 		DurationMs: r.DurationMs,
@@ -93,7 +138,8 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 	}
 
 	rootExe := resolveExe(meta.Args)
-	r.ProcessTree = buildProcessTree(r.Processes, meta.RootPID, rootExe, meta.Args, meta.Workdir)
+	r.ProcessTree = buildProcessTree(r.Processes, r.ProcessTree, meta.RootPID, rootExe, meta.Args, meta.Workdir)
+	r.Outcome.Crashes = crashedDescendants(r.ProcessTree, meta.RootPID)
 
 	r.Environment = &Environment{
 		Runtime: runtimeName(meta.Args),
@@ -101,6 +147,10 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 		Arch:    runtime.GOARCH,
 		Sandbox: Sandbox{Network: "enabled"},
 	}
+	if meta.Environment != nil {
+		env := *meta.Environment
+		r.Environment = &env
+	}
 
 	r.Execution = &ExecutionInfo{
 		Backend:   meta.Backend.Backend,
@@ -108,8 +158,16 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 	}
 
 	r.Artifacts = &Artifacts{
-		StdoutHash: hashBytes(meta.Stdout),
-		StderrHash: hashBytes(meta.Stderr),
+		StdoutHash: hashOr(meta.StdoutHash, meta.Stdout),
+		StderrHash: hashOr(meta.StderrHash, meta.Stderr),
+		StdinHash:  meta.StdinHash,
+	}
+
+	if len(meta.Files) > 0 {
+		r.Files = make(map[string]FileHashes, len(meta.Files))
+		for path, hashes := range meta.Files {
+			r.Files[path] = hashes
+		}
 	}
 
 	if meta.Resources.CPUTimeMs > 0 || meta.Resources.MaxRSSKB > 0 {
@@ -123,6 +181,16 @@ func PopulateMetadata(r *Receipt, meta Meta) {
 }
 
 func (r *Receipt) MaskPaths(prefixes []string) {
+	if r.Timeline != nil {
+		// Timeline entries keep their position but lose masked paths; the
+		// paths themselves are listed once under Redactions.
+		for i := range r.Timeline.Events {
+			ev := &r.Timeline.Events[i]
+			if hasPrefix(ev.Path, prefixes) || hasPrefix(ev.Target, prefixes) {
+				ev.Path, ev.Target = "", ""
+			}
+		}
+	}
 	if r.Filesystem == nil {
 		return
 	}
@@ -132,6 +200,40 @@ func (r *Receipt) MaskPaths(prefixes []string) {
 	r.Filesystem.Reads = redactList(r.Filesystem.Reads, prefixes, &r.Redactions)
 	r.Filesystem.Writes = redactList(r.Filesystem.Writes, prefixes, &r.Redactions)
 	r.Filesystem.Deletes = redactList(r.Filesystem.Deletes, prefixes, &r.Redactions)
+	r.Filesystem.Mkdirs = redactList(r.Filesystem.Mkdirs, prefixes, &r.Redactions)
+	// Outputs come from writes and renames, which already list redactions.
+	var outputs []string
+	r.Filesystem.Outputs = redactList(r.Filesystem.Outputs, prefixes, &outputs)
+
+	renames := r.Filesystem.Renames[:0]
+	for _, rename := range r.Filesystem.Renames {
+		if hasPrefix(rename.From, prefixes) || hasPrefix(rename.To, prefixes) {
+			r.Redactions = append(r.Redactions, rename.From+" -> "+rename.To)
+			continue
+		}
+		renames = append(renames, rename)
+	}
+	r.Filesystem.Renames = renames
+
+	changes := r.Filesystem.PermissionChanges[:0]
+	for _, change := range r.Filesystem.PermissionChanges {
+		if hasPrefix(change.Path, prefixes) {
+			r.Redactions = append(r.Redactions, change.Path)
+			continue
+		}
+		changes = append(changes, change)
+	}
+	r.Filesystem.PermissionChanges = changes
+
+	for path := range r.Files {
+		if hasPrefix(path, prefixes) {
+			delete(r.Files, path)
+		}
+	}
+
+	// Truncated paths are already listed in their primary section.
+	var discarded []string
+	r.Filesystem.TruncatedPaths = redactList(r.Filesystem.TruncatedPaths, prefixes, &discarded)
 }
 
 func redactList(values []string, prefixes []string, redactions *[]string) []string {
@@ -168,6 +270,13 @@ func executionID(meta Meta) string {
 	return fmt.Sprintf("pid:%d:start:%d", meta.RootPID, meta.Start.UnixNano())
 }
 
+func hashOr(recorded string, data []byte) string {
+	if recorded != "" {
+		return recorded
+	}
+	return hashBytes(data)
+}
+
 func hashBytes(data []byte) string {
 	sum := sha256.Sum256(data)
 	return hex.EncodeToString(sum[:])
@@ -184,10 +293,16 @@ func resolveExe(cmdArgs []string) string {
 	return exe
 }
 
-func buildProcessTree(processes []ProcessEntry, rootPID uint32, rootExe string, rootArgv []string, workingDir string) []ProcessV2 {
+// buildProcessTree derives the tree from observed processes, keeping lifecycle
+// details the aggregator recorded in existing.
+func buildProcessTree(processes []ProcessEntry, existing []ProcessV2, rootPID uint32, rootExe string, rootArgv []string, workingDir string) []ProcessV2 {
 	if len(processes) == 0 {
 		return []ProcessV2{}
 	}
+	lifecycle := make(map[uint32]ProcessV2, len(existing))
+	for _, proc := range existing {
+		lifecycle[proc.PID] = proc
+	}
 	out := make([]ProcessV2, 0, len(processes))
 	for _, proc := range processes {
 		argv := argvFromCmd(proc.Cmd)
@@ -205,17 +320,43 @@ func buildProcessTree(processes []ProcessEntry, rootPID uint32, rootExe string,
 			}
 			wd = workingDir
 		}
+		lc := lifecycle[proc.PID]
+		if exe == "" {
+			exe = lc.Exe
+		}
 		out = append(out, ProcessV2{
 			PID:        proc.PID,
 			PPID:       proc.PPID,
 			Exe:        exe,
 			Argv:       argv,
 			WorkingDir: wd,
+			StartTime:  lc.StartTime,
+			EndTime:    lc.EndTime,
+			ExitCode:   lc.ExitCode,
+			Signal:     lc.Signal,
+			CoreDumped: lc.CoreDumped,
 		})
 	}
 	return out
 }
 
+func crashedDescendants(tree []ProcessV2, rootPID uint32) []ProcessCrash {
+	var crashes []ProcessCrash
+	for _, proc := range tree {
+		if proc.PID == rootPID || proc.Signal == "" {
+			continue
+		}
+		crashes = append(crashes, ProcessCrash{
+			PID:        proc.PID,
+			PPID:       proc.PPID,
+			Exe:        proc.Exe,
+			Signal:     proc.Signal,
+			CoreDumped: proc.CoreDumped,
+		})
+	}
+	return crashes
+}
+
 func argvFromCmd(cmd string) []string {
 	if strings.TrimSpace(cmd) == "" {
 		return []string{}
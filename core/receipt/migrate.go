@@ -0,0 +1,136 @@
+package receipt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"glasshouse/core/signing"
+	"glasshouse/core/version"
+)
+
+// LegacyVersion stands for receipts written before the "version" field,
+// such as audit.Receipt documents, which carry "receipt_version" instead
+// and list files under filesystem "read"/"written".
+const LegacyVersion = "legacy"
+
+// migrations upgrade a decoded receipt one version at a time, in order.
+// Adding a receipt version means publishing its schema (go generate) and
+// appending the step from the previous version here.
+var migrations = []struct {
+	from, to string
+	apply    func(doc map[string]any)
+}{
+	{from: LegacyVersion, to: "v0.3.0", apply: migrateLegacy},
+	// v0.4.0 added the optional "files" map and "filesystem.outputs".
+	{from: "v0.3.0", to: "v0.4.0", apply: func(map[string]any) {}},
+}
+
+// Migration is the result of Migrate.
+type Migration struct {
+	From string
+	To   string
+	Data []byte
+	// DroppedSignature is set when the source was signed; a migrated
+	// receipt no longer matches its signature and must be re-signed.
+	DroppedSignature bool
+}
+
+// Migrate upgrades a receipt document to version.ReceiptVersion. A receipt
+// that is already current is returned unchanged.
+func Migrate(data []byte) (Migration, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return Migration{}, err
+	}
+	from := documentVersion(doc)
+	result := Migration{From: from, To: version.ReceiptVersion}
+	if from == version.ReceiptVersion {
+		result.Data = data
+		return result, nil
+	}
+	current := from
+	for _, step := range migrations {
+		if step.from != current {
+			continue
+		}
+		step.apply(doc)
+		doc["version"] = step.to
+		current = step.to
+	}
+	if current != version.ReceiptVersion {
+		return Migration{}, fmt.Errorf("cannot migrate receipt version %q to %s", from, version.ReceiptVersion)
+	}
+	if _, signed := doc[signing.Field]; signed {
+		delete(doc, signing.Field)
+		result.DroppedSignature = true
+	}
+	if result.Data, err = json.MarshalIndent(doc, "", "  "); err != nil {
+		return Migration{}, err
+	}
+	return result, nil
+}
+
+func documentVersion(doc map[string]any) string {
+	if v, ok := doc["version"].(string); ok && v != "" {
+		return v
+	}
+	return LegacyVersion
+}
+
+// migrateLegacy maps an audit.Receipt onto the v0.3.0 layout.
+func migrateLegacy(doc map[string]any) {
+	delete(doc, "receipt_version")
+	setDefault(doc, "exit_code", json.Number("0"))
+	setDefault(doc, "duration_ms", json.Number("0"))
+	setDefault(doc, "processes", []any{})
+	setDefault(doc, "filesystem", nil)
+	setDefault(doc, "network", nil)
+
+	if fs := asObject(doc["filesystem"]); fs != nil {
+		fs["reads"] = mergePaths(fs["reads"], fs["read"])
+		fs["writes"] = mergePaths(fs["writes"], fs["written"])
+		delete(fs, "read")
+		delete(fs, "written")
+		setDefault(fs, "deletes", []any{})
+		setDefault(fs, "policy_violations", []any{})
+	}
+	if network := asObject(doc["network"]); network != nil {
+		setDefault(network, "attempts", []any{})
+		setDefault(network, "bytes_sent", json.Number("0"))
+		setDefault(network, "bytes_received", json.Number("0"))
+	}
+	if syscalls := asObject(doc["syscalls"]); syscalls != nil {
+		setDefault(syscalls, "counts", map[string]any{})
+		setDefault(syscalls, "denied", []any{})
+	}
+}
+
+func setDefault(obj map[string]any, key string, value any) {
+	if _, ok := obj[key]; !ok {
+		obj[key] = value
+	}
+}
+
+// mergePaths returns the sorted union of two JSON string arrays.
+func mergePaths(lists ...any) []any {
+	set := make(map[string]struct{})
+	for _, list := range lists {
+		items, _ := list.([]any)
+		for _, item := range items {
+			if path, ok := item.(string); ok {
+				set[path] = struct{}{}
+			}
+		}
+	}
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	out := make([]any, len(paths))
+	for i, path := range paths {
+		out[i] = path
+	}
+	return out
+}
@@ -1,8 +1,19 @@
 package receipt
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"glasshouse/core/profiling"
 )
 
 func TestReceiptMasking(t *testing.T) {
@@ -52,3 +63,429 @@ func TestAggregatorReceiptContainsEssentials(t *testing.T) {
 		t.Fatal("missing filesystem or network")
 	}
 }
+
+func TestAggregatorRecordsProcessLifecycle(t *testing.T) {
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	agg.HandleEvent(profiling.Event{Type: profiling.EventFork, PID: 101, PPID: 100, Comm: "sh"})
+	agg.HandleEvent(profiling.Event{Type: profiling.EventFork, PID: 102, PPID: 100, Comm: "worker"})
+	agg.HandleEvent(profiling.Event{Type: profiling.EventExit, PID: 101, Flags: 3 << 8})
+	agg.HandleEvent(profiling.Event{Type: profiling.EventExit, PID: 102, Flags: uint32(syscall.SIGSEGV) | 0x80})
+	rec := agg.Receipt(0, time.Second)
+	PopulateMetadata(&rec, Meta{RootPID: 100, Args: []string{"/bin/sh"}})
+
+	byPID := map[uint32]ProcessV2{}
+	for _, proc := range rec.ProcessTree {
+		byPID[proc.PID] = proc
+	}
+	exited := byPID[101]
+	if exited.ExitCode == nil || *exited.ExitCode != 3 || exited.StartTime == "" || exited.EndTime == "" {
+		t.Fatalf("unexpected lifecycle for 101: %+v", exited)
+	}
+	crashed := byPID[102]
+	if crashed.Signal != syscall.SIGSEGV.String() || !crashed.CoreDumped || crashed.Exe != "worker" {
+		t.Fatalf("unexpected lifecycle for 102: %+v", crashed)
+	}
+	if len(rec.Outcome.Crashes) != 1 || rec.Outcome.Crashes[0].PID != 102 {
+		t.Fatalf("expected crash of 102, got %+v", rec.Outcome.Crashes)
+	}
+}
+
+func TestAggregatorRecordsFilesystemMutations(t *testing.T) {
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	events := []profiling.Event{
+		{Type: profiling.EventUnlink, PID: 100, Path: "/tmp/old"},
+		{Type: profiling.EventRename, PID: 100, Path: "/tmp/a", Target: "/tmp/b"},
+		{Type: profiling.EventMkdir, PID: 100, Path: "/tmp/dir", Flags: 0o755},
+		{Type: profiling.EventChmod, PID: 100, Path: "/tmp/b", Flags: 0o100755},
+		{Type: profiling.EventChown, PID: 100, Path: "/tmp/b", UID: 1000, GID: ^uint32(0)},
+		{Type: profiling.EventTruncate, PID: 100, Path: "/tmp/log"},
+	}
+	for _, ev := range events {
+		agg.HandleEvent(ev)
+	}
+	fs := agg.Receipt(0, time.Second).Filesystem
+
+	if len(fs.Deletes) != 1 || fs.Deletes[0] != "/tmp/old" {
+		t.Fatalf("deletes %v", fs.Deletes)
+	}
+	if len(fs.Renames) != 1 || fs.Renames[0] != (Rename{From: "/tmp/a", To: "/tmp/b"}) {
+		t.Fatalf("renames %v", fs.Renames)
+	}
+	if len(fs.Mkdirs) != 1 || len(fs.Writes) != 1 || fs.Writes[0] != "/tmp/log" {
+		t.Fatalf("mkdirs %v writes %v", fs.Mkdirs, fs.Writes)
+	}
+	if len(fs.PermissionChanges) != 2 {
+		t.Fatalf("permission changes %+v", fs.PermissionChanges)
+	}
+	chmod, chown := fs.PermissionChanges[0], fs.PermissionChanges[1]
+	if chmod.Op != "chmod" || chmod.Mode != "0755" {
+		t.Fatalf("chmod %+v", chmod)
+	}
+	if chown.Op != "chown" || chown.UID == nil || *chown.UID != 1000 || chown.GID != nil {
+		t.Fatalf("chown %+v", chown)
+	}
+}
+
+func TestAggregatorOutputsFollowEventOrder(t *testing.T) {
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	write := uint32(syscall.O_WRONLY | syscall.O_CREAT | syscall.O_TRUNC)
+	events := []profiling.Event{
+		// rm out; build > out
+		{Type: profiling.EventUnlink, PID: 100, Path: "/out/app"},
+		{Type: profiling.EventOpen, PID: 100, Path: "/out/app", Flags: write},
+		// written, moved into place, then written again
+		{Type: profiling.EventOpen, PID: 100, Path: "/out/lib.tmp", Flags: write},
+		{Type: profiling.EventRename, PID: 100, Path: "/out/lib.tmp", Target: "/out/lib"},
+		{Type: profiling.EventOpen, PID: 100, Path: "/out/lib.tmp", Flags: write},
+		// written, then cleaned up
+		{Type: profiling.EventOpen, PID: 100, Path: "/out/scratch", Flags: write},
+		{Type: profiling.EventUnlink, PID: 100, Path: "/out/scratch"},
+	}
+	for _, ev := range events {
+		agg.HandleEvent(ev)
+	}
+	fs := agg.Receipt(0, time.Second).Filesystem
+	want := []string{"/out/app", "/out/lib", "/out/lib.tmp"}
+	if strings.Join(fs.Outputs, ",") != strings.Join(want, ",") {
+		t.Fatalf("outputs %v, want %v", fs.Outputs, want)
+	}
+}
+
+func TestAggregatorRecordsNetworkActivity(t *testing.T) {
+	query := []byte{
+		0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0, 1, 0, 1,
+	}
+	response := append([]byte{}, query...)
+	response[2], response[7] = 0x81, 2
+	response = append(response,
+		0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 6,
+		3, 'w', 'w', 'w', 0xc0, 12,
+		0xc0, 41, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4,
+		93, 184, 216, 34,
+	)
+	resolver := [16]byte{10, 0, 0, 53}
+	remote := [16]byte{93, 184, 216, 34}
+	peer := [16]byte{192, 168, 1, 7}
+
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	events := []profiling.Event{
+		{Type: profiling.EventSend, PID: 100, AddrFamily: syscall.AF_INET, Addr: resolver, Port: 53, Proto: syscall.IPPROTO_UDP, Flags: uint32(len(query)), Payload: query},
+		{Type: profiling.EventRecv, PID: 100, AddrFamily: syscall.AF_INET, Addr: resolver, Port: 53, Proto: syscall.IPPROTO_UDP, Flags: uint32(len(response)), Payload: response},
+		{Type: profiling.EventConnect, PID: 100, AddrFamily: syscall.AF_INET, Addr: remote, Port: 443, Proto: syscall.IPPROTO_TCP},
+		{Type: profiling.EventSocketStats, PID: 100, AddrFamily: syscall.AF_INET, Addr: remote, Port: 443, Proto: syscall.IPPROTO_TCP, BytesSent: 100, BytesReceived: 2000},
+		{Type: profiling.EventListen, PID: 100, AddrFamily: syscall.AF_INET, Port: 8080, Proto: syscall.IPPROTO_TCP},
+		{Type: profiling.EventAccept, PID: 100, AddrFamily: syscall.AF_INET, Addr: peer, Port: 50000, Proto: syscall.IPPROTO_TCP, Flags: 8080},
+	}
+	for _, ev := range events {
+		agg.HandleEvent(ev)
+	}
+	network := agg.Receipt(0, time.Second).Network
+
+	if len(network.DNS) != 1 {
+		t.Fatalf("dns %+v", network.DNS)
+	}
+	dns := network.DNS[0]
+	if dns.Name != "example.com" || dns.Type != "A" || dns.Server != "10.0.0.53:53" || len(dns.Answers) != 2 {
+		t.Fatalf("dns %+v", dns)
+	}
+	var https Connection
+	for _, conn := range network.Connections {
+		if conn.Dst == "93.184.216.34:443" {
+			https = conn
+		}
+	}
+	if https.Hostname != "example.com" || https.BytesSent != 100 || https.BytesReceived != 2000 {
+		t.Fatalf("connection %+v", https)
+	}
+	if network.BytesSent != int64(100+len(query)) || network.BytesReceived != int64(2000+len(response)) {
+		t.Fatalf("totals sent %d received %d", network.BytesSent, network.BytesReceived)
+	}
+	if len(network.Listeners) != 1 || network.Listeners[0].Addr != "0.0.0.0:8080" {
+		t.Fatalf("listeners %+v", network.Listeners)
+	}
+	if len(network.Inbound) != 1 || network.Inbound[0].Src != "192.168.1.7:50000" || network.Inbound[0].LocalPort != 8080 {
+		t.Fatalf("inbound %+v", network.Inbound)
+	}
+}
+
+func TestAggregatorRecordsSecurityEvents(t *testing.T) {
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	events := []profiling.Event{
+		{Type: profiling.EventSetUID, PID: 100, Op: 2, Args: [3]uint64{0, 0, 0xffffffff}},
+		{Type: profiling.EventPtrace, PID: 100, Flags: 16, Args: [3]uint64{1}},
+		{Type: profiling.EventMount, PID: 100, Path: "/mnt", Target: "/dev/sda1"},
+		{Type: profiling.EventBPF, PID: 100, Flags: 5},
+		{Type: profiling.EventBPF, PID: 100, Flags: 5},
+		{Type: profiling.EventModuleLoad, PID: 100, Op: 1, Path: "/tmp/evil.ko"},
+		{Type: profiling.EventMemfdCreate, PID: 100, Path: "payload"},
+		{Type: profiling.EventFilelessExec, PID: 100, Path: "/memfd:payload (deleted)"},
+		{Type: profiling.EventExec, PID: 101, PPID: 100, Path: "/proc/self/fd/3"},
+		{Type: profiling.EventMprotectExec, PID: 100, Flags: 5},
+	}
+	for _, ev := range events {
+		agg.HandleEvent(ev)
+	}
+	rec := agg.Receipt(0, time.Second)
+	sec := rec.Security
+	if sec == nil {
+		t.Fatal("missing security section")
+	}
+	if len(sec.IDChanges) != 1 {
+		t.Fatalf("id changes %+v", sec.IDChanges)
+	}
+	change := sec.IDChanges[0]
+	if change.Syscall != "setresuid" || change.Real == nil || *change.Real != 0 || change.Saved != nil {
+		t.Fatalf("id change %+v", change)
+	}
+	if len(sec.Ptrace) != 1 || sec.Ptrace[0].Request != "PTRACE_ATTACH" || sec.Ptrace[0].TargetPID != 1 {
+		t.Fatalf("ptrace %+v", sec.Ptrace)
+	}
+	if len(sec.Mounts) != 1 || sec.Mounts[0].Source != "/dev/sda1" || sec.Mounts[0].Target != "/mnt" {
+		t.Fatalf("mounts %+v", sec.Mounts)
+	}
+	if len(sec.BPF) != 1 || sec.BPF[0].Command != "BPF_PROG_LOAD" || sec.BPF[0].Count != 2 {
+		t.Fatalf("bpf %+v", sec.BPF)
+	}
+	if len(sec.ModuleLoads) != 1 || sec.ModuleLoads[0].Syscall != "finit_module" {
+		t.Fatalf("module loads %+v", sec.ModuleLoads)
+	}
+	if len(sec.MemfdCreates) != 1 || len(sec.FilelessExecs) != 2 || len(sec.ExecutableMemory) != 1 {
+		t.Fatalf("security %+v", sec)
+	}
+	if rec.Syscalls.Counts["setresuid"] != 1 || rec.Syscalls.Counts["bpf"] != 2 {
+		t.Fatalf("syscall counts %v", rec.Syscalls.Counts)
+	}
+
+	empty := NewAggregator("host")
+	empty.SetRoot(1, "/bin/true")
+	if empty.Receipt(0, time.Second).Security != nil {
+		t.Fatal("security section should be omitted without events")
+	}
+}
+
+func TestAggregatorTimelineOrdersAndCaps(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	agg := NewStreamAggregator(AggregatorOptions{Provenance: "host"})
+	id := agg.StartExecution(ExecutionStart{RootPID: 100, StartedAt: start, TimelineLimit: 3})
+	events := []profiling.Event{
+		{Type: profiling.EventConnect, PID: 100, AddrFamily: syscall.AF_INET, Addr: [16]byte{10, 0, 0, 1}, Port: 443, Timestamp: start.Add(30 * time.Millisecond)},
+		{Type: profiling.EventOpen, PID: 100, Path: "/tmp/out", Flags: syscall.O_WRONLY, Timestamp: start.Add(10 * time.Millisecond)},
+		{Type: profiling.EventFork, PID: 101, PPID: 100, Timestamp: start.Add(20 * time.Millisecond)},
+		{Type: profiling.EventExit, PID: 101, Timestamp: start.Add(40 * time.Millisecond)},
+	}
+	for _, ev := range events {
+		agg.HandleEvent(ev)
+	}
+	rec, ok := agg.FlushExecution(id, 0, time.Second)
+	if !ok || rec.Timeline == nil {
+		t.Fatalf("missing timeline: %+v", rec.Timeline)
+	}
+	got := rec.Timeline.Events
+	if len(got) != 3 || rec.Timeline.Dropped != 1 {
+		t.Fatalf("timeline %+v", rec.Timeline)
+	}
+	if got[0].Type != "open" || got[0].OffsetNs != int64(10*time.Millisecond) || got[0].Path != "/tmp/out" {
+		t.Fatalf("first entry %+v", got[0])
+	}
+	if got[1].Type != "fork" || got[2].Type != "connect" || got[2].Addr != "10.0.0.1:443" {
+		t.Fatalf("entries out of order: %+v", got)
+	}
+	for _, proc := range rec.ProcessTree {
+		if proc.PID == 101 && proc.EndTime != formatTime(start.Add(40*time.Millisecond)) {
+			t.Fatalf("exit time not taken from event: %+v", proc)
+		}
+	}
+
+	plain := NewAggregator("host")
+	plain.SetRoot(1, "/bin/true")
+	if plain.Receipt(0, time.Second).Timeline != nil {
+		t.Fatal("timeline should be omitted unless enabled")
+	}
+}
+
+func TestAggregatorCheckpointRestoresOpenExecutions(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	before := []profiling.Event{
+		{Type: profiling.EventFork, PID: 101, PPID: 100},
+		{Type: profiling.EventExec, PID: 101, PPID: 100, Path: "/usr/bin/curl", Comm: "curl"},
+		{Type: profiling.EventOpen, PID: 101, Path: "/etc/hosts"},
+		{Type: profiling.EventOpen, PID: 101, Path: "/tmp/out", Flags: syscall.O_WRONLY | syscall.O_CREAT},
+		{Type: profiling.EventRename, PID: 101, Path: "/tmp/out", Target: "/tmp/final"},
+		{Type: profiling.EventConnect, PID: 101, AddrFamily: syscall.AF_INET, Proto: syscall.IPPROTO_TCP, Addr: [16]byte{10, 0, 0, 1}, Port: 443},
+		{Type: profiling.EventSetUID, PID: 101, Op: 2, Args: [3]uint64{0, 0, 0xffffffff}},
+		{Type: profiling.EventBPF, PID: 101, Flags: 5},
+		{Type: profiling.EventMprotectExec, PID: 101, Flags: 5},
+	}
+	after := []profiling.Event{
+		{Type: profiling.EventBPF, PID: 101, Flags: 5},
+		{Type: profiling.EventOpen, PID: 101, Path: "/etc/hosts"},
+		{Type: profiling.EventExit, PID: 101, PPID: 100},
+	}
+	for i := range before {
+		before[i].Timestamp = start.Add(time.Duration(i+1) * time.Millisecond)
+	}
+	for i := range after {
+		after[i].Timestamp = start.Add(time.Duration(i+1) * time.Second)
+	}
+	original := NewStreamAggregator(AggregatorOptions{Provenance: "host"})
+	id := original.StartExecution(ExecutionStart{RootPID: 100, RootStartTime: 7, Command: "/bin/sh", StartedAt: start, TimelineLimit: 10})
+	for _, ev := range before {
+		original.HandleEvent(ev)
+	}
+	original.RecordPolicyViolation(id, PolicyViolation{Phase: "runtime", Rule: "no-bpf"})
+
+	data, err := json.Marshal(original.Checkpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewStreamAggregator(AggregatorOptions{Provenance: "host"})
+	if err := restored.Restore(cp); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := json.Marshal(original.Checkpoint())
+	second, _ := json.Marshal(restored.Checkpoint())
+	if !bytes.Equal(first, second) {
+		t.Fatalf("restored checkpoint differs:\n%s\n%s", second, first)
+	}
+
+	for _, agg := range []*Aggregator{original, restored} {
+		for _, ev := range after {
+			if got := agg.HandleEvent(ev); got != id {
+				t.Fatalf("event attributed to %v, want %v", got, id)
+			}
+		}
+	}
+	want, _ := original.FlushExecution(id, 0, 2*time.Second)
+	got, ok := restored.FlushExecution(id, 0, 2*time.Second)
+	if !ok {
+		t.Fatal("restored aggregator lost the execution")
+	}
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(wantJSON, gotJSON) {
+		t.Fatalf("restored receipt differs:\n%s\n%s", gotJSON, wantJSON)
+	}
+
+	cp.Version = CheckpointVersion + 1
+	if err := restored.Restore(cp); err == nil {
+		t.Fatal("expected unsupported checkpoint version to be rejected")
+	}
+}
+
+func TestDiffIgnoresVolatileFields(t *testing.T) {
+	base := func(pid uint32, start string) Receipt {
+		return Receipt{
+			ExecutionID: start,
+			StartTime:   start,
+			ProcessTree: []ProcessV2{{PID: pid, Exe: "/bin/sh", Argv: []string{"sh", "build.sh"}}},
+			Filesystem: &FilesystemInfo{
+				Reads:  []string{"/src/main.c", "/proc/" + strconv.Itoa(int(pid)) + "/status"},
+				Writes: []string{"/out/main.o"},
+			},
+			Network:    &NetworkInfo{Attempts: []NetworkAttempt{{Dst: "10.0.0.1:443", Protocol: "tcp"}}},
+			Syscalls:   &SyscallInfo{Counts: map[string]int{"open": 3}},
+			Artifacts:  &Artifacts{StdoutHash: "aa"},
+			DurationMs: int64(pid),
+		}
+	}
+	a, b := base(100, "t1"), base(200, "t2")
+	if d := Diff(a, b); d.Changed() || d.Resources["duration_ms"].Delta != 100 {
+		t.Fatalf("identical runs differ: %+v", d)
+	}
+
+	b.ProcessTree = append(b.ProcessTree, ProcessV2{PID: 201, Exe: "/usr/bin/curl", Argv: []string{"curl", "evil.example"}})
+	b.Filesystem.Writes = nil
+	b.Network.Attempts = append(b.Network.Attempts, NetworkAttempt{Dst: "203.0.113.9:80", Protocol: "tcp"})
+	b.Syscalls.Counts = map[string]int{"open": 5, "connect": 1}
+	b.ExitCode = 1
+	d := Diff(a, b)
+	if !d.Changed() {
+		t.Fatal("expected a behavioral change")
+	}
+	if len(d.Processes.Added) != 1 || d.Processes.Added[0] != "/usr/bin/curl evil.example" {
+		t.Fatalf("processes = %+v", d.Processes)
+	}
+	if len(d.Writes.Removed) != 1 || len(d.Network.Added) != 1 || d.Network.Added[0] != "203.0.113.9:80/tcp" {
+		t.Fatalf("writes = %+v, network = %+v", d.Writes, d.Network)
+	}
+	if d.Syscalls["open"].Delta != 2 || d.Syscalls["connect"].After != 1 || d.ExitCode == nil || d.ExitCode.After != 1 {
+		t.Fatalf("syscalls = %+v, exit = %+v", d.Syscalls, d.ExitCode)
+	}
+}
+
+func TestFileHasherRecordsReadAndWrittenContent(t *testing.T) {
+	dir := t.TempDir()
+	input, output, large := filepath.Join(dir, "input.csv"), filepath.Join(dir, "output.txt"), filepath.Join(dir, "large.bin")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum := func(content string) string {
+		s := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(s[:])
+	}
+	writeFile(input, "a,b\n")
+	writeFile(large, strings.Repeat("x", 64))
+
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	hasher := NewFileHasher(32)
+	for _, ev := range []profiling.Event{
+		{Type: profiling.EventOpen, PID: 100, Path: input},
+		{Type: profiling.EventOpen, PID: 100, Path: large},
+		{Type: profiling.EventOpen, PID: 100, Path: output, Flags: syscall.O_WRONLY | syscall.O_CREAT},
+		// Left relative by an exited process; it must not resolve against
+		// our own cwd.
+		{Type: profiling.EventOpen, PID: 100, Path: "receipt_test.go"},
+	} {
+		agg.HandleEvent(ev)
+		hasher.Observe(ev)
+	}
+	// The read digest reflects the content at open, the written one the
+	// content at the end.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		hasher.mu.Lock()
+		hashed := hasher.read[input] != nil
+		hasher.mu.Unlock()
+		if hashed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("read of input was not hashed")
+		}
+	}
+	writeFile(input, "changed\n")
+	writeFile(output, "done\n")
+
+	rec := agg.Receipt(0, time.Second)
+	hasher.Apply(&rec)
+	if got := rec.Files[input].Read; got == nil || got.SHA256 != sum("a,b\n") || got.Size != 4 || got.ModTime == "" {
+		t.Fatalf("input = %+v", got)
+	}
+	if got := rec.Files[output]; got.Read != nil || got.Written == nil || got.Written.SHA256 != sum("done\n") {
+		t.Fatalf("output = %+v", got)
+	}
+	if got := rec.Files[large].Read; got == nil || got.SHA256 != "" || got.Skipped != SkippedTooLarge || got.Size != 64 {
+		t.Fatalf("large = %+v", got)
+	}
+	if got, ok := rec.Files["receipt_test.go"]; ok {
+		t.Fatalf("relative path hashed: %+v", got)
+	}
+
+	rec.MaskPaths([]string{input})
+	if _, ok := rec.Files[input]; ok {
+		t.Fatal("masked path kept its hashes")
+	}
+}
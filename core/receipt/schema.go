@@ -0,0 +1,185 @@
+package receipt
+
+import (
+	"embed"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"glasshouse/core/version"
+)
+
+//go:generate go run ../../cmd/glasshouse receipt schema --write schema
+
+// schemas holds the published JSON Schema of every receipt version,
+// generated by GenerateSchema when the version was current.
+//
+//go:embed schema/*.json
+var schemas embed.FS
+
+// SchemaFile is the name a version's schema is published under.
+func SchemaFile(v string) string {
+	return "receipt-" + v + ".json"
+}
+
+// Schema returns the published JSON Schema for receipt version v.
+func Schema(v string) ([]byte, error) {
+	data, err := schemas.ReadFile("schema/" + SchemaFile(v))
+	if err != nil {
+		return nil, fmt.Errorf("no schema for receipt version %q", v)
+	}
+	return data, nil
+}
+
+// SchemaVersions lists the versions with a published schema.
+func SchemaVersions() []string {
+	entries, _ := schemas.ReadDir("schema")
+	var out []string
+	for _, entry := range entries {
+		name := entry.Name()
+		out = append(out, strings.TrimSuffix(strings.TrimPrefix(name, "receipt-"), ".json"))
+	}
+	return out
+}
+
+// GenerateSchema derives the JSON Schema of the current receipt version from
+// the Receipt type.
+func GenerateSchema() ([]byte, error) {
+	g := schemaGen{defs: make(map[string]any), types: make(map[string]reflect.Type)}
+	root, err := g.schema(reflect.TypeOf(Receipt{}))
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "urn:glasshouse:receipt:" + version.ReceiptVersion,
+		"title":   "glasshouse receipt " + version.ReceiptVersion,
+		"$ref":    root["$ref"],
+		"$defs":   g.defs,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteSchema writes the current version's schema into dir.
+func WriteSchema(dir string) (string, error) {
+	data, err := GenerateSchema()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, SchemaFile(version.ReceiptVersion))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("write schema: %w", err)
+	}
+	return path, nil
+}
+
+type schemaGen struct {
+	defs  map[string]any
+	types map[string]reflect.Type
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func (g *schemaGen) schema(t reflect.Type) (map[string]any, error) {
+	if t.Kind() != reflect.Pointer && (t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler)) {
+		return map[string]any{"type": "string"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"anyOf": []any{elem, map[string]any{"type": "null"}}}, nil
+	case reflect.Struct:
+		return g.structRef(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": []any{"array", "null"}, "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("schema: map key %s is not a string", t.Key())
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": []any{"object", "null"}, "additionalProperties": values}, nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]any{}, nil
+	}
+	return nil, fmt.Errorf("schema: unsupported type %s", t)
+}
+
+// structRef adds t to $defs under its type name and returns a reference.
+func (g *schemaGen) structRef(t reflect.Type) (map[string]any, error) {
+	name := t.Name()
+	ref := map[string]any{"$ref": "#/$defs/" + name}
+	if seen, ok := g.types[name]; ok {
+		if seen != t {
+			return nil, fmt.Errorf("schema: %s and %s share a definition name", seen, t)
+		}
+		return ref, nil
+	}
+	g.types[name] = t
+	properties := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		prop, err := g.schema(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		properties[name] = prop
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+	def := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		def["required"] = required
+	}
+	g.defs[t.Name()] = def
+	return ref, nil
+}
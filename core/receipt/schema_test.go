@@ -0,0 +1,77 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"glasshouse/audit"
+	"glasshouse/core/profiling"
+	"glasshouse/core/version"
+)
+
+func TestPublishedSchemaIsCurrent(t *testing.T) {
+	generated, err := GenerateSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := Schema(version.ReceiptVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, published) {
+		t.Fatalf("schema/%s is stale: run go generate ./core/receipt", SchemaFile(version.ReceiptVersion))
+	}
+}
+
+func TestValidateAndMigrateLegacyAuditReceipt(t *testing.T) {
+	agg := NewAggregator("host")
+	agg.SetRoot(100, "/bin/sh")
+	agg.HandleEvent(profiling.Event{Type: profiling.EventExec, PID: 100, Path: "/bin/sh"})
+	agg.HandleEvent(profiling.Event{Type: profiling.EventOpen, PID: 100, Path: "/etc/hosts"})
+	current, err := json.Marshal(agg.Receipt(0, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(current); err != nil {
+		t.Fatalf("current receipt: %v", err)
+	}
+
+	broken := bytes.Replace(current, []byte(`"exit_code":0`), []byte(`"exit_code":"0"`), 1)
+	var invalid *ValidationError
+	if err := Validate(broken); !errors.As(err, &invalid) || len(invalid.Problems) != 1 || invalid.Problems[0] != "/exit_code: want integer, got string" {
+		t.Fatalf("broken receipt: %v", err)
+	}
+
+	legacy, err := json.Marshal(audit.Receipt{
+		ReceiptVersion: "v0.1.0",
+		Processes:      []audit.ProcessEntry{{PID: 100, Cmd: "sh"}},
+		Filesystem:     &audit.FilesystemInfo{Read: []string{"/etc/hosts"}, Written: []string{"/tmp/out"}, Writes: []string{"/tmp/log"}},
+		Network:        &audit.NetworkInfo{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(legacy); !errors.Is(err, ErrLegacy) {
+		t.Fatalf("legacy receipt: %v", err)
+	}
+	migrated, err := Migrate(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.From != LegacyVersion || migrated.To != version.ReceiptVersion {
+		t.Fatalf("migrated %s -> %s", migrated.From, migrated.To)
+	}
+	if err := Validate(migrated.Data); err != nil {
+		t.Fatalf("migrated receipt: %v", err)
+	}
+	var rec Receipt
+	if err := json.Unmarshal(migrated.Data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Filesystem.Reads) != 1 || len(rec.Filesystem.Writes) != 2 || rec.Filesystem.Writes[0] != "/tmp/log" {
+		t.Fatalf("filesystem = %+v", rec.Filesystem)
+	}
+}
@@ -0,0 +1,370 @@
+package receipt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"glasshouse/core/profiling"
+)
+
+// SecurityInfo summarizes privilege changes and kernel interaction attempts.
+type SecurityInfo struct {
+	IDChanges         []IDChange         `json:"id_changes,omitempty"`
+	CapabilityChanges []CapabilityChange `json:"capability_changes,omitempty"`
+	Ptrace            []PtraceCall       `json:"ptrace,omitempty"`
+	Mounts            []MountCall        `json:"mounts,omitempty"`
+	BPF               []BPFCall          `json:"bpf,omitempty"`
+	ModuleLoads       []ModuleLoad       `json:"module_loads,omitempty"`
+	MemfdCreates      []MemfdCreate      `json:"memfd_creates,omitempty"`
+	FilelessExecs     []FilelessExec     `json:"fileless_execs,omitempty"`
+	// ExecutableMemory counts mprotect calls adding PROT_EXEC per process.
+	ExecutableMemory []ExecutableMemory `json:"executable_memory,omitempty"`
+}
+
+// IDChange is a setuid/setgid family call. IDs left unchanged are omitted.
+type IDChange struct {
+	PID       uint32  `json:"pid"`
+	Syscall   string  `json:"syscall"`
+	Real      *uint32 `json:"real,omitempty"`
+	Effective *uint32 `json:"effective,omitempty"`
+	Saved     *uint32 `json:"saved,omitempty"`
+	FS        *uint32 `json:"fs,omitempty"`
+}
+
+// CapabilityChange is a capset call with the requested sets as hex masks.
+type CapabilityChange struct {
+	PID         uint32 `json:"pid"`
+	TargetPID   uint32 `json:"target_pid,omitempty"`
+	Effective   string `json:"effective"`
+	Permitted   string `json:"permitted"`
+	Inheritable string `json:"inheritable"`
+}
+
+type PtraceCall struct {
+	PID       uint32 `json:"pid"`
+	Request   string `json:"request"`
+	TargetPID uint32 `json:"target_pid"`
+}
+
+type MountCall struct {
+	PID    uint32 `json:"pid"`
+	Op     string `json:"op"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target"`
+	Flags  uint32 `json:"flags,omitempty"`
+}
+
+type BPFCall struct {
+	PID     uint32 `json:"pid"`
+	Command string `json:"command"`
+	Count   int    `json:"count"`
+}
+
+type ModuleLoad struct {
+	PID     uint32 `json:"pid"`
+	Syscall string `json:"syscall"`
+	Path    string `json:"path,omitempty"`
+	Params  string `json:"params,omitempty"`
+}
+
+type MemfdCreate struct {
+	PID   uint32 `json:"pid"`
+	Name  string `json:"name"`
+	Flags uint32 `json:"flags,omitempty"`
+}
+
+type FilelessExec struct {
+	PID  uint32 `json:"pid"`
+	Path string `json:"path"`
+}
+
+type ExecutableMemory struct {
+	PID   uint32 `json:"pid"`
+	Count int    `json:"count"`
+}
+
+// sec_event op values.
+const (
+	idOpSet    = 0
+	idOpSetRe  = 1
+	idOpSetRes = 2
+	idOpSetFS  = 3
+
+	moduleOpFinit = 1
+
+	idUnchanged = 0xffffffff
+)
+
+type idChangeKey struct {
+	pid     uint32
+	syscall string
+	args    [3]uint64
+}
+
+type countKey struct {
+	pid  uint32
+	name string
+}
+
+// securityState aggregates security events for one execution.
+type securityState struct {
+	ids       map[idChangeKey]struct{}
+	caps      map[CapabilityChange]struct{}
+	ptrace    map[PtraceCall]struct{}
+	mounts    map[MountCall]struct{}
+	bpf       map[countKey]int
+	modules   map[ModuleLoad]struct{}
+	memfds    map[MemfdCreate]struct{}
+	fileless  map[FilelessExec]struct{}
+	mprotects map[uint32]int
+}
+
+func newSecurityState() *securityState {
+	return &securityState{
+		ids:       make(map[idChangeKey]struct{}),
+		caps:      make(map[CapabilityChange]struct{}),
+		ptrace:    make(map[PtraceCall]struct{}),
+		mounts:    make(map[MountCall]struct{}),
+		bpf:       make(map[countKey]int),
+		modules:   make(map[ModuleLoad]struct{}),
+		memfds:    make(map[MemfdCreate]struct{}),
+		fileless:  make(map[FilelessExec]struct{}),
+		mprotects: make(map[uint32]int),
+	}
+}
+
+// isFilelessExecPath reports exec paths that name a file descriptor rather
+// than a file on disk.
+func isFilelessExecPath(path string) bool {
+	return strings.HasPrefix(path, "/proc/self/fd/") || strings.HasPrefix(path, "/dev/fd/") ||
+		(strings.HasPrefix(path, "/proc/") && strings.Contains(path, "/fd/"))
+}
+
+func (s *securityState) handleEvent(ev profiling.Event) {
+	switch ev.Type {
+	case profiling.EventSetUID, profiling.EventSetGID:
+		s.ids[idChangeKey{pid: ev.PID, syscall: idSyscall(ev.Type, ev.Op), args: ev.Args}] = struct{}{}
+	case profiling.EventCapset:
+		s.caps[CapabilityChange{
+			PID:         ev.PID,
+			TargetPID:   ev.Flags,
+			Effective:   hexMask(ev.Args[0]),
+			Permitted:   hexMask(ev.Args[1]),
+			Inheritable: hexMask(ev.Args[2]),
+		}] = struct{}{}
+	case profiling.EventPtrace:
+		s.ptrace[PtraceCall{PID: ev.PID, Request: ptraceRequest(ev.Flags), TargetPID: uint32(ev.Args[0])}] = struct{}{}
+	case profiling.EventMount:
+		s.mounts[MountCall{PID: ev.PID, Op: "mount", Source: ev.Target, Target: ev.Path, Flags: ev.Flags}] = struct{}{}
+	case profiling.EventUmount:
+		s.mounts[MountCall{PID: ev.PID, Op: "umount", Target: ev.Path, Flags: ev.Flags}] = struct{}{}
+	case profiling.EventBPF:
+		s.bpf[countKey{pid: ev.PID, name: bpfCommand(ev.Flags)}]++
+	case profiling.EventModuleLoad:
+		load := ModuleLoad{PID: ev.PID, Syscall: "init_module", Params: ev.Target}
+		if ev.Op == moduleOpFinit {
+			load.Syscall = "finit_module"
+			load.Path = ev.Path
+		}
+		s.modules[load] = struct{}{}
+	case profiling.EventMemfdCreate:
+		s.memfds[MemfdCreate{PID: ev.PID, Name: ev.Path, Flags: ev.Flags}] = struct{}{}
+	case profiling.EventFilelessExec:
+		s.fileless[FilelessExec{PID: ev.PID, Path: ev.Path}] = struct{}{}
+	case profiling.EventExec:
+		if isFilelessExecPath(ev.Path) {
+			s.fileless[FilelessExec{PID: ev.PID, Path: ev.Path}] = struct{}{}
+		}
+	case profiling.EventMprotectExec:
+		s.mprotects[ev.PID]++
+	}
+}
+
+// securitySyscall names the syscall behind a security event for syscall counts.
+func securitySyscall(ev profiling.Event) string {
+	switch ev.Type {
+	case profiling.EventSetUID, profiling.EventSetGID:
+		return idSyscall(ev.Type, ev.Op)
+	case profiling.EventModuleLoad:
+		if ev.Op == moduleOpFinit {
+			return "finit_module"
+		}
+		return "init_module"
+	case profiling.EventUmount:
+		return "umount2"
+	case profiling.EventFilelessExec:
+		return "execveat"
+	case profiling.EventMprotectExec:
+		return "mprotect"
+	default:
+		return ev.Type.String()
+	}
+}
+
+// info returns nil when no security events were seen.
+func (s *securityState) info() *SecurityInfo {
+	if len(s.ids)+len(s.caps)+len(s.ptrace)+len(s.mounts)+len(s.bpf)+len(s.modules)+len(s.memfds)+len(s.fileless)+len(s.mprotects) == 0 {
+		return nil
+	}
+	info := &SecurityInfo{}
+	for key := range s.ids {
+		info.IDChanges = append(info.IDChanges, idChange(key))
+	}
+	sort.Slice(info.IDChanges, func(i, j int) bool {
+		a, b := info.IDChanges[i], info.IDChanges[j]
+		if a.PID != b.PID {
+			return a.PID < b.PID
+		}
+		return a.Syscall+formatIDs(a) < b.Syscall+formatIDs(b)
+	})
+	info.CapabilityChanges = sortedByKey(s.caps, func(c CapabilityChange) string {
+		return fmt.Sprintf("%010d|%010d|%s|%s|%s", c.PID, c.TargetPID, c.Effective, c.Permitted, c.Inheritable)
+	})
+	info.Ptrace = sortedByKey(s.ptrace, func(c PtraceCall) string {
+		return fmt.Sprintf("%010d|%s|%010d", c.PID, c.Request, c.TargetPID)
+	})
+	info.Mounts = sortedByKey(s.mounts, func(c MountCall) string {
+		return fmt.Sprintf("%010d|%s|%s|%s|%d", c.PID, c.Op, c.Target, c.Source, c.Flags)
+	})
+	for key, count := range s.bpf {
+		info.BPF = append(info.BPF, BPFCall{PID: key.pid, Command: key.name, Count: count})
+	}
+	sort.Slice(info.BPF, func(i, j int) bool {
+		if info.BPF[i].PID != info.BPF[j].PID {
+			return info.BPF[i].PID < info.BPF[j].PID
+		}
+		return info.BPF[i].Command < info.BPF[j].Command
+	})
+	info.ModuleLoads = sortedByKey(s.modules, func(m ModuleLoad) string {
+		return fmt.Sprintf("%010d|%s|%s|%s", m.PID, m.Syscall, m.Path, m.Params)
+	})
+	info.MemfdCreates = sortedByKey(s.memfds, func(m MemfdCreate) string {
+		return fmt.Sprintf("%010d|%s|%d", m.PID, m.Name, m.Flags)
+	})
+	info.FilelessExecs = sortedByKey(s.fileless, func(f FilelessExec) string {
+		return fmt.Sprintf("%010d|%s", f.PID, f.Path)
+	})
+	for pid, count := range s.mprotects {
+		info.ExecutableMemory = append(info.ExecutableMemory, ExecutableMemory{PID: pid, Count: count})
+	}
+	sort.Slice(info.ExecutableMemory, func(i, j int) bool {
+		return info.ExecutableMemory[i].PID < info.ExecutableMemory[j].PID
+	})
+	return info
+}
+
+func sortedByKey[T comparable](set map[T]struct{}, key func(T) string) []T {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]T, 0, len(set))
+	for value := range set {
+		out = append(out, value)
+	}
+	sort.Slice(out, func(i, j int) bool { return key(out[i]) < key(out[j]) })
+	return out
+}
+
+func idSyscall(t profiling.EventType, op uint32) string {
+	kind := "uid"
+	if t == profiling.EventSetGID {
+		kind = "gid"
+	}
+	switch op {
+	case idOpSetRe:
+		return "setre" + kind
+	case idOpSetRes:
+		return "setres" + kind
+	case idOpSetFS:
+		return "setfs" + kind
+	default:
+		return "set" + kind
+	}
+}
+
+func idChange(key idChangeKey) IDChange {
+	change := IDChange{PID: key.pid, Syscall: key.syscall}
+	id := func(v uint64) *uint32 {
+		if uint32(v) == idUnchanged {
+			return nil
+		}
+		value := uint32(v)
+		return &value
+	}
+	change.Real = id(key.args[0])
+	change.Effective = id(key.args[1])
+	if strings.HasPrefix(key.syscall, "setfs") {
+		change.FS = id(key.args[2])
+	} else {
+		change.Saved = id(key.args[2])
+	}
+	return change
+}
+
+func formatIDs(c IDChange) string {
+	parts := make([]string, 0, 4)
+	for _, v := range []*uint32{c.Real, c.Effective, c.Saved, c.FS} {
+		if v == nil {
+			parts = append(parts, "-")
+			continue
+		}
+		parts = append(parts, strconv.FormatUint(uint64(*v), 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+func hexMask(v uint64) string {
+	return "0x" + strconv.FormatUint(v, 16)
+}
+
+var ptraceRequests = map[uint32]string{
+	0:      "PTRACE_TRACEME",
+	1:      "PTRACE_PEEKTEXT",
+	2:      "PTRACE_PEEKDATA",
+	3:      "PTRACE_PEEKUSER",
+	4:      "PTRACE_POKETEXT",
+	5:      "PTRACE_POKEDATA",
+	6:      "PTRACE_POKEUSER",
+	7:      "PTRACE_CONT",
+	8:      "PTRACE_KILL",
+	9:      "PTRACE_SINGLESTEP",
+	12:     "PTRACE_GETREGS",
+	13:     "PTRACE_SETREGS",
+	16:     "PTRACE_ATTACH",
+	17:     "PTRACE_DETACH",
+	24:     "PTRACE_SYSCALL",
+	0x4200: "PTRACE_SETOPTIONS",
+	0x4201: "PTRACE_GETEVENTMSG",
+	0x4204: "PTRACE_GETREGSET",
+	0x4205: "PTRACE_SETREGSET",
+	0x4206: "PTRACE_SEIZE",
+	0x4207: "PTRACE_INTERRUPT",
+}
+
+func ptraceRequest(req uint32) string {
+	if name, ok := ptraceRequests[req]; ok {
+		return name
+	}
+	return "PTRACE_" + strconv.FormatUint(uint64(req), 10)
+}
+
+var bpfCommands = []string{
+	"BPF_MAP_CREATE", "BPF_MAP_LOOKUP_ELEM", "BPF_MAP_UPDATE_ELEM", "BPF_MAP_DELETE_ELEM",
+	"BPF_MAP_GET_NEXT_KEY", "BPF_PROG_LOAD", "BPF_OBJ_PIN", "BPF_OBJ_GET",
+	"BPF_PROG_ATTACH", "BPF_PROG_DETACH", "BPF_PROG_TEST_RUN", "BPF_PROG_GET_NEXT_ID",
+	"BPF_MAP_GET_NEXT_ID", "BPF_PROG_GET_FD_BY_ID", "BPF_MAP_GET_FD_BY_ID", "BPF_OBJ_GET_INFO_BY_FD",
+	"BPF_PROG_QUERY", "BPF_RAW_TRACEPOINT_OPEN", "BPF_BTF_LOAD", "BPF_BTF_GET_FD_BY_ID",
+	"BPF_TASK_FD_QUERY", "BPF_MAP_LOOKUP_AND_DELETE_ELEM", "BPF_MAP_FREEZE", "BPF_BTF_GET_NEXT_ID",
+	"BPF_MAP_LOOKUP_BATCH", "BPF_MAP_LOOKUP_AND_DELETE_BATCH", "BPF_MAP_UPDATE_BATCH", "BPF_MAP_DELETE_BATCH",
+	"BPF_LINK_CREATE", "BPF_LINK_UPDATE", "BPF_LINK_GET_FD_BY_ID", "BPF_LINK_GET_NEXT_ID",
+	"BPF_ENABLE_STATS", "BPF_ITER_CREATE", "BPF_LINK_DETACH", "BPF_PROG_BIND_MAP",
+}
+
+func bpfCommand(cmd uint32) string {
+	if int(cmd) < len(bpfCommands) {
+		return bpfCommands[cmd]
+	}
+	return "BPF_" + strconv.FormatUint(uint64(cmd), 10)
+}
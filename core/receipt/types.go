@@ -1,5 +1,7 @@
 package receipt
 
+import "glasshouse/core/signing"
+
 // Receipt is a deterministic, versioned artifact emitted when profiling is enabled.
 type Receipt struct {
 	Version     string `json:"version"`
@@ -9,23 +11,35 @@ type Receipt struct {
 	StartTime   string `json:"start_time,omitempty"`
 	EndTime     string `json:"end_time,omitempty"`
 	// ObservationMode is guest|host|host+guest depending on the attachment scope.
-	ObservationMode string          `json:"observation_mode,omitempty"`
-	Completeness    string          `json:"completeness,omitempty"`
-	Outcome         *Outcome        `json:"outcome,omitempty"`
-	Timing          *Timing         `json:"timing,omitempty"`
-	ProcessTree     []ProcessV2     `json:"process_tree,omitempty"`
-	Syscalls        *SyscallInfo    `json:"syscalls,omitempty"`
-	Environment     *Environment    `json:"environment,omitempty"`
-	Execution       *ExecutionInfo  `json:"execution,omitempty"`
-	Artifacts       *Artifacts      `json:"artifacts,omitempty"`
-	ExitCode        int             `json:"exit_code"`
-	DurationMs      int64           `json:"duration_ms"`
-	Processes       []ProcessEntry  `json:"processes"`
-	Filesystem      *FilesystemInfo `json:"filesystem"`
-	Network         *NetworkInfo    `json:"network"`
-	Resources       *Resources      `json:"resources,omitempty"`
-	Redactions      []string        `json:"redactions,omitempty"`
-	Policy          *PolicyInfo     `json:"policy,omitempty"`
+	ObservationMode string `json:"observation_mode,omitempty"`
+	// ObservationMechanism is how events were captured: ebpf or ptrace.
+	ObservationMechanism string `json:"observation_mechanism,omitempty"`
+	Completeness         string `json:"completeness,omitempty"`
+	// Drops counts events lost before reaching the aggregator, by event type.
+	Drops       map[string]uint64 `json:"drops,omitempty"`
+	Outcome     *Outcome          `json:"outcome,omitempty"`
+	Timing      *Timing           `json:"timing,omitempty"`
+	ProcessTree []ProcessV2       `json:"process_tree,omitempty"`
+	Syscalls    *SyscallInfo      `json:"syscalls,omitempty"`
+	Environment *Environment      `json:"environment,omitempty"`
+	Execution   *ExecutionInfo    `json:"execution,omitempty"`
+	Artifacts   *Artifacts        `json:"artifacts,omitempty"`
+	ExitCode    int               `json:"exit_code"`
+	DurationMs  int64             `json:"duration_ms"`
+	Processes   []ProcessEntry    `json:"processes"`
+	Filesystem  *FilesystemInfo   `json:"filesystem"`
+	// Files holds content hashes of filesystem paths when file hashing is
+	// enabled.
+	Files      map[string]FileHashes `json:"files,omitempty"`
+	Network    *NetworkInfo          `json:"network"`
+	Security   *SecurityInfo         `json:"security,omitempty"`
+	Timeline   *Timeline             `json:"timeline,omitempty"`
+	Resources  *Resources            `json:"resources,omitempty"`
+	Redactions []string              `json:"redactions,omitempty"`
+	Policy     *PolicyInfo           `json:"policy,omitempty"`
+	// Signature is added when the receipt is emitted with a signing key and
+	// covers every other field.
+	Signature *signing.Envelope `json:"signature,omitempty"`
 }
 
 type ProcessEntry struct {
@@ -35,23 +49,76 @@ type ProcessEntry struct {
 }
 
 type FilesystemInfo struct {
-	Reads            []string `json:"reads"`
-	Writes           []string `json:"writes"`
-	Deletes          []string `json:"deletes"`
+	Reads   []string `json:"reads"`
+	Writes  []string `json:"writes"`
+	Deletes []string `json:"deletes"`
+	// Outputs lists the written files, and the rename targets of written
+	// files, that were not deleted or renamed away later. Unlike the other
+	// lists it depends on the order of operations.
+	Outputs           []string           `json:"outputs,omitempty"`
+	Renames           []Rename           `json:"renames,omitempty"`
+	Mkdirs            []string           `json:"mkdirs,omitempty"`
+	PermissionChanges []PermissionChange `json:"permission_changes,omitempty"`
+	// TruncatedPaths lists recorded paths that hit the capture limit.
+	TruncatedPaths   []string `json:"truncated_paths,omitempty"`
 	PolicyViolations []string `json:"policy_violations"`
 }
 
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PermissionChange records a chmod (Mode) or chown (UID/GID, omitted when unchanged).
+type PermissionChange struct {
+	Path string  `json:"path"`
+	Op   string  `json:"op"`
+	Mode string  `json:"mode,omitempty"`
+	UID  *uint32 `json:"uid,omitempty"`
+	GID  *uint32 `json:"gid,omitempty"`
+}
+
 type NetworkInfo struct {
 	Connections   []Connection     `json:"connections,omitempty"`
 	Attempts      []NetworkAttempt `json:"attempts"`
+	Listeners     []Listener       `json:"listeners,omitempty"`
+	Inbound       []Inbound        `json:"inbound,omitempty"`
+	DNS           []DNSQuery       `json:"dns,omitempty"`
 	BytesSent     int64            `json:"bytes_sent"`
 	BytesReceived int64            `json:"bytes_received"`
 }
 
 type Connection struct {
-	Dst       string `json:"dst"`
-	Protocol  string `json:"protocol,omitempty"`
-	Attempted bool   `json:"attempted"`
+	Dst           string `json:"dst"`
+	Hostname      string `json:"hostname,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+	Attempted     bool   `json:"attempted"`
+	BytesSent     int64  `json:"bytes_sent,omitempty"`
+	BytesReceived int64  `json:"bytes_received,omitempty"`
+}
+
+// Listener is a local address the execution accepted traffic on.
+type Listener struct {
+	Addr     string `json:"addr"`
+	Protocol string `json:"protocol"`
+}
+
+// Inbound is a connection accepted on one of the execution's listeners.
+type Inbound struct {
+	Src           string `json:"src"`
+	LocalPort     uint16 `json:"local_port"`
+	Protocol      string `json:"protocol"`
+	BytesSent     int64  `json:"bytes_sent,omitempty"`
+	BytesReceived int64  `json:"bytes_received,omitempty"`
+}
+
+// DNSQuery is a lookup observed on the wire, with answers from the response
+// when one was captured.
+type DNSQuery struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Server  string   `json:"server"`
+	Answers []string `json:"answers,omitempty"`
 }
 
 type Resources struct {
@@ -60,9 +127,32 @@ type Resources struct {
 }
 
 type Outcome struct {
-	ExitCode int     `json:"exit_code"`
-	Signal   *string `json:"signal"`
-	Error    *string `json:"error"`
+	ExitCode    int          `json:"exit_code"`
+	Signal      *string      `json:"signal"`
+	Error       *string      `json:"error"`
+	Termination *Termination `json:"termination,omitempty"`
+	// Crashes lists descendant processes terminated by a signal.
+	Crashes []ProcessCrash `json:"crashes,omitempty"`
+}
+
+// ProcessCrash identifies a descendant process that was killed by a signal.
+type ProcessCrash struct {
+	PID        uint32 `json:"pid"`
+	PPID       uint32 `json:"ppid"`
+	Exe        string `json:"exe"`
+	Signal     string `json:"signal"`
+	CoreDumped bool   `json:"core_dumped,omitempty"`
+}
+
+// Termination records how an execution was stopped after its context ended.
+type Termination struct {
+	Reason string `json:"reason"`
+	// Method is graceful (exited after SIGTERM), forced (killed) or abandoned
+	// (still running after the kill grace period).
+	Method string `json:"method"`
+	// Signals lists what was delivered, in order; SIGTERM is left out when
+	// the backend could not signal the workload.
+	Signals []string `json:"signals"`
 }
 
 type Timing struct {
@@ -76,6 +166,11 @@ type ProcessV2 struct {
 	Exe        string   `json:"exe"`
 	Argv       []string `json:"argv"`
 	WorkingDir string   `json:"working_dir"`
+	StartTime  string   `json:"start_time,omitempty"`
+	EndTime    string   `json:"end_time,omitempty"`
+	ExitCode   *int     `json:"exit_code,omitempty"`
+	Signal     string   `json:"signal,omitempty"`
+	CoreDumped bool     `json:"core_dumped,omitempty"`
 }
 
 type NetworkAttempt struct {
@@ -109,6 +204,8 @@ type Sandbox struct {
 type Artifacts struct {
 	StdoutHash string `json:"stdout_hash"`
 	StderrHash string `json:"stderr_hash"`
+	// StdinHash is only set when the execution consumed stdin.
+	StdinHash string `json:"stdin_hash,omitempty"`
 }
 
 // PolicyInfo captures policy violations and enforcement decisions.
@@ -132,3 +229,19 @@ type PolicyEnforcement struct {
 	Rule    string `json:"rule,omitempty"`
 	Message string `json:"message,omitempty"`
 }
+
+// Timeline lists events in the order they happened, with offsets from the
+// execution start. It is capped; Dropped counts events past the cap.
+type Timeline struct {
+	Events  []TimelineEvent `json:"events"`
+	Dropped int             `json:"dropped,omitempty"`
+}
+
+type TimelineEvent struct {
+	OffsetNs int64  `json:"offset_ns"`
+	Type     string `json:"type"`
+	PID      uint32 `json:"pid"`
+	Path     string `json:"path,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Addr     string `json:"addr,omitempty"`
+}
@@ -0,0 +1,234 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every way a document departs from its schema.
+type ValidationError struct {
+	Version  string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("receipt %s: %s", e.Version, strings.Join(e.Problems, "; "))
+}
+
+// ErrLegacy is returned by Validate for receipts that predate versioned
+// schemas; Migrate upgrades them.
+var ErrLegacy = errors.New("legacy receipt without a schema version (migrate it first)")
+
+// Validate checks a receipt document against the published schema for the
+// version it declares. Problems are reported as *ValidationError with JSON
+// pointer locations.
+func Validate(data []byte) error {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return err
+	}
+	v := documentVersion(doc)
+	if v == LegacyVersion {
+		return ErrLegacy
+	}
+	raw, err := Schema(v)
+	if err != nil {
+		return err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return fmt.Errorf("schema %s: %w", v, err)
+	}
+	c := schemaCheck{defs: asObject(schema["$defs"])}
+	c.check(schema, doc, "")
+	if len(c.problems) > 0 {
+		return &ValidationError{Version: v, Problems: c.problems}
+	}
+	return nil
+}
+
+func decodeDocument(data []byte) (map[string]any, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode receipt: %w", err)
+	}
+	if doc == nil {
+		return nil, errors.New("decode receipt: not a JSON object")
+	}
+	return doc, nil
+}
+
+// schemaCheck evaluates the JSON Schema subset GenerateSchema emits:
+// type, properties, required, additionalProperties, items, anyOf, minimum
+// and local $refs.
+type schemaCheck struct {
+	defs     map[string]any
+	problems []string
+}
+
+func (c *schemaCheck) fail(path, format string, args ...any) {
+	if path == "" {
+		path = "/"
+	}
+	c.problems = append(c.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *schemaCheck) check(schema map[string]any, value any, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := asObject(c.defs[strings.TrimPrefix(ref, "#/$defs/")])
+		if def == nil {
+			c.fail(path, "unknown schema reference %s", ref)
+			return
+		}
+		c.check(def, value, path)
+		return
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, option := range anyOf {
+			trial := schemaCheck{defs: c.defs}
+			trial.check(asObject(option), value, path)
+			if len(trial.problems) == 0 {
+				return
+			}
+		}
+		// Report against the first non-null alternative, which is the
+		// informative one for nullable fields.
+		if value != nil && len(anyOf) > 0 {
+			c.check(asObject(anyOf[0]), value, path)
+		} else {
+			c.fail(path, "matches no allowed schema")
+		}
+		return
+	}
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		c.fail(path, "want %s, got %s", typeNames(types), jsonType(value))
+		return
+	}
+	if min, ok := schema["minimum"].(float64); ok {
+		if n, isNum := value.(json.Number); isNum {
+			if f, err := n.Float64(); err == nil && f < min {
+				c.fail(path, "%s is below the minimum %v", n, min)
+			}
+		}
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		c.checkObject(schema, v, path)
+	case []any:
+		if items := asObject(schema["items"]); items != nil {
+			for i, item := range v {
+				c.check(items, item, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	}
+}
+
+func (c *schemaCheck) checkObject(schema map[string]any, obj map[string]any, path string) {
+	properties := asObject(schema["properties"])
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if key, _ := name.(string); key != "" {
+				if _, present := obj[key]; !present {
+					c.fail(path, "missing required field %q", key)
+				}
+			}
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child := path + "/" + escapePointer(key)
+		if prop := asObject(properties[key]); prop != nil {
+			c.check(prop, obj[key], child)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				c.fail(child, "unknown field")
+			}
+		case map[string]any:
+			c.check(extra, obj[key], child)
+		}
+	}
+}
+
+func matchesType(types any, value any) bool {
+	switch t := types.(type) {
+	case string:
+		return typeMatches(t, value)
+	case []any:
+		for _, name := range t {
+			if s, _ := name.(string); typeMatches(s, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeMatches(name string, value any) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		if err != nil {
+			_, err = fmt.Sscan(n.String(), new(uint64))
+		}
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	}
+	return jsonType(value) == name
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeNames(types any) string {
+	if list, ok := types.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+func asObject(v any) map[string]any {
+	obj, _ := v.(map[string]any)
+	return obj
+}
+
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
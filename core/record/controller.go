@@ -0,0 +1,54 @@
+package record
+
+import (
+	"context"
+
+	"glasshouse/core/profiling"
+)
+
+// Controller replays a recording's events as a profiling session.
+type Controller struct {
+	rec *Recording
+}
+
+func NewController(rec *Recording) *Controller {
+	return &Controller{rec: rec}
+}
+
+// Capabilities reports the mechanism the events were recorded with.
+func (c *Controller) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{
+		Host:      true,
+		Guest:     true,
+		Combined:  true,
+		Mechanism: c.rec.Trailer.ObservationMechanism,
+	}
+}
+
+// Start returns a session holding every recorded event; it is drained
+// rather than closed early.
+func (c *Controller) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	_ = ctx
+	_ = target
+	s := &session{
+		events: make(chan profiling.Event, len(c.rec.Events)),
+		errs:   make(chan error),
+	}
+	for _, ev := range c.rec.Events {
+		s.events <- ev
+	}
+	close(s.events)
+	close(s.errs)
+	return s, nil
+}
+
+type session struct {
+	events chan profiling.Event
+	errs   chan error
+}
+
+func (s *session) Events() <-chan profiling.Event { return s.events }
+func (s *session) Errors() <-chan error           { return s.errs }
+func (s *session) Close() error                   { return nil }
+
+var _ profiling.Controller = (*Controller)(nil)
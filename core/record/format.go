@@ -0,0 +1,178 @@
+// Package record captures the profiling events and metadata of an execution
+// so its receipt and policy verdict can be rebuilt offline.
+//
+// A recording starts with an 8-byte preamble: the magic "GHREC", a zero byte
+// and the big-endian format version. Frames follow, each a big-endian uint32
+// length and a JSON object holding one of header, event or trailer. The
+// header comes first and the trailer last; a recording without a trailer was
+// cut short and cannot be replayed.
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+const (
+	Magic   = "GHREC"
+	Version = 1
+
+	preambleSize = 8
+	// maxFrameSize bounds a single frame so a corrupt length cannot exhaust
+	// memory.
+	maxFrameSize = 16 << 20
+)
+
+// Header describes the execution request and its identity.
+type Header struct {
+	Args        []string          `json:"args"`
+	Workdir     string            `json:"workdir,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Profiling   profiling.Mode    `json:"profiling"`
+	Timeline    int               `json:"timeline,omitempty"`
+	ReceiptMask []string          `json:"receipt_mask,omitempty"`
+	HandleID    string            `json:"handle_id,omitempty"`
+	RootPID     int               `json:"root_pid"`
+	CgroupPath  string            `json:"cgroup_path,omitempty"`
+}
+
+// Trailer holds what the receipt recorded about the execution apart from
+// its events.
+type Trailer struct {
+	StartedAt            time.Time              `json:"started_at"`
+	CompletedAt          time.Time              `json:"completed_at"`
+	ExitCode             int                    `json:"exit_code"`
+	ExecutionID          string                 `json:"execution_id"`
+	Outcome              *receipt.Outcome       `json:"outcome,omitempty"`
+	Resources            *receipt.Resources     `json:"resources,omitempty"`
+	Execution            *receipt.ExecutionInfo `json:"execution,omitempty"`
+	Artifacts            *receipt.Artifacts     `json:"artifacts,omitempty"`
+	Environment          *receipt.Environment   `json:"environment,omitempty"`
+	Provenance           string                 `json:"provenance,omitempty"`
+	ObservationMode      string                 `json:"observation_mode,omitempty"`
+	ObservationMechanism string                 `json:"observation_mechanism,omitempty"`
+	Drops                map[string]uint64      `json:"drops,omitempty"`
+	// Files are the content hashes taken during the run; a replay cannot
+	// take them again.
+	Files map[string]receipt.FileHashes `json:"files,omitempty"`
+}
+
+type frame struct {
+	Header  *Header          `json:"header,omitempty"`
+	Event   *profiling.Event `json:"event,omitempty"`
+	Trailer *Trailer         `json:"trailer,omitempty"`
+}
+
+// Recording is a fully read recording.
+type Recording struct {
+	Header  Header
+	Events  []profiling.Event
+	Trailer Trailer
+}
+
+// Writer appends frames to a recording.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes the preamble and returns a Writer for the frames.
+func NewWriter(w io.Writer) (*Writer, error) {
+	preamble := make([]byte, preambleSize)
+	copy(preamble, Magic)
+	binary.BigEndian.PutUint16(preamble[6:], Version)
+	if _, err := w.Write(preamble); err != nil {
+		return nil, fmt.Errorf("write recording preamble: %w", err)
+	}
+	return &Writer{w: w}, nil
+}
+
+func (w *Writer) WriteHeader(h Header) error          { return w.write(frame{Header: &h}) }
+func (w *Writer) WriteEvent(ev profiling.Event) error { return w.write(frame{Event: &ev}) }
+func (w *Writer) WriteTrailer(t Trailer) error        { return w.write(frame{Trailer: &t}) }
+
+func (w *Writer) write(f frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("encode recording frame: %w", err)
+	}
+	w.buf = binary.BigEndian.AppendUint32(w.buf[:0], uint32(len(data)))
+	w.buf = append(w.buf, data...)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return fmt.Errorf("write recording frame: %w", err)
+	}
+	return nil
+}
+
+// Read parses a complete recording.
+func Read(r io.Reader) (*Recording, error) {
+	br := bufio.NewReader(r)
+	preamble := make([]byte, preambleSize)
+	if _, err := io.ReadFull(br, preamble); err != nil {
+		return nil, fmt.Errorf("read recording preamble: %w", err)
+	}
+	if string(preamble[:len(Magic)]) != Magic || preamble[5] != 0 {
+		return nil, errors.New("not a glasshouse recording")
+	}
+	if v := binary.BigEndian.Uint16(preamble[6:]); v != Version {
+		return nil, fmt.Errorf("unsupported recording version %d (want %d)", v, Version)
+	}
+
+	rec := &Recording{}
+	var sawHeader, sawTrailer bool
+	lenBuf := make([]byte, 4)
+	for n := 0; ; n++ {
+		if _, err := io.ReadFull(br, lenBuf); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("read frame %d: %w", n, err)
+		}
+		size := binary.BigEndian.Uint32(lenBuf)
+		if size > maxFrameSize {
+			return nil, fmt.Errorf("frame %d: length %d exceeds %d", n, size, maxFrameSize)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("read frame %d: %w", n, err)
+		}
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("decode frame %d: %w", n, err)
+		}
+		switch {
+		case sawTrailer:
+			return nil, fmt.Errorf("frame %d follows the trailer", n)
+		case f.Header != nil:
+			if sawHeader {
+				return nil, fmt.Errorf("frame %d: duplicate header", n)
+			}
+			sawHeader = true
+			rec.Header = *f.Header
+		case !sawHeader:
+			return nil, fmt.Errorf("frame %d precedes the header", n)
+		case f.Event != nil:
+			rec.Events = append(rec.Events, *f.Event)
+		case f.Trailer != nil:
+			sawTrailer = true
+			rec.Trailer = *f.Trailer
+		default:
+			return nil, fmt.Errorf("frame %d: empty frame", n)
+		}
+	}
+	if !sawHeader {
+		return nil, errors.New("recording has no header")
+	}
+	if !sawTrailer {
+		return nil, errors.New("recording has no trailer; the execution did not finish recording")
+	}
+	return rec, nil
+}
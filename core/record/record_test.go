@@ -0,0 +1,98 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glasshouse/backend/fake"
+	"glasshouse/core/execution"
+	"glasshouse/core/policy"
+	"glasshouse/core/profiling"
+)
+
+type eventProfiler struct{ events []profiling.Event }
+
+func (p eventProfiler) Capabilities() profiling.Capabilities {
+	return profiling.Capabilities{Host: true, Mechanism: profiling.MechanismEBPF}
+}
+
+func (p eventProfiler) Start(ctx context.Context, target profiling.Target) (profiling.Session, error) {
+	return NewController(&Recording{Events: p.events}).Start(ctx, target)
+}
+
+func TestReplayRebuildsRecordedReceipt(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	input := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(input, []byte("a,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	events := []profiling.Event{
+		{Type: profiling.EventExec, PID: 4242, Comm: "sh", Path: "/bin/sh", Timestamp: base},
+		{Type: profiling.EventOpen, PID: 4242, Comm: "sh", Path: input, Timestamp: base},
+		{Type: profiling.EventFork, PID: 4243, PPID: 4242, Comm: "sh", Timestamp: base.Add(time.Millisecond)},
+		{Type: profiling.EventMkdir, PID: 4243, PPID: 4242, Path: "/tmp/out", Timestamp: base.Add(2 * time.Millisecond)},
+		{Type: profiling.EventExit, PID: 4243, PPID: 4242, Timestamp: base.Add(3 * time.Millisecond)},
+	}
+	p, err := policy.Parse([]byte(`{"runtime": [{"name": "no-mkdir", "deny_events": ["mkdir"]}]}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+
+	var buf bytes.Buffer
+	recorder, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatalf("recorder: %v", err)
+	}
+	engine := execution.Engine{
+		Backend:   fake.New(0),
+		Profiler:  eventProfiler{events: events},
+		Observers: []execution.Observer{recorder},
+		Policy:    &p,
+	}
+	spec := execution.ExecutionSpec{Args: []string{"sh", "-c", "mkdir /tmp/out"}, Profiling: profiling.ProfilingHost, Timeline: 10, HashFiles: true}
+	original, err := engine.Run(context.Background(), spec)
+	if err != nil || original.Receipt == nil {
+		t.Fatalf("run: %v", err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if original.Receipt.Files[input].Read == nil {
+		t.Fatalf("files = %+v", original.Receipt.Files)
+	}
+
+	rec, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(rec.Events) != len(events) {
+		t.Fatalf("recorded %d events, want %d", len(rec.Events), len(events))
+	}
+	replayed, err := execution.Engine{Profiler: NewController(rec), Policy: &p}.Replay(context.Background(), rec.Replay())
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	want, _ := json.Marshal(original.Receipt)
+	got, _ := json.Marshal(replayed.Receipt)
+	if !bytes.Equal(want, got) {
+		t.Fatalf("replayed receipt differs:\nwant %s\ngot  %s", want, got)
+	}
+	if replayed.Verdict == nil || replayed.Verdict.Allowed || replayed.Verdict.Reasons[0] != "no-mkdir" {
+		t.Fatalf("unexpected verdict %+v", replayed.Verdict)
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatal("expected truncated recording to be rejected")
+	}
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[7] = Version + 1
+	if _, err := Read(bytes.NewReader(corrupt)); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package record
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"glasshouse/core/execution"
+	"glasshouse/core/identity"
+	"glasshouse/core/profiling"
+	"glasshouse/core/receipt"
+)
+
+// Recorder is an engine observer that tees the profiling session's events
+// to a recording. The trailer is written once the receipt is built, so runs
+// without profiling produce a recording that cannot be replayed.
+type Recorder struct {
+	execution.NopObserver
+
+	mu     sync.Mutex
+	w      *Writer
+	header Header
+	result execution.ExecutionResult
+	err    error
+}
+
+// NewRecorder writes the recording preamble to w.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	rw, err := NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{w: rw}, nil
+}
+
+// Err returns the first write error.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) OnPrepared(ctx context.Context, spec execution.ExecutionSpec) error {
+	_ = ctx
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.header = Header{
+		Args:        spec.Args,
+		Workdir:     spec.Workdir,
+		Labels:      spec.Labels,
+		Profiling:   spec.Profiling,
+		Timeline:    spec.Timeline,
+		ReceiptMask: spec.ReceiptMask,
+	}
+	return nil
+}
+
+func (r *Recorder) OnStarted(ctx context.Context, h execution.ExecutionHandle, id execution.ExecutionIdentity) {
+	_ = ctx
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.header.HandleID = h.ID
+	r.header.RootPID = id.RootPID
+	r.header.CgroupPath = id.CgroupPath
+	r.record(r.w.WriteHeader(r.header))
+}
+
+func (r *Recorder) OnEvent(ctx context.Context, ev profiling.Event) {
+	_ = ctx
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(r.w.WriteEvent(ev))
+}
+
+func (r *Recorder) OnExit(ctx context.Context, result execution.ExecutionResult) {
+	_ = ctx
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result = result
+}
+
+func (r *Recorder) OnReceipt(ctx context.Context, rec *receipt.Receipt) {
+	_ = ctx
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(r.w.WriteTrailer(Trailer{
+		StartedAt:            r.result.StartedAt,
+		CompletedAt:          r.result.CompletedAt,
+		ExitCode:             r.result.ExitCode,
+		ExecutionID:          rec.ExecutionID,
+		Outcome:              rec.Outcome,
+		Resources:            rec.Resources,
+		Execution:            rec.Execution,
+		Artifacts:            rec.Artifacts,
+		Environment:          rec.Environment,
+		Provenance:           rec.Provenance,
+		ObservationMode:      rec.ObservationMode,
+		ObservationMechanism: rec.ObservationMechanism,
+		Drops:                rec.Drops,
+		Files:                rec.Files,
+	}))
+}
+
+func (r *Recorder) record(err error) {
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Replay converts the recording into the input of execution.Engine.Replay.
+func (rec *Recording) Replay() execution.Replay {
+	h, t := rec.Header, rec.Trailer
+	var rootStart uint64
+	if id, err := identity.ParseExecutionID(t.ExecutionID); err == nil {
+		rootStart = id.RootStartTime
+	}
+	meta := receipt.Meta{
+		ExecutionID:          t.ExecutionID,
+		Provenance:           t.Provenance,
+		ObservationMode:      t.ObservationMode,
+		ObservationMechanism: t.ObservationMechanism,
+		Outcome:              t.Outcome,
+		Environment:          t.Environment,
+		Files:                t.Files,
+	}
+	if t.Resources != nil {
+		meta.Resources = *t.Resources
+	}
+	if t.Execution != nil {
+		meta.Backend = *t.Execution
+	}
+	if t.Artifacts != nil {
+		meta.StdoutHash = t.Artifacts.StdoutHash
+		meta.StderrHash = t.Artifacts.StderrHash
+		meta.StdinHash = t.Artifacts.StdinHash
+	}
+	var drops map[profiling.EventType]uint64
+	for name, n := range t.Drops {
+		if typ, ok := profiling.ParseEventType(name); ok {
+			if drops == nil {
+				drops = make(map[profiling.EventType]uint64)
+			}
+			drops[typ] = n
+		}
+	}
+	return execution.Replay{
+		Spec: execution.ExecutionSpec{
+			Args:        h.Args,
+			Workdir:     h.Workdir,
+			Labels:      h.Labels,
+			Profiling:   h.Profiling,
+			Timeline:    h.Timeline,
+			ReceiptMask: h.ReceiptMask,
+		},
+		Handle:        execution.ExecutionHandle{ID: h.HandleID},
+		Identity:      execution.ExecutionIdentity{RootPID: h.RootPID, CgroupPath: h.CgroupPath},
+		RootStartTime: rootStart,
+		StartedAt:     t.StartedAt,
+		CompletedAt:   t.CompletedAt,
+		ExitCode:      t.ExitCode,
+		Meta:          meta,
+		Drops:         drops,
+	}
+}
+
+var _ execution.Observer = (*Recorder)(nil)
@@ -0,0 +1,276 @@
+// Package signing signs receipts with Ed25519 and verifies them.
+//
+// A signature covers the canonical JSON of the receipt without its
+// "signature" member, bound to the signing key ID and time through the DSSE
+// pre-authentication encoding. The envelope is detached: the payload is
+// rebuilt from the receipt it is stored in rather than embedded.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// PayloadType identifies signed glasshouse receipts in the DSSE encoding.
+const PayloadType = "application/vnd.glasshouse.receipt+json"
+
+// Field is the receipt member that holds the Envelope and is excluded from
+// the signed payload.
+const Field = "signature"
+
+// Envelope is a detached DSSE-style envelope.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is one signer's signature. Sig is base64 encoded in JSON.
+type Signature struct {
+	KeyID    string    `json:"keyid"`
+	SignedAt time.Time `json:"signed_at"`
+	Sig      []byte    `json:"sig"`
+}
+
+// Signer signs receipts with one Ed25519 key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+	now   func() time.Time
+}
+
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey)), now: time.Now}
+}
+
+// LoadSigner reads a PEM encoded PKCS#8 Ed25519 private key, as written by
+// `openssl genpkey -algorithm ed25519`.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return NewSigner(edKey), nil
+}
+
+// KeyID returns the ID of the signer's public key.
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign returns an envelope for receipt, which must encode to a JSON object.
+// Any existing signature member is ignored.
+func (s *Signer) Sign(receipt any) (*Envelope, error) {
+	obj, err := toObject(receipt)
+	if err != nil {
+		return nil, err
+	}
+	sig := Signature{KeyID: s.keyID, SignedAt: s.now().UTC()}
+	payload, err := statement(obj, sig)
+	if err != nil {
+		return nil, err
+	}
+	sig.Sig = s.SignPayload(PayloadType, payload).Sig
+	return &Envelope{PayloadType: PayloadType, Signatures: []Signature{sig}}, nil
+}
+
+// SignPayload signs the DSSE encoding of an arbitrary payload, for other
+// signed glasshouse documents such as log tree heads.
+func (s *Signer) SignPayload(payloadType string, payload []byte) Signature {
+	return Signature{
+		KeyID:    s.keyID,
+		SignedAt: s.now().UTC(),
+		Sig:      ed25519.Sign(s.key, pae(payloadType, payload)),
+	}
+}
+
+// VerifyPayload checks a signature made by SignPayload.
+func VerifyPayload(pub ed25519.PublicKey, payloadType string, payload []byte, sig Signature) error {
+	if sig.KeyID != KeyID(pub) {
+		return ErrNoKey
+	}
+	if !ed25519.Verify(pub, pae(payloadType, payload), sig.Sig) {
+		return fmt.Errorf("signature by %s does not match", sig.KeyID)
+	}
+	return nil
+}
+
+// KeyID identifies a public key by the SHA-256 of its PKIX encoding.
+func KeyID(pub ed25519.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadPublicKey reads a PEM encoded PKIX Ed25519 public key.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: not a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// GenerateKey returns a new key pair PEM encoded for LoadSigner and
+// LoadPublicKey.
+func GenerateKey() (private, public []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+var (
+	ErrUnsigned = errors.New("receipt is not signed")
+	ErrNoKey    = errors.New("no signature from this key")
+)
+
+// Verify checks the signature in a receipt's JSON against pub and returns
+// the matching signature.
+func Verify(data []byte, pub ed25519.PublicKey) (Signature, error) {
+	var obj map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return Signature{}, fmt.Errorf("decode receipt: %w", err)
+	}
+	raw, ok := obj[Field]
+	if !ok {
+		return Signature{}, ErrUnsigned
+	}
+	delete(obj, Field)
+	envData, err := json.Marshal(raw)
+	if err != nil {
+		return Signature{}, err
+	}
+	var env Envelope
+	if err := json.Unmarshal(envData, &env); err != nil {
+		return Signature{}, fmt.Errorf("decode signature: %w", err)
+	}
+	if env.PayloadType != PayloadType {
+		return Signature{}, fmt.Errorf("unexpected payload type %q", env.PayloadType)
+	}
+	keyID := KeyID(pub)
+	for _, sig := range env.Signatures {
+		if sig.KeyID != keyID {
+			continue
+		}
+		payload, err := statement(obj, sig)
+		if err != nil {
+			return Signature{}, err
+		}
+		if !ed25519.Verify(pub, pae(env.PayloadType, payload), sig.Sig) {
+			return sig, fmt.Errorf("signature by %s does not match the receipt", keyID)
+		}
+		return sig, nil
+	}
+	return Signature{}, ErrNoKey
+}
+
+// Canonical encodes v as JSON with object keys sorted, no insignificant
+// whitespace and no HTML escaping. Numbers keep the literal form of v's
+// JSON encoding, so canonicalizing a decoded copy gives the same bytes.
+func Canonical(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func toObject(receipt any) (map[string]any, error) {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("marshal receipt: %w", err)
+	}
+	var obj map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("receipt is not a JSON object: %w", err)
+	}
+	delete(obj, Field)
+	return obj, nil
+}
+
+// statement is the signed payload: the receipt bound to the key and time.
+func statement(receipt map[string]any, sig Signature) ([]byte, error) {
+	return Canonical(map[string]any{
+		"keyid":     sig.KeyID,
+		"receipt":   receipt,
+		"signed_at": sig.SignedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// pae is the DSSE pre-authentication encoding.
+func pae(payloadType string, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("DSSEv1 ")
+	buf.WriteString(strconv.Itoa(len(payloadType)))
+	buf.WriteByte(' ')
+	buf.WriteString(payloadType)
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(len(payload)))
+	buf.WriteByte(' ')
+	buf.Write(payload)
+	return buf.Bytes()
+}
@@ -0,0 +1,90 @@
+package signing_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"glasshouse/core/receipt"
+	"glasshouse/core/signing"
+)
+
+func TestSignedReceiptVerifiesAndDetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	priv, pub, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(privPath, priv, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pub, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.LoadSigner(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := signing.LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.KeyID() != signing.KeyID(pubKey) {
+		t.Fatal("signer and public key IDs differ")
+	}
+
+	rec := receipt.Receipt{
+		Version:    "v0.3.0",
+		ExitCode:   0,
+		Processes:  []receipt.ProcessEntry{{PID: 1, Cmd: "/bin/echo <a&b>"}},
+		Filesystem: &receipt.FilesystemInfo{Reads: []string{"/etc/hosts"}},
+		Drops:      map[string]uint64{"open": 3},
+	}
+	env, err := signer.Sign(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Signature = env
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signing.Verify(data, pubKey)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if sig.KeyID != signer.KeyID() || sig.SignedAt.IsZero() {
+		t.Fatalf("signature metadata %+v", sig)
+	}
+
+	tampered := bytes.Replace(data, []byte("/etc/hosts"), []byte("/etc/passw"), 1)
+	if _, err := signing.Verify(tampered, pubKey); err == nil {
+		t.Fatal("tampered receipt verified")
+	}
+	_, otherPub, _ := signing.GenerateKey()
+	otherPath := filepath.Join(dir, "other.pub")
+	_ = os.WriteFile(otherPath, otherPub, 0o644)
+	otherKey, _ := signing.LoadPublicKey(otherPath)
+	if _, err := signing.Verify(data, otherKey); !errors.Is(err, signing.ErrNoKey) {
+		t.Fatalf("other key: %v", err)
+	}
+	rec.Signature = nil
+	unsigned, _ := json.Marshal(rec)
+	if _, err := signing.Verify(unsigned, pubKey); !errors.Is(err, signing.ErrUnsigned) {
+		t.Fatalf("unsigned: %v", err)
+	}
+
+	// Receipts that are plain JSON objects, like the server's, sign the same way.
+	generic := map[string]interface{}{"id": "r1", "exit_code": 0, "duration_ms": 12.5}
+	if generic[signing.Field], err = signer.Sign(generic); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal(generic)
+	if _, err := signing.Verify(data, pubKey); err != nil {
+		t.Fatalf("verify generic receipt: %v", err)
+	}
+}
@@ -0,0 +1,561 @@
+// Package translog is an append-only, transparency-log style store for
+// receipts.
+//
+// Entries are hash-chained and covered by an RFC 9162 Merkle tree whose
+// leaves are the canonical JSON of each receipt. The log periodically
+// signs a tree head; inclusion proofs show that a receipt is in a signed
+// tree and consistency proofs show that a later tree extends an earlier
+// one, so a receipt cannot be removed or reordered once a head covering
+// it has been handed out.
+package translog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"glasshouse/core/signing"
+)
+
+const (
+	entriesFile = "entries.jsonl"
+	headsFile   = "heads.jsonl"
+	lockFile    = ".lock"
+)
+
+// TreeHeadType identifies signed tree heads in the DSSE encoding.
+const TreeHeadType = "application/vnd.glasshouse.treehead+json"
+
+// DefaultHeadInterval is how often Run signs a new tree head.
+const DefaultHeadInterval = time.Minute
+
+// Entry is one log record. Chain is the SHA-256 of the previous entry's
+// chain hash followed by LeafHash.
+type Entry struct {
+	Index     uint64          `json:"index"`
+	Timestamp time.Time       `json:"timestamp"`
+	LeafHash  Hash            `json:"leaf_hash"`
+	Chain     Hash            `json:"chain"`
+	Receipt   json.RawMessage `json:"receipt"`
+}
+
+// TreeHead commits to the first Size entries of the log.
+type TreeHead struct {
+	Size      uint64             `json:"size"`
+	Root      Hash               `json:"root"`
+	Chain     Hash               `json:"chain"`
+	Timestamp time.Time          `json:"timestamp"`
+	Signature *signing.Signature `json:"signature,omitempty"`
+}
+
+func (h TreeHead) payload() ([]byte, error) {
+	return signing.Canonical(map[string]any{
+		"chain":     h.Chain,
+		"root":      h.Root,
+		"size":      h.Size,
+		"timestamp": h.Timestamp.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// Verify checks the head's signature against pub.
+func (h TreeHead) Verify(pub ed25519.PublicKey) error {
+	if h.Signature == nil {
+		return errors.New("tree head is not signed")
+	}
+	payload, err := h.payload()
+	if err != nil {
+		return err
+	}
+	return signing.VerifyPayload(pub, TreeHeadType, payload, *h.Signature)
+}
+
+// InclusionProof shows that the entry at LeafIndex is in the tree of
+// TreeSize entries. Head is the signed head for that size when there is one.
+type InclusionProof struct {
+	LeafIndex uint64    `json:"leaf_index"`
+	TreeSize  uint64    `json:"tree_size"`
+	LeafHash  Hash      `json:"leaf_hash"`
+	Hashes    []Hash    `json:"hashes"`
+	Head      *TreeHead `json:"head,omitempty"`
+}
+
+// Verify checks the proof against root.
+func (p InclusionProof) Verify(root Hash) error {
+	return VerifyInclusion(p.LeafHash, p.LeafIndex, p.TreeSize, p.Hashes, root)
+}
+
+// ConsistencyProof shows that the tree of Second entries extends the tree
+// of First entries.
+type ConsistencyProof struct {
+	First  uint64 `json:"first"`
+	Second uint64 `json:"second"`
+	Hashes []Hash `json:"hashes"`
+}
+
+// Verify checks the proof against the roots of both trees.
+func (p ConsistencyProof) Verify(root1, root2 Hash) error {
+	return VerifyConsistency(p.First, p.Second, p.Hashes, root1, root2)
+}
+
+// Log is a log directory opened for appending. Several processes may
+// append to the same directory; writes are serialized with a file lock.
+type Log struct {
+	dir    string
+	signer *signing.Signer
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries *os.File
+	offset  int64
+	leaves  []Hash
+	chain   []Hash
+	byLeaf  map[Hash]uint64
+	heads   []TreeHead
+	headOff int64
+}
+
+// Open opens or creates the log in dir. signer signs tree heads and may be
+// nil, in which case SignHead fails and Run does nothing.
+func Open(dir string, signer *signing.Signer) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, entriesFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	l := &Log{dir: dir, signer: signer, now: time.Now, entries: f, byLeaf: make(map[Hash]uint64)}
+	if err := l.withLock(l.catchUp); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) Close() error {
+	return l.entries.Close()
+}
+
+// Size returns the number of entries.
+func (l *Log) Size() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return uint64(len(l.leaves))
+}
+
+// Append adds a receipt, which must encode to a JSON object, and returns
+// its entry.
+func (l *Log) Append(receipt any) (Entry, error) {
+	data, err := signing.Canonical(receipt)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encode receipt: %w", err)
+	}
+	var entry Entry
+	err = l.withLock(func() error {
+		if err := l.catchUp(); err != nil {
+			return err
+		}
+		leaf := LeafHash(data)
+		entry = Entry{
+			Index:     uint64(len(l.leaves)),
+			Timestamp: l.now().UTC(),
+			LeafHash:  leaf,
+			Chain:     chainHash(l.lastChain(), leaf),
+			Receipt:   data,
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		// Drop a partial line left by a write that never completed, so the
+		// entry does not land on the end of it.
+		if err := l.entries.Truncate(l.offset); err != nil {
+			return fmt.Errorf("truncate log: %w", err)
+		}
+		if _, err := l.entries.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("append log entry: %w", err)
+		}
+		if err := l.entries.Sync(); err != nil {
+			return fmt.Errorf("sync log: %w", err)
+		}
+		l.offset += int64(len(line)) + 1
+		l.add(entry)
+		return nil
+	})
+	return entry, err
+}
+
+// Entry returns the entry at index.
+func (l *Log) Entry(index uint64) (Entry, error) {
+	if err := l.refresh(); err != nil {
+		return Entry{}, err
+	}
+	l.mu.Lock()
+	offset := l.offset
+	l.mu.Unlock()
+	f, err := os.Open(filepath.Join(l.dir, entriesFile))
+	if err != nil {
+		return Entry{}, fmt.Errorf("open log: %w", err)
+	}
+	defer f.Close()
+	scanner := newScanner(io.LimitReader(f, offset))
+	for i := uint64(0); scanner.Scan(); i++ {
+		if i != index {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return Entry{}, fmt.Errorf("log entry %d: %w", i, err)
+		}
+		return entry, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return Entry{}, fmt.Errorf("read log: %w", err)
+	}
+	return Entry{}, fmt.Errorf("no log entry %d", index)
+}
+
+// ReceiptHash returns the leaf hash a receipt has in the log.
+func ReceiptHash(receipt any) (Hash, error) {
+	data, err := signing.Canonical(receipt)
+	if err != nil {
+		return Hash{}, fmt.Errorf("encode receipt: %w", err)
+	}
+	return LeafHash(data), nil
+}
+
+// Find returns the index of the entry holding receipt.
+func (l *Log) Find(receipt any) (uint64, bool, error) {
+	leaf, err := ReceiptHash(receipt)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := l.refresh(); err != nil {
+		return 0, false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, ok := l.byLeaf[leaf]
+	return index, ok, nil
+}
+
+// TreeHead returns the unsigned head of the first size entries.
+func (l *Log) TreeHead(size uint64) (TreeHead, error) {
+	if err := l.refresh(); err != nil {
+		return TreeHead{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.treeHead(size)
+}
+
+func (l *Log) treeHead(size uint64) (TreeHead, error) {
+	if size > uint64(len(l.leaves)) {
+		return TreeHead{}, fmt.Errorf("tree size %d exceeds log size %d", size, len(l.leaves))
+	}
+	head := TreeHead{Size: size, Root: rootHash(l.leaves[:size]), Timestamp: l.now().UTC()}
+	if size > 0 {
+		head.Chain = l.chain[size-1]
+	}
+	return head, nil
+}
+
+// SignHead signs and records a head covering the whole log.
+func (l *Log) SignHead() (TreeHead, error) {
+	if l.signer == nil {
+		return TreeHead{}, errors.New("log has no signing key")
+	}
+	var head TreeHead
+	err := l.withLock(func() error {
+		if err := l.catchUp(); err != nil {
+			return err
+		}
+		var err error
+		if head, err = l.treeHead(uint64(len(l.leaves))); err != nil {
+			return err
+		}
+		payload, err := head.payload()
+		if err != nil {
+			return err
+		}
+		sig := l.signer.SignPayload(TreeHeadType, payload)
+		head.Signature = &sig
+		line, err := json.Marshal(head)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(l.dir, headsFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open tree heads: %w", err)
+		}
+		defer f.Close()
+		if err := f.Truncate(l.headOff); err != nil {
+			return fmt.Errorf("truncate tree heads: %w", err)
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write tree head: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("sync tree heads: %w", err)
+		}
+		l.headOff += int64(len(line)) + 1
+		l.heads = append(l.heads, head)
+		return nil
+	})
+	return head, err
+}
+
+// Heads returns every signed tree head, oldest first.
+func (l *Log) Heads() ([]TreeHead, error) {
+	if err := l.refresh(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]TreeHead(nil), l.heads...), nil
+}
+
+// LatestHead returns the most recent signed tree head.
+func (l *Log) LatestHead() (TreeHead, bool, error) {
+	heads, err := l.Heads()
+	if err != nil || len(heads) == 0 {
+		return TreeHead{}, false, err
+	}
+	return heads[len(heads)-1], true, nil
+}
+
+// InclusionProof proves entry index in the tree of size entries. The proof
+// carries the signed head for size when one was issued.
+func (l *Log) InclusionProof(index, size uint64) (InclusionProof, error) {
+	if err := l.refresh(); err != nil {
+		return InclusionProof{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.leaves)) || index >= size {
+		return InclusionProof{}, fmt.Errorf("entry %d is not in a tree of size %d (log size %d)", index, size, len(l.leaves))
+	}
+	proof := InclusionProof{
+		LeafIndex: index,
+		TreeSize:  size,
+		LeafHash:  l.leaves[index],
+		Hashes:    inclusionPath(index, l.leaves[:size]),
+	}
+	for i := len(l.heads) - 1; i >= 0; i-- {
+		if l.heads[i].Size == size {
+			head := l.heads[i]
+			proof.Head = &head
+			break
+		}
+	}
+	return proof, nil
+}
+
+// ConsistencyProof proves that the tree of second entries extends the tree
+// of first entries.
+func (l *Log) ConsistencyProof(first, second uint64) (ConsistencyProof, error) {
+	if err := l.refresh(); err != nil {
+		return ConsistencyProof{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if first > second || second > uint64(len(l.leaves)) {
+		return ConsistencyProof{}, fmt.Errorf("no consistency proof from size %d to %d (log size %d)", first, second, len(l.leaves))
+	}
+	proof := ConsistencyProof{First: first, Second: second, Hashes: []Hash{}}
+	if first > 0 && first < second {
+		proof.Hashes = consistencyPath(first, l.leaves[:second], true)
+	}
+	return proof, nil
+}
+
+// Run signs a tree head every interval, and once more when ctx is done,
+// whenever the log has grown since the last head.
+func (l *Log) Run(ctx context.Context, interval time.Duration, errf func(error)) {
+	if l.signer == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultHeadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		done := false
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-ticker.C:
+		}
+		if err := l.signIfGrown(); err != nil && errf != nil {
+			errf(err)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func (l *Log) signIfGrown() error {
+	head, ok, err := l.LatestHead()
+	if err != nil {
+		return err
+	}
+	if ok && head.Size == l.Size() {
+		return nil
+	}
+	_, err = l.SignHead()
+	return err
+}
+
+func (l *Log) refresh() error {
+	return l.withLock(l.catchUp)
+}
+
+// withLock runs fn holding the in-process mutex and the directory lock.
+func (l *Log) withLock(fn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := lockDir(filepath.Join(l.dir, lockFile))
+	if err != nil {
+		return fmt.Errorf("lock log: %w", err)
+	}
+	defer unlock()
+	return fn()
+}
+
+// catchUp reads entries and heads written since the last call, by this or
+// another process, and validates them.
+func (l *Log) catchUp() error {
+	f, err := os.Open(filepath.Join(l.dir, entriesFile))
+	if err != nil {
+		return fmt.Errorf("open log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("read log: %w", err)
+	}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial final line is a write that never completed.
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read log: %w", err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("log entry %d: %w", len(l.leaves), err)
+		}
+		if err := l.check(entry); err != nil {
+			return err
+		}
+		l.offset += int64(len(line))
+		l.add(entry)
+	}
+
+	hf, err := os.Open(filepath.Join(l.dir, headsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open tree heads: %w", err)
+	}
+	defer hf.Close()
+	if _, err := hf.Seek(l.headOff, io.SeekStart); err != nil {
+		return fmt.Errorf("read tree heads: %w", err)
+	}
+	reader = bufio.NewReader(hf)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read tree heads: %w", err)
+		}
+		var head TreeHead
+		if err := json.Unmarshal(line, &head); err != nil {
+			return fmt.Errorf("tree head %d: %w", len(l.heads), err)
+		}
+		l.headOff += int64(len(line))
+		l.heads = append(l.heads, head)
+	}
+	return nil
+}
+
+// check validates an entry read back from disk against the log so far.
+func (l *Log) check(entry Entry) error {
+	index := uint64(len(l.leaves))
+	if entry.Index != index {
+		return fmt.Errorf("log entry %d has index %d", index, entry.Index)
+	}
+	data, err := signing.Canonical(entry.Receipt)
+	if err != nil {
+		return fmt.Errorf("log entry %d: %w", index, err)
+	}
+	if !bytes.Equal(data, entry.Receipt) || LeafHash(data) != entry.LeafHash {
+		return fmt.Errorf("log entry %d: leaf hash does not match its receipt", index)
+	}
+	if chainHash(l.lastChain(), entry.LeafHash) != entry.Chain {
+		return fmt.Errorf("log entry %d: hash chain is broken", index)
+	}
+	return nil
+}
+
+func (l *Log) add(entry Entry) {
+	l.leaves = append(l.leaves, entry.LeafHash)
+	l.chain = append(l.chain, entry.Chain)
+	if _, ok := l.byLeaf[entry.LeafHash]; !ok {
+		l.byLeaf[entry.LeafHash] = entry.Index
+	}
+}
+
+func (l *Log) lastChain() Hash {
+	if len(l.chain) == 0 {
+		return Hash{}
+	}
+	return l.chain[len(l.chain)-1]
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return scanner
+}
+
+// Audit re-checks every signed tree head against the log: the signature
+// must verify with pub and the head must match the log's root and chain
+// hash at its size. A mismatch means entries were removed, reordered or
+// rewritten after the head was issued.
+func (l *Log) Audit(pub ed25519.PublicKey) ([]TreeHead, error) {
+	if err := l.refresh(); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, head := range l.heads {
+		if err := head.Verify(pub); err != nil {
+			return nil, fmt.Errorf("tree head %d: %w", i, err)
+		}
+		current, err := l.treeHead(head.Size)
+		if err != nil {
+			return nil, fmt.Errorf("tree head %d: %w", i, err)
+		}
+		if current.Root != head.Root || current.Chain != head.Chain {
+			return nil, fmt.Errorf("tree head %d (size %d) does not match the log", i, head.Size)
+		}
+	}
+	return append([]TreeHead(nil), l.heads...), nil
+}
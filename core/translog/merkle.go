@@ -0,0 +1,175 @@
+package translog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Hash is a SHA-256 digest, hex encoded in JSON.
+type Hash [sha256.Size]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return fmt.Errorf("hash %q: want %d hex digits", text, 2*len(h))
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+// LeafHash is the RFC 9162 hash of one log entry.
+func LeafHash(data []byte) Hash {
+	return sha256.Sum256(append([]byte{0x00}, data...))
+}
+
+func nodeHash(left, right Hash) Hash {
+	buf := make([]byte, 0, 1+2*len(left))
+	buf = append(buf, 0x01)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return sha256.Sum256(buf)
+}
+
+func chainHash(prev, leaf Hash) Hash {
+	return sha256.Sum256(append(prev[:], leaf[:]...))
+}
+
+// split returns the largest power of two smaller than n.
+func split(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// rootHash is MTH(D[n]) over leaf hashes.
+func rootHash(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return nodeHash(rootHash(leaves[:k]), rootHash(leaves[k:]))
+}
+
+// inclusionPath is PATH(m, D[n]).
+func inclusionPath(m uint64, leaves []Hash) []Hash {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(uint64(len(leaves)))
+	if m < k {
+		return append(inclusionPath(m, leaves[:k]), rootHash(leaves[k:]))
+	}
+	return append(inclusionPath(m-k, leaves[k:]), rootHash(leaves[:k]))
+}
+
+// consistencyPath is SUBPROOF(m, D[n], b).
+func consistencyPath(m uint64, leaves []Hash, complete bool) []Hash {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{rootHash(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(consistencyPath(m, leaves[:k], complete), rootHash(leaves[k:]))
+	}
+	return append(consistencyPath(m-k, leaves[k:], false), rootHash(leaves[:k]))
+}
+
+var ErrProof = errors.New("proof does not verify")
+
+// VerifyInclusion checks that leaf is entry index of the tree of size with
+// the given root.
+func VerifyInclusion(leaf Hash, index, size uint64, path []Hash, root Hash) error {
+	if index >= size {
+		return fmt.Errorf("index %d is outside a tree of size %d", index, size)
+	}
+	fn, sn, r := index, size-1, leaf
+	for _, p := range path {
+		if sn == 0 {
+			return ErrProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || r != root {
+		return ErrProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of size second with root2 extends
+// the tree of size first with root1.
+func VerifyConsistency(first, second uint64, path []Hash, root1, root2 Hash) error {
+	switch {
+	case first > second:
+		return fmt.Errorf("tree size %d is smaller than %d", second, first)
+	case first == second:
+		if len(path) != 0 || root1 != root2 {
+			return ErrProof
+		}
+		return nil
+	case first == 0:
+		if len(path) != 0 {
+			return ErrProof
+		}
+		return nil
+	case len(path) == 0:
+		return ErrProof
+	}
+	if first&(first-1) == 0 {
+		path = append([]Hash{root1}, path...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := path[0], path[0]
+	for _, c := range path[1:] {
+		if sn == 0 {
+			return ErrProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || fr != root1 || sr != root2 {
+		return ErrProof
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package translog
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"glasshouse/core/signing"
+)
+
+func TestProofsVerifyForEverySize(t *testing.T) {
+	var leaves []Hash
+	for i := 0; i < 20; i++ {
+		leaves = append(leaves, LeafHash([]byte(fmt.Sprint(i))))
+	}
+	for n := 1; n <= len(leaves); n++ {
+		root := rootHash(leaves[:n])
+		for m := 0; m < n; m++ {
+			if err := VerifyInclusion(leaves[m], uint64(m), uint64(n), inclusionPath(uint64(m), leaves[:n]), root); err != nil {
+				t.Fatalf("inclusion %d/%d: %v", m, n, err)
+			}
+		}
+		for m := 1; m < n; m++ {
+			proof := consistencyPath(uint64(m), leaves[:n], true)
+			if err := VerifyConsistency(uint64(m), uint64(n), proof, rootHash(leaves[:m]), root); err != nil {
+				t.Fatalf("consistency %d->%d: %v", m, n, err)
+			}
+			if err := VerifyConsistency(uint64(m), uint64(n), proof, leaves[0], root); m > 1 && err == nil {
+				t.Fatalf("consistency %d->%d verified against the wrong root", m, n)
+			}
+		}
+	}
+}
+
+func TestLogDetectsSuppressedReceipt(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	log, err := Open(dir, signing.NewSigner(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := log.Append(map[string]any{"execution_id": fmt.Sprint("exec-", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old, err := log.SignHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(map[string]any{"execution_id": "exec-5"}); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := log.SignHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	reopened, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, ok, err := reopened.Find(map[string]any{"execution_id": "exec-3"})
+	if err != nil || !ok || index != 3 {
+		t.Fatalf("find = %d, %v, %v", index, ok, err)
+	}
+	inclusion, err := reopened.InclusionProof(index, latest.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inclusion.Head == nil || inclusion.Head.Verify(pub) != nil || inclusion.Verify(inclusion.Head.Root) != nil {
+		t.Fatalf("inclusion proof does not verify: %+v", inclusion)
+	}
+	consistency, err := reopened.ConsistencyProof(old.Size, latest.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := consistency.Verify(old.Root, latest.Root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Audit(pub); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+
+	// Dropping an entry breaks the hash chain.
+	path := filepath.Join(dir, entriesFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	tampered := strings.Join(append(lines[:3:3], lines[4:]...), "")
+	if err := os.WriteFile(path, []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir, nil); err == nil || !strings.Contains(err.Error(), "index") {
+		t.Fatalf("open after suppression: %v", err)
+	}
+
+	// Rebuilding the log without the entry no longer matches the signed heads.
+	rebuilt := t.TempDir()
+	forged, err := Open(rebuilt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 1, 2, 4, 5} {
+		if _, err := forged.Append(map[string]any{"execution_id": fmt.Sprint("exec-", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	heads, err := os.ReadFile(filepath.Join(dir, headsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rebuilt, headsFile), heads, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forged.Audit(pub); err == nil {
+		t.Fatal("audit accepted a log with a suppressed receipt")
+	}
+}
+
+func TestAppendAfterTornWrite(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	log, err := Open(dir, signing.NewSigner(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(map[string]any{"execution_id": "exec-0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.SignHead(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	// Simulate writers that died halfway through a line.
+	for _, name := range []string{entriesFile, headsFile} {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(`{"index":1,"ti`); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	log, err = Open(dir, signing.NewSigner(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(map[string]any{"execution_id": "exec-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.SignHead(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	reopened, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("reopen after torn write: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.Size() != 2 {
+		t.Fatalf("size = %d, want 2", reopened.Size())
+	}
+	heads, err := reopened.Heads()
+	if err != nil || len(heads) != 2 {
+		t.Fatalf("heads = %d, %v", len(heads), err)
+	}
+}
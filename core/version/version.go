@@ -2,7 +2,7 @@ package version
 
 const (
 	// ReceiptVersion is the canonical version for structured receipts.
-	ReceiptVersion = "v0.3.0"
+	ReceiptVersion = "v0.4.0"
 	// CoreVersion tracks overall core semantics; bump when grammars change.
 	CoreVersion = "v0.3.0"
 )
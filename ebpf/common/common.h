@@ -9,46 +9,117 @@
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_tracing.h>
 
-#define PATH_MAX 256
-#define COMM_MAX 16
-#define ADDR_LEN 16
-
-enum event_type {
-	EVENT_EXEC = 1,
-	EVENT_OPEN = 2,
-	EVENT_CONNECT = 3,
-};
+#include "events.h"
 
-struct event {
-	__u32 type;
-	__u32 pid;
-	__u32 ppid;
-	__u64 cgroup_id;
-	__u32 flags;
-	__u16 port;
-	__u8 addr_family;
-	__u8 proto;
-	__u8 addr[ADDR_LEN];
-	char comm[COMM_MAX];
-	char filename[PATH_MAX];
-};
+#define AT_FDCWD -100
 
 struct {
 	__uint(type, BPF_MAP_TYPE_RINGBUF);
 	__uint(max_entries, 1 << 24);
 } events SEC(".maps");
 
+/*
+ * Target filtering. When filter_config.enabled is set, programs only emit
+ * events for processes in tracked_pids (followed across forks by proc.c) or
+ * tasks in tracked_cgroups. Userspace shares these maps across all objects.
+ */
+struct filter_config {
+	__u32 enabled;
+	__u32 pad;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, __u32);
+	__type(value, struct filter_config);
+} filter_config SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 16384);
+	__type(key, __u32);
+	__type(value, __u8);
+} tracked_pids SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 1024);
+	__type(key, __u64);
+	__type(value, __u8);
+} tracked_cgroups SEC(".maps");
+
+/*
+ * Ring buffer submissions that failed, per event type. Userspace sums the
+ * per-CPU values when a session closes.
+ */
+#define DROP_SLOTS 64
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, DROP_SLOTS);
+	__type(key, __u32);
+	__type(value, __u64);
+} drops SEC(".maps");
+
+static __always_inline void record_drop(__u32 type) {
+	__u64 *count = bpf_map_lookup_elem(&drops, &type);
+	if (count) {
+		*count += 1;
+	}
+}
+
+static __always_inline int should_trace(void) {
+	__u32 zero = 0;
+	struct filter_config *cfg = bpf_map_lookup_elem(&filter_config, &zero);
+	if (!cfg || !cfg->enabled) {
+		return 1;
+	}
+	__u64 cgroup_id = bpf_get_current_cgroup_id();
+	if (bpf_map_lookup_elem(&tracked_cgroups, &cgroup_id)) {
+		return 1;
+	}
+	__u32 pid = bpf_get_current_pid_tgid() >> 32;
+	return bpf_map_lookup_elem(&tracked_pids, &pid) != NULL;
+}
+
 static __always_inline __u32 get_ppid(void) {
 	struct task_struct *task = (struct task_struct *)bpf_get_current_task();
 	return BPF_CORE_READ(task, real_parent, tgid);
 }
 
+/* set_header stamps the wire header; length is the full record size. */
+static __always_inline void set_header(struct event *e, __u16 type, __u32 length) {
+	e->hdr.type = type;
+	e->hdr.version = WIRE_VERSION;
+	e->hdr.length = length;
+}
+
 static __always_inline void fill_common(struct event *e) {
 	__u64 pid_tgid = bpf_get_current_pid_tgid();
 	e->pid = pid_tgid >> 32;
 	e->ppid = get_ppid();
 	e->cgroup_id = bpf_get_current_cgroup_id();
+	e->ts_ns = bpf_ktime_get_boot_ns();
 	bpf_get_current_comm(&e->comm, sizeof(e->comm));
 }
 
+/*
+ * read_user_str reads a NUL-terminated user string into dst and sets bit in
+ * *wire_flags when it did not fit. A full buffer alone is ambiguous: the
+ * string may be exactly size-1 bytes long, so the user byte that would have
+ * been the terminator is checked too.
+ */
+static __always_inline long read_user_str(char *dst, __u32 size, const char *src, __u32 *wire_flags,
+					  __u32 bit) {
+	long n = bpf_probe_read_user_str(dst, size, src);
+	if (n == size) {
+		char next = 0;
+		if (bpf_probe_read_user(&next, sizeof(next), src + size - 1) == 0 && next != 0) {
+			*wire_flags |= bit;
+		}
+	}
+	return n;
+}
+
 #endif
@@ -0,0 +1,127 @@
+#ifndef GLASSHOUSE_EVENTS_H
+#define GLASSHOUSE_EVENTS_H
+
+/*
+ * Event wire format shared with userspace. Every ring buffer record starts
+ * with struct wire_header; length is the full record size and version is
+ * bumped whenever a struct below changes. The Go decoder in audit/wire.go is
+ * checked against this file by audit/wire_test.go, so keep the declarations
+ * simple: fixed-width integer fields, char arrays and nested structs.
+ */
+
+#define WIRE_VERSION 2
+
+#define PATH_MAX 256
+#define COMM_MAX 16
+#define ADDR_LEN 16
+
+/* Variable-length events carry struct event up to filename followed by up
+ * to PATH_MAX_FULL bytes of path. */
+#define EVENT_HEADER_SIZE 80
+#define PATH_MAX_FULL 4096
+
+/* Bits in event.wire_flags. A path is truncated when the read filled its
+ * buffer before reaching the string's terminator. */
+#define WIRE_PATH_TRUNCATED 1
+#define WIRE_TARGET_TRUNCATED 2
+
+enum event_type {
+	EVENT_EXEC = 1,
+	EVENT_OPEN = 2,
+	EVENT_CONNECT = 3,
+	EVENT_FORK = 4,
+	EVENT_EXIT = 5,
+	EVENT_UNLINK = 6,
+	EVENT_RENAME = 7,
+	EVENT_MKDIR = 8,
+	EVENT_CHMOD = 9,
+	EVENT_CHOWN = 10,
+	EVENT_TRUNCATE = 11,
+	EVENT_BIND = 12,
+	EVENT_LISTEN = 13,
+	EVENT_ACCEPT = 14,
+	EVENT_SEND = 15,
+	EVENT_RECV = 16,
+	EVENT_SOCKET_STATS = 17,
+	EVENT_SETUID = 18,
+	EVENT_SETGID = 19,
+	EVENT_CAPSET = 20,
+	EVENT_PTRACE = 21,
+	EVENT_MOUNT = 22,
+	EVENT_UMOUNT = 23,
+	EVENT_BPF = 24,
+	EVENT_MODULE_LOAD = 25,
+	EVENT_MEMFD_CREATE = 26,
+	EVENT_FILELESS_EXEC = 27,
+	EVENT_MPROTECT_EXEC = 28,
+};
+
+struct wire_header {
+	__u16 type;
+	__u16 version;
+	__u32 length;
+};
+
+struct event {
+	struct wire_header hdr;
+	__u32 pid;
+	__u32 ppid;
+	/* Directory fd a relative filename is resolved against (AT_FDCWD for cwd). */
+	__s32 dirfd;
+	__u32 flags;
+	__u64 cgroup_id;
+	/* CLOCK_BOOTTIME at emission; userspace converts it to wall clock. */
+	__u64 ts_ns;
+	__u16 port;
+	__u8 addr_family;
+	__u8 proto;
+	__u32 wire_flags;
+	__u8 addr[ADDR_LEN];
+	char comm[COMM_MAX];
+	char filename[PATH_MAX];
+};
+
+/*
+ * Filesystem mutations extend the common event. base.filename holds the
+ * affected path, base.flags the syscall flags or mode, and target the rename
+ * destination.
+ */
+struct fs_event {
+	struct event base;
+	__u32 uid;
+	__u32 gid;
+	__s32 target_dirfd;
+	__u32 pad;
+	char target[PATH_MAX];
+};
+
+/* Per-socket TCP byte counters, emitted when the socket closes. */
+struct net_event {
+	struct event base;
+	__u64 bytes_sent;
+	__u64 bytes_received;
+};
+
+/*
+ * Security-sensitive syscalls. op distinguishes syscall variants that share an
+ * event type (setuid/setreuid/..., init_module/finit_module), args holds the
+ * numeric arguments and target a secondary string such as the mount source.
+ */
+struct sec_event {
+	struct event base;
+	__u32 op;
+	__u32 pad;
+	__u64 args[3];
+	char target[PATH_MAX];
+};
+
+/*
+ * Open events share the first EVENT_HEADER_SIZE bytes of struct event and
+ * are submitted with only as much filename as was read.
+ */
+struct open_event {
+	__u8 header[EVENT_HEADER_SIZE];
+	char filename[PATH_MAX_FULL];
+};
+
+#endif
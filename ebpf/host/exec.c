@@ -1,23 +1,27 @@
 #include "common.h"
 
-static __always_inline void capture_cmdline(char *dst, int dst_len, const char *filename) {
+static __always_inline void capture_cmdline(char *dst, int dst_len, const char *filename, __u32 *wire_flags) {
 	if (filename) {
-		bpf_probe_read_user_str(dst, dst_len, filename);
+		read_user_str(dst, dst_len, filename, wire_flags, WIRE_PATH_TRUNCATED);
 	}
 }
 
 SEC("tracepoint/syscalls/sys_enter_execve")
 int trace_execve(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
+		record_drop(EVENT_EXEC);
 		return 0;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_EXEC;
+	set_header(e, EVENT_EXEC, sizeof(*e));
 	fill_common(e);
 
 	const char *filename = (const char *)ctx->args[0];
-	capture_cmdline(e->filename, sizeof(e->filename), filename);
+	capture_cmdline(e->filename, sizeof(e->filename), filename, &e->wire_flags);
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
@@ -25,16 +29,20 @@ int trace_execve(struct trace_event_raw_sys_enter *ctx) {
 
 SEC("tracepoint/syscalls/sys_enter_execveat")
 int trace_execveat(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
+		record_drop(EVENT_EXEC);
 		return 0;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_EXEC;
+	set_header(e, EVENT_EXEC, sizeof(*e));
 	fill_common(e);
 
 	const char *filename = (const char *)ctx->args[1];
-	capture_cmdline(e->filename, sizeof(e->filename), filename);
+	capture_cmdline(e->filename, sizeof(e->filename), filename, &e->wire_flags);
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
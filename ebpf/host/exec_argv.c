@@ -2,21 +2,25 @@
 
 #define ARGS_MAX 8
 
-static __always_inline int append_arg(char *dst, int dst_len, const char *src, int off) {
+/* append_arg sets WIRE_PATH_TRUNCATED when src, or the separator before it,
+ * does not fit in what is left of dst. */
+static __always_inline int append_arg(char *dst, int dst_len, const char *src, int off, __u32 *wire_flags) {
 	if (!src) {
 		return off;
 	}
 	if (off >= dst_len - 1) {
+		*wire_flags |= WIRE_PATH_TRUNCATED;
 		return off;
 	}
 	if (off > 0) {
 		dst[off] = ' ';
 		off++;
 		if (off >= dst_len - 1) {
+			*wire_flags |= WIRE_PATH_TRUNCATED;
 			return off;
 		}
 	}
-	int copied = bpf_probe_read_user_str(dst + off, dst_len - off, src);
+	int copied = read_user_str(dst + off, dst_len - off, src, wire_flags, WIRE_PATH_TRUNCATED);
 	if (copied <= 0) {
 		return off;
 	}
@@ -25,7 +29,7 @@ static __always_inline int append_arg(char *dst, int dst_len, const char *src, i
 }
 
 static __always_inline void capture_cmdline(char *dst, int dst_len, const char *filename,
-					    const char *const *argv) {
+					    const char *const *argv, __u32 *wire_flags) {
 	int off = 0;
 
 #pragma unroll
@@ -37,27 +41,31 @@ static __always_inline void capture_cmdline(char *dst, int dst_len, const char *
 		if (!argp) {
 			break;
 		}
-		off = append_arg(dst, dst_len, argp, off);
+		off = append_arg(dst, dst_len, argp, off, wire_flags);
 	}
 
 	if (off == 0 && filename) {
-		bpf_probe_read_user_str(dst, dst_len, filename);
+		read_user_str(dst, dst_len, filename, wire_flags, WIRE_PATH_TRUNCATED);
 	}
 }
 
 SEC("tracepoint/syscalls/sys_enter_execve")
 int trace_execve(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
+		record_drop(EVENT_EXEC);
 		return 0;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_EXEC;
+	set_header(e, EVENT_EXEC, sizeof(*e));
 	fill_common(e);
 
 	const char *filename = (const char *)ctx->args[0];
 	const char *const *argv = (const char *const *)ctx->args[1];
-	capture_cmdline(e->filename, sizeof(e->filename), filename, argv);
+	capture_cmdline(e->filename, sizeof(e->filename), filename, argv, &e->wire_flags);
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
@@ -65,17 +73,21 @@ int trace_execve(struct trace_event_raw_sys_enter *ctx) {
 
 SEC("tracepoint/syscalls/sys_enter_execveat")
 int trace_execveat(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
+		record_drop(EVENT_EXEC);
 		return 0;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_EXEC;
+	set_header(e, EVENT_EXEC, sizeof(*e));
 	fill_common(e);
 
 	const char *filename = (const char *)ctx->args[1];
 	const char *const *argv = (const char *const *)ctx->args[2];
-	capture_cmdline(e->filename, sizeof(e->filename), filename, argv);
+	capture_cmdline(e->filename, sizeof(e->filename), filename, argv, &e->wire_flags);
 
 	bpf_ringbuf_submit(e, 0);
 	return 0;
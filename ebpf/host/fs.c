@@ -1,39 +1,196 @@
 #include "common.h"
 
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, __u32);
+	__type(value, struct open_event);
+} open_scratch SEC(".maps");
+
+static __always_inline int emit_open(__s32 dirfd, const char *filename, __u32 flags) {
+	if (!should_trace()) {
+		return 0;
+	}
+	__u32 zero = 0;
+	struct open_event *buf = bpf_map_lookup_elem(&open_scratch, &zero);
+	if (!buf) {
+		return 0;
+	}
+	struct event *e = (struct event *)buf;
+	__builtin_memset(buf->header, 0, sizeof(buf->header));
+	set_header(e, EVENT_OPEN, 0);
+	fill_common(e);
+	e->dirfd = dirfd;
+	e->flags = flags;
+
+	long n = read_user_str(buf->filename, sizeof(buf->filename), filename, &e->wire_flags, WIRE_PATH_TRUNCATED);
+	if (n < 1) {
+		buf->filename[0] = 0;
+		n = 1;
+	}
+	if (n > PATH_MAX_FULL) {
+		n = PATH_MAX_FULL;
+	}
+	e->hdr.length = EVENT_HEADER_SIZE + n;
+	if (bpf_ringbuf_output(&events, buf, EVENT_HEADER_SIZE + n, 0)) {
+		record_drop(EVENT_OPEN);
+	}
+	return 0;
+}
+
 SEC("tracepoint/syscalls/sys_enter_openat")
 int trace_openat(struct trace_event_raw_sys_enter *ctx) {
-	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	return emit_open((__s32)ctx->args[0], (const char *)ctx->args[1], (__u32)ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_open")
+int trace_open(struct trace_event_raw_sys_enter *ctx) {
+	return emit_open(AT_FDCWD, (const char *)ctx->args[0], (__u32)ctx->args[1]);
+}
+
+#define AT_REMOVEDIR 0x200
+
+static __always_inline struct fs_event *reserve_fs_event(__u32 type, __s32 dirfd, const char *path) {
+	struct fs_event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
-		return 0;
+		record_drop(type);
+		return NULL;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_OPEN;
-	fill_common(e);
-
-	const char *filename = (const char *)ctx->args[1];
-	e->flags = (__u32)ctx->args[2];
-	bpf_probe_read_user_str(e->filename, sizeof(e->filename), filename);
+	set_header(&e->base, type, sizeof(*e));
+	fill_common(&e->base);
+	e->base.dirfd = dirfd;
+	read_user_str(e->base.filename, sizeof(e->base.filename), path, &e->base.wire_flags, WIRE_PATH_TRUNCATED);
+	return e;
+}
 
+static __always_inline int emit_unlink(__s32 dirfd, const char *path, __u32 flags) {
+	if (!should_trace()) {
+		return 0;
+	}
+	struct fs_event *e = reserve_fs_event(EVENT_UNLINK, dirfd, path);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = flags;
 	bpf_ringbuf_submit(e, 0);
 	return 0;
 }
 
-SEC("tracepoint/syscalls/sys_enter_open")
-int trace_open(struct trace_event_raw_sys_enter *ctx) {
-	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+static __always_inline int emit_rename(__s32 from_dirfd, const char *from, __s32 to_dirfd, const char *to, __u32 flags) {
+	if (!should_trace()) {
+		return 0;
+	}
+	struct fs_event *e = reserve_fs_event(EVENT_RENAME, from_dirfd, from);
 	if (!e) {
 		return 0;
 	}
-	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_OPEN;
-	fill_common(e);
+	e->base.flags = flags;
+	e->target_dirfd = to_dirfd;
+	read_user_str(e->target, sizeof(e->target), to, &e->base.wire_flags, WIRE_TARGET_TRUNCATED);
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
 
-	const char *filename = (const char *)ctx->args[0];
-	e->flags = (__u32)ctx->args[1];
-	bpf_probe_read_user_str(e->filename, sizeof(e->filename), filename);
+static __always_inline int emit_mode(__u32 type, __s32 dirfd, const char *path, __u32 mode) {
+	if (!should_trace()) {
+		return 0;
+	}
+	struct fs_event *e = reserve_fs_event(type, dirfd, path);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = mode;
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
 
+static __always_inline int emit_chown(__s32 dirfd, const char *path, __u32 uid, __u32 gid, __u32 flags) {
+	if (!should_trace()) {
+		return 0;
+	}
+	struct fs_event *e = reserve_fs_event(EVENT_CHOWN, dirfd, path);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = flags;
+	e->uid = uid;
+	e->gid = gid;
 	bpf_ringbuf_submit(e, 0);
 	return 0;
 }
 
+SEC("tracepoint/syscalls/sys_enter_unlinkat")
+int trace_unlinkat(struct trace_event_raw_sys_enter *ctx) {
+	return emit_unlink((__s32)ctx->args[0], (const char *)ctx->args[1], (__u32)ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_unlink")
+int trace_unlink(struct trace_event_raw_sys_enter *ctx) {
+	return emit_unlink(AT_FDCWD, (const char *)ctx->args[0], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_rmdir")
+int trace_rmdir(struct trace_event_raw_sys_enter *ctx) {
+	return emit_unlink(AT_FDCWD, (const char *)ctx->args[0], AT_REMOVEDIR);
+}
+
+SEC("tracepoint/syscalls/sys_enter_renameat2")
+int trace_renameat2(struct trace_event_raw_sys_enter *ctx) {
+	return emit_rename((__s32)ctx->args[0], (const char *)ctx->args[1], (__s32)ctx->args[2],
+			   (const char *)ctx->args[3], (__u32)ctx->args[4]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_renameat")
+int trace_renameat(struct trace_event_raw_sys_enter *ctx) {
+	return emit_rename((__s32)ctx->args[0], (const char *)ctx->args[1], (__s32)ctx->args[2],
+			   (const char *)ctx->args[3], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_rename")
+int trace_rename(struct trace_event_raw_sys_enter *ctx) {
+	return emit_rename(AT_FDCWD, (const char *)ctx->args[0], AT_FDCWD, (const char *)ctx->args[1], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_mkdirat")
+int trace_mkdirat(struct trace_event_raw_sys_enter *ctx) {
+	return emit_mode(EVENT_MKDIR, (__s32)ctx->args[0], (const char *)ctx->args[1], (__u32)ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_mkdir")
+int trace_mkdir(struct trace_event_raw_sys_enter *ctx) {
+	return emit_mode(EVENT_MKDIR, AT_FDCWD, (const char *)ctx->args[0], (__u32)ctx->args[1]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_fchmodat")
+int trace_fchmodat(struct trace_event_raw_sys_enter *ctx) {
+	return emit_mode(EVENT_CHMOD, (__s32)ctx->args[0], (const char *)ctx->args[1], (__u32)ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_chmod")
+int trace_chmod(struct trace_event_raw_sys_enter *ctx) {
+	return emit_mode(EVENT_CHMOD, AT_FDCWD, (const char *)ctx->args[0], (__u32)ctx->args[1]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_fchownat")
+int trace_fchownat(struct trace_event_raw_sys_enter *ctx) {
+	return emit_chown((__s32)ctx->args[0], (const char *)ctx->args[1], (__u32)ctx->args[2], (__u32)ctx->args[3],
+			  (__u32)ctx->args[4]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_chown")
+int trace_chown(struct trace_event_raw_sys_enter *ctx) {
+	return emit_chown(AT_FDCWD, (const char *)ctx->args[0], (__u32)ctx->args[1], (__u32)ctx->args[2], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_lchown")
+int trace_lchown(struct trace_event_raw_sys_enter *ctx) {
+	return emit_chown(AT_FDCWD, (const char *)ctx->args[0], (__u32)ctx->args[1], (__u32)ctx->args[2], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_truncate")
+int trace_truncate(struct trace_event_raw_sys_enter *ctx) {
+	return emit_mode(EVENT_TRUNCATE, AT_FDCWD, (const char *)ctx->args[0], 0);
+}
+
 char LICENSE[] SEC("license") = "Dual BSD/GPL";
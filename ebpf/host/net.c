@@ -11,6 +11,8 @@
 #define IPPROTO_TCP 6
 #define IPPROTO_UDP 17
 
+#define DNS_PORT 53
+
 struct socket_args {
 	__u32 domain;
 	__u32 type;
@@ -22,9 +24,28 @@ struct socket_key {
 	__u32 fd;
 };
 
+/* Peer fields come from connect, local fields from bind. */
 struct socket_meta {
 	__u8 protocol;
-	__u8 pad[3];
+	__u8 family;
+	__u16 port;
+	__u8 addr[ADDR_LEN];
+	__u8 local_family;
+	__u8 pad;
+	__u16 local_port;
+	__u8 local_addr[ADDR_LEN];
+};
+
+struct recv_args {
+	__u32 fd;
+	__u32 pad;
+	__u64 buf;
+	__u64 src_addr;
+};
+
+struct tcp_stats {
+	__u64 sent;
+	__u64 received;
 };
 
 struct {
@@ -41,6 +62,20 @@ struct {
 	__type(value, struct socket_meta);
 } socket_meta_map SEC(".maps");
 
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 8192);
+	__type(key, __u64);
+	__type(value, struct recv_args);
+} recv_args_map SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 16384);
+	__type(key, __u64);
+	__type(value, struct tcp_stats);
+} tcp_stats_map SEC(".maps");
+
 static __always_inline __u8 infer_proto(struct socket_args *args) {
 	if (!args) {
 		return 0;
@@ -58,8 +93,54 @@ static __always_inline __u8 infer_proto(struct socket_args *args) {
 	return 0;
 }
 
+static __always_inline struct socket_meta *lookup_meta(__u32 pid, __u32 fd) {
+	struct socket_key key = {
+		.pid = pid,
+		.fd = fd,
+	};
+	return bpf_map_lookup_elem(&socket_meta_map, &key);
+}
+
+/* read_sockaddr fills family, port and addr from a user sockaddr. */
+static __always_inline int read_sockaddr(struct event *e, const void *addr) {
+	struct sockaddr_in sa4 = {};
+	struct sockaddr_in6 sa6 = {};
+
+	if (!addr) {
+		return 0;
+	}
+	if (bpf_probe_read_user(&sa4, sizeof(sa4), addr) == 0 && sa4.sin_family == AF_INET) {
+		e->addr_family = AF_INET;
+		e->port = bpf_ntohs(sa4.sin_port);
+		__builtin_memcpy(e->addr, &sa4.sin_addr, sizeof(sa4.sin_addr));
+		return 1;
+	}
+	if (bpf_probe_read_user(&sa6, sizeof(sa6), addr) == 0 && sa6.sin6_family == AF_INET6) {
+		e->addr_family = AF_INET6;
+		e->port = bpf_ntohs(sa6.sin6_port);
+		__builtin_memcpy(e->addr, &sa6.sin6_addr, sizeof(sa6.sin6_addr));
+		return 1;
+	}
+	return 0;
+}
+
+/* capture_payload copies the start of a datagram into e->filename. */
+static __always_inline void capture_payload(struct event *e, const void *buf, __u64 len) {
+	__u32 n = len;
+	if (!buf || n == 0) {
+		return;
+	}
+	if (n > sizeof(e->filename)) {
+		n = sizeof(e->filename);
+	}
+	bpf_probe_read_user(e->filename, n, buf);
+}
+
 SEC("tracepoint/syscalls/sys_enter_socket")
 int trace_socket_enter(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	__u64 pid_tgid = bpf_get_current_pid_tgid();
 	__u32 pid = pid_tgid >> 32;
 	struct socket_args args = {};
@@ -74,6 +155,9 @@ int trace_socket_enter(struct trace_event_raw_sys_enter *ctx) {
 
 SEC("tracepoint/syscalls/sys_exit_socket")
 int trace_socket_exit(struct trace_event_raw_sys_exit *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	__u64 pid_tgid = bpf_get_current_pid_tgid();
 	__u32 pid = pid_tgid >> 32;
 	struct socket_args *args = bpf_map_lookup_elem(&socket_args_map, &pid);
@@ -101,49 +185,334 @@ int trace_socket_exit(struct trace_event_raw_sys_exit *ctx) {
 
 SEC("tracepoint/syscalls/sys_enter_connect")
 int trace_connect(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
 	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
 	if (!e) {
+		record_drop(EVENT_CONNECT);
 		return 0;
 	}
 	__builtin_memset(e, 0, sizeof(*e));
-	e->type = EVENT_CONNECT;
+	set_header(e, EVENT_CONNECT, sizeof(*e));
 	fill_common(e);
 
-	__u32 fd = (__u32)ctx->args[0];
-	struct socket_key key = {
-		.pid = e->pid,
-		.fd = fd,
-	};
-	struct socket_meta *meta = bpf_map_lookup_elem(&socket_meta_map, &key);
+	struct socket_meta *meta = lookup_meta(e->pid, (__u32)ctx->args[0]);
 	if (meta) {
 		e->proto = meta->protocol;
 	}
 
-	struct sockaddr *addr = (struct sockaddr *)ctx->args[1];
-	struct sockaddr_in sa4 = {};
-	struct sockaddr_in6 sa6 = {};
+	if (!read_sockaddr(e, (const void *)ctx->args[1])) {
+		bpf_ringbuf_discard(e, 0);
+		return 0;
+	}
+	/* Remember the peer so send/recv on connected sockets can be attributed. */
+	if (meta) {
+		meta->family = e->addr_family;
+		meta->port = e->port;
+		__builtin_memcpy(meta->addr, e->addr, sizeof(meta->addr));
+	}
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_bind")
+int trace_bind(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_BIND);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_BIND, sizeof(*e));
+	fill_common(e);
 
-	if (bpf_probe_read_user(&sa4, sizeof(sa4), addr) == 0) {
-		if (sa4.sin_family == AF_INET) {
-			e->addr_family = AF_INET;
-			e->port = bpf_ntohs(sa4.sin_port);
-			__builtin_memcpy(e->addr, &sa4.sin_addr, sizeof(sa4.sin_addr));
-			bpf_ringbuf_submit(e, 0);
+	struct socket_meta *meta = lookup_meta(e->pid, (__u32)ctx->args[0]);
+	if (meta) {
+		e->proto = meta->protocol;
+	}
+	if (!read_sockaddr(e, (const void *)ctx->args[1])) {
+		bpf_ringbuf_discard(e, 0);
+		return 0;
+	}
+	if (meta) {
+		meta->local_family = e->addr_family;
+		meta->local_port = e->port;
+		__builtin_memcpy(meta->local_addr, e->addr, sizeof(meta->local_addr));
+	}
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_listen")
+int trace_listen(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
+	__u32 pid = bpf_get_current_pid_tgid() >> 32;
+	struct socket_meta *meta = lookup_meta(pid, (__u32)ctx->args[0]);
+	if (!meta) {
+		return 0;
+	}
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_LISTEN);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_LISTEN, sizeof(*e));
+	fill_common(e);
+	e->proto = meta->protocol;
+	e->addr_family = meta->local_family;
+	e->port = meta->local_port;
+	__builtin_memcpy(e->addr, meta->local_addr, sizeof(e->addr));
+	e->flags = (__u32)ctx->args[1];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("kretprobe/inet_csk_accept")
+int BPF_KRETPROBE(trace_accept, struct sock *sk) {
+	if (!sk || !should_trace()) {
+		return 0;
+	}
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_ACCEPT);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_ACCEPT, sizeof(*e));
+	fill_common(e);
+	e->proto = IPPROTO_TCP;
+
+	/* addr/port describe the remote peer; flags carries the local port. */
+	__u16 family = BPF_CORE_READ(sk, __sk_common.skc_family);
+	e->port = bpf_ntohs(BPF_CORE_READ(sk, __sk_common.skc_dport));
+	e->flags = BPF_CORE_READ(sk, __sk_common.skc_num);
+	if (family == AF_INET) {
+		e->addr_family = AF_INET;
+		__u32 daddr = BPF_CORE_READ(sk, __sk_common.skc_daddr);
+		__builtin_memcpy(e->addr, &daddr, sizeof(daddr));
+	} else if (family == AF_INET6) {
+		e->addr_family = AF_INET6;
+		BPF_CORE_READ_INTO(&e->addr, sk, __sk_common.skc_v6_daddr.in6_u.u6_addr8);
+	}
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/*
+ * emit_send records a UDP datagram. The destination is the explicit address
+ * or the connected peer; DNS payloads are kept for userspace parsing.
+ */
+static __always_inline int emit_send(__u32 fd, const void *buf, __u64 len, const void *addr) {
+	if (!should_trace()) {
+		return 0;
+	}
+	__u32 pid = bpf_get_current_pid_tgid() >> 32;
+	struct socket_meta *meta = lookup_meta(pid, fd);
+	if (!meta || meta->protocol != IPPROTO_UDP) {
+		return 0;
+	}
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_SEND);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_SEND, sizeof(*e));
+	fill_common(e);
+	e->proto = IPPROTO_UDP;
+	e->flags = (__u32)len;
+
+	if (!read_sockaddr(e, addr)) {
+		if (meta->port == 0) {
+			bpf_ringbuf_discard(e, 0);
+			return 0;
+		}
+		e->addr_family = meta->family;
+		e->port = meta->port;
+		__builtin_memcpy(e->addr, meta->addr, sizeof(e->addr));
+	}
+	if (e->port == DNS_PORT) {
+		capture_payload(e, buf, len);
+	}
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+static __always_inline int emit_send_msg(__u32 fd, const struct user_msghdr *msg) {
+	struct user_msghdr hdr = {};
+	struct iovec iov = {};
+
+	if (bpf_probe_read_user(&hdr, sizeof(hdr), msg) < 0) {
+		return 0;
+	}
+	if (hdr.msg_iovlen > 0 && hdr.msg_iov) {
+		bpf_probe_read_user(&iov, sizeof(iov), hdr.msg_iov);
+	}
+	return emit_send(fd, iov.iov_base, iov.iov_len, hdr.msg_name);
+}
+
+SEC("tracepoint/syscalls/sys_enter_sendto")
+int trace_sendto(struct trace_event_raw_sys_enter *ctx) {
+	return emit_send((__u32)ctx->args[0], (const void *)ctx->args[1], ctx->args[2],
+			 (const void *)ctx->args[4]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_sendmsg")
+int trace_sendmsg(struct trace_event_raw_sys_enter *ctx) {
+	return emit_send_msg((__u32)ctx->args[0], (const struct user_msghdr *)ctx->args[1]);
+}
+
+/* Only the first message is recorded; resolvers send one query per call. */
+SEC("tracepoint/syscalls/sys_enter_sendmmsg")
+int trace_sendmmsg(struct trace_event_raw_sys_enter *ctx) {
+	if ((__u32)ctx->args[2] == 0) {
+		return 0;
+	}
+	const struct mmsghdr *vec = (const struct mmsghdr *)ctx->args[1];
+	return emit_send_msg((__u32)ctx->args[0], &vec->msg_hdr);
+}
+
+SEC("tracepoint/syscalls/sys_enter_recvfrom")
+int trace_recvfrom_enter(struct trace_event_raw_sys_enter *ctx) {
+	if (!should_trace()) {
+		return 0;
+	}
+	__u64 pid_tgid = bpf_get_current_pid_tgid();
+	struct recv_args args = {
+		.fd = (__u32)ctx->args[0],
+		.buf = ctx->args[1],
+		.src_addr = ctx->args[4],
+	};
+	bpf_map_update_elem(&recv_args_map, &pid_tgid, &args, BPF_ANY);
+	return 0;
+}
+
+/*
+ * Every UDP datagram received is counted like emit_send counts sends; DNS
+ * responses also carry their payload so hostnames can be matched to
+ * addresses.
+ */
+SEC("tracepoint/syscalls/sys_exit_recvfrom")
+int trace_recvfrom_exit(struct trace_event_raw_sys_exit *ctx) {
+	__u64 pid_tgid = bpf_get_current_pid_tgid();
+	struct recv_args *args = bpf_map_lookup_elem(&recv_args_map, &pid_tgid);
+	if (!args) {
+		return 0;
+	}
+	struct recv_args saved = *args;
+	bpf_map_delete_elem(&recv_args_map, &pid_tgid);
+
+	long ret = ctx->ret;
+	if (ret <= 0) {
+		return 0;
+	}
+	struct socket_meta *meta = lookup_meta(pid_tgid >> 32, saved.fd);
+	if (!meta || meta->protocol != IPPROTO_UDP) {
+		return 0;
+	}
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_RECV);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_RECV, sizeof(*e));
+	fill_common(e);
+	e->proto = IPPROTO_UDP;
+	e->flags = (__u32)ret;
+	if (!read_sockaddr(e, (const void *)saved.src_addr)) {
+		if (meta->port == 0) {
+			bpf_ringbuf_discard(e, 0);
 			return 0;
 		}
+		e->addr_family = meta->family;
+		e->port = meta->port;
+		__builtin_memcpy(e->addr, meta->addr, sizeof(e->addr));
 	}
+	if (e->port == DNS_PORT) {
+		capture_payload(e, (const void *)saved.buf, (__u64)ret);
+	}
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
 
-	if (bpf_probe_read_user(&sa6, sizeof(sa6), addr) == 0) {
-		if (sa6.sin6_family == AF_INET6) {
-			e->addr_family = AF_INET6;
-			e->port = bpf_ntohs(sa6.sin6_port);
-			__builtin_memcpy(e->addr, &sa6.sin6_addr, sizeof(sa6.sin6_addr));
-			bpf_ringbuf_submit(e, 0);
+SEC("kprobe/tcp_sendmsg")
+int BPF_KPROBE(trace_tcp_sendmsg, struct sock *sk, struct msghdr *msg, size_t size) {
+	if (!should_trace()) {
+		return 0;
+	}
+	__u64 key = (__u64)sk;
+	struct tcp_stats *stats = bpf_map_lookup_elem(&tcp_stats_map, &key);
+	if (!stats) {
+		struct tcp_stats zero = {};
+		bpf_map_update_elem(&tcp_stats_map, &key, &zero, BPF_NOEXIST);
+		stats = bpf_map_lookup_elem(&tcp_stats_map, &key);
+		if (!stats) {
 			return 0;
 		}
 	}
+	__sync_fetch_and_add(&stats->sent, size);
+	return 0;
+}
 
-	bpf_ringbuf_discard(e, 0);
+SEC("kprobe/tcp_cleanup_rbuf")
+int BPF_KPROBE(trace_tcp_cleanup_rbuf, struct sock *sk, int copied) {
+	if (copied <= 0 || !should_trace()) {
+		return 0;
+	}
+	__u64 key = (__u64)sk;
+	struct tcp_stats *stats = bpf_map_lookup_elem(&tcp_stats_map, &key);
+	if (!stats) {
+		struct tcp_stats zero = {};
+		bpf_map_update_elem(&tcp_stats_map, &key, &zero, BPF_NOEXIST);
+		stats = bpf_map_lookup_elem(&tcp_stats_map, &key);
+		if (!stats) {
+			return 0;
+		}
+	}
+	__sync_fetch_and_add(&stats->received, copied);
+	return 0;
+}
+
+SEC("kprobe/tcp_close")
+int BPF_KPROBE(trace_tcp_close, struct sock *sk) {
+	__u64 key = (__u64)sk;
+	struct tcp_stats *stats = bpf_map_lookup_elem(&tcp_stats_map, &key);
+	if (!stats) {
+		return 0;
+	}
+	struct net_event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_SOCKET_STATS);
+		bpf_map_delete_elem(&tcp_stats_map, &key);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(&e->base, EVENT_SOCKET_STATS, sizeof(*e));
+	fill_common(&e->base);
+	e->base.proto = IPPROTO_TCP;
+	e->bytes_sent = stats->sent;
+	e->bytes_received = stats->received;
+
+	__u16 family = BPF_CORE_READ(sk, __sk_common.skc_family);
+	e->base.port = bpf_ntohs(BPF_CORE_READ(sk, __sk_common.skc_dport));
+	if (family == AF_INET) {
+		e->base.addr_family = AF_INET;
+		__u32 daddr = BPF_CORE_READ(sk, __sk_common.skc_daddr);
+		__builtin_memcpy(e->base.addr, &daddr, sizeof(daddr));
+	} else if (family == AF_INET6) {
+		e->base.addr_family = AF_INET6;
+		BPF_CORE_READ_INTO(&e->base.addr, sk, __sk_common.skc_v6_daddr.in6_u.u6_addr8);
+	}
+	bpf_map_delete_elem(&tcp_stats_map, &key);
+	bpf_ringbuf_submit(e, 0);
 	return 0;
 }
 
@@ -0,0 +1,68 @@
+#include "common.h"
+
+/*
+ * Process lifecycle: emits fork and exit events, propagates target tracking
+ * to child processes and drops exited ones.
+ */
+
+SEC("tp_btf/sched_process_fork")
+int BPF_PROG(trace_fork, struct task_struct *parent, struct task_struct *child) {
+	__u32 parent_tgid = BPF_CORE_READ(parent, tgid);
+	__u32 child_pid = BPF_CORE_READ(child, pid);
+	__u32 child_tgid = BPF_CORE_READ(child, tgid);
+
+	/* New threads share the tgid that is already tracked. */
+	if (child_pid != child_tgid) {
+		return 0;
+	}
+	if (bpf_map_lookup_elem(&tracked_pids, &parent_tgid)) {
+		__u8 one = 1;
+		bpf_map_update_elem(&tracked_pids, &child_tgid, &one, BPF_ANY);
+	}
+	if (!should_trace()) {
+		return 0;
+	}
+
+	struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(EVENT_FORK);
+		return 0;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(e, EVENT_FORK, sizeof(*e));
+	e->pid = child_tgid;
+	e->ppid = parent_tgid;
+	e->cgroup_id = bpf_get_current_cgroup_id();
+	e->ts_ns = bpf_ktime_get_boot_ns();
+	BPF_CORE_READ_STR_INTO(&e->comm, child, comm);
+
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("tp_btf/sched_process_exit")
+int BPF_PROG(trace_exit, struct task_struct *task) {
+	__u32 pid = BPF_CORE_READ(task, pid);
+	__u32 tgid = BPF_CORE_READ(task, tgid);
+
+	if (pid != tgid) {
+		return 0;
+	}
+	if (should_trace()) {
+		struct event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+		if (e) {
+			__builtin_memset(e, 0, sizeof(*e));
+			set_header(e, EVENT_EXIT, sizeof(*e));
+			fill_common(e);
+			/* Raw wait status: exit code in bits 8-15, signal in bits 0-6. */
+			e->flags = (__u32)BPF_CORE_READ(task, exit_code);
+			bpf_ringbuf_submit(e, 0);
+		} else {
+			record_drop(EVENT_EXIT);
+		}
+	}
+	bpf_map_delete_elem(&tracked_pids, &tgid);
+	return 0;
+}
+
+char LICENSE[] SEC("license") = "Dual BSD/GPL";
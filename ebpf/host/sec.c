@@ -0,0 +1,248 @@
+#include "common.h"
+
+#define AT_EMPTY_PATH 0x1000
+#define PROT_EXEC 0x4
+#define ID_UNCHANGED 0xffffffff
+
+enum id_op {
+	ID_OP_SET = 0,
+	ID_OP_SETRE = 1,
+	ID_OP_SETRES = 2,
+	ID_OP_SETFS = 3,
+};
+
+enum module_op {
+	MODULE_OP_INIT = 0,
+	MODULE_OP_FINIT = 1,
+};
+
+static __always_inline struct sec_event *reserve_sec_event(__u32 type, __u32 op) {
+	if (!should_trace()) {
+		return NULL;
+	}
+	struct sec_event *e = bpf_ringbuf_reserve(&events, sizeof(*e), 0);
+	if (!e) {
+		record_drop(type);
+		return NULL;
+	}
+	__builtin_memset(e, 0, sizeof(*e));
+	set_header(&e->base, type, sizeof(*e));
+	e->base.dirfd = AT_FDCWD;
+	fill_common(&e->base);
+	e->op = op;
+	return e;
+}
+
+/* args holds the requested real, effective and saved (or fs) IDs. */
+static __always_inline int emit_id_change(__u32 type, __u32 op, __u64 real, __u64 effective, __u64 saved) {
+	struct sec_event *e = reserve_sec_event(type, op);
+	if (!e) {
+		return 0;
+	}
+	e->args[0] = (__u32)real;
+	e->args[1] = (__u32)effective;
+	e->args[2] = (__u32)saved;
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_setuid")
+int trace_setuid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETUID, ID_OP_SET, ID_UNCHANGED, ctx->args[0], ID_UNCHANGED);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setreuid")
+int trace_setreuid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETUID, ID_OP_SETRE, ctx->args[0], ctx->args[1], ID_UNCHANGED);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setresuid")
+int trace_setresuid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETUID, ID_OP_SETRES, ctx->args[0], ctx->args[1], ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setfsuid")
+int trace_setfsuid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETUID, ID_OP_SETFS, ID_UNCHANGED, ID_UNCHANGED, ctx->args[0]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setgid")
+int trace_setgid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETGID, ID_OP_SET, ID_UNCHANGED, ctx->args[0], ID_UNCHANGED);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setregid")
+int trace_setregid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETGID, ID_OP_SETRE, ctx->args[0], ctx->args[1], ID_UNCHANGED);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setresgid")
+int trace_setresgid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETGID, ID_OP_SETRES, ctx->args[0], ctx->args[1], ctx->args[2]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setfsgid")
+int trace_setfsgid(struct trace_event_raw_sys_enter *ctx) {
+	return emit_id_change(EVENT_SETGID, ID_OP_SETFS, ID_UNCHANGED, ID_UNCHANGED, ctx->args[0]);
+}
+
+struct cap_data {
+	__u32 effective;
+	__u32 permitted;
+	__u32 inheritable;
+};
+
+/* capset(hdr, data): flags is the target pid, args the 64-bit effective,
+ * permitted and inheritable sets. */
+SEC("tracepoint/syscalls/sys_enter_capset")
+int trace_capset(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_CAPSET, 0);
+	if (!e) {
+		return 0;
+	}
+	struct {
+		__u32 version;
+		int pid;
+	} hdr = {};
+	struct cap_data data[2] = {};
+	bpf_probe_read_user(&hdr, sizeof(hdr), (const void *)ctx->args[0]);
+	bpf_probe_read_user(&data, sizeof(data), (const void *)ctx->args[1]);
+	e->base.flags = (__u32)hdr.pid;
+	e->args[0] = (__u64)data[1].effective << 32 | data[0].effective;
+	e->args[1] = (__u64)data[1].permitted << 32 | data[0].permitted;
+	e->args[2] = (__u64)data[1].inheritable << 32 | data[0].inheritable;
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* ptrace(request, pid, addr, data): flags is the request. */
+SEC("tracepoint/syscalls/sys_enter_ptrace")
+int trace_ptrace(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_PTRACE, 0);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = (__u32)ctx->args[0];
+	e->args[0] = (__u32)ctx->args[1];
+	e->args[1] = ctx->args[2];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* mount(source, target, fstype, flags, data): filename is the mount point,
+ * target the source. */
+SEC("tracepoint/syscalls/sys_enter_mount")
+int trace_mount(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_MOUNT, 0);
+	if (!e) {
+		return 0;
+	}
+	bpf_probe_read_user_str(e->target, sizeof(e->target), (const char *)ctx->args[0]);
+	bpf_probe_read_user_str(e->base.filename, sizeof(e->base.filename), (const char *)ctx->args[1]);
+	e->base.flags = (__u32)ctx->args[3];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* umount2 is defined as the umount syscall. */
+SEC("tracepoint/syscalls/sys_enter_umount")
+int trace_umount(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_UMOUNT, 0);
+	if (!e) {
+		return 0;
+	}
+	bpf_probe_read_user_str(e->base.filename, sizeof(e->base.filename), (const char *)ctx->args[0]);
+	e->base.flags = (__u32)ctx->args[1];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* bpf(cmd, attr, size): flags is the command. */
+SEC("tracepoint/syscalls/sys_enter_bpf")
+int trace_bpf(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_BPF, 0);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = (__u32)ctx->args[0];
+	e->args[0] = (__u32)ctx->args[2];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* init_module(image, len, params): filename holds the parameters. */
+SEC("tracepoint/syscalls/sys_enter_init_module")
+int trace_init_module(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_MODULE_LOAD, MODULE_OP_INIT);
+	if (!e) {
+		return 0;
+	}
+	e->args[0] = ctx->args[1];
+	bpf_probe_read_user_str(e->target, sizeof(e->target), (const char *)ctx->args[2]);
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* finit_module(fd, params, flags): dirfd is the module fd. */
+SEC("tracepoint/syscalls/sys_enter_finit_module")
+int trace_finit_module(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_MODULE_LOAD, MODULE_OP_FINIT);
+	if (!e) {
+		return 0;
+	}
+	e->base.dirfd = (__s32)ctx->args[0];
+	e->base.flags = (__u32)ctx->args[2];
+	bpf_probe_read_user_str(e->target, sizeof(e->target), (const char *)ctx->args[1]);
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_memfd_create")
+int trace_memfd_create(struct trace_event_raw_sys_enter *ctx) {
+	struct sec_event *e = reserve_sec_event(EVENT_MEMFD_CREATE, 0);
+	if (!e) {
+		return 0;
+	}
+	bpf_probe_read_user_str(e->base.filename, sizeof(e->base.filename), (const char *)ctx->args[0]);
+	e->base.flags = (__u32)ctx->args[1];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* execveat(fd, "", argv, envp, AT_EMPTY_PATH) runs a file descriptor, which
+ * is how memfd payloads are executed without touching the filesystem. */
+SEC("tracepoint/syscalls/sys_enter_execveat")
+int trace_fileless_exec(struct trace_event_raw_sys_enter *ctx) {
+	__u32 flags = (__u32)ctx->args[4];
+	if (!(flags & AT_EMPTY_PATH)) {
+		return 0;
+	}
+	struct sec_event *e = reserve_sec_event(EVENT_FILELESS_EXEC, 0);
+	if (!e) {
+		return 0;
+	}
+	e->base.dirfd = (__s32)ctx->args[0];
+	e->base.flags = flags;
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+/* mprotect(addr, len, prot) that makes memory executable. */
+SEC("tracepoint/syscalls/sys_enter_mprotect")
+int trace_mprotect(struct trace_event_raw_sys_enter *ctx) {
+	__u32 prot = (__u32)ctx->args[2];
+	if (!(prot & PROT_EXEC)) {
+		return 0;
+	}
+	struct sec_event *e = reserve_sec_event(EVENT_MPROTECT_EXEC, 0);
+	if (!e) {
+		return 0;
+	}
+	e->base.flags = prot;
+	e->args[0] = ctx->args[0];
+	e->args[1] = ctx->args[1];
+	bpf_ringbuf_submit(e, 0);
+	return 0;
+}
+
+char LICENSE[] SEC("license") = "Dual BSD/GPL";
@@ -2,9 +2,9 @@ module glasshouse
 
 go 1.21
 
-require github.com/cilium/ebpf v0.12.3
-
 require (
-	golang.org/x/exp v0.0.0-20230224173230-c95f2b4c22f2 // indirect
-	golang.org/x/sys v0.14.1-0.20231108175955-e4099bfacb8c // indirect
+	github.com/cilium/ebpf v0.12.3
+	golang.org/x/sys v0.14.1-0.20231108175955-e4099bfacb8c
 )
+
+require golang.org/x/exp v0.0.0-20230224173230-c95f2b4c22f2 // indirect
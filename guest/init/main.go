@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -52,6 +53,9 @@ func main() {
 	start := time.Now()
 	cmd := exec.Command("python3", "-c", string(codeBytes))
 	cmd.Dir = "/workspace"
+	if stdin, err := os.ReadFile("/workspace/.pending/stdin"); err == nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
 
 	stdout, err := cmd.Output()
 	duration := time.Since(start)
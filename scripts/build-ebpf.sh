@@ -34,5 +34,7 @@ clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/exec.c" -o "$OBJ_DIR/exec.o"
 clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/exec_argv.c" -o "$OBJ_DIR/exec-argv.o"
 clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/fs.c" -o "$OBJ_DIR/fs.o"
 clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/net.c" -o "$OBJ_DIR/net.o"
+clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/proc.c" -o "$OBJ_DIR/proc.o"
+clang "${COMMON_FLAGS[@]}" -c "$HOST_DIR/sec.c" -o "$OBJ_DIR/sec.o"
 
 echo "Built eBPF objects in $OBJ_DIR"